@@ -0,0 +1,180 @@
+package controllers_test
+
+import (
+	"database/sql"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/datalayer/mockdatalayer"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/models/filters"
+	"github.com/donohutcheon/gowebserver/router/auth/totp"
+	"github.com/donohutcheon/gowebserver/services/users"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountDeletion(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+	dl := state.DataLayer.(*mockdatalayer.MockDataLayer)
+	meURL := state.URL + "/api/me"
+	credentials := models.User{
+		Email:    "subzero@dreamrealm.com",
+		Password: "secret",
+	}
+	loginParams := AuthParameters{
+		authRequest:   credentials,
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	}
+
+	_, err := dl.CreateContact("Scorpion", "0832222222", 1)
+	require.NoError(t, err)
+	_, err = dl.CreateCardTransaction(&datalayer.CardTransaction{UserID: 1})
+	require.NoError(t, err)
+	contacts, err := dl.GetContactsByUserID(1)
+	require.NoError(t, err)
+	require.NotEmpty(t, contacts)
+
+	session := login(t, ctx, cl, state.URL, loginParams)
+	accessToken := session.Token.AccessToken
+
+	doRequest(t, ctx, cl, http.MethodDelete, meURL, withBearer(accessToken),
+		map[string]string{"password": "wrong"}, http.StatusForbidden, "Password is incorrect", nil)
+	doRequest(t, ctx, cl, http.MethodDelete, meURL, withBearer(accessToken), map[string]string{"password": "secret"},
+		http.StatusOK, "Account has been scheduled for deletion, log in before it is purged to cancel", nil)
+
+	// The account and its data disappear straight away.
+	doRequest(t, ctx, cl, http.MethodGet, state.URL+"/api/users/current", withBearer(accessToken), nil,
+		http.StatusForbidden, "User account does not exist", nil)
+	_, err = dl.GetUserByEmail("subzero@dreamrealm.com")
+	assert.Equal(t, datalayer.ErrNoData, err)
+	_, err = dl.GetContactsByUserID(1)
+	assert.Equal(t, datalayer.ErrNoData, err)
+	_, err = dl.GetCardTransactionsByUserID(1, nil, filters.CardTransactionFilter{})
+	assert.Equal(t, datalayer.ErrNoData, err)
+
+	// The address stays reserved during the grace period.
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/sign-up", nil,
+		map[string]string{"email": "subzero@dreamrealm.com", "password": "Lin-Kuei-Warrior"}, http.StatusBadRequest,
+		"Email address already exists", nil)
+
+	// Logging in cancels the deletion.
+	login(t, ctx, cl, state.URL, loginParams)
+	dbUser, err := dl.GetUserByEmail("subzero@dreamrealm.com")
+	require.NoError(t, err)
+	assert.False(t, dbUser.DeletedAt.Valid)
+	restored, err := dl.GetContactsByUserID(1)
+	require.NoError(t, err)
+	assert.Equal(t, contacts, restored)
+
+	// Accounts are purged once the grace period has passed.
+	session = login(t, ctx, cl, state.URL, loginParams)
+	doRequest(t, ctx, cl, http.MethodDelete, meURL,
+		withBearer(session.Token.AccessToken), map[string]string{"password": "secret"},
+		http.StatusOK, "Account has been scheduled for deletion, log in before it is purged to cancel", nil)
+
+	err = users.PurgeDeletedUsers(state)
+	require.NoError(t, err)
+	_, err = dl.GetDeletedUserByEmail("subzero@dreamrealm.com")
+	require.NoError(t, err, "purged during the grace period")
+
+	dbUser.DeletedAt.Time = time.Now().Add(-state.DeletionGracePeriod - time.Minute)
+	login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest:   credentials,
+		expHTTPStatus: http.StatusForbidden,
+		expLoginResp: AuthResponse{
+			Message: "Invalid login credentials",
+		},
+	})
+
+	err = users.PurgeDeletedUsers(state)
+	require.NoError(t, err)
+	_, err = dl.GetDeletedUserByEmail("subzero@dreamrealm.com")
+	assert.Equal(t, datalayer.ErrNoData, err)
+	for _, contact := range dl.Contacts {
+		assert.NotEqual(t, int64(1), contact.UserID)
+	}
+	for _, cardTransaction := range dl.CardTransactions {
+		assert.NotEqual(t, int64(1), cardTransaction.UserID)
+	}
+
+	// Other users are untouched.
+	_, err = dl.GetUserByEmail("reptile@netherrealm.com")
+	assert.NoError(t, err)
+}
+
+func TestAccountDeletionRestoreNeedsFullLogin(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+	dl := state.DataLayer.(*mockdatalayer.MockDataLayer)
+
+	loginAs := func(email string) string {
+		return login(t, ctx, cl, state.URL, AuthParameters{
+			authRequest:   models.User{Email: email, Password: "secret"},
+			expHTTPStatus: http.StatusOK,
+			expLoginResp:  AuthResponse{Message: "Logged In", Status: true},
+		}).Token.AccessToken
+	}
+	deleteAccount := func(accessToken string) {
+		doRequest(t, ctx, cl, http.MethodDelete, state.URL+"/api/me", withBearer(accessToken),
+			map[string]string{"password": "secret"}, http.StatusOK,
+			"Account has been scheduled for deletion, log in before it is purged to cancel", nil)
+	}
+
+	// The password alone does not restore a user with two-factor
+	// authentication, only the second factor does.
+	subZero := loginAs("subzero@dreamrealm.com")
+	secret, step, _ := enableTwoFactor(t, ctx, cl, state.URL, subZero)
+	deleteAccount(subZero)
+
+	gotResp := new(TwoFactorControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/login", nil,
+		map[string]string{"email": "subzero@dreamrealm.com", "password": "secret"},
+		http.StatusOK, "Two-factor authentication required", gotResp)
+	challengeToken := gotResp.Challenge.ChallengeToken
+	_, err := dl.GetUserByEmail("subzero@dreamrealm.com")
+	assert.Equal(t, datalayer.ErrNoData, err)
+
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/2fa/login", nil,
+		map[string]string{"challengeToken": challengeToken, "code": "000000"},
+		http.StatusForbidden, "Invalid two-factor authentication code", nil)
+	_, err = dl.GetUserByEmail("subzero@dreamrealm.com")
+	assert.Equal(t, datalayer.ErrNoData, err)
+
+	code, err := totp.Code(secret, step+1)
+	require.NoError(t, err)
+	gotResp = new(TwoFactorControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/2fa/login", nil,
+		map[string]string{"challengeToken": challengeToken, "code": code}, http.StatusOK, "Logged In", gotResp)
+	_, err = dl.GetUserByEmail("subzero@dreamrealm.com")
+	require.NoError(t, err)
+	doRequest(t, ctx, cl, http.MethodGet, state.URL+"/api/users/current", withBearer(gotResp.Token.AccessToken), nil,
+		http.StatusOK, "success", nil)
+
+	// Disabled users are not restored.
+	reptile := loginAs("reptile@netherrealm.com")
+	deleteAccount(reptile)
+	dbUser, err := dl.GetDeletedUserByEmail("reptile@netherrealm.com")
+	require.NoError(t, err)
+	dbUser.DisabledAt = datalayer.JsonNullTime{NullTime: sql.NullTime{Time: time.Now(), Valid: true}}
+	login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest:   models.User{Email: "reptile@netherrealm.com", Password: "secret"},
+		expHTTPStatus: http.StatusForbidden,
+		expLoginResp:  AuthResponse{Message: "User account has been disabled"},
+	})
+	_, err = dl.GetUserByEmail("reptile@netherrealm.com")
+	assert.Equal(t, datalayer.ErrNoData, err)
+}
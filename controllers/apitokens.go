@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/gorilla/mux"
+)
+
+// APITokens lists the caller's API tokens on GET and issues a new one on POST.
+func APITokens(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
+	w.Header().Set("X-XSS-Protection", "1; mode=block")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	switch r.Method {
+	case http.MethodGet:
+		return getAPITokens(w, r, state)
+	case http.MethodPost:
+		return createAPIToken(w, r, state)
+	}
+
+	return nil
+}
+
+func getAPITokens(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	userID := auth.PrincipalFromContext(r.Context()).UserID
+
+	apiToken := models.NewAPIToken(state)
+	data, err := apiToken.GetAPITokens(userID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("apiTokens", data)
+	resp.Respond(w)
+
+	return nil
+}
+
+func createAPIToken(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	userID := auth.PrincipalFromContext(r.Context()).UserID
+
+	apiToken := models.NewAPIToken(state)
+	err := json.NewDecoder(r.Body).Decode(apiToken)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	apiToken.UserID = userID
+	data, err := apiToken.Create()
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "API token has been created")
+	resp.Set("apiToken", data)
+	resp.Respond(w)
+
+	return nil
+}
+
+func RevokeAPIToken(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
+	w.Header().Set("X-XSS-Protection", "1; mode=block")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	userID := auth.PrincipalFromContext(r.Context()).UserID
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		err := e.NewError("Invalid API token ID", []types.ErrorField{
+			{Name: "id", Message: "API token ID must be a number"},
+		}, http.StatusBadRequest)
+		e.WriteError(w, err)
+		return err
+	}
+
+	apiToken := models.NewAPIToken(state)
+	err = apiToken.Revoke(id, userID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "API token has been revoked")
+	resp.Respond(w)
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package controllers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type APITokenControllerResponse struct {
+	Message   string             `json:"message"`
+	Status    bool               `json:"status"`
+	Fields    []types.ErrorField `json:"fields"`
+	APIToken  models.APIToken    `json:"apiToken"`
+	APITokens []models.APIToken  `json:"apiTokens"`
+}
+
+// createAPIToken issues an API token with the scopes and returns it.
+func createAPIToken(t *testing.T, ctx context.Context, cl *http.Client, url, accessToken, name string,
+	scopes ...string) string {
+	gotResp := new(APITokenControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, url+"/api/auth/api-tokens", withBearer(accessToken),
+		map[string]interface{}{"name": name, "scopes": scopes}, http.StatusOK, "", gotResp)
+
+	return gotResp.APIToken.Token
+}
+
+func TestAPITokens(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+
+	session := login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest: models.User{
+			Email:    "subzero@dreamrealm.com",
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	})
+	accessToken := session.Token.AccessToken
+	tokensURL := state.URL + "/api/auth/api-tokens"
+
+	// Invalid requests are rejected with field errors.
+	gotResp := new(APITokenControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, tokensURL, withBearer(accessToken), map[string]interface{}{
+		"scopes": []string{"transactions:delete"},
+	}, http.StatusBadRequest, "Invalid API token request", gotResp)
+	assert.Equal(t, []types.ErrorField{
+		{Name: "name", Message: "API token name is required"},
+		{Name: "scopes", Message: "Unknown scope transactions:delete"},
+	}, gotResp.Fields)
+
+	gotResp = new(APITokenControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, tokensURL, withBearer(accessToken), map[string]interface{}{
+		"name":   "Budget app",
+		"scopes": []string{"transactions:read"},
+	}, http.StatusOK, "API token has been created", gotResp)
+	created := gotResp.APIToken
+	require.True(t, strings.HasPrefix(created.Token, "gwapi_"))
+	assert.True(t, strings.HasPrefix(created.Token, created.Prefix))
+	assert.Equal(t, []string{"transactions:read"}, created.Scopes)
+	assert.False(t, created.LastUsedAt.Valid)
+
+	// The token can read transactions but nothing else.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, state.URL+"/api/me/card-transactions", nil)
+	require.NoError(t, err)
+	req.Header.Add("Authorization", "Bearer "+created.Token)
+	res, err := cl.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/card-transactions/new", withBearer(created.Token),
+		models.CardTransaction{CurrencyCode: "ZAR", MerchantName: "Bakery"}, http.StatusForbidden,
+		"Token is missing a required scope", nil)
+
+	doRequest(t, ctx, cl, http.MethodGet, tokensURL, withBearer(created.Token), nil, http.StatusForbidden,
+		"Token is not permitted to access this resource", nil)
+
+	// Listing never reveals the token itself.
+	gotResp = new(APITokenControllerResponse)
+	doRequest(t, ctx, cl, http.MethodGet, tokensURL, withBearer(accessToken), nil, http.StatusOK, "", gotResp)
+	require.Len(t, gotResp.APITokens, 1)
+	listed := gotResp.APITokens[0]
+	assert.Equal(t, created.ID, listed.ID)
+	assert.Equal(t, "Budget app", listed.Name)
+	assert.Empty(t, listed.Token)
+	assert.True(t, listed.LastUsedAt.Valid)
+
+	// Revoked tokens stop working immediately.
+	revokeURL := fmt.Sprintf("%s/%d", tokensURL, created.ID)
+	doRequest(t, ctx, cl, http.MethodDelete, revokeURL, withBearer(accessToken), nil, http.StatusOK,
+		"API token has been revoked", nil)
+	doRequest(t, ctx, cl, http.MethodDelete, revokeURL, withBearer(accessToken), nil, http.StatusNotFound,
+		"API token not found", nil)
+
+	doRequest(t, ctx, cl, http.MethodGet, state.URL+"/api/me/card-transactions", withBearer(created.Token), nil,
+		http.StatusForbidden, "API token has been revoked", nil)
+
+	gotResp = new(APITokenControllerResponse)
+	doRequest(t, ctx, cl, http.MethodGet, tokensURL, withBearer(accessToken), nil, http.StatusOK, "", gotResp)
+	assert.Len(t, gotResp.APITokens, 0)
+}
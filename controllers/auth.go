@@ -7,6 +7,7 @@ import (
 	"github.com/donohutcheon/gowebserver/models"
 	"github.com/donohutcheon/gowebserver/router/auth"
 	"github.com/donohutcheon/gowebserver/state"
+	"github.com/gorilla/mux"
 	"net/http"
 )
 
@@ -29,17 +30,20 @@ func Authenticate(w http.ResponseWriter, r *http.Request, state *state.ServerSta
 		return err
 	}
 
-	data, err := user.Login(user.Email, user.Password)
+	data, challenge, err := user.Login(user.Email, user.Password, clientInfo(r))
 	if err != nil {
 		errors.WriteError(w, err)
 		return err
 	}
 
-	resp := response.New(true, "Logged In")
-	resp["token"] = data
-	resp.Respond(w)
+	if challenge != nil {
+		resp := response.New(true, "Two-factor authentication required")
+		resp["challenge"] = challenge
+		resp.Respond(w)
+		return nil
+	}
 
-	return nil
+	return respondTokens(w, state, "Logged In", data, auth.WantsCookies(r))
 }
 
 func RefreshToken(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
@@ -65,17 +69,28 @@ func RefreshToken(w http.ResponseWriter, r *http.Request, state *state.ServerSta
 		return err
 	}
 
-	data, err := auth.RefreshToken(refreshTokenReq.RefreshToken)
+	// Browsers using cookie authentication send the refresh token as a cookie.
+	cookies := auth.WantsCookies(r)
+	if len(refreshTokenReq.RefreshToken) == 0 {
+		cookie, err := r.Cookie(auth.RefreshTokenCookie)
+		if err == nil {
+			err = auth.CheckCSRF(r)
+			if err != nil {
+				errors.WriteError(w, err)
+				return err
+			}
+			refreshTokenReq.RefreshToken = cookie.Value
+			cookies = true
+		}
+	}
+
+	data, err := auth.RefreshToken(state, refreshTokenReq.RefreshToken, clientInfo(r))
 	if err != nil {
 		errors.WriteError(w, err)
 		return err
 	}
 
-	resp := response.New(true, "Tokens refreshed")
-	resp.Set("token", data)
-	resp.Respond(w)
-
-	return nil
+	return respondTokens(w, state, "Tokens refreshed", data, cookies)
 }
 
 func GetAPIToken(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
@@ -89,13 +104,14 @@ func GetAPIToken(w http.ResponseWriter, r *http.Request, state *state.ServerStat
 		return nil
 	}
 
-	userID := r.Context().Value("userID").(int64)
+	userID := auth.PrincipalFromContext(r.Context()).UserID
 
 	user := models.NewUser(state)
 	user.ID = userID
 	data, err := user.GetAPIToken()
 	if err != nil {
 		errors.WriteError(w, errors.NewError("could not generate API token", nil, http.StatusForbidden))
+		return err
 	}
 
 	resp := response.New(true, "Logged In")
@@ -103,4 +119,117 @@ func GetAPIToken(w http.ResponseWriter, r *http.Request, state *state.ServerStat
 	resp.Respond(w)
 
 	return nil
+}
+
+func Logout(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
+	w.Header().Set("X-XSS-Protection", "1; mode=block")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	principal := auth.PrincipalFromContext(r.Context())
+	userID := principal.UserID
+	familyID := principal.FamilyID
+	if len(familyID) == 0 {
+		err := errors.NewError("token is not bound to a session", nil, http.StatusBadRequest)
+		errors.WriteError(w, err)
+		return err
+	}
+
+	user := models.NewUser(state)
+	user.ID = userID
+	err := user.Logout(familyID)
+	if err != nil {
+		errors.WriteError(w, err)
+		return err
+	}
+	auth.ClearSessionCookies(w, state)
+
+	resp := response.New(true, "Logged out")
+	resp.Respond(w)
+
+	return nil
+}
+
+func LogoutAll(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
+	w.Header().Set("X-XSS-Protection", "1; mode=block")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	userID := auth.PrincipalFromContext(r.Context()).UserID
+
+	user := models.NewUser(state)
+	user.ID = userID
+	err := user.LogoutAll()
+	if err != nil {
+		errors.WriteError(w, err)
+		return err
+	}
+	auth.ClearSessionCookies(w, state)
+
+	resp := response.New(true, "Logged out of all sessions")
+	resp.Respond(w)
+
+	return nil
+}
+
+func UnlockAccount(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
+	w.Header().Set("X-XSS-Protection", "1; mode=block")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	accountUnlock := models.NewAccountUnlock(state)
+	accountUnlock.Token = mux.Vars(r)["token"]
+	err := accountUnlock.Unlock()
+	if err != nil {
+		errors.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "Account has been unlocked")
+	resp.Respond(w)
+
+	return nil
+}
+
+// respondTokens answers a login or refresh.  With cookie authentication the
+// tokens are set in cookies and left out of the body.
+func respondTokens(w http.ResponseWriter, state *state.ServerState, message string, data *auth.TokenResponse, cookies bool) error {
+	if cookies {
+		err := auth.SetSessionCookies(w, state, data)
+		if err != nil {
+			err = errors.Wrap("Failed to set session cookies", http.StatusInternalServerError, err)
+			errors.WriteError(w, err)
+			return err
+		}
+		data = &auth.TokenResponse{ExpiresIn: data.ExpiresIn}
+	}
+
+	resp := response.New(true, message)
+	resp["token"] = data
+	resp.Respond(w)
+
+	return nil
+}
+
+// clientInfo describes the device making the request for session records.
+func clientInfo(r *http.Request) auth.Client {
+	return auth.Client{
+		UserAgent: r.UserAgent(),
+		IP:        auth.ClientIP(r),
+	}
 }
\ No newline at end of file
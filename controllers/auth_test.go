@@ -227,3 +227,161 @@ func TestRefreshToken(t *testing.T) {
 		})
 	}
 }
+
+func TestRefreshTokenReuse(t *testing.T) {
+	ctx := context.Background()
+	cl := new(http.Client)
+
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks)
+
+	gotAuthResp := login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest: models.User{
+			Email:    "subzero@dreamrealm.com",
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	})
+
+	firstRefresh := auth.RefreshJWTReq{
+		GrantType:    "refresh_token",
+		RefreshToken: gotAuthResp.Token.RefreshToken,
+	}
+	gotRefreshResp := refreshToken(t, ctx, cl, state.URL, RefreshTokenParameters{
+		request:       firstRefresh,
+		expHTTPStatus: http.StatusOK,
+		expResponse: AuthResponse{
+			Message: "Tokens refreshed",
+			Status:  true,
+		},
+	})
+	assert.NotEqual(t, gotAuthResp.Token.RefreshToken, gotRefreshResp.Token.RefreshToken)
+
+	// Replaying the rotated token must fail and revoke the family.
+	refreshToken(t, ctx, cl, state.URL, RefreshTokenParameters{
+		request:       firstRefresh,
+		expHTTPStatus: http.StatusForbidden,
+		expResponse: AuthResponse{
+			Message: "refresh token has already been used, session revoked",
+			Status:  false,
+		},
+	})
+
+	// The legitimately rotated token belongs to the revoked family.
+	refreshToken(t, ctx, cl, state.URL, RefreshTokenParameters{
+		request: auth.RefreshJWTReq{
+			GrantType:    "refresh_token",
+			RefreshToken: gotRefreshResp.Token.RefreshToken,
+		},
+		expHTTPStatus: http.StatusForbidden,
+		expResponse: AuthResponse{
+			Message: "refresh token has been revoked",
+			Status:  false,
+		},
+	})
+
+	// Access tokens are not refresh tokens.
+	refreshToken(t, ctx, cl, state.URL, RefreshTokenParameters{
+		request: auth.RefreshJWTReq{
+			GrantType:    "refresh_token",
+			RefreshToken: gotAuthResp.Token.AccessToken,
+		},
+		expHTTPStatus: http.StatusForbidden,
+		expResponse: AuthResponse{
+			Message: "refresh token is not recognised",
+			Status:  false,
+		},
+	})
+}
+
+func logout(t *testing.T, ctx context.Context, cl *http.Client, url, path string, auth *AuthResponse, expHTTPStatus int, expMessage string) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url+path, nil)
+	assert.NoError(t, err)
+	req.Header.Add("Authorization", "Bearer "+auth.Token.AccessToken)
+
+	res, err := cl.Do(req)
+	require.NoError(t, err)
+
+	body, err := ioutil.ReadAll(res.Body)
+	gotResp := new(AuthResponse)
+	err = json.Unmarshal(body, gotResp)
+	require.NoError(t, err)
+
+	assert.Equal(t, expHTTPStatus, res.StatusCode)
+	assert.Equal(t, expMessage, gotResp.Message)
+}
+
+func TestLogout(t *testing.T) {
+	ctx := context.Background()
+	cl := new(http.Client)
+
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks)
+
+	authParams := AuthParameters{
+		authRequest: models.User{
+			Email:    "subzero@dreamrealm.com",
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	}
+	loggedIn := &GetCurrentUserParameters{
+		expResponse: UserControllerResponse{
+			Message: "success",
+			Status:  true,
+			User: models.User{
+				Email: "subzero@dreamrealm.com",
+			},
+		},
+		expHTTPStatus: http.StatusOK,
+	}
+	loggedOut := &GetCurrentUserParameters{
+		expResponse: UserControllerResponse{
+			Message: "Session has been logged out",
+			Status:  false,
+		},
+		expHTTPStatus: http.StatusForbidden,
+	}
+
+	laptop := login(t, ctx, cl, state.URL, authParams)
+	phone := login(t, ctx, cl, state.URL, authParams)
+
+	// Logging out of one session leaves the other intact.
+	logout(t, ctx, cl, state.URL, "/api/auth/logout", laptop, http.StatusOK, "Logged out")
+	getCurrentUser(t, ctx, cl, state.URL, laptop, loggedOut)
+	refreshToken(t, ctx, cl, state.URL, RefreshTokenParameters{
+		request: auth.RefreshJWTReq{
+			GrantType:    "refresh_token",
+			RefreshToken: laptop.Token.RefreshToken,
+		},
+		expHTTPStatus: http.StatusForbidden,
+		expResponse: AuthResponse{
+			Message: "refresh token has been revoked",
+			Status:  false,
+		},
+	})
+	getCurrentUser(t, ctx, cl, state.URL, phone, loggedIn)
+
+	// Logging out everywhere kills the remaining sessions.
+	logout(t, ctx, cl, state.URL, "/api/auth/logout-all", phone, http.StatusOK, "Logged out of all sessions")
+	getCurrentUser(t, ctx, cl, state.URL, phone, loggedOut)
+	refreshToken(t, ctx, cl, state.URL, RefreshTokenParameters{
+		request: auth.RefreshJWTReq{
+			GrantType:    "refresh_token",
+			RefreshToken: phone.Token.RefreshToken,
+		},
+		expHTTPStatus: http.StatusForbidden,
+		expResponse: AuthResponse{
+			Message: "refresh token has been revoked",
+			Status:  false,
+		},
+	})
+}
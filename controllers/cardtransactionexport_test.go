@@ -0,0 +1,181 @@
+package controllers_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportCardTransactions(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+	exportURL := state.URL + "/api/me/card-transactions/export"
+
+	session := login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest: models.User{
+			Email:    "subzero@dreamrealm.com",
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	})
+	accessToken := session.Token.AccessToken
+
+	// Transactions are exported in date order, without those of other users
+	// or deleted ones.
+	start := time.Date(2020, 4, 1, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		_, err := state.DataLayer.CreateCardTransaction(&datalayer.CardTransaction{
+			DateTime:      start.AddDate(0, 0, 4-i),
+			Amount:        int64(100 * (i + 1)),
+			CurrencyScale: 2,
+			CurrencyCode:  "ZAR",
+			Reference:     fmt.Sprintf("purchase %d", i),
+			MerchantName:  "Dwelms en Dinges, Hillbrow",
+			UserID:        1,
+		})
+		require.NoError(t, err)
+	}
+	_, err := state.DataLayer.CreateCardTransaction(&datalayer.CardTransaction{
+		DateTime: start, Amount: 100, CurrencyCode: "ZAR", MerchantName: "Other", UserID: 2,
+	})
+	require.NoError(t, err)
+	deletedID, err := state.DataLayer.CreateCardTransaction(&datalayer.CardTransaction{
+		DateTime: start, Amount: 100, CurrencyCode: "ZAR", MerchantName: "Deleted", UserID: 1,
+	})
+	require.NoError(t, err)
+	require.NoError(t, state.DataLayer.DeleteCardTransaction(deletedID, 1))
+
+	res, body := doRequest(t, ctx, cl, http.MethodGet, exportURL, withBearer(accessToken), nil, http.StatusOK, "", nil)
+	assert.Equal(t, "text/csv; charset=utf-8", res.Header.Get("Content-Type"))
+	assert.Regexp(t, `^attachment; filename="card-transactions-\d{4}-\d{2}-\d{2}\.csv"$`, res.Header.Get("Content-Disposition"))
+	records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 6)
+	assert.Equal(t, []string{"id", "dateTime", "amount", "currencyCode", "reference", "merchantName", "merchantCity",
+		"merchantCountryCode", "merchantCountryName", "merchantCategoryCode", "merchantCategoryName"}, records[0])
+	assert.Equal(t, []string{"2020-04-01T09:00:00Z", "5.00", "ZAR", "purchase 4", "Dwelms en Dinges, Hillbrow"},
+		records[1][1:6])
+	assert.Equal(t, "2020-04-05T09:00:00Z", records[5][1])
+
+	// The filters of the list endpoint apply.
+	_, body = doRequest(t, ctx, cl, http.MethodGet, exportURL+"?format=ndjson&amount=200-400", withBearer(accessToken),
+		nil, http.StatusOK, "", nil)
+	var exported []models.CardTransaction
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		var cardTransaction models.CardTransaction
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &cardTransaction))
+		exported = append(exported, cardTransaction)
+	}
+	require.Len(t, exported, 2, string(body))
+	assert.Equal(t, models.CurrencyValue{Value: 300, Scale: 2}, exported[0].Amount)
+	assert.Equal(t, "purchase 1", exported[1].Reference)
+
+	dateRangeURL := fmt.Sprintf("%s?format=json&dateTime=%d-%d", exportURL,
+		start.AddDate(0, 0, 1).Unix(), start.AddDate(0, 0, 3).Unix())
+	_, body = doRequest(t, ctx, cl, http.MethodGet, dateRangeURL, withBearer(accessToken), nil, http.StatusOK, "", nil)
+	exported = nil
+	require.NoError(t, json.Unmarshal(body, &exported), string(body))
+	require.Len(t, exported, 2)
+	assert.Equal(t, "purchase 3", exported[0].Reference)
+	assert.Equal(t, models.CurrencyValue{Value: 300, Scale: 2}, exported[1].Amount)
+
+	_, body = doRequest(t, ctx, cl, http.MethodGet, exportURL+"?format=json&amount=1000-2000", withBearer(accessToken),
+		nil, http.StatusOK, "", nil)
+	assert.Equal(t, "[]\n", string(body))
+
+	_, body = doRequest(t, ctx, cl, http.MethodGet, exportURL+"?format=xlsx", withBearer(accessToken), nil,
+		http.StatusBadRequest, "", nil)
+	assert.Contains(t, string(body), "Format must be one of csv, ndjson, json")
+}
+
+func TestExportAndImportCardTransactions(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+
+	loginAs := func(email string) string {
+		return login(t, ctx, cl, state.URL, AuthParameters{
+			authRequest:   models.User{Email: email, Password: "secret"},
+			expHTTPStatus: http.StatusOK,
+			expLoginResp:  AuthResponse{Message: "Logged In", Status: true},
+		}).Token.AccessToken
+	}
+	subZero := loginAs("subzero@dreamrealm.com")
+	reptile := loginAs("reptile@netherrealm.com")
+
+	for i := 0; i < 3; i++ {
+		_, err := state.DataLayer.CreateCardTransaction(&datalayer.CardTransaction{
+			DateTime:      time.Date(2020, 4, 1+i, 9, 30, 0, 0, time.UTC),
+			Amount:        int64(1250 * (i + 1)),
+			CurrencyScale: 2,
+			CurrencyCode:  "ZAR",
+			Reference:     fmt.Sprintf("purchase %d", i),
+			MerchantName:  "Dwelms en Dinges, Hillbrow",
+			MerchantCity:  "Johannesburg",
+			UserID:        1,
+		})
+		require.NoError(t, err)
+	}
+	_, err := state.DataLayer.CreateCardTransaction(&datalayer.CardTransaction{
+		DateTime:      time.Date(2020, 4, 4, 17, 45, 0, 0, time.UTC),
+		Amount:        -350,
+		CurrencyScale: 2,
+		CurrencyCode:  "ZAR",
+		Reference:     `=HYPERLINK("http://evil.example","refund")`,
+		MerchantName:  "@SUM(1+1)",
+		MerchantCity:  "-Johannesburg",
+		UserID:        1,
+	})
+	require.NoError(t, err)
+
+	_, exported := doRequest(t, ctx, cl, http.MethodGet, state.URL+"/api/me/card-transactions/export?format=csv",
+		withBearer(subZero), nil, http.StatusOK, "", nil)
+	exportedRecords, err := csv.NewReader(bytes.NewReader(exported)).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, exportedRecords, 5)
+
+	// Cells that spreadsheets would evaluate are exported as text, while
+	// negative amounts are left as numbers.
+	assert.Equal(t, []string{"2020-04-04T17:45:00Z", "-3.50", "ZAR", `'=HYPERLINK("http://evil.example","refund")`,
+		"'@SUM(1+1)", "'-Johannesburg"}, exportedRecords[4][1:7])
+
+	// An export imports with the time of day intact.
+	importResp := doImportRequest(t, ctx, cl, state.URL+"/api/me/card-transactions/import", reptile,
+		"export.csv", string(exported), map[string]string{
+			"dateFormat": time.RFC3339,
+			"mapping": `{"dateTime":"dateTime","amount":"amount","currencyCode":"currencyCode","reference":"reference",` +
+				`"merchantName":"merchantName","merchantCity":"merchantCity"}`,
+		}, http.StatusOK, "Card transactions have been imported")
+	assert.True(t, importResp.Status)
+	assert.Equal(t, 4, importResp.Count)
+
+	_, reimported := doRequest(t, ctx, cl, http.MethodGet, state.URL+"/api/me/card-transactions/export?format=csv",
+		withBearer(reptile), nil, http.StatusOK, "", nil)
+	reimportedRecords, err := csv.NewReader(bytes.NewReader(reimported)).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, reimportedRecords, len(exportedRecords))
+	for i := range exportedRecords {
+		// The IDs are new.
+		assert.Equal(t, exportedRecords[i][1:], reimportedRecords[i][1:])
+	}
+}
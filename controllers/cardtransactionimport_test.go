@@ -0,0 +1,254 @@
+package controllers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/models/filters"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type ImportControllerResponse struct {
+	Message          string                   `json:"message"`
+	Status           bool                     `json:"status"`
+	Fields           []types.ErrorField       `json:"fields"`
+	Count            int                      `json:"count"`
+	CardTransactions []models.CardTransaction `json:"cardTransactions"`
+}
+
+func doImportRequest(t *testing.T, ctx context.Context, cl *http.Client, url, bearer, filename, statement string,
+	params map[string]string, expHTTPStatus int, expMessage string) *ImportControllerResponse {
+	reqBody := new(bytes.Buffer)
+	writer := multipart.NewWriter(reqBody)
+	for key, value := range params {
+		require.NoError(t, writer.WriteField(key, value))
+	}
+	part, err := writer.CreateFormFile("file", filename)
+	require.NoError(t, err)
+	_, err = part.Write([]byte(statement))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, reqBody)
+	require.NoError(t, err)
+	req.Header.Add("Authorization", "Bearer "+bearer)
+	req.Header.Add("Content-Type", writer.FormDataContentType())
+
+	res, err := cl.Do(req)
+	require.NoError(t, err)
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	gotResp := new(ImportControllerResponse)
+	err = json.Unmarshal(body, gotResp)
+	require.NoError(t, err)
+
+	assert.Equal(t, expHTTPStatus, res.StatusCode, string(body))
+	assert.Equal(t, expMessage, gotResp.Message)
+
+	return gotResp
+}
+
+const csvStatement = `Date,Amount,Description,Payee,Currency
+2020-04-25,-400.00,simulation,Dwelms en Dinges,
+2020-04-26,"1,250.5",refund,The Coders Bakery,USD
+`
+
+const invalidCSVStatement = `Date,Amount,Description,Payee,Currency
+2020-04-25,four hundred,simulation,Dwelms en Dinges,
+26 April 2020,12.00,coffee,Cafe,
+2020-04-27,(3.50),bread,The Coders Bakery,
+2020-04-28,12.00,tea,,rand
+`
+
+const ofx1Statement = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+
+<OFX>
+<BANKMSGSRSV1>
+<STMTTRNRS>
+<STMTRS>
+<CURDEF>USD
+<BANKTRANLIST>
+<DTSTART>20200401
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20200425194623.000[-5:EST]
+<TRNAMT>-12.50
+<FITID>1001
+<NAME>Corner Store
+<MEMO>Groceries
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20200426
+<TRNAMT>100
+<FITID>1002
+<NAME>Employer
+</STMTTRN>
+</BANKTRANLIST>
+</STMTRS>
+</STMTTRNRS>
+</BANKMSGSRSV1>
+</OFX>
+`
+
+const ofx2Statement = `<?xml version="1.0" encoding="UTF-8"?>
+<?OFX OFXHEADER="200" VERSION="211"?>
+<OFX>
+  <CREDITCARDMSGSRSV1><CCSTMTTRNRS><CCSTMTRS>
+    <CURDEF>EUR</CURDEF>
+    <BANKTRANLIST>
+      <STMTTRN>
+        <TRNTYPE>DEBIT</TRNTYPE>
+        <DTPOSTED>20200425120000</DTPOSTED>
+        <TRNAMT>-7.25</TRNAMT>
+        <FITID>2001</FITID>
+        <NAME>Fish &amp; Chips</NAME>
+        <CURRENCY><CURRATE>1.1</CURRATE><CURSYM>GBP</CURSYM></CURRENCY>
+      </STMTTRN>
+    </BANKTRANLIST>
+  </CCSTMTRS></CCSTMTTRNRS></CREDITCARDMSGSRSV1>
+</OFX>
+`
+
+const qifStatement = `!Type:CCard
+D4/25'20
+T-45.00
+PPetrol Station
+MFuel
+LAuto:Fuel
+^
+D04/27/2020
+U-9.99
+PStreaming Service
+^
+`
+
+func TestImportCardTransactions(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+	importURL := state.URL + "/api/me/card-transactions/import"
+
+	session := login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest: models.User{
+			Email:    "subzero@dreamrealm.com",
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	})
+	accessToken := session.Token.AccessToken
+	stored := func() int {
+		dbCardTransactions, _ := state.DataLayer.GetCardTransactionsByUserID(1, models.NewCardTransaction(state),
+			filters.CardTransactionFilter{})
+		return len(dbCardTransactions)
+	}
+	csvParams := map[string]string{
+		"mapping":      `{"dateTime":"Date","amount":"Amount","reference":"Description","merchantName":"Payee","currencyCode":"Currency"}`,
+		"currencyCode": "zar",
+	}
+
+	// The import parameters are validated.
+	gotResp := doImportRequest(t, ctx, cl, importURL, accessToken, "statement.txt", csvStatement, nil,
+		http.StatusBadRequest, "Invalid import request")
+	assert.Equal(t, []types.ErrorField{{Name: "format", Message: "Format must be one of csv, ofx, qif"}}, gotResp.Fields)
+	gotResp = doImportRequest(t, ctx, cl, importURL, accessToken, "statement.csv", csvStatement,
+		map[string]string{"mapping": `{"amount":"Amount","balance":"Balance"}`, "dryRun": "maybe"},
+		http.StatusBadRequest, "Invalid import request")
+	assert.Equal(t, []types.ErrorField{
+		{Name: "mapping", Message: "Mapping is invalid, unknown field balance"},
+		{Name: "dryRun", Message: "Dry run must be true or false"},
+	}, gotResp.Fields)
+	gotResp = doImportRequest(t, ctx, cl, importURL, accessToken, "statement.csv", csvStatement,
+		map[string]string{"mapping": `{"dateTime":"Date","amount":"Total"}`},
+		http.StatusBadRequest, "Statement could not be read")
+	assert.Equal(t, []types.ErrorField{{Name: "file", Message: "column Total of amount is not in the header"}}, gotResp.Fields)
+	doImportRequest(t, ctx, cl, importURL, accessToken, "statement.qif", "!Type:Bank\n", nil,
+		http.StatusBadRequest, "Statement has no transactions")
+
+	// A dry run previews the valid transactions and reports the invalid ones.
+	csvParams["dryRun"] = "true"
+	gotResp = doImportRequest(t, ctx, cl, importURL, accessToken, "statement.csv", invalidCSVStatement, csvParams,
+		http.StatusOK, "Import preview, nothing was imported")
+	assert.False(t, gotResp.Status)
+	assert.Equal(t, []types.ErrorField{
+		{Name: "transactions[1].amount", Message: "Amount must be a decimal number"},
+		{Name: "transactions[2].dateTime", Message: "Date must match 2006-01-02"},
+		{Name: "transactions[4].currencyCode", Message: "Currency code must be a three letter ISO 4217 code such as ZAR"},
+		{Name: "transactions[4].merchantName", Message: "Merchant name is required"},
+	}, gotResp.Fields)
+	require.Len(t, gotResp.CardTransactions, 1)
+	assert.Equal(t, models.CurrencyValue{Value: -350, Scale: 2}, gotResp.CardTransactions[0].Amount)
+	assert.Equal(t, "ZAR", gotResp.CardTransactions[0].CurrencyCode)
+	assert.Zero(t, stored())
+
+	// Statements with invalid transactions are not imported at all.
+	delete(csvParams, "dryRun")
+	doImportRequest(t, ctx, cl, importURL, accessToken, "statement.csv", invalidCSVStatement, csvParams,
+		http.StatusBadRequest, "Statement has invalid transactions, nothing was imported")
+	assert.Zero(t, stored())
+
+	gotResp = doImportRequest(t, ctx, cl, importURL, accessToken, "statement.csv", csvStatement, csvParams,
+		http.StatusOK, "Card transactions have been imported")
+	assert.True(t, gotResp.Status)
+	assert.Equal(t, 2, gotResp.Count)
+	assert.Equal(t, time.Date(2020, 4, 25, 0, 0, 0, 0, time.UTC), gotResp.CardTransactions[0].DateTime)
+	assert.Equal(t, "ZAR", gotResp.CardTransactions[0].CurrencyCode)
+	assert.Equal(t, "Dwelms en Dinges", gotResp.CardTransactions[0].MerchantName)
+	assert.Equal(t, models.CurrencyValue{Value: 12505, Scale: 1}, gotResp.CardTransactions[1].Amount)
+	assert.Equal(t, "USD", gotResp.CardTransactions[1].CurrencyCode)
+	assert.Equal(t, 2, stored())
+
+	// OFX 1.x SGML and 2.x XML statements.
+	gotResp = doImportRequest(t, ctx, cl, importURL, accessToken, "statement.ofx", ofx1Statement, nil,
+		http.StatusOK, "Card transactions have been imported")
+	require.Equal(t, 2, gotResp.Count)
+	txn := gotResp.CardTransactions[0]
+	assert.True(t, time.Date(2020, 4, 26, 0, 46, 23, 0, time.UTC).Equal(txn.DateTime), txn.DateTime)
+	assert.Equal(t, models.CurrencyValue{Value: -1250, Scale: 2}, txn.Amount)
+	assert.Equal(t, "USD", txn.CurrencyCode)
+	assert.Equal(t, "Corner Store", txn.MerchantName)
+	assert.Equal(t, "Groceries", txn.Reference)
+	assert.Equal(t, models.CurrencyValue{Value: 100, Scale: 0}, gotResp.CardTransactions[1].Amount)
+
+	gotResp = doImportRequest(t, ctx, cl, importURL, accessToken, "export.xml", ofx2Statement,
+		map[string]string{"format": "ofx"}, http.StatusOK, "Card transactions have been imported")
+	require.Equal(t, 1, gotResp.Count)
+	assert.Equal(t, "Fish & Chips", gotResp.CardTransactions[0].MerchantName)
+	assert.Equal(t, "GBP", gotResp.CardTransactions[0].CurrencyCode)
+
+	// QIF statements have no currency of their own.
+	doImportRequest(t, ctx, cl, importURL, accessToken, "statement.qif", qifStatement, nil,
+		http.StatusBadRequest, "Statement has invalid transactions, nothing was imported")
+	gotResp = doImportRequest(t, ctx, cl, importURL, accessToken, "statement.qif", qifStatement,
+		map[string]string{"currencyCode": "ZAR"}, http.StatusOK, "Card transactions have been imported")
+	require.Equal(t, 2, gotResp.Count)
+	assert.Equal(t, time.Date(2020, 4, 25, 0, 0, 0, 0, time.UTC), gotResp.CardTransactions[0].DateTime)
+	assert.Equal(t, "Petrol Station", gotResp.CardTransactions[0].MerchantName)
+	assert.Equal(t, "Auto:Fuel", gotResp.CardTransactions[0].MerchantCategoryName)
+	assert.Equal(t, models.CurrencyValue{Value: -999, Scale: 2}, gotResp.CardTransactions[1].Amount)
+	assert.Equal(t, 7, stored())
+
+	// Imports need the transactions:write scope.
+	readOnly := createAPIToken(t, ctx, cl, state.URL, accessToken, "Reader", "transactions:read")
+	doImportRequest(t, ctx, cl, importURL, readOnly, "statement.qif", qifStatement, map[string]string{"currencyCode": "ZAR"},
+		http.StatusForbidden, "Token is missing a required scope")
+}
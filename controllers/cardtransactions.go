@@ -2,14 +2,21 @@ package controllers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/donohutcheon/gowebserver/controllers/errors"
 	"github.com/donohutcheon/gowebserver/controllers/response"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
 	"github.com/donohutcheon/gowebserver/datalayer"
 	"github.com/donohutcheon/gowebserver/models"
 	"github.com/donohutcheon/gowebserver/models/pagination"
+	"github.com/donohutcheon/gowebserver/models/statements"
+	"github.com/donohutcheon/gowebserver/router/auth"
 	"github.com/donohutcheon/gowebserver/state"
+	"github.com/gorilla/mux"
 )
 
 func CreateCardTransaction(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
@@ -17,7 +24,7 @@ func CreateCardTransaction(w http.ResponseWriter, r *http.Request, state *state.
 		return nil
 	}
 
-	userID := r.Context().Value("userID").(int64) //Grab the id of the userID that send the request
+	userID := auth.PrincipalFromContext(r.Context()).UserID //Grab the id of the userID that send the request
 	cardTransaction := models.NewCardTransaction(state)
 
 	err := json.NewDecoder(r.Body).Decode(cardTransaction)
@@ -60,7 +67,7 @@ func GetCardTransactions(w http.ResponseWriter, r *http.Request, state *state.Se
 		return err
 	}
 
-	userID := r.Context().Value("userID").(int64)
+	userID := auth.PrincipalFromContext(r.Context()).UserID
 	data, err := cardTransaction.GetCardTransactionsByUserID(userID)
 	if err != nil && err != datalayer.ErrNoData {
 		errors.WriteError(w, err, http.StatusInternalServerError)
@@ -74,3 +81,169 @@ func GetCardTransactions(w http.ResponseWriter, r *http.Request, state *state.Se
 
 	return nil
 }
+
+// CardTransaction reads, updates and deletes one of the caller's card
+// transactions.
+func CardTransaction(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	// The route only matches digits, so this fails on IDs out of range.
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		err := errors.NewError("Invalid card transaction ID", []types.ErrorField{
+			{Name: "id", Message: "Card transaction ID is out of range"},
+		}, http.StatusBadRequest)
+		errors.WriteError(w, err)
+		return err
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		return getCardTransaction(w, r, state, id)
+	case http.MethodPatch:
+		return updateCardTransaction(w, r, state, id)
+	case http.MethodDelete:
+		return deleteCardTransaction(w, r, state, id)
+	}
+
+	return nil
+}
+
+func getCardTransaction(w http.ResponseWriter, r *http.Request, state *state.ServerState, id int64) error {
+	userID := auth.PrincipalFromContext(r.Context()).UserID
+	data, err := models.NewCardTransaction(state).GetCardTransaction(id, userID)
+	if err != nil {
+		errors.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("cardTransaction", data)
+	resp.Respond(w)
+
+	return nil
+}
+
+func updateCardTransaction(w http.ResponseWriter, r *http.Request, state *state.ServerState, id int64) error {
+	update := models.NewCardTransactionUpdate(state)
+	err := json.NewDecoder(r.Body).Decode(update)
+	if err != nil {
+		err = errors.Wrap("Invalid request", http.StatusBadRequest, err)
+		errors.WriteError(w, err)
+		return err
+	}
+
+	userID := auth.PrincipalFromContext(r.Context()).UserID
+	data, err := update.Apply(id, userID)
+	if err != nil {
+		errors.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "Card transaction has been updated")
+	resp.Set("cardTransaction", data)
+	resp.Respond(w)
+
+	return nil
+}
+
+func deleteCardTransaction(w http.ResponseWriter, r *http.Request, state *state.ServerState, id int64) error {
+	userID := auth.PrincipalFromContext(r.Context()).UserID
+	err := models.NewCardTransaction(state).DeleteCardTransaction(id, userID)
+	if err != nil {
+		errors.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "Card transaction has been deleted")
+	resp.Respond(w)
+
+	return nil
+}
+
+// ImportCardTransactions loads the card transactions of a bank statement
+// uploaded as the file of a multipart form.  With dryRun set nothing is
+// stored and the transactions are returned for review.
+func ImportCardTransactions(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	// Allow for the other form fields besides the statement.
+	r.Body = http.MaxBytesReader(w, r.Body, statements.MaxStatementSize+1<<20)
+	err := r.ParseMultipartForm(statements.MaxStatementSize)
+	if err != nil {
+		err = errors.Wrap("Invalid import request, expected a multipart form of at most 10MB", http.StatusBadRequest, err)
+		errors.WriteError(w, err)
+		return err
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		err := errors.NewError("Invalid import request", []types.ErrorField{
+			{Name: "file", Message: "A statement file is required"},
+		}, http.StatusBadRequest)
+		errors.WriteError(w, err)
+		return err
+	}
+	defer file.Close()
+
+	cardTransactionImport := models.NewCardTransactionImport(state)
+	err = cardTransactionImport.SetParameters(header.Filename, r.Form)
+	if err != nil {
+		errors.WriteError(w, err)
+		return err
+	}
+
+	userID := auth.PrincipalFromContext(r.Context()).UserID
+	data, fields, err := cardTransactionImport.Import(file, userID)
+	if err != nil {
+		errors.WriteError(w, err)
+		return err
+	}
+
+	var resp response.Response
+	if cardTransactionImport.DryRun {
+		resp = response.NewWithFieldsList(len(fields) == 0, "Import preview, nothing was imported", fields)
+	} else {
+		resp = response.New(true, "Card transactions have been imported")
+	}
+	resp.Set("count", len(data))
+	resp.Set("cardTransactions", data)
+	resp.Respond(w)
+
+	return nil
+}
+
+// ExportCardTransactions streams all of the caller's card transactions that
+// match the filters of GetCardTransactions as a file download.
+func ExportCardTransactions(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	format, err := models.ParseExportFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		errors.WriteError(w, err)
+		return err
+	}
+
+	cardTransaction := models.NewCardTransaction(state)
+	err = cardTransaction.SetFilterCriteria(r.URL.Query())
+	if err != nil {
+		errors.WriteError(w, err, http.StatusBadRequest)
+		return err
+	}
+
+	filename := fmt.Sprintf("card-transactions-%s.%s", time.Now().Format("2006-01-02"), format)
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Header().Add("Access-Control-Expose-Headers", "Content-Disposition")
+	w.WriteHeader(http.StatusOK)
+
+	userID := auth.PrincipalFromContext(r.Context()).UserID
+	return cardTransaction.ExportCardTransactions(w, format, userID)
+}
@@ -5,11 +5,13 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"testing"
 	"time"
 
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
 	"github.com/donohutcheon/gowebserver/datalayer"
 	"github.com/donohutcheon/gowebserver/models"
 	"github.com/donohutcheon/gowebserver/state"
@@ -24,6 +26,13 @@ type CreateCardTransactionControllerResponse struct {
 	CardTransaction models.CardTransaction `json:"cardTransaction"`
 }
 
+type CardTransactionControllerResponse struct {
+	Message         string                 `json:"message"`
+	Status          bool                   `json:"status"`
+	Fields          []types.ErrorField     `json:"fields"`
+	CardTransaction models.CardTransaction `json:"cardTransaction"`
+}
+
 type GetCardTransactionControllerResponse struct {
 	Message          string                   `json:"message"`
 	Status           bool                     `json:"status"`
@@ -247,4 +256,117 @@ func getCardTransactions(t *testing.T, ctx context.Context, cl *http.Client,
 
 		assert.Equal(t, x, gotResp.CardTransactions[i])
 	}
-}
\ No newline at end of file
+}
+
+func TestCardTransactionOwnership(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+	transactionsURL := state.URL + "/api/me/card-transactions"
+
+	loginAs := func(email string) *AuthResponse {
+		return login(t, ctx, cl, state.URL, AuthParameters{
+			authRequest:   models.User{Email: email, Password: "secret"},
+			expHTTPStatus: http.StatusOK,
+			expLoginResp:  AuthResponse{Message: "Logged In", Status: true},
+		})
+	}
+	subZeroSession := loginAs("subzero@dreamrealm.com")
+	subZero := subZeroSession.Token.AccessToken
+	reptile := loginAs("reptile@netherrealm.com").Token.AccessToken
+
+	transaction := models.CardTransaction{
+		DateTime:             time.Date(2020, 04, 25, 19, 46, 23, 0, time.UTC),
+		Amount:               models.CurrencyValue{Value: 400, Scale: 2},
+		CurrencyCode:         "ZAR",
+		Reference:            "simulation",
+		MerchantName:         "Dwelms en Dinges",
+		MerchantCity:         "Hillbrow",
+		MerchantCountryCode:  "ZA",
+		MerchantCountryName:  "South Africa",
+		MerchantCategoryCode: "contraband",
+		MerchantCategoryName: "Contraband",
+	}
+	ownResp, otherResp := new(CardTransactionControllerResponse), new(CardTransactionControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/card-transactions/new", withBearer(subZero), transaction,
+		http.StatusOK, "success", ownResp)
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/card-transactions/new", withBearer(reptile), transaction,
+		http.StatusOK, "success", otherResp)
+	ownID, otherID := ownResp.CardTransaction.ID, otherResp.CardTransaction.ID
+	ownURL := fmt.Sprintf("%s/%d", transactionsURL, ownID)
+	otherURL := fmt.Sprintf("%s/%d", transactionsURL, otherID)
+
+	gotResp := new(CardTransactionControllerResponse)
+	doRequest(t, ctx, cl, http.MethodGet, ownURL, withBearer(subZero), nil, http.StatusOK, "success", gotResp)
+	assert.Equal(t, "simulation", gotResp.CardTransaction.Reference)
+
+	// Other users' transactions are not found.
+	doRequest(t, ctx, cl, http.MethodGet, otherURL, withBearer(subZero), nil,
+		http.StatusNotFound, "Card transaction not found", nil)
+	doRequest(t, ctx, cl, http.MethodPatch, otherURL, withBearer(subZero), map[string]string{"reference": "mine"},
+		http.StatusNotFound, "Card transaction not found", nil)
+	doRequest(t, ctx, cl, http.MethodDelete, otherURL, withBearer(subZero), nil,
+		http.StatusNotFound, "Card transaction not found", nil)
+	doRequest(t, ctx, cl, http.MethodGet, transactionsURL+"/999", withBearer(subZero), nil,
+		http.StatusNotFound, "Card transaction not found", nil)
+	gotResp = new(CardTransactionControllerResponse)
+	doRequest(t, ctx, cl, http.MethodGet, transactionsURL+"/99999999999999999999", withBearer(subZero), nil,
+		http.StatusBadRequest, "Invalid card transaction ID", gotResp)
+	assert.Equal(t, []types.ErrorField{{Name: "id", Message: "Card transaction ID is out of range"}}, gotResp.Fields)
+
+	// IDs that are not numbers do not match the route.
+	doRequest(t, ctx, cl, http.MethodGet, transactionsURL+"/first", withBearer(subZero), nil,
+		http.StatusNotFound, "", nil)
+
+	// Updates are validated and only change the fields in the request.
+	gotResp = new(CardTransactionControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPatch, ownURL, withBearer(subZero), map[string]interface{}{
+		"amount":       map[string]int{"value": 100, "scale": 19},
+		"currencyCode": "rand",
+		"merchantName": " ",
+	}, http.StatusBadRequest, "Invalid card transaction update", gotResp)
+	assert.Equal(t, []types.ErrorField{
+		{Name: "amount.scale", Message: "Scale must be between 0 and 18"},
+		{Name: "currencyCode", Message: "Currency code must be a three letter ISO 4217 code such as ZAR"},
+		{Name: "merchantName", Message: "Merchant name is required"},
+	}, gotResp.Fields)
+
+	gotResp = new(CardTransactionControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPatch, ownURL, withBearer(subZero), map[string]interface{}{
+		"amount":    map[string]int{"value": 550, "scale": 2},
+		"reference": " refund ",
+	}, http.StatusOK, "Card transaction has been updated", gotResp)
+	assert.Equal(t, models.CurrencyValue{Value: 550, Scale: 2}, gotResp.CardTransaction.Amount)
+	assert.Equal(t, "refund", gotResp.CardTransaction.Reference)
+	assert.Equal(t, "Dwelms en Dinges", gotResp.CardTransaction.MerchantName)
+
+	gotResp = new(CardTransactionControllerResponse)
+	doRequest(t, ctx, cl, http.MethodGet, otherURL, withBearer(reptile), nil, http.StatusOK, "success", gotResp)
+	assert.Equal(t, "simulation", gotResp.CardTransaction.Reference)
+
+	// Deleted transactions are gone from the API.
+	doRequest(t, ctx, cl, http.MethodDelete, ownURL, withBearer(subZero), nil,
+		http.StatusOK, "Card transaction has been deleted", nil)
+	doRequest(t, ctx, cl, http.MethodGet, ownURL, withBearer(subZero), nil,
+		http.StatusNotFound, "Card transaction not found", nil)
+	doRequest(t, ctx, cl, http.MethodDelete, ownURL, withBearer(subZero), nil,
+		http.StatusNotFound, "Card transaction not found", nil)
+	getCardTransactions(t, ctx, cl, state.URL, subZeroSession, &GetCardTransactionParameters{
+		expResponse: GetCardTransactionControllerResponse{
+			Message:          "success",
+			Status:           true,
+			CardTransactions: []models.CardTransaction{},
+		},
+	})
+
+	dbCardTransaction, err := state.DataLayer.GetCardTransactionByID(ownID)
+	require.NoError(t, err)
+	assert.True(t, dbCardTransaction.DeletedAt.Valid)
+
+	// Scoped tokens need the transactions scopes.
+	readOnly := createAPIToken(t, ctx, cl, state.URL, reptile, "Reader", "transactions:read")
+	doRequest(t, ctx, cl, http.MethodGet, otherURL, withBearer(readOnly), nil, http.StatusOK, "success", nil)
+	doRequest(t, ctx, cl, http.MethodDelete, otherURL, withBearer(readOnly), nil,
+		http.StatusForbidden, "Token is missing a required scope", nil)
+}
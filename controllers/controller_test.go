@@ -1,13 +1,17 @@
 package controllers_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"regexp"
 	"testing"
+	"time"
 
+	"github.com/donohutcheon/gowebserver/provider/mail/mockmail"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -27,4 +31,103 @@ func mailCallback(t *testing.T, ctx context.Context, to []string, from, subject,
 
 	body, err := ioutil.ReadAll(res.Body)
 	fmt.Println("Confirmation response body: ", string(body))
-}
\ No newline at end of file
+}
+
+// sentMail is a mail captured by a mailRecorder callback.
+type sentMail struct {
+	to      []string
+	message string
+}
+
+// mailRecorder returns a mail callback which sends each mail on the returned
+// channel instead of following any links in it.
+func mailRecorder() (mockmail.CallbackFunc, chan sentMail) {
+	sent := make(chan sentMail, 4)
+	return func(t *testing.T, ctx context.Context, to []string, from, subject, message string) {
+		sent <- sentMail{to: to, message: message}
+	}, sent
+}
+
+// receiveMail waits for the next mail recorded on sent.
+func receiveMail(t *testing.T, sent chan sentMail) sentMail {
+	select {
+	case mail := <-sent:
+		return mail
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "timed out waiting for mail")
+	}
+
+	return sentMail{}
+}
+
+// receiveToken waits for the next mail recorded on sent and returns the first
+// submatch of re in its message.
+func receiveToken(t *testing.T, sent chan sentMail, re *regexp.Regexp) string {
+	mail := receiveMail(t, sent)
+	match := re.FindStringSubmatch(mail.message)
+	require.Len(t, match, 2, mail.message)
+
+	return match[1]
+}
+
+// doRequest sends request, unless it is nil, as JSON with the headers and
+// checks the status of the response and, unless expMessage is empty, its
+// message.  The JSON response is decoded into resp unless it is nil.  The
+// response is returned with its body, which has already been read.
+func doRequest(t *testing.T, ctx context.Context, cl *http.Client, method, url string, header http.Header,
+	request interface{}, expHTTPStatus int, expMessage string, resp interface{}) (*http.Response, []byte) {
+	var reqBody []byte
+	if request != nil {
+		b, err := json.Marshal(request)
+		require.NoError(t, err)
+		reqBody = b
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(reqBody))
+	require.NoError(t, err)
+	for name, values := range header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+
+	res, err := cl.Do(req)
+	require.NoError(t, err)
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	res.Body.Close()
+
+	assert.Equal(t, expHTTPStatus, res.StatusCode, string(body))
+	if resp != nil {
+		err = json.Unmarshal(body, resp)
+		require.NoError(t, err, string(body))
+	}
+	if len(expMessage) > 0 {
+		gotResp := new(struct {
+			Message string `json:"message"`
+		})
+		err = json.Unmarshal(body, gotResp)
+		require.NoError(t, err, string(body))
+		assert.Equal(t, expMessage, gotResp.Message)
+	}
+
+	return res, body
+}
+
+// withBearer returns the authorization header of an access token, unless it
+// is empty, and the headers given as name and value pairs, leaving out those
+// with an empty value.
+func withBearer(token string, pairs ...string) http.Header {
+	header := http.Header{}
+	if len(token) > 0 {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if len(pairs[i+1]) > 0 {
+			header.Set(pairs[i], pairs[i+1])
+		}
+	}
+
+	return header
+}
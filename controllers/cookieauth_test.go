@@ -0,0 +1,102 @@
+package controllers_test
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"testing"
+
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func cookieValue(jar http.CookieJar, u *url.URL, name string) string {
+	for _, cookie := range jar.Cookies(u) {
+		if cookie.Name == name {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+func TestCookieAuthentication(t *testing.T) {
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	cl := &http.Client{Jar: jar}
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+	credentials := map[string]string{"email": "subzero@dreamrealm.com", "password": "secret"}
+	apiURL, err := url.Parse(state.URL + "/api/users/current")
+	require.NoError(t, err)
+	refreshURL, err := url.Parse(state.URL + "/api/auth/refresh")
+	require.NoError(t, err)
+	// cookieMode asks for cookie authentication, with a CSRF token if given.
+	cookieMode := func(csrfToken string) http.Header {
+		return withBearer("", auth.AuthModeHeader, auth.AuthModeCookie, auth.CSRFHeader, csrfToken)
+	}
+
+	// The tokens are kept out of the body.
+	gotResp := new(AuthResponse)
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/login", cookieMode(""), credentials, http.StatusOK,
+		"Logged In", gotResp)
+	assert.Empty(t, gotResp.Token.AccessToken)
+	assert.Empty(t, gotResp.Token.RefreshToken)
+	assert.NotZero(t, gotResp.Token.ExpiresIn)
+
+	require.NotEmpty(t, cookieValue(jar, apiURL, auth.AccessTokenCookie))
+	refreshToken := cookieValue(jar, refreshURL, auth.RefreshTokenCookie)
+	require.NotEmpty(t, refreshToken)
+	csrfToken := cookieValue(jar, apiURL, auth.CSRFCookie)
+	require.NotEmpty(t, csrfToken)
+	// The refresh token is only sent to the refresh endpoint.
+	assert.Empty(t, cookieValue(jar, apiURL, auth.RefreshTokenCookie))
+
+	// Safe requests need no CSRF token.
+	doRequest(t, ctx, cl, http.MethodGet, apiURL.String(), cookieMode(""), nil, http.StatusOK, "success", nil)
+
+	// State-changing requests must echo the CSRF cookie.
+	tokensURL := state.URL + "/api/auth/api-tokens"
+	tokenRequest := map[string]interface{}{"name": "Budget app", "scopes": []string{"transactions:read"}}
+	doRequest(t, ctx, cl, http.MethodPost, tokensURL, cookieMode(""), tokenRequest,
+		http.StatusForbidden, "Missing or invalid CSRF token", nil)
+	doRequest(t, ctx, cl, http.MethodPost, tokensURL, cookieMode("forged"), tokenRequest,
+		http.StatusForbidden, "Missing or invalid CSRF token", nil)
+	doRequest(t, ctx, cl, http.MethodPost, tokensURL, cookieMode(csrfToken), tokenRequest,
+		http.StatusOK, "API token has been created", nil)
+
+	// Refreshing from the cookie rotates the cookies.
+	refreshRequest := auth.RefreshJWTReq{GrantType: "refresh_token"}
+	doRequest(t, ctx, cl, http.MethodPost, refreshURL.String(), cookieMode(""), refreshRequest,
+		http.StatusForbidden, "Missing or invalid CSRF token", nil)
+	gotResp = new(AuthResponse)
+	doRequest(t, ctx, cl, http.MethodPost, refreshURL.String(), cookieMode(csrfToken), refreshRequest,
+		http.StatusOK, "Tokens refreshed", gotResp)
+	assert.Empty(t, gotResp.Token.AccessToken)
+	assert.NotEqual(t, refreshToken, cookieValue(jar, refreshURL, auth.RefreshTokenCookie))
+	assert.NotEqual(t, csrfToken, cookieValue(jar, apiURL, auth.CSRFCookie))
+	csrfToken = cookieValue(jar, apiURL, auth.CSRFCookie)
+	doRequest(t, ctx, cl, http.MethodGet, apiURL.String(), cookieMode(""), nil, http.StatusOK, "success", nil)
+
+	// Logging out clears the cookies.
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/logout", cookieMode(csrfToken), nil, http.StatusOK,
+		"Logged out", nil)
+	assert.Empty(t, cookieValue(jar, apiURL, auth.AccessTokenCookie))
+	assert.Empty(t, cookieValue(jar, apiURL, auth.CSRFCookie))
+	assert.Empty(t, cookieValue(jar, refreshURL, auth.RefreshTokenCookie))
+	doRequest(t, ctx, cl, http.MethodGet, apiURL.String(), cookieMode(""), nil, http.StatusForbidden,
+		"Missing auth token", nil)
+
+	// Bearer tokens keep working and need no CSRF token.
+	bearerClient := new(http.Client)
+	bearerResp := new(SessionControllerResponse)
+	doRequest(t, ctx, bearerClient, http.MethodPost, state.URL+"/api/auth/login",
+		nil, credentials, http.StatusOK, "Logged In", bearerResp)
+	bearer := bearerResp.Token
+	require.NotEmpty(t, bearer.AccessToken)
+	doRequest(t, ctx, bearerClient, http.MethodPost, tokensURL, withBearer(bearer.AccessToken), tokenRequest,
+		http.StatusOK, "", nil)
+}
@@ -0,0 +1,142 @@
+package controllers_test
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/datalayer/mockdatalayer"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var emailChangeRe = regexp.MustCompile(`confirm-email/([a-f0-9]+)`)
+
+// receiveEmailChange waits for the confirmation sent to the new address and
+// the notification sent to the old one, returning the confirmation token.
+func receiveEmailChange(t *testing.T, sent chan sentMail, oldEmail, newEmail string) string {
+	var token string
+	for i := 0; i < 2; i++ {
+		mail := receiveMail(t, sent)
+		if mail.to[0] == newEmail {
+			match := emailChangeRe.FindStringSubmatch(mail.message)
+			require.Len(t, match, 2, mail.message)
+			token = match[1]
+		} else {
+			// The old address is only notified.
+			assert.Equal(t, []string{oldEmail}, mail.to)
+			assert.NotRegexp(t, emailChangeRe, mail.message)
+		}
+	}
+	require.NotEmpty(t, token)
+
+	return token
+}
+
+func TestEmailChange(t *testing.T) {
+	cl := new(http.Client)
+	callback, sent := mailRecorder()
+	callbacks := state.NewMockCallbacks(callback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+	// The mock mail client expects a single mail, an email change sends two.
+	callbacks.MockMailWG.Add(1)
+	emailURL := state.URL + "/api/me/email"
+
+	session := login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest: models.User{
+			Email:    "subzero@dreamrealm.com",
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	})
+	accessToken := session.Token.AccessToken
+
+	// The current password is required and the new address must be free.
+	doRequest(t, ctx, cl, http.MethodPost, emailURL, withBearer(accessToken),
+		map[string]string{"email": "kuai.liang@dreamrealm.com", "password": "wrong"},
+		http.StatusForbidden, "Password is incorrect", nil)
+	doRequest(t, ctx, cl, http.MethodPost, emailURL, withBearer(accessToken),
+		map[string]string{"email": "reptile@netherrealm.com", "password": "secret"},
+		http.StatusBadRequest, "Email address already exists", nil)
+	doRequest(t, ctx, cl, http.MethodPost, emailURL, withBearer(accessToken),
+		map[string]string{"email": "nowhere", "password": "secret"},
+		http.StatusBadRequest, "Email address is required", nil)
+
+	doRequest(t, ctx, cl, http.MethodPost, emailURL, withBearer(accessToken),
+		map[string]string{"email": "kuai.liang@dreamrealm.com", "password": "secret"},
+		http.StatusOK, "A confirmation link has been sent to the new email address", nil)
+
+	token := receiveEmailChange(t, sent, "subzero@dreamrealm.com", "kuai.liang@dreamrealm.com")
+
+	// Nothing changes until the new address is confirmed.
+	dl := state.DataLayer.(*mockdatalayer.MockDataLayer)
+	dbUser, err := dl.GetUserByID(1)
+	require.NoError(t, err)
+	assert.Equal(t, "subzero@dreamrealm.com", dbUser.Email.String)
+
+	confirmURL := state.URL + "/api/users/confirm-email/"
+	doRequest(t, ctx, cl, http.MethodGet, confirmURL+"bogus", nil, nil,
+		http.StatusBadRequest, "Email change link is invalid or has expired", nil)
+	doRequest(t, ctx, cl, http.MethodGet, confirmURL+token, nil, nil,
+		http.StatusOK, "Email address has been changed", nil)
+	assert.Equal(t, "kuai.liang@dreamrealm.com", dbUser.Email.String)
+
+	// The link is single use.
+	doRequest(t, ctx, cl, http.MethodGet, confirmURL+token, nil, nil,
+		http.StatusBadRequest, "Email change link is invalid or has expired", nil)
+
+	login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest: models.User{
+			Email:    "kuai.liang@dreamrealm.com",
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	})
+}
+
+func TestEmailChangeTakenBeforeConfirmation(t *testing.T) {
+	cl := new(http.Client)
+	callback, sent := mailRecorder()
+	callbacks := state.NewMockCallbacks(callback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+	// The mock mail client expects a single mail, an email change sends two.
+	callbacks.MockMailWG.Add(1)
+
+	session := login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest: models.User{
+			Email:    "reptile@netherrealm.com",
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	})
+
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/me/email", withBearer(session.Token.AccessToken),
+		map[string]string{"email": "syzoth@zaterra.com", "password": "secret"}, http.StatusOK,
+		"A confirmation link has been sent to the new email address", nil)
+	token := receiveEmailChange(t, sent, "reptile@netherrealm.com", "syzoth@zaterra.com")
+
+	// Someone else signs up with the address in the meantime.
+	_, err := state.DataLayer.CreateUser("syzoth@zaterra.com", "hash", datalayer.UserRoleUser)
+	require.NoError(t, err)
+
+	doRequest(t, ctx, cl, http.MethodGet, state.URL+"/api/users/confirm-email/"+token,
+		nil, nil, http.StatusBadRequest, "Email address already exists", nil)
+}
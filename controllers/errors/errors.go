@@ -13,6 +13,8 @@ type ControllerError struct {
 	Fields []types.ErrorField
 	StatusCode int
 	Err error
+	// Header is added to the response, e.g. Retry-After.
+	Header http.Header
 }
 
 func NewError(errorMessage string, fields []types.ErrorField, statusCode int) *ControllerError {
@@ -42,6 +44,11 @@ func (e *ControllerError) Error() string {
 func WriteError(w http.ResponseWriter, err error, defaultStatusCode ...int) {
 	if err, ok := err.(*ControllerError); ok {
 		resp := response.NewWithFieldsList(false, err.ErrorMessage, err.Fields)
+		for key, values := range err.Header {
+			for _, value := range values {
+				w.Header().Add(key, value)
+			}
+		}
 		w.WriteHeader(err.StatusCode)
 		resp.Respond(w)
 		return
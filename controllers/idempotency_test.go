@@ -0,0 +1,158 @@
+package controllers_test
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/datalayer/mockdatalayer"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/router/idempotency"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyKeys(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+	dl := state.DataLayer.(*mockdatalayer.MockDataLayer)
+	createURL := state.URL + "/api/card-transactions/new"
+
+	loginAs := func(email string) string {
+		return login(t, ctx, cl, state.URL, AuthParameters{
+			authRequest:   models.User{Email: email, Password: "secret"},
+			expHTTPStatus: http.StatusOK,
+			expLoginResp:  AuthResponse{Message: "Logged In", Status: true},
+		}).Token.AccessToken
+	}
+	subZero := loginAs("subzero@dreamrealm.com")
+	reptile := loginAs("reptile@netherrealm.com")
+
+	countTransactions := func(userID int64) int {
+		n := 0
+		for _, transaction := range dl.CardTransactions {
+			if transaction.UserID == userID {
+				n++
+			}
+		}
+		return n
+	}
+
+	transaction := models.CardTransaction{
+		DateTime:             time.Date(2020, 04, 25, 19, 46, 23, 0, time.UTC),
+		Amount:               models.CurrencyValue{Value: 400, Scale: 2},
+		CurrencyCode:         "ZAR",
+		Reference:            "simulation",
+		MerchantName:         "Dwelms en Dinges",
+		MerchantCity:         "Hillbrow",
+		MerchantCountryCode:  "ZA",
+		MerchantCountryName:  "South Africa",
+		MerchantCategoryCode: "contraband",
+		MerchantCategoryName: "Contraband",
+	}
+
+	// A retry replays the first response without creating another row.
+	first, retried := new(CardTransactionControllerResponse), new(CardTransactionControllerResponse)
+	res, _ := doRequest(t, ctx, cl, http.MethodPost, createURL, withBearer(subZero, idempotency.Header, "retry-1"),
+		transaction, http.StatusOK, "success", first)
+	assert.Empty(t, res.Header.Get(idempotency.ReplayedHeader))
+	firstHeader := res.Header
+	res, _ = doRequest(t, ctx, cl, http.MethodPost, createURL, withBearer(subZero, idempotency.Header, "retry-1"),
+		transaction, http.StatusOK, "success", retried)
+	assert.Equal(t, "true", res.Header.Get(idempotency.ReplayedHeader))
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+	for name, values := range firstHeader {
+		if name != "Date" {
+			assert.Equal(t, values, res.Header[name], name)
+		}
+	}
+	assert.Equal(t, first.CardTransaction.ID, retried.CardTransaction.ID)
+	assert.Equal(t, 1, countTransactions(1))
+
+	// Reusing a key with a different request is refused.
+	changed := transaction
+	changed.Reference = "changed"
+	doRequest(t, ctx, cl, http.MethodPost, createURL, withBearer(subZero, idempotency.Header, "retry-1"), changed,
+		http.StatusUnprocessableEntity, "Idempotency key has already been used with a different request", nil)
+	assert.Equal(t, 1, countTransactions(1))
+
+	// Keys are scoped to the user.
+	other := new(CardTransactionControllerResponse)
+	res, _ = doRequest(t, ctx, cl, http.MethodPost, createURL, withBearer(reptile, idempotency.Header, "retry-1"),
+		transaction, http.StatusOK, "success", other)
+	assert.Empty(t, res.Header.Get(idempotency.ReplayedHeader))
+	assert.NotEqual(t, first.CardTransaction.ID, other.CardTransaction.ID)
+
+	// Requests without a key are not deduplicated.
+	doRequest(t, ctx, cl, http.MethodPost, createURL, withBearer(subZero), transaction, http.StatusOK, "success", nil)
+	doRequest(t, ctx, cl, http.MethodPost, createURL, withBearer(subZero), transaction, http.StatusOK, "success", nil)
+	assert.Equal(t, 3, countTransactions(1))
+
+	gotResp := new(CardTransactionControllerResponse)
+	longKey := strings.Repeat("k", idempotency.MaxKeyLength+1)
+	doRequest(t, ctx, cl, http.MethodPost, createURL, withBearer(subZero, idempotency.Header, longKey), transaction,
+		http.StatusBadRequest, "Invalid idempotency key", gotResp)
+	require.Len(t, gotResp.Fields, 1)
+	assert.Equal(t, idempotency.Header, gotResp.Fields[0].Name)
+
+	res, _ = doRequest(t, ctx, cl, http.MethodPost, createURL, withBearer(subZero, idempotency.Header, "too-large-1"),
+		strings.Repeat("x", idempotency.MaxRequestSize), http.StatusRequestEntityTooLarge, "Request body is too large", nil)
+	assert.True(t, res.Close)
+	_, err := dl.GetIdempotencyKey(1, "too-large-1")
+	assert.Equal(t, datalayer.ErrNoData, err)
+
+	// Client errors are stored and replayed too.
+	invalid := transaction
+	invalid.CurrencyCode = ""
+	gotResp, retriedResp := new(CardTransactionControllerResponse), new(CardTransactionControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, createURL, withBearer(subZero, idempotency.Header, "invalid-1"), invalid,
+		http.StatusBadRequest, "Invalid request, validation failed", gotResp)
+	res, _ = doRequest(t, ctx, cl, http.MethodPost, createURL, withBearer(subZero, idempotency.Header, "invalid-1"),
+		invalid, http.StatusBadRequest, "Invalid request, validation failed", retriedResp)
+	assert.Equal(t, "true", res.Header.Get(idempotency.ReplayedHeader))
+	assert.Equal(t, gotResp.Fields, retriedResp.Fields)
+
+	// Every header of the stored response is replayed.
+	key, err := dl.GetIdempotencyKey(1, "invalid-1")
+	require.NoError(t, err)
+	key.ResponseHeaders.String = `{"Content-Type":["application/json"],"Location":["/api/me/card-transactions/1"],"Retry-After":["30"]}`
+	res, _ = doRequest(t, ctx, cl, http.MethodPost, createURL, withBearer(subZero, idempotency.Header, "invalid-1"),
+		invalid, http.StatusBadRequest, "Invalid request, validation failed", nil)
+	assert.Equal(t, "/api/me/card-transactions/1", res.Header.Get("Location"))
+	assert.Equal(t, "30", res.Header.Get("Retry-After"))
+
+	// A key still being handled is refused until it is done.
+	key, err = dl.GetIdempotencyKey(1, "retry-1")
+	require.NoError(t, err)
+	storedStatus := key.StatusCode
+	key.StatusCode = sql.NullInt64{}
+	res, _ = doRequest(t, ctx, cl, http.MethodPost, createURL, withBearer(subZero, idempotency.Header, "retry-1"),
+		transaction, http.StatusConflict, "A request with this idempotency key is still in progress", nil)
+	assert.Equal(t, "1", res.Header.Get("Retry-After"))
+	key.StatusCode = storedStatus
+
+	// Expired keys can be used again.
+	key.ExpiresAt = datalayer.JsonNullTime{NullTime: sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true}}
+	renewed := new(CardTransactionControllerResponse)
+	res, _ = doRequest(t, ctx, cl, http.MethodPost, createURL, withBearer(subZero, idempotency.Header, "retry-1"),
+		changed, http.StatusOK, "success", renewed)
+	assert.Empty(t, res.Header.Get(idempotency.ReplayedHeader))
+	assert.Equal(t, "changed", renewed.CardTransaction.Reference)
+	assert.Equal(t, 4, countTransactions(1))
+
+	key, err = dl.GetIdempotencyKey(1, "retry-1")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(idempotency.DefaultWindow), key.ExpiresAt.Time, time.Minute)
+
+	deleted, err := dl.DeleteIdempotencyKeysExpiredBefore(time.Now().Add(idempotency.DefaultWindow + time.Minute))
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, deleted)
+	assert.Empty(t, dl.IdempotencyKeys)
+}
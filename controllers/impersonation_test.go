@@ -0,0 +1,102 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type ImpersonationControllerResponse struct {
+	Message string                          `json:"message"`
+	Status  bool                            `json:"status"`
+	Token   auth.ImpersonationResponse      `json:"token"`
+	User    models.User                     `json:"user"`
+	Audits  []*datalayer.ImpersonationAudit `json:"audits"`
+}
+
+func TestImpersonation(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+	usersURL := state.URL + "/api/admin/users"
+
+	loginAs := func(email string) string {
+		resp := login(t, ctx, cl, state.URL, AuthParameters{
+			authRequest:   models.User{Email: email, Password: "secret"},
+			expHTTPStatus: http.StatusOK,
+			expLoginResp:  AuthResponse{Message: "Logged In", Status: true},
+		})
+		return resp.Token.AccessToken
+	}
+	admin := loginAs("subzero@dreamrealm.com")
+	user := loginAs("reptile@netherrealm.com")
+
+	// Only administrators can impersonate, and only users.
+	doRequest(t, ctx, cl, http.MethodPost, usersURL+"/1/impersonate", withBearer(user), nil,
+		http.StatusForbidden, "Insufficient role to access this resource", nil)
+	doRequest(t, ctx, cl, http.MethodPost, usersURL+"/1/impersonate", withBearer(admin), nil,
+		http.StatusBadRequest, "Administrators cannot be impersonated", nil)
+	doRequest(t, ctx, cl, http.MethodPost, usersURL+"/999/impersonate", withBearer(admin), nil,
+		http.StatusNotFound, "User not found", nil)
+
+	gotResp := new(ImpersonationControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, usersURL+"/2/impersonate", withBearer(admin), nil,
+		http.StatusOK, "Impersonation token issued", gotResp)
+	assert.Equal(t, int64(2), gotResp.Token.UserID)
+	impersonation := gotResp.Token.AccessToken
+	require.NotEmpty(t, impersonation)
+
+	// The administrator sees what the user sees and responses are marked.
+	gotResp = new(ImpersonationControllerResponse)
+	res, _ := doRequest(t, ctx, cl, http.MethodGet, state.URL+"/api/users/current", withBearer(impersonation), nil,
+		http.StatusOK, "success", gotResp)
+	assert.Equal(t, "reptile@netherrealm.com", gotResp.User.Email)
+	assert.Equal(t, "1", res.Header.Get(auth.ImpersonatedByHeader))
+	res, _ = doRequest(t, ctx, cl, http.MethodGet, state.URL+"/api/users/current", withBearer(user), nil,
+		http.StatusOK, "success", nil)
+	assert.Empty(t, res.Header.Get(auth.ImpersonatedByHeader))
+
+	// Sensitive actions are refused.
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/me/email", withBearer(impersonation),
+		map[string]string{"email": "syzoth@zaterra.com", "password": "secret"},
+		http.StatusForbidden, "This action is not allowed while impersonating a user", nil)
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/api-tokens", withBearer(impersonation),
+		map[string]interface{}{"name": "Backdoor", "scopes": []string{"profile:read"}},
+		http.StatusForbidden, "This action is not allowed while impersonating a user", nil)
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/logout-all", withBearer(impersonation), nil,
+		http.StatusForbidden, "This action is not allowed while impersonating a user", nil)
+	doRequest(t, ctx, cl, http.MethodGet, usersURL, withBearer(impersonation), nil,
+		http.StatusForbidden, "Insufficient role to access this resource", nil)
+
+	// Every impersonated request is audited.
+	doRequest(t, ctx, cl, http.MethodGet, usersURL+"/2/impersonations", withBearer(user), nil,
+		http.StatusForbidden, "Insufficient role to access this resource", nil)
+	gotResp = new(ImpersonationControllerResponse)
+	doRequest(t, ctx, cl, http.MethodGet, usersURL+"/2/impersonations?sortDir=desc", withBearer(admin), nil,
+		http.StatusOK, "success", gotResp)
+	require.Len(t, gotResp.Audits, 5)
+	latest := gotResp.Audits[0]
+	assert.Equal(t, int64(1), latest.ActorID)
+	assert.Equal(t, int64(2), latest.UserID)
+	assert.Equal(t, http.MethodGet, latest.Method)
+	assert.Equal(t, "/api/admin/users", latest.Path)
+	assert.Equal(t, http.StatusForbidden, latest.StatusCode)
+	assert.Equal(t, "/api/users/current", gotResp.Audits[4].Path)
+	assert.Equal(t, http.StatusOK, gotResp.Audits[4].StatusCode)
+
+	// Disabling the user ends the impersonation.
+	doRequest(t, ctx, cl, http.MethodPost, usersURL+"/2/disable", withBearer(admin), nil,
+		http.StatusOK, "User has been disabled", nil)
+	doRequest(t, ctx, cl, http.MethodGet, state.URL+"/api/users/current", withBearer(impersonation), nil,
+		http.StatusForbidden, "User account has been disabled", nil)
+	doRequest(t, ctx, cl, http.MethodPost, usersURL+"/2/impersonate", withBearer(admin), nil,
+		http.StatusConflict, "Disabled users cannot be impersonated", nil)
+}
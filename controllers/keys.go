@@ -0,0 +1,24 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// GetJWKS publishes the public keys used to verify tokens so that other
+// services can validate them without sharing a secret.
+func GetJWKS(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	return json.NewEncoder(w).Encode(state.Keys.JWKS())
+}
@@ -0,0 +1,173 @@
+package controllers_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/donohutcheon/gowebserver/datalayer/mockdatalayer"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/router/auth/keys"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getJWKS(t *testing.T, ctx context.Context, cl *http.Client, url string) keys.JSONWebKeySet {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/.well-known/jwks.json", nil)
+	assert.NoError(t, err)
+
+	res, err := cl.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	jwks := keys.JSONWebKeySet{}
+	err = json.Unmarshal(body, &jwks)
+	require.NoError(t, err)
+
+	return jwks
+}
+
+// verifyWithJWKS verifies a token the way an external service would, using
+// only the published key set.
+func verifyWithJWKS(t *testing.T, jwks keys.JSONWebKeySet, rawToken string) *auth.JSONWebToken {
+	tk := new(auth.JSONWebToken)
+	_, err := jwt.ParseWithClaims(rawToken, tk, func(token *jwt.Token) (interface{}, error) {
+		for _, jwk := range jwks.Keys {
+			if jwk.KeyID != token.Header["kid"] {
+				continue
+			}
+			require.Equal(t, "RSA", jwk.KeyType)
+			require.Equal(t, jwk.Algorithm, token.Method.Alg())
+
+			n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+			require.NoError(t, err)
+			e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+			require.NoError(t, err)
+
+			return &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}, nil
+		}
+		return nil, keys.ErrUnknownKey
+	})
+	require.NoError(t, err)
+
+	return tk
+}
+
+func TestJWKS(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+
+	authParams := AuthParameters{
+		authRequest: models.User{
+			Email:    "subzero@dreamrealm.com",
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	}
+	loggedIn := &GetCurrentUserParameters{
+		expResponse: UserControllerResponse{
+			Message: "success",
+			Status:  true,
+			User: models.User{
+				Email: "subzero@dreamrealm.com",
+			},
+		},
+		expHTTPStatus: http.StatusOK,
+	}
+
+	jwks := getJWKS(t, ctx, cl, state.URL)
+	require.Len(t, jwks.Keys, 1)
+	assert.Equal(t, "RS256", jwks.Keys[0].Algorithm)
+	assert.Equal(t, "sig", jwks.Keys[0].Use)
+
+	before := login(t, ctx, cl, state.URL, authParams)
+	tk := verifyWithJWKS(t, jwks, before.Token.AccessToken)
+	assert.Equal(t, int64(1), tk.UserID)
+
+	// After rotation both keys are published and old tokens keep working.
+	err := state.Keys.Rotate()
+	require.NoError(t, err)
+
+	jwks = getJWKS(t, ctx, cl, state.URL)
+	require.Len(t, jwks.Keys, 2)
+
+	after := login(t, ctx, cl, state.URL, authParams)
+	verifyWithJWKS(t, jwks, before.Token.AccessToken)
+	verifyWithJWKS(t, jwks, after.Token.AccessToken)
+
+	beforeToken, _, err := new(jwt.Parser).ParseUnverified(before.Token.AccessToken, new(auth.JSONWebToken))
+	require.NoError(t, err)
+	afterToken, _, err := new(jwt.Parser).ParseUnverified(after.Token.AccessToken, new(auth.JSONWebToken))
+	require.NoError(t, err)
+	assert.NotEqual(t, beforeToken.Header["kid"], afterToken.Header["kid"])
+
+	getCurrentUser(t, ctx, cl, state.URL, before, loggedIn)
+	getCurrentUser(t, ctx, cl, state.URL, after, loggedIn)
+}
+
+func TestSigningKeyEncryption(t *testing.T) {
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	dl := state.DataLayer.(*mockdatalayer.MockDataLayer)
+
+	// Private keys are encrypted before they are stored.
+	require.Len(t, dl.SigningKeys, 1)
+	assert.Regexp(t, "^aes-gcm:", dl.SigningKeys[0].PrivateKey)
+	assert.NotContains(t, dl.SigningKeys[0].PrivateKey, "PRIVATE KEY")
+
+	config := keys.Config{
+		Algorithm:          keys.AlgorithmRS256,
+		RotationPeriod:     keys.DefaultRotationPeriod,
+		VerificationPeriod: keys.DefaultVerificationPeriod,
+	}
+	_, err := keys.New(dl, config)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is encrypted but SIGNING_KEY_ENCRYPTION_KEY is not set")
+
+	config.EncryptionKey = bytes.Repeat([]byte{1}, keys.EncryptionKeySize)
+	_, err = keys.New(dl, config)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "could not be decrypted")
+
+	// Keys stored before encryption was configured keep working and new keys
+	// are encrypted.
+	legacy := mockdatalayer.New(t)
+	_, err = keys.New(legacy, keys.Config{
+		Algorithm:          keys.AlgorithmRS256,
+		RotationPeriod:     keys.DefaultRotationPeriod,
+		VerificationPeriod: keys.DefaultVerificationPeriod,
+	})
+	require.NoError(t, err)
+	require.Len(t, legacy.SigningKeys, 1)
+	assert.Contains(t, legacy.SigningKeys[0].PrivateKey, "PRIVATE KEY")
+
+	keyStore, err := keys.New(legacy, config)
+	require.NoError(t, err)
+	require.NoError(t, keyStore.Rotate())
+	assert.Len(t, keyStore.VerificationKeys(), 2)
+	require.Len(t, legacy.SigningKeys, 2)
+	assert.Regexp(t, "^aes-gcm:", legacy.SigningKeys[1].PrivateKey)
+}
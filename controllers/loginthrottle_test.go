@@ -0,0 +1,102 @@
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var unlockRe = regexp.MustCompile(`/api/auth/unlock/([a-f0-9]+)`)
+
+func attemptLogin(t *testing.T, ctx context.Context, cl *http.Client, url, email, password string,
+	expHTTPStatus int, expMessage string) http.Header {
+	res, _ := doRequest(t, ctx, cl, http.MethodPost, url+"/api/auth/login", nil,
+		map[string]string{"email": email, "password": password}, expHTTPStatus, expMessage, nil)
+
+	return res.Header
+}
+
+func TestAccountLockout(t *testing.T) {
+	cl := new(http.Client)
+	unlockCallback, unlockTokens := mailRecorder()
+	callbacks := state.NewMockCallbacks(unlockCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+	email := "subzero@dreamrealm.com"
+
+	for i := 0; i < 4; i++ {
+		header := attemptLogin(t, ctx, cl, state.URL, email, "wrong", http.StatusForbidden, "Invalid login credentials")
+		assert.Empty(t, header.Get("Retry-After"))
+	}
+
+	// Past the free attempts the account backs off, even for the right password.
+	header := attemptLogin(t, ctx, cl, state.URL, email, "secret",
+		http.StatusTooManyRequests, "Too many failed login attempts, try again later")
+	assert.Equal(t, "1", header.Get("Retry-After"))
+
+	time.Sleep(1100 * time.Millisecond)
+
+	// Reaching the threshold locks the account and emails an unlock link.
+	attemptLogin(t, ctx, cl, state.URL, email, "wrong", http.StatusForbidden, "Invalid login credentials")
+	token := receiveToken(t, unlockTokens, unlockRe)
+
+	header = attemptLogin(t, ctx, cl, state.URL, email, "secret",
+		http.StatusTooManyRequests, "Account is temporarily locked, check your email to unlock it")
+	assert.Equal(t, "60", header.Get("Retry-After"))
+
+	// Other accounts are unaffected.
+	attemptLogin(t, ctx, cl, state.URL, "reptile@netherrealm.com", "secret", http.StatusOK, "Logged In")
+
+	unlockURL := fmt.Sprintf("%s/api/auth/unlock/%s", state.URL, token)
+	for _, exp := range []struct {
+		status  int
+		message string
+	}{
+		{http.StatusOK, "Account has been unlocked"},
+		{http.StatusBadRequest, "Unlock link is invalid or has expired"},
+	} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, unlockURL, nil)
+		require.NoError(t, err)
+		res, err := cl.Do(req)
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		gotResp := new(MessageResponse)
+		require.NoError(t, json.Unmarshal(body, gotResp))
+		assert.Equal(t, exp.status, res.StatusCode)
+		assert.Equal(t, exp.message, gotResp.Message)
+	}
+
+	attemptLogin(t, ctx, cl, state.URL, email, "secret", http.StatusOK, "Logged In")
+}
+
+func TestIPBackoff(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+
+	// Failures against unknown accounts still count against the address.
+	for i := 0; i < 11; i++ {
+		email := fmt.Sprintf("nobody%d@earthrealm.com", i)
+		attemptLogin(t, ctx, cl, state.URL, email, "secret", http.StatusForbidden, "Invalid login credentials")
+	}
+
+	header := attemptLogin(t, ctx, cl, state.URL, "subzero@dreamrealm.com", "secret",
+		http.StatusTooManyRequests, "Too many failed login attempts, try again later")
+	assert.Equal(t, "1", header.Get("Retry-After"))
+
+	time.Sleep(1100 * time.Millisecond)
+
+	attemptLogin(t, ctx, cl, state.URL, "subzero@dreamrealm.com", "secret", http.StatusOK, "Logged In")
+}
@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/gorilla/mux"
+)
+
+func RequestMagicLink(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
+	w.Header().Set("X-XSS-Protection", "1; mode=block")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	magicLink := models.NewMagicLink(state)
+	err := json.NewDecoder(r.Body).Decode(magicLink)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	err = magicLink.Request()
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "If the account exists a login link has been sent")
+	resp.Respond(w)
+
+	return nil
+}
+
+// MagicLinkLogin checks a login link and, once confirmed with
+// confirm=true, exchanges it for tokens.
+func MagicLinkLogin(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
+	w.Header().Set("X-XSS-Protection", "1; mode=block")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	magicLink := models.NewMagicLink(state)
+	magicLink.Token = mux.Vars(r)["token"]
+
+	if r.URL.Query().Get("confirm") != "true" {
+		expiresAt, err := magicLink.Check()
+		if err != nil {
+			e.WriteError(w, err)
+			return err
+		}
+
+		resp := response.New(true, "Confirm to log in")
+		resp.Set("expiresAt", expiresAt)
+		resp.Respond(w)
+		return nil
+	}
+
+	data, challenge, err := magicLink.Login(clientInfo(r))
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	if challenge != nil {
+		resp := response.New(true, "Two-factor authentication required")
+		resp["challenge"] = challenge
+		resp.Respond(w)
+		return nil
+	}
+
+	return respondTokens(w, state, "Logged In", data, auth.WantsCookies(r))
+}
@@ -0,0 +1,128 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/datalayer/mockdatalayer"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var magicLinkRe = regexp.MustCompile(`magic-link\?token=([a-f0-9]+)`)
+
+type MagicLinkResponse struct {
+	Message   string                 `json:"message"`
+	Status    bool                   `json:"status"`
+	Fields    []types.ErrorField     `json:"fields"`
+	ExpiresAt datalayer.JsonNullTime `json:"expiresAt"`
+	Token     auth.TokenResponse     `json:"token"`
+}
+
+func TestMagicLink(t *testing.T) {
+	cl := new(http.Client)
+	callback, tokens := mailRecorder()
+	callbacks := state.NewMockCallbacks(callback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+	// The mock mail client expects a single mail, three are sent.
+	callbacks.MockMailWG.Add(2)
+	requestURL := state.URL + "/api/auth/magic-link"
+	dl := state.DataLayer.(*mockdatalayer.MockDataLayer)
+
+	openLink := func(token string, confirm bool, expHTTPStatus int, expMessage string) *MagicLinkResponse {
+		url := requestURL + "/" + token
+		if confirm {
+			url += "?confirm=true"
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		require.NoError(t, err)
+
+		res, err := cl.Do(req)
+		require.NoError(t, err)
+
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		gotResp := new(MagicLinkResponse)
+		err = json.Unmarshal(body, gotResp)
+		require.NoError(t, err)
+
+		assert.Equal(t, expHTTPStatus, res.StatusCode, string(body))
+		assert.Equal(t, expMessage, gotResp.Message)
+
+		return gotResp
+	}
+
+	// Unknown addresses are not revealed.
+	doRequest(t, ctx, cl, http.MethodPost, requestURL, nil, map[string]string{"email": "nobody"},
+		http.StatusBadRequest, "Email address is required", nil)
+	doRequest(t, ctx, cl, http.MethodPost, requestURL, nil, map[string]string{"email": "shao@outworld.com"},
+		http.StatusOK, "If the account exists a login link has been sent", nil)
+
+	doRequest(t, ctx, cl, http.MethodPost, requestURL, nil, map[string]string{"email": "reptile@netherrealm.com"},
+		http.StatusOK, "If the account exists a login link has been sent", nil)
+	first := receiveToken(t, tokens, magicLinkRe)
+
+	// Opening the link, e.g. by a mail scanner, does not use it up.
+	gotResp := openLink(first, false, http.StatusOK, "Confirm to log in")
+	assert.True(t, gotResp.ExpiresAt.Time.After(time.Now()))
+	openLink(first, false, http.StatusOK, "Confirm to log in")
+	openLink("0123abcd", false, http.StatusBadRequest, "Login link is invalid or has expired")
+
+	// Only the latest link works.
+	doRequest(t, ctx, cl, http.MethodPost, requestURL, nil, map[string]string{"email": "reptile@netherrealm.com"},
+		http.StatusOK, "If the account exists a login link has been sent", nil)
+	second := receiveToken(t, tokens, magicLinkRe)
+	openLink(first, true, http.StatusBadRequest, "Login link is invalid or has expired")
+
+	gotResp = openLink(second, true, http.StatusOK, "Logged In")
+	accessToken := gotResp.Token.AccessToken
+	require.NotEmpty(t, accessToken)
+	assert.NotEmpty(t, gotResp.Token.RefreshToken)
+	doRequest(t, ctx, cl, http.MethodGet, state.URL+"/api/users/current", withBearer(accessToken), nil,
+		http.StatusOK, "success", nil)
+	openLink(second, true, http.StatusBadRequest, "Login link is invalid or has expired")
+
+	// Users can turn magic links off, which stops links already sent.
+	doRequest(t, ctx, cl, http.MethodPost, requestURL, nil, map[string]string{"email": "reptile@netherrealm.com"},
+		http.StatusOK, "If the account exists a login link has been sent", nil)
+	third := receiveToken(t, tokens, magicLinkRe)
+	profile := new(ProfileControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPatch, state.URL+"/api/users/current", withBearer(accessToken),
+		map[string]interface{}{"settings": map[string]bool{"magicLinkEnabled": false}}, http.StatusOK,
+		"Profile has been updated", profile)
+	assert.False(t, profile.User.Settings.MagicLinkEnabled)
+	openLink(third, true, http.StatusForbidden, "Login links are turned off for this account")
+
+	doRequest(t, ctx, cl, http.MethodPost, requestURL, nil, map[string]string{"email": "reptile@netherrealm.com"},
+		http.StatusOK, "If the account exists a login link has been sent", nil)
+	assert.Never(t, func() bool {
+		return len(dl.MagicLinks) > 3
+	}, 200*time.Millisecond, 10*time.Millisecond)
+
+	// Links are not sent to users who have not confirmed their address.
+	_, err := dl.CreateUser("kitana@edenia.com", "hash", datalayer.UserRoleUser)
+	require.NoError(t, err)
+	doRequest(t, ctx, cl, http.MethodPost, requestURL, nil, map[string]string{"email": "kitana@edenia.com"},
+		http.StatusOK, "If the account exists a login link has been sent", nil)
+	assert.Never(t, func() bool {
+		return len(dl.MagicLinks) > 3
+	}, 200*time.Millisecond, 10*time.Millisecond)
+
+	// Passwords still work.
+	login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest:   models.User{Email: "reptile@netherrealm.com", Password: "secret"},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp:  AuthResponse{Message: "Logged In", Status: true},
+	})
+}
@@ -0,0 +1,306 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/gorilla/mux"
+)
+
+// OAuthClients lists the caller's OAuth clients on GET and registers a new one
+// on POST.
+func OAuthClients(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
+	w.Header().Set("X-XSS-Protection", "1; mode=block")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	switch r.Method {
+	case http.MethodGet:
+		return getOAuthClients(w, r, state)
+	case http.MethodPost:
+		return createOAuthClient(w, r, state)
+	}
+
+	return nil
+}
+
+func getOAuthClients(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	userID := auth.PrincipalFromContext(r.Context()).UserID
+
+	client := models.NewOAuthClient(state)
+	data, err := client.GetOAuthClients(userID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("clients", data)
+	resp.Respond(w)
+
+	return nil
+}
+
+func createOAuthClient(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	userID := auth.PrincipalFromContext(r.Context()).UserID
+
+	client := models.NewOAuthClient(state)
+	err := json.NewDecoder(r.Body).Decode(client)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	client.UserID = userID
+	data, err := client.Create()
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "OAuth client has been created")
+	resp.Set("client", data)
+	resp.Respond(w)
+
+	return nil
+}
+
+func DeleteOAuthClient(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
+	w.Header().Set("X-XSS-Protection", "1; mode=block")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	userID := auth.PrincipalFromContext(r.Context()).UserID
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		err := e.NewError("Invalid OAuth client ID", []types.ErrorField{
+			{Name: "id", Message: "OAuth client ID must be a number"},
+		}, http.StatusBadRequest)
+		e.WriteError(w, err)
+		return err
+	}
+
+	client := models.NewOAuthClient(state)
+	err = client.Delete(id, userID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "OAuth client has been deleted")
+	resp.Respond(w)
+
+	return nil
+}
+
+// OAuthAuthorize backs the consent screen.  GET takes the authorization
+// request parameters from the query string and describes what is being asked
+// for; POST takes the same parameters with the user's decision and returns
+// the URI to send the user back to the client with.
+func OAuthAuthorize(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
+	w.Header().Set("X-XSS-Protection", "1; mode=block")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	switch r.Method {
+	case http.MethodGet:
+		return getOAuthConsent(w, r, state)
+	case http.MethodPost:
+		return decideOAuthConsent(w, r, state)
+	}
+
+	return nil
+}
+
+func getOAuthConsent(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	query := r.URL.Query()
+	authorization := models.NewOAuthAuthorization(state)
+	authorization.ResponseType = query.Get("response_type")
+	authorization.ClientID = query.Get("client_id")
+	authorization.RedirectURI = query.Get("redirect_uri")
+	authorization.Scope = query.Get("scope")
+	authorization.State = query.Get("state")
+	authorization.CodeChallenge = query.Get("code_challenge")
+	authorization.CodeChallengeMethod = query.Get("code_challenge_method")
+	authorization.UserID = auth.PrincipalFromContext(r.Context()).UserID
+
+	data, err := authorization.Consent()
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("consent", data)
+	resp.Respond(w)
+
+	return nil
+}
+
+func decideOAuthConsent(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	authorization := models.NewOAuthAuthorization(state)
+	err := json.NewDecoder(r.Body).Decode(authorization)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	authorization.UserID = auth.PrincipalFromContext(r.Context()).UserID
+	redirectURI, err := authorization.Decide()
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	message := "Access has been granted"
+	if !authorization.Approve {
+		message = "Access has been denied"
+	}
+	resp := response.New(true, message)
+	resp.Set("redirectURI", redirectURI)
+	resp.Respond(w)
+
+	return nil
+}
+
+// OAuthToken is the token endpoint of RFC 6749.
+func OAuthToken(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	req, err := oauthTokenRequest(r, state)
+	if err != nil {
+		writeOAuthError(w, err)
+		return err
+	}
+
+	data, err := req.Grant()
+	if err != nil {
+		writeOAuthError(w, err)
+		return err
+	}
+
+	return writeOAuthResponse(w, data)
+}
+
+// OAuthIntrospect is the token introspection endpoint of RFC 7662.
+func OAuthIntrospect(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	req, err := oauthTokenRequest(r, state)
+	if err != nil {
+		writeOAuthError(w, err)
+		return err
+	}
+
+	data, err := req.Introspect()
+	if err != nil {
+		writeOAuthError(w, err)
+		return err
+	}
+
+	return writeOAuthResponse(w, data)
+}
+
+// OAuthRevoke is the token revocation endpoint of RFC 7009.
+func OAuthRevoke(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	req, err := oauthTokenRequest(r, state)
+	if err != nil {
+		writeOAuthError(w, err)
+		return err
+	}
+
+	err = req.Revoke()
+	if err != nil {
+		writeOAuthError(w, err)
+		return err
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	return nil
+}
+
+// oauthTokenRequest reads the form parameters and client credentials, which
+// are taken from HTTP basic authentication or else from the form.
+func oauthTokenRequest(r *http.Request, state *state.ServerState) (*models.OAuthTokenRequest, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return nil, auth.NewOAuthError(auth.OAuthErrInvalidRequest, "Request body must be form encoded")
+	}
+
+	req := models.NewOAuthTokenRequest(state)
+	req.GrantType = r.PostForm.Get("grant_type")
+	req.Code = r.PostForm.Get("code")
+	req.RedirectURI = r.PostForm.Get("redirect_uri")
+	req.CodeVerifier = r.PostForm.Get("code_verifier")
+	req.RefreshToken = r.PostForm.Get("refresh_token")
+	req.Scope = r.PostForm.Get("scope")
+	req.Token = r.PostForm.Get("token")
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		// Credentials are form encoded before being put in the header.
+		req.ClientID, err = url.QueryUnescape(clientID)
+		if err != nil {
+			return nil, auth.NewOAuthError(auth.OAuthErrInvalidClient, "Client authentication failed")
+		}
+		req.ClientSecret, err = url.QueryUnescape(clientSecret)
+		if err != nil {
+			return nil, auth.NewOAuthError(auth.OAuthErrInvalidClient, "Client authentication failed")
+		}
+	} else {
+		req.ClientID = r.PostForm.Get("client_id")
+		req.ClientSecret = r.PostForm.Get("client_secret")
+	}
+
+	return req, nil
+}
+
+func writeOAuthResponse(w http.ResponseWriter, v interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	return json.NewEncoder(w).Encode(v)
+}
+
+func writeOAuthError(w http.ResponseWriter, err error) {
+	oauthErr, ok := err.(*auth.OAuthError)
+	if !ok {
+		oauthErr = auth.WrapOAuthError("Internal server error", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	if oauthErr.StatusCode == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	w.WriteHeader(oauthErr.StatusCode)
+	json.NewEncoder(w).Encode(oauthErr)
+}
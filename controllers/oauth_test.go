@@ -0,0 +1,380 @@
+package controllers_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/datalayer/mockdatalayer"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/provider/oidc"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type OAuthControllerResponse struct {
+	Message     string               `json:"message"`
+	Status      bool                 `json:"status"`
+	Fields      []types.ErrorField   `json:"fields"`
+	Client      models.OAuthClient   `json:"client"`
+	Clients     []models.OAuthClient `json:"clients"`
+	Consent     models.OAuthConsent  `json:"consent"`
+	RedirectURI string               `json:"redirectURI"`
+}
+
+type OAuthTokenResponse struct {
+	models.OAuthTokenResponse
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// postOAuthForm calls the token, introspection or revocation endpoint with
+// the client credentials in a basic authorization header.
+func postOAuthForm(t *testing.T, ctx context.Context, cl *http.Client, url, clientID, clientSecret string,
+	form url.Values, expHTTPStatus int, resp interface{}) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(form.Encode()))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(clientID, clientSecret)
+
+	res, err := cl.Do(req)
+	require.NoError(t, err)
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, expHTTPStatus, res.StatusCode, string(body))
+	if resp != nil {
+		err = json.Unmarshal(body, resp)
+		require.NoError(t, err, string(body))
+	}
+}
+
+func registerOAuthClient(t *testing.T, ctx context.Context, cl *http.Client, url, accessToken string,
+	public bool, scopes ...string) models.OAuthClient {
+	gotResp := new(OAuthControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, url+"/api/oauth/clients", withBearer(accessToken), map[string]interface{}{
+		"name":         "Budget app",
+		"redirectURIs": []string{"https://budget.example.com/callback"},
+		"scopes":       scopes,
+		"public":       public,
+	}, http.StatusOK, "OAuth client has been created", gotResp)
+	require.True(t, strings.HasPrefix(gotResp.Client.ClientID, "gwc_"))
+
+	return gotResp.Client
+}
+
+func TestOAuthAuthorizationCode(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+
+	session := login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest: models.User{
+			Email:    "subzero@dreamrealm.com",
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	})
+	accessToken := session.Token.AccessToken
+
+	// Invalid registrations are rejected with field errors.
+	gotResp := new(OAuthControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/oauth/clients", withBearer(accessToken), map[string]interface{}{
+		"name":         "Budget app",
+		"redirectURIs": []string{"http://budget.example.com/callback"},
+		"scopes":       []string{"transactions:delete"},
+	}, http.StatusBadRequest, "Invalid OAuth client request", gotResp)
+	assert.Equal(t, []types.ErrorField{
+		{Name: "redirectURIs", Message: "Redirect URI http://budget.example.com/callback must be an absolute https or loopback http URI"},
+		{Name: "scopes", Message: "Unknown scope transactions:delete"},
+	}, gotResp.Fields)
+
+	client := registerOAuthClient(t, ctx, cl, state.URL, accessToken, false, "transactions:read", "profile:read")
+	require.True(t, strings.HasPrefix(client.ClientSecret, "gwcs_"))
+	assert.False(t, client.Public)
+
+	gotResp = new(OAuthControllerResponse)
+	doRequest(t, ctx, cl, http.MethodGet, state.URL+"/api/oauth/clients", withBearer(accessToken), nil, http.StatusOK,
+		"", gotResp)
+	require.Len(t, gotResp.Clients, 1)
+	assert.Equal(t, client.ClientID, gotResp.Clients[0].ClientID)
+	assert.Empty(t, gotResp.Clients[0].ClientSecret)
+
+	verifier := strings.Repeat("v", 43)
+	authorization := map[string]interface{}{
+		"response_type":         "code",
+		"client_id":             client.ClientID,
+		"redirect_uri":          "https://budget.example.com/callback",
+		"scope":                 "transactions:read",
+		"state":                 "xyz",
+		"code_challenge":        oidc.CodeChallenge(verifier),
+		"code_challenge_method": "S256",
+	}
+	query := url.Values{}
+	for k, v := range authorization {
+		query.Set(k, v.(string))
+	}
+
+	// The consent screen refuses unregistered redirect URIs.
+	badQuery := url.Values{}
+	for k, v := range query {
+		badQuery[k] = v
+	}
+	badQuery.Set("redirect_uri", "https://evil.example.com/callback")
+	gotResp = new(OAuthControllerResponse)
+	doRequest(t, ctx, cl, http.MethodGet, state.URL+"/api/oauth/authorize?"+badQuery.Encode(), withBearer(accessToken),
+		nil, http.StatusBadRequest, "", gotResp)
+	assert.Equal(t, []types.ErrorField{
+		{Name: "redirect_uri", Message: "Redirect URI is not registered for this client"},
+	}, gotResp.Fields)
+
+	gotResp = new(OAuthControllerResponse)
+	doRequest(t, ctx, cl, http.MethodGet, state.URL+"/api/oauth/authorize?"+query.Encode(), withBearer(accessToken),
+		nil, http.StatusOK, "", gotResp)
+	assert.Equal(t, models.OAuthConsent{
+		ClientID:    client.ClientID,
+		ClientName:  "Budget app",
+		RedirectURI: "https://budget.example.com/callback",
+		Scopes:      []string{"transactions:read"},
+	}, gotResp.Consent)
+
+	gotResp = new(OAuthControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/oauth/authorize", withBearer(accessToken),
+		authorization, http.StatusOK, "Access has been denied", gotResp)
+	assert.Equal(t, "https://budget.example.com/callback?error=access_denied&state=xyz", gotResp.RedirectURI)
+
+	authorization["approve"] = true
+	gotResp = new(OAuthControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/oauth/authorize", withBearer(accessToken),
+		authorization, http.StatusOK, "Access has been granted", gotResp)
+	redirectURI, err := url.Parse(gotResp.RedirectURI)
+	require.NoError(t, err)
+	assert.Equal(t, "xyz", redirectURI.Query().Get("state"))
+	code := redirectURI.Query().Get("code")
+	require.NotEmpty(t, code)
+
+	tokenURL := state.URL + "/api/oauth/token"
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {"https://budget.example.com/callback"},
+		"code_verifier": {strings.Repeat("w", 43)},
+	}
+
+	gotToken := new(OAuthTokenResponse)
+	postOAuthForm(t, ctx, cl, tokenURL, client.ClientID, "wrong", exchange, http.StatusUnauthorized, gotToken)
+	assert.Equal(t, "invalid_client", gotToken.Error)
+
+	gotToken = new(OAuthTokenResponse)
+	postOAuthForm(t, ctx, cl, tokenURL, client.ClientID, client.ClientSecret, exchange, http.StatusBadRequest, gotToken)
+	assert.Equal(t, "invalid_grant", gotToken.Error)
+	assert.Equal(t, "PKCE code verifier does not match the code challenge", gotToken.ErrorDescription)
+
+	exchange.Set("code_verifier", verifier)
+	gotToken = new(OAuthTokenResponse)
+	postOAuthForm(t, ctx, cl, tokenURL, client.ClientID, client.ClientSecret, exchange, http.StatusOK, gotToken)
+	require.True(t, strings.HasPrefix(gotToken.AccessToken, "gwoat_"))
+	require.True(t, strings.HasPrefix(gotToken.RefreshToken, "gwort_"))
+	assert.Equal(t, "Bearer", gotToken.TokenType)
+	assert.Equal(t, int64(3600), gotToken.ExpiresIn)
+	assert.Equal(t, "transactions:read", gotToken.Scope)
+	tokens := gotToken.OAuthTokenResponse
+
+	// Codes can only be redeemed once.
+	gotToken = new(OAuthTokenResponse)
+	postOAuthForm(t, ctx, cl, tokenURL, client.ClientID, client.ClientSecret, exchange, http.StatusBadRequest, gotToken)
+	assert.Equal(t, "invalid_grant", gotToken.Error)
+
+	// The token reaches only what its scopes allow.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, state.URL+"/api/me/card-transactions", nil)
+	require.NoError(t, err)
+	req.Header.Add("Authorization", "Bearer "+tokens.AccessToken)
+	res, err := cl.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	doRequest(t, ctx, cl, http.MethodGet, state.URL+"/api/users/current", withBearer(tokens.AccessToken), nil,
+		http.StatusForbidden, "Token is missing a required scope", nil)
+	doRequest(t, ctx, cl, http.MethodGet, state.URL+"/api/oauth/clients", withBearer(tokens.AccessToken), nil,
+		http.StatusForbidden, "Token is not permitted to access this resource", nil)
+
+	introspectURL := state.URL + "/api/oauth/introspect"
+	gotIntrospection := new(models.OAuthIntrospection)
+	postOAuthForm(t, ctx, cl, introspectURL, client.ClientID, client.ClientSecret,
+		url.Values{"token": {tokens.AccessToken}}, http.StatusOK, gotIntrospection)
+	assert.True(t, gotIntrospection.Active)
+	assert.Equal(t, "transactions:read", gotIntrospection.Scope)
+	assert.Equal(t, client.ClientID, gotIntrospection.ClientID)
+	assert.Equal(t, "1", gotIntrospection.Subject)
+	assert.Equal(t, "Bearer", gotIntrospection.TokenType)
+
+	gotIntrospection = new(models.OAuthIntrospection)
+	postOAuthForm(t, ctx, cl, introspectURL, client.ClientID, client.ClientSecret,
+		url.Values{"token": {"gwoat_unknown"}}, http.StatusOK, gotIntrospection)
+	assert.Equal(t, models.OAuthIntrospection{Active: false}, *gotIntrospection)
+
+	// Refreshing rotates both tokens.
+	refresh := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken}}
+	gotToken = new(OAuthTokenResponse)
+	postOAuthForm(t, ctx, cl, tokenURL, client.ClientID, client.ClientSecret, refresh, http.StatusOK, gotToken)
+	require.NotEmpty(t, gotToken.AccessToken)
+	assert.NotEqual(t, tokens.RefreshToken, gotToken.RefreshToken)
+	assert.Equal(t, "transactions:read", gotToken.Scope)
+	refreshed := gotToken.OAuthTokenResponse
+
+	gotToken = new(OAuthTokenResponse)
+	postOAuthForm(t, ctx, cl, tokenURL, client.ClientID, client.ClientSecret, refresh, http.StatusBadRequest, gotToken)
+	assert.Equal(t, "invalid_grant", gotToken.Error)
+
+	doRequest(t, ctx, cl, http.MethodGet, state.URL+"/api/me/card-transactions", withBearer(tokens.AccessToken), nil,
+		http.StatusForbidden, "OAuth token is invalid or has expired", nil)
+
+	// Revoking the refresh token ends the grant.
+	revokeURL := state.URL + "/api/oauth/revoke"
+	postOAuthForm(t, ctx, cl, revokeURL, client.ClientID, client.ClientSecret,
+		url.Values{"token": {refreshed.RefreshToken}}, http.StatusOK, nil)
+	postOAuthForm(t, ctx, cl, revokeURL, client.ClientID, client.ClientSecret,
+		url.Values{"token": {"gwort_unknown"}}, http.StatusOK, nil)
+
+	doRequest(t, ctx, cl, http.MethodGet, state.URL+"/api/me/card-transactions", withBearer(refreshed.AccessToken), nil,
+		http.StatusForbidden, "OAuth token is invalid or has expired", nil)
+
+	gotIntrospection = new(models.OAuthIntrospection)
+	postOAuthForm(t, ctx, cl, introspectURL, client.ClientID, client.ClientSecret,
+		url.Values{"token": {refreshed.AccessToken}}, http.StatusOK, gotIntrospection)
+	assert.False(t, gotIntrospection.Active)
+}
+
+func TestOAuthClientCredentials(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+
+	session := login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest: models.User{
+			Email:    "subzero@dreamrealm.com",
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	})
+	accessToken := session.Token.AccessToken
+	tokenURL := state.URL + "/api/oauth/token"
+
+	client := registerOAuthClient(t, ctx, cl, state.URL, accessToken, false, "transactions:read")
+
+	gotToken := new(OAuthTokenResponse)
+	postOAuthForm(t, ctx, cl, tokenURL, client.ClientID, client.ClientSecret,
+		url.Values{"grant_type": {"client_credentials"}, "scope": {"transactions:write"}}, http.StatusBadRequest, gotToken)
+	assert.Equal(t, "invalid_scope", gotToken.Error)
+
+	gotToken = new(OAuthTokenResponse)
+	postOAuthForm(t, ctx, cl, tokenURL, client.ClientID, client.ClientSecret,
+		url.Values{"grant_type": {"client_credentials"}}, http.StatusOK, gotToken)
+	require.NotEmpty(t, gotToken.AccessToken)
+	assert.Empty(t, gotToken.RefreshToken)
+	assert.Equal(t, "transactions:read", gotToken.Scope)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, state.URL+"/api/me/card-transactions", nil)
+	require.NoError(t, err)
+	req.Header.Add("Authorization", "Bearer "+gotToken.AccessToken)
+	res, err := cl.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	// Public clients have no secret to authenticate with.
+	public := registerOAuthClient(t, ctx, cl, state.URL, accessToken, true, "transactions:read")
+	assert.Empty(t, public.ClientSecret)
+	assert.True(t, public.Public)
+	publicToken := new(OAuthTokenResponse)
+	postOAuthForm(t, ctx, cl, tokenURL, public.ClientID, "",
+		url.Values{"grant_type": {"client_credentials"}}, http.StatusBadRequest, publicToken)
+	assert.Equal(t, "unauthorized_client", publicToken.Error)
+
+	// Deleting a client revokes its tokens.
+	deleteURL := fmt.Sprintf("%s/api/oauth/clients/%d", state.URL, client.ID)
+	doRequest(t, ctx, cl, http.MethodDelete, deleteURL, withBearer(accessToken), nil, http.StatusOK,
+		"OAuth client has been deleted", nil)
+	doRequest(t, ctx, cl, http.MethodDelete, deleteURL, withBearer(accessToken), nil, http.StatusNotFound,
+		"OAuth client not found", nil)
+
+	doRequest(t, ctx, cl, http.MethodGet, state.URL+"/api/me/card-transactions", withBearer(gotToken.AccessToken), nil,
+		http.StatusForbidden, "OAuth token is invalid or has expired", nil)
+}
+
+func TestOAuthIntrospectUserState(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+	dl := state.DataLayer.(*mockdatalayer.MockDataLayer)
+
+	session := login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest: models.User{
+			Email:    "subzero@dreamrealm.com",
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	})
+	client := registerOAuthClient(t, ctx, cl, state.URL, session.Token.AccessToken, false, "transactions:read")
+
+	issue := func() string {
+		gotToken := new(OAuthTokenResponse)
+		postOAuthForm(t, ctx, cl, state.URL+"/api/oauth/token", client.ClientID, client.ClientSecret,
+			url.Values{"grant_type": {"client_credentials"}}, http.StatusOK, gotToken)
+		require.NotEmpty(t, gotToken.AccessToken)
+		return gotToken.AccessToken
+	}
+	introspect := func(token string) bool {
+		gotIntrospection := new(models.OAuthIntrospection)
+		postOAuthForm(t, ctx, cl, state.URL+"/api/oauth/introspect", client.ClientID, client.ClientSecret,
+			url.Values{"token": {token}}, http.StatusOK, gotIntrospection)
+		return gotIntrospection.Active
+	}
+
+	token := issue()
+	assert.True(t, introspect(token))
+
+	// Logging out everywhere ends tokens issued before it.
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/logout-all", withBearer(session.Token.AccessToken),
+		nil, http.StatusOK, "", nil)
+	assert.False(t, introspect(token))
+	token = issue()
+	assert.True(t, introspect(token))
+
+	// Disabled users have no active tokens.
+	user, err := dl.GetUserByID(1)
+	require.NoError(t, err)
+	user.DisabledAt = datalayer.JsonNullTime{NullTime: sql.NullTime{Time: time.Now(), Valid: true}}
+	assert.False(t, introspect(token))
+
+	// Nor do deleted users.
+	user.DisabledAt = datalayer.JsonNullTime{}
+	assert.True(t, introspect(token))
+	user.DeletedAt = datalayer.JsonNullTime{NullTime: sql.NullTime{Time: time.Now(), Valid: true}}
+	assert.False(t, introspect(token))
+}
@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/gorilla/mux"
+)
+
+const oidcStateCookie = "oidc_state"
+
+// OIDCStart redirects the browser to the identity provider.
+func OIDCStart(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
+	w.Header().Set("X-XSS-Protection", "1; mode=block")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	login := models.NewOIDCLogin(state)
+	login.Provider = mux.Vars(r)["provider"]
+	redirectURL, err := login.Start(r.Context())
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	http.SetCookie(w, oidcCookie(state, login.Provider, login.State, int(models.OIDCLoginLifeSpan.Seconds())))
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+
+	return nil
+}
+
+// OIDCLink starts linking an identity provider to the signed in user,
+// returning the provider URL for the browser to visit.
+func OIDCLink(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
+	w.Header().Set("X-XSS-Protection", "1; mode=block")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	login := models.NewOIDCLogin(state)
+	login.Provider = mux.Vars(r)["provider"]
+	login.UserID = auth.PrincipalFromContext(r.Context()).UserID
+	redirectURL, err := login.Start(r.Context())
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	http.SetCookie(w, oidcCookie(state, login.Provider, login.State, int(models.OIDCLoginLifeSpan.Seconds())))
+	resp := response.New(true, "Identity provider link started")
+	resp["redirectURL"] = redirectURL
+	resp.Respond(w)
+
+	return nil
+}
+
+// OIDCCallback completes the login when the identity provider redirects
+// back, responding like Authenticate, or completes a link started by OIDCLink.
+func OIDCCallback(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
+	w.Header().Set("X-XSS-Protection", "1; mode=block")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	login := models.NewOIDCLogin(state)
+	login.Provider = mux.Vars(r)["provider"]
+	http.SetCookie(w, oidcCookie(state, login.Provider, "", -1))
+
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); len(providerErr) > 0 {
+		err := e.NewError("Identity provider denied the login: "+providerErr, nil, http.StatusForbidden)
+		e.WriteError(w, err)
+		return err
+	}
+
+	login.State = query.Get("state")
+	login.Code = query.Get("code")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err == nil {
+		login.BrowserState = cookie.Value
+	}
+
+	login.Client = clientInfo(r)
+	data, challenge, err := login.Callback(r.Context())
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	if login.UserID != 0 {
+		resp := response.New(true, "Identity provider linked")
+		resp.Respond(w)
+		return nil
+	}
+
+	if challenge != nil {
+		resp := response.New(true, "Two-factor authentication required")
+		resp["challenge"] = challenge
+		resp.Respond(w)
+		return nil
+	}
+
+	resp := response.New(true, "Logged In")
+	resp["token"] = data
+	resp.Respond(w)
+
+	return nil
+}
+
+func oidcCookie(state *state.ServerState, provider, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/api/auth/oidc/" + provider,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(state.URL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -0,0 +1,352 @@
+package controllers_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/provider/oidc"
+	"github.com/donohutcheon/gowebserver/router/auth/keys"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	fakeClientID     = "gowebserver"
+	fakeClientSecret = "fake-secret"
+)
+
+type fakeGrant struct {
+	codeChallenge string
+	nonce         string
+	subject       string
+	email         string
+	emailVerified bool
+}
+
+// fakeIssuer is a minimal OpenID Connect provider serving discovery, keys
+// and the token endpoint.
+type fakeIssuer struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	mutex  sync.Mutex
+	grants map[string]fakeGrant
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	f := &fakeIssuer{key: key, grants: make(map[string]fakeGrant)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 f.URL,
+			"authorization_endpoint": f.URL + "/authorize",
+			"token_endpoint":         f.URL + "/token",
+			"jwks_uri":               f.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(keys.JSONWebKeySet{Keys: []keys.JSONWebKey{{
+			KeyType:   "RSA",
+			KeyID:     "fake-key",
+			Use:       "sig",
+			Algorithm: "RS256",
+			N:         base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", f.token)
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+func (f *fakeIssuer) grant(code string, grant fakeGrant) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.grants[code] = grant
+}
+
+func (f *fakeIssuer) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok || clientID != fakeClientID || clientSecret != fakeClientSecret {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	f.mutex.Lock()
+	grant, ok := f.grants[r.PostFormValue("code")]
+	delete(f.grants, r.PostFormValue("code"))
+	f.mutex.Unlock()
+	if !ok || oidc.CodeChallenge(r.PostFormValue("code_verifier")) != grant.codeChallenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            f.URL,
+		"sub":            grant.subject,
+		"aud":            fakeClientID,
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          grant.nonce,
+		"email":          grant.email,
+		"email_verified": grant.emailVerified,
+	})
+	token.Header["kid"] = "fake-key"
+	idToken, err := token.SignedString(f.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "fake-access-token",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+// startOIDCLogin begins a login and returns the redirect parameters sent to
+// the provider.
+func startOIDCLogin(t *testing.T, ctx context.Context, cl *http.Client, url, provider string) url.Values {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/api/auth/oidc/"+provider+"/start", nil)
+	require.NoError(t, err)
+	res, err := cl.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusFound, res.StatusCode)
+
+	location, err := res.Location()
+	require.NoError(t, err)
+	params := location.Query()
+	assert.Equal(t, "S256", params.Get("code_challenge_method"))
+
+	var cookie *http.Cookie
+	for _, c := range res.Cookies() {
+		if c.Name == "oidc_state" {
+			cookie = c
+		}
+	}
+	require.NotNil(t, cookie)
+	assert.Equal(t, params.Get("state"), cookie.Value)
+	assert.True(t, cookie.HttpOnly)
+
+	return params
+}
+
+// startOIDCLink begins linking the provider to the signed in user and returns
+// the redirect parameters sent to the provider and the state cookie.
+func startOIDCLink(t *testing.T, ctx context.Context, cl *http.Client, url, provider, token string) (url.Values, string) {
+	resp := new(struct {
+		RedirectURL string `json:"redirectURL"`
+	})
+	res, _ := doRequest(t, ctx, cl, http.MethodPost, url+"/api/auth/oidc/"+provider+"/link", withBearer(token), nil,
+		http.StatusOK, "Identity provider link started", resp)
+
+	location, err := res.Request.URL.Parse(resp.RedirectURL)
+	require.NoError(t, err)
+
+	var cookie string
+	for _, c := range res.Cookies() {
+		if c.Name == "oidc_state" {
+			cookie = c.Value
+		}
+	}
+	require.NotEmpty(t, cookie)
+
+	return location.Query(), cookie
+}
+
+func oidcCallback(t *testing.T, ctx context.Context, cl *http.Client, url, provider string, query url.Values,
+	cookie string, expHTTPStatus int, expMessage string) *AuthResponse {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		url+"/api/auth/oidc/"+provider+"/callback?"+query.Encode(), nil)
+	require.NoError(t, err)
+	if len(cookie) > 0 {
+		req.AddCookie(&http.Cookie{Name: "oidc_state", Value: cookie})
+	}
+	res, err := cl.Do(req)
+	require.NoError(t, err)
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	gotResp := new(AuthResponse)
+	err = json.Unmarshal(body, gotResp)
+	require.NoError(t, err)
+
+	assert.Equal(t, expHTTPStatus, res.StatusCode, string(body))
+	assert.Equal(t, expMessage, gotResp.Message)
+
+	return gotResp
+}
+
+func TestOIDCLogin(t *testing.T) {
+	cl := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	issuer := newFakeIssuer(t)
+	state := facotory.NewForTesting(t, state.NewMockCallbacks(nil))
+	state.Providers.OIDC["fake"] = oidc.New(oidc.Config{
+		Name:         "fake",
+		Issuer:       issuer.URL,
+		ClientID:     fakeClientID,
+		ClientSecret: fakeClientSecret,
+		RedirectURL:  state.URL + "/api/auth/oidc/fake/callback",
+	})
+	ctx := state.Context
+	dl := state.DataLayer
+
+	providerLogin := func(code string, grant fakeGrant) (url.Values, url.Values) {
+		params := startOIDCLogin(t, ctx, cl, state.URL, "fake")
+		grant.codeChallenge = params.Get("code_challenge")
+		grant.nonce = params.Get("nonce")
+		issuer.grant(code, grant)
+		return params, url.Values{"code": {code}, "state": {params.Get("state")}}
+	}
+
+	t.Run("New user", func(t *testing.T) {
+		params, query := providerLogin("code-1", fakeGrant{subject: "sub-1", email: "kitana@edenia.com", emailVerified: true})
+		resp := oidcCallback(t, ctx, cl, state.URL, "fake", query, params.Get("state"), http.StatusOK, "Logged In")
+		assert.NotEmpty(t, resp.Token.AccessToken)
+
+		user, err := dl.GetUserByEmail("kitana@edenia.com")
+		require.NoError(t, err)
+		assert.Equal(t, string(datalayer.UserStateConfirmed), user.State.String)
+		identity, err := dl.GetIdentity("fake", "sub-1")
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, identity.UserID)
+
+		// A replayed callback is rejected.
+		oidcCallback(t, ctx, cl, state.URL, "fake", query, params.Get("state"),
+			http.StatusBadRequest, "Login request is invalid or has expired")
+
+		// Later logins use the linked identity even if the email changes.
+		params, query = providerLogin("code-2", fakeGrant{subject: "sub-1", email: "kitana@outworld.com"})
+		oidcCallback(t, ctx, cl, state.URL, "fake", query, params.Get("state"), http.StatusOK, "Logged In")
+		_, err = dl.GetUserByEmail("kitana@outworld.com")
+		assert.Equal(t, datalayer.ErrNoData, err)
+	})
+
+	t.Run("Existing user not linked by email", func(t *testing.T) {
+		params, query := providerLogin("code-3", fakeGrant{subject: "sub-3", email: "subzero@dreamrealm.com", emailVerified: true})
+		oidcCallback(t, ctx, cl, state.URL, "fake", query, params.Get("state"), http.StatusConflict,
+			"An account with this email address already exists, log in and link the identity provider from your account")
+
+		_, err := dl.GetIdentity("fake", "sub-3")
+		assert.Equal(t, datalayer.ErrNoData, err)
+
+		// An account registered by someone else is not confirmed either.
+		userID, err := dl.CreateUser("liukang@shaolin.com", "password", datalayer.UserRoleUser)
+		require.NoError(t, err)
+		params, query = providerLogin("code-6", fakeGrant{subject: "sub-6", email: "liukang@shaolin.com", emailVerified: true})
+		oidcCallback(t, ctx, cl, state.URL, "fake", query, params.Get("state"), http.StatusConflict,
+			"An account with this email address already exists, log in and link the identity provider from your account")
+
+		user, err := dl.GetUserByID(userID)
+		require.NoError(t, err)
+		assert.Equal(t, string(datalayer.UserStateUnconfirmed), user.State.String)
+		_, err = dl.GetIdentity("fake", "sub-6")
+		assert.Equal(t, datalayer.ErrNoData, err)
+	})
+
+	t.Run("Link from signed in account", func(t *testing.T) {
+		loginAs := func(email string) string {
+			return login(t, ctx, cl, state.URL, AuthParameters{
+				authRequest:   models.User{Email: email, Password: "secret"},
+				expHTTPStatus: http.StatusOK,
+				expLoginResp:  AuthResponse{Message: "Logged In", Status: true},
+			}).Token.AccessToken
+		}
+
+		params, cookie := startOIDCLink(t, ctx, cl, state.URL, "fake", loginAs("subzero@dreamrealm.com"))
+		issuer.grant("code-7", fakeGrant{
+			codeChallenge: params.Get("code_challenge"),
+			nonce:         params.Get("nonce"),
+			subject:       "sub-3",
+			email:         "subzero@linrealm.com",
+		})
+		query := url.Values{"code": {"code-7"}, "state": {params.Get("state")}}
+		resp := oidcCallback(t, ctx, cl, state.URL, "fake", query, cookie, http.StatusOK, "Identity provider linked")
+		assert.Empty(t, resp.Token.AccessToken)
+
+		identity, err := dl.GetIdentity("fake", "sub-3")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), identity.UserID)
+
+		// The linked identity now logs in to the account.
+		params, query = providerLogin("code-8", fakeGrant{subject: "sub-3", email: "subzero@linrealm.com"})
+		resp = oidcCallback(t, ctx, cl, state.URL, "fake", query, params.Get("state"), http.StatusOK, "Logged In")
+		assert.NotEmpty(t, resp.Token.AccessToken)
+
+		// An identity linked to one account cannot be linked to another.
+		params, cookie = startOIDCLink(t, ctx, cl, state.URL, "fake", loginAs("reptile@netherrealm.com"))
+		issuer.grant("code-9", fakeGrant{
+			codeChallenge: params.Get("code_challenge"),
+			nonce:         params.Get("nonce"),
+			subject:       "sub-3",
+		})
+		query = url.Values{"code": {"code-9"}, "state": {params.Get("state")}}
+		oidcCallback(t, ctx, cl, state.URL, "fake", query, cookie, http.StatusConflict,
+			"Identity is already linked to another account")
+
+		// Linking needs a signed in user.
+		doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/oidc/fake/link", nil, nil,
+			http.StatusForbidden, "Missing auth token", nil)
+	})
+
+	t.Run("Unverified email", func(t *testing.T) {
+		params, query := providerLogin("code-4", fakeGrant{subject: "sub-4", email: "reptile@netherrealm.com"})
+		oidcCallback(t, ctx, cl, state.URL, "fake", query, params.Get("state"),
+			http.StatusForbidden, "Email address has not been verified by the identity provider")
+
+		_, err := dl.GetIdentity("fake", "sub-4")
+		assert.Equal(t, datalayer.ErrNoData, err)
+	})
+
+	t.Run("Missing cookie", func(t *testing.T) {
+		_, query := providerLogin("code-5", fakeGrant{subject: "sub-5", email: "jax@earthrealm.com", emailVerified: true})
+		oidcCallback(t, ctx, cl, state.URL, "fake", query, "",
+			http.StatusBadRequest, "Login request is invalid or has expired")
+	})
+
+	t.Run("Invalid code", func(t *testing.T) {
+		params := startOIDCLogin(t, ctx, cl, state.URL, "fake")
+		query := url.Values{"code": {"unknown"}, "state": {params.Get("state")}}
+		oidcCallback(t, ctx, cl, state.URL, "fake", query, params.Get("state"),
+			http.StatusForbidden, "Identity provider login failed")
+	})
+
+	t.Run("Provider error", func(t *testing.T) {
+		query := url.Values{"error": {"access_denied"}}
+		oidcCallback(t, ctx, cl, state.URL, "fake", query, "",
+			http.StatusForbidden, "Identity provider denied the login: access_denied")
+	})
+
+	t.Run("Unknown provider", func(t *testing.T) {
+		oidcCallback(t, ctx, cl, state.URL, "nope", url.Values{}, "",
+			http.StatusNotFound, "Identity provider not found")
+	})
+}
@@ -0,0 +1,101 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/router/auth/passwords"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+	signUpURL := state.URL + "/api/auth/sign-up"
+
+	tests := []struct {
+		name      string
+		email     string
+		password  string
+		expFields []types.ErrorField
+	}{
+		{
+			name:     "Too short",
+			email:    "sindel@edenia.com",
+			password: "kahn",
+			expFields: []types.ErrorField{
+				{Name: "password", Message: "Password must be at least 6 characters long"},
+			},
+		},
+		{
+			name:     "Breached",
+			email:    "sindel@edenia.com",
+			password: "iloveyou",
+			expFields: []types.ErrorField{
+				{Name: "password", Message: "Password has appeared in a data breach, choose another"},
+			},
+		},
+		{
+			name:     "Email local part",
+			email:    "sindel@edenia.com",
+			password: "xSINDELx",
+			expFields: []types.ErrorField{
+				{Name: "password", Message: "Password must not contain your email address"},
+			},
+		},
+		{
+			name:     "Several rules",
+			email:    "jax@outworld.com",
+			password: "Jax",
+			expFields: []types.ErrorField{
+				{Name: "password", Message: "Password must be at least 6 characters long"},
+				{Name: "password", Message: "Password must not contain your email address"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gotResp := new(MessageResponse)
+			doRequest(t, ctx, cl, http.MethodPost, signUpURL, nil,
+				map[string]string{"email": test.email, "password": test.password}, http.StatusBadRequest,
+				"Password does not meet the password policy", gotResp)
+			assert.Equal(t, test.expFields, gotResp.Fields)
+		})
+	}
+
+	// Character classes are enforced when configured.
+	strict, err := passwords.New(passwords.Config{
+		MinLength:     10,
+		RequireLower:  true,
+		RequireUpper:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+		BreachedList:  "../" + passwords.DefaultBreachedList,
+	})
+	require.NoError(t, err)
+	state.PasswordPolicy = strict
+
+	gotResp := new(MessageResponse)
+	doRequest(t, ctx, cl, http.MethodPost, signUpURL, nil,
+		map[string]string{"email": "sindel@edenia.com", "password": "password1"}, http.StatusBadRequest,
+		"Password does not meet the password policy", gotResp)
+	assert.Equal(t, []types.ErrorField{
+		{Name: "password", Message: "Password must be at least 10 characters long"},
+		{Name: "password", Message: "Password must contain an upper case letter"},
+		{Name: "password", Message: "Password must contain a symbol"},
+		{Name: "password", Message: "Password has appeared in a data breach, choose another"},
+	}, gotResp.Fields)
+
+	doRequest(t, ctx, cl, http.MethodPost, signUpURL, nil,
+		map[string]string{"email": "sindel@edenia.com", "password": "Queen-of-Edenia-1"}, http.StatusOK,
+		"User has been created", nil)
+	// The confirmation is followed before the test ends and cancels the context.
+	callbacks.MockMailWG.Wait()
+}
@@ -0,0 +1,152 @@
+package controllers_test
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer/mockdatalayer"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/require"
+)
+
+var resetPasswordRe = regexp.MustCompile(`reset-password\?token=([a-f0-9]+)`)
+
+type MessageResponse struct {
+	Message string             `json:"message"`
+	Status  bool               `json:"status"`
+	Fields  []types.ErrorField `json:"fields"`
+}
+
+func TestPasswordReset(t *testing.T) {
+	cl := new(http.Client)
+	resetCallback, resetTokens := mailRecorder()
+	callbacks := state.NewMockCallbacks(resetCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+
+	oldPassword := AuthParameters{
+		authRequest: models.User{
+			Email:    "subzero@dreamrealm.com",
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	}
+	session := login(t, ctx, cl, state.URL, oldPassword)
+
+	// Unknown accounts get the same answer and no mail.
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/forgot-password", nil,
+		map[string]string{"email": "skeletor@eternia.com"}, http.StatusOK,
+		"If the account exists a password reset link has been sent", nil)
+
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/forgot-password", nil,
+		map[string]string{"email": "subzero@dreamrealm.com"}, http.StatusOK,
+		"If the account exists a password reset link has been sent", nil)
+	token := receiveToken(t, resetTokens, resetPasswordRe)
+
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/reset-password", nil,
+		map[string]string{"token": "bogus", "password": "n3wsecret"}, http.StatusBadRequest,
+		"Password reset link is invalid or has expired", nil)
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/reset-password", nil,
+		map[string]string{"token": token, "password": "short"}, http.StatusBadRequest,
+		"Password does not meet the password policy", nil)
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/reset-password", nil,
+		map[string]string{"token": token, "password": "n3wsecret"}, http.StatusOK, "Password has been reset", nil)
+
+	// The token is single use.
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/reset-password", nil,
+		map[string]string{"token": token, "password": "an0thersecret"}, http.StatusBadRequest,
+		"Password reset link is invalid or has expired", nil)
+
+	// Existing sessions are ended and only the new password works.
+	getCurrentUser(t, ctx, cl, state.URL, session, &GetCurrentUserParameters{
+		expResponse: UserControllerResponse{
+			Message: "Session has been logged out",
+			Status:  false,
+		},
+		expHTTPStatus: http.StatusForbidden,
+	})
+	login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest:   oldPassword.authRequest,
+		expHTTPStatus: http.StatusForbidden,
+		expLoginResp: AuthResponse{
+			Message: "Invalid login credentials",
+			Status:  false,
+		},
+	})
+	login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest: models.User{
+			Email:    "subzero@dreamrealm.com",
+			Password: "n3wsecret",
+		},
+		expHTTPStatus: oldPassword.expHTTPStatus,
+		expLoginResp:  oldPassword.expLoginResp,
+	})
+}
+
+func TestPasswordResetExpired(t *testing.T) {
+	cl := new(http.Client)
+	resetCallback, resetTokens := mailRecorder()
+	callbacks := state.NewMockCallbacks(resetCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/forgot-password", nil,
+		map[string]string{"email": "subzero@dreamrealm.com"}, http.StatusOK,
+		"If the account exists a password reset link has been sent", nil)
+	token := receiveToken(t, resetTokens, resetPasswordRe)
+
+	dl := state.DataLayer.(*mockdatalayer.MockDataLayer)
+	require.Len(t, dl.PasswordResets, 1)
+	dl.PasswordResets[0].ExpiresAt.Time = time.Now().Add(-time.Minute)
+
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/reset-password", nil,
+		map[string]string{"token": token, "password": "n3wsecret"}, http.StatusBadRequest,
+		"Password reset link is invalid or has expired", nil)
+}
+
+func TestPasswordResetResend(t *testing.T) {
+	cl := new(http.Client)
+	resetCallback, resetTokens := mailRecorder()
+	callbacks := state.NewMockCallbacks(resetCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+	// The mock mail client expects a single mail, the resend sends another.
+	callbacks.MockMailWG.Add(1)
+	forgotRequest := map[string]string{"email": "subzero@dreamrealm.com"}
+
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/forgot-password", nil, forgotRequest,
+		http.StatusOK, "If the account exists a password reset link has been sent", nil)
+	firstToken := receiveToken(t, resetTokens, resetPasswordRe)
+
+	// Requesting again is rate limited, answering like an unknown address does.
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/forgot-password", nil, forgotRequest,
+		http.StatusOK, "If the account exists a password reset link has been sent", nil)
+
+	dl := state.DataLayer.(*mockdatalayer.MockDataLayer)
+	user, err := dl.GetUserByEmail("subzero@dreamrealm.com")
+	require.NoError(t, err)
+	require.True(t, user.PasswordResetSentAt.Valid)
+	user.PasswordResetSentAt.Time = time.Now().Add(-models.PasswordResetInterval)
+
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/forgot-password", nil, forgotRequest,
+		http.StatusOK, "If the account exists a password reset link has been sent", nil)
+	secondToken := receiveToken(t, resetTokens, resetPasswordRe)
+	require.NotEqual(t, firstToken, secondToken)
+	require.Len(t, dl.PasswordResets, 2)
+
+	// Sending a new link expires the earlier one.
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/reset-password", nil,
+		map[string]string{"token": firstToken, "password": "n3wsecret"}, http.StatusBadRequest,
+		"Password reset link is invalid or has expired", nil)
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/reset-password", nil,
+		map[string]string{"token": secondToken, "password": "n3wsecret"}, http.StatusOK, "Password has been reset", nil)
+}
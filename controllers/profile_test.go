@@ -0,0 +1,118 @@
+package controllers_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type ProfileControllerResponse struct {
+	Message string             `json:"message"`
+	Status  bool               `json:"status"`
+	Fields  []types.ErrorField `json:"fields"`
+	User    models.User        `json:"user"`
+}
+
+func TestProfile(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+	profileURL := state.URL + "/api/users/current"
+
+	session := login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest: models.User{
+			Email:    "reptile@netherrealm.com",
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	})
+	accessToken := session.Token.AccessToken
+
+	// Users start with an empty profile and the default settings.
+	gotResp := new(ProfileControllerResponse)
+	doRequest(t, ctx, cl, http.MethodGet, profileURL, withBearer(accessToken), nil, http.StatusOK, "success", gotResp)
+	assert.Empty(t, gotResp.User.FirstName)
+	assert.Equal(t, models.DefaultSettings, gotResp.User.Settings)
+
+	gotResp = new(ProfileControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPatch, profileURL, withBearer(accessToken), map[string]interface{}{
+		"firstName": strings.Repeat("x", 256),
+		"age":       -1,
+		"settings": map[string]string{
+			"themeName":    "neon",
+			"currencyCode": "rand",
+			"timezone":     "Outworld/Kahns_Arena",
+			"locale":       "english",
+		},
+	}, http.StatusBadRequest, "Invalid profile update", gotResp)
+	assert.Equal(t, []types.ErrorField{
+		{Name: "firstName", Message: "First name must be at most 255 characters long"},
+		{Name: "age", Message: "Age must be between 0 and 150"},
+		{Name: "settings.themeName", Message: "Theme must be one of default, light, dark"},
+		{Name: "settings.currencyCode", Message: "Currency code must be a three letter ISO 4217 code such as ZAR"},
+		{Name: "settings.timezone", Message: "Timezone must be an IANA time zone such as Africa/Johannesburg"},
+		{Name: "settings.locale", Message: "Locale must be a language tag such as en-ZA"},
+	}, gotResp.Fields)
+
+	gotResp = new(ProfileControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPatch, profileURL, withBearer(accessToken), map[string]interface{}{
+		"firstName": "Syzoth",
+		"surname":   " Zaterran ",
+		"age":       34,
+		"address":   "Zaterra",
+		"settings": map[string]string{
+			"themeName": "dark",
+			"timezone":  "Europe/London",
+		},
+	}, http.StatusOK, "Profile has been updated", gotResp)
+	assert.Equal(t, "Zaterran", gotResp.User.Surname)
+	assert.Empty(t, gotResp.User.Password)
+
+	// Only the fields in the request change.
+	doRequest(t, ctx, cl, http.MethodPatch, profileURL, withBearer(accessToken), map[string]interface{}{
+		"address":  "",
+		"settings": map[string]string{"locale": "en-GB"},
+	}, http.StatusOK, "Profile has been updated", nil)
+
+	gotResp = new(ProfileControllerResponse)
+	doRequest(t, ctx, cl, http.MethodGet, profileURL, withBearer(accessToken), nil, http.StatusOK, "success", gotResp)
+	user := gotResp.User
+	assert.Equal(t, "Syzoth", user.FirstName)
+	assert.Equal(t, "Zaterran", user.Surname)
+	assert.Equal(t, 34, user.Age)
+	assert.Empty(t, user.Address)
+	assert.NotZero(t, user.Settings.ID)
+	assert.Equal(t, "dark", user.Settings.ThemeName)
+	assert.Equal(t, "ZAR", user.Settings.CurrencyCode)
+	assert.Equal(t, "Europe/London", user.Settings.Timezone)
+	assert.Equal(t, "en-GB", user.Settings.Locale)
+
+	// Other users are unaffected.
+	dbUser, err := state.DataLayer.GetUserByEmail("subzero@dreamrealm.com")
+	require.NoError(t, err)
+	assert.False(t, dbUser.FirstName.Valid)
+
+	// API tokens need the profile:write scope.
+	readOnly := createAPIToken(t, ctx, cl, state.URL, accessToken, "Reader", "profile:read")
+	doRequest(t, ctx, cl, http.MethodGet, profileURL, withBearer(readOnly), nil, http.StatusOK, "success", nil)
+	doRequest(t, ctx, cl, http.MethodPatch, profileURL, withBearer(readOnly), map[string]string{"firstName": "Reptile"},
+		http.StatusForbidden, "Token is missing a required scope", nil)
+
+	writer := createAPIToken(t, ctx, cl, state.URL, accessToken, "Writer", "profile:write")
+	gotResp = new(ProfileControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPatch, profileURL, withBearer(writer), map[string]string{"firstName": "Reptile"},
+		http.StatusOK, "Profile has been updated", gotResp)
+	assert.Equal(t, "Reptile", gotResp.User.FirstName)
+}
@@ -0,0 +1,212 @@
+package controllers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type SigningKeyControllerResponse struct {
+	Message     string                     `json:"message"`
+	Status      bool                       `json:"status"`
+	Fields      []types.ErrorField         `json:"fields"`
+	SigningKey  models.RequestSigningKey   `json:"signingKey"`
+	SigningKeys []models.RequestSigningKey `json:"signingKeys"`
+}
+
+type signedRequest struct {
+	method    string
+	path      string
+	body      []byte
+	keyID     string
+	secret    string
+	timestamp time.Time
+	nonce     string
+}
+
+// doSignedRequest signs the request with the secret and sends it, after
+// which tamper can change what is sent.
+func doSignedRequest(t *testing.T, ctx context.Context, cl *http.Client, baseURL string, sr signedRequest,
+	tamper func(req *http.Request), expHTTPStatus int, expMessage string) *CreateCardTransactionControllerResponse {
+	stringToSign := auth.StringToSign(sr.method, sr.path, sr.timestamp, sr.nonce, sr.body)
+	authorization := fmt.Sprintf("%s KeyId=%s, Timestamp=%d, Nonce=%s, Signature=%s", auth.SignatureScheme,
+		sr.keyID, sr.timestamp.Unix(), sr.nonce, auth.SignRequest(sr.secret, stringToSign))
+
+	req, err := http.NewRequestWithContext(ctx, sr.method, baseURL+sr.path, bytes.NewReader(sr.body))
+	require.NoError(t, err)
+	req.Header.Add("Authorization", authorization)
+	if tamper != nil {
+		tamper(req)
+	}
+
+	res, err := cl.Do(req)
+	require.NoError(t, err)
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	gotResp := new(CreateCardTransactionControllerResponse)
+	err = json.Unmarshal(body, gotResp)
+	require.NoError(t, err)
+
+	assert.Equal(t, expHTTPStatus, res.StatusCode, string(body))
+	assert.Equal(t, expMessage, gotResp.Message)
+
+	return gotResp
+}
+
+func TestRequestSigning(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+	keysURL := state.URL + "/api/auth/signing-keys"
+
+	session := login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest: models.User{
+			Email:    "subzero@dreamrealm.com",
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	})
+	accessToken := session.Token.AccessToken
+
+	gotResp := new(SigningKeyControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, keysURL, withBearer(accessToken), map[string]interface{}{
+		"scopes": []string{"transactions:delete"},
+	}, http.StatusBadRequest, "Invalid signing key request", gotResp)
+	assert.Equal(t, []types.ErrorField{
+		{Name: "name", Message: "Signing key name is required"},
+		{Name: "scopes", Message: "Unknown scope transactions:delete"},
+	}, gotResp.Fields)
+
+	gotResp = new(SigningKeyControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, keysURL, withBearer(accessToken), map[string]interface{}{
+		"name":   "Card processor",
+		"scopes": []string{auth.ScopeTransactionsWrite},
+	}, http.StatusOK, "Signing key has been created", gotResp)
+	key := gotResp.SigningKey
+	require.NotEmpty(t, key.Secret)
+	assert.Regexp(t, "^"+auth.SigningKeyPrefix, key.KeyID)
+
+	// The secret is only shown once.
+	gotResp = new(SigningKeyControllerResponse)
+	doRequest(t, ctx, cl, http.MethodGet, keysURL, withBearer(accessToken), nil, http.StatusOK, "success", gotResp)
+	require.Len(t, gotResp.SigningKeys, 1)
+	assert.Equal(t, key.KeyID, gotResp.SigningKeys[0].KeyID)
+	assert.Empty(t, gotResp.SigningKeys[0].Secret)
+
+	// The secret is sealed with the signing key encryption key when stored.
+	dbKey, err := state.DataLayer.GetRequestSigningKeyByKeyID(key.KeyID)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(dbKey.Secret, "aes-gcm:"))
+	assert.NotContains(t, dbKey.Secret, key.Secret)
+
+	body, err := json.Marshal(models.CardTransaction{
+		DateTime:             time.Date(2020, 04, 25, 19, 46, 23, 0, time.UTC),
+		Amount:               models.CurrencyValue{Value: 400, Scale: 2},
+		CurrencyCode:         "ZAR",
+		Reference:            "signed",
+		MerchantName:         "Dwelms en Dinges",
+		MerchantCity:         "Hillbrow",
+		MerchantCountryCode:  "ZA",
+		MerchantCountryName:  "South Africa",
+		MerchantCategoryCode: "contraband",
+		MerchantCategoryName: "Contraband",
+	})
+	require.NoError(t, err)
+	now := time.Now()
+	signed := signedRequest{
+		method:    http.MethodPost,
+		path:      "/api/card-transactions/new",
+		body:      body,
+		keyID:     key.KeyID,
+		secret:    key.Secret,
+		timestamp: now,
+		nonce:     "nonce-1",
+	}
+	nonce := 1
+	nextNonce := func() string {
+		nonce++
+		return "nonce-" + strconv.Itoa(nonce)
+	}
+
+	gotTxn := doSignedRequest(t, ctx, cl, state.URL, signed, nil, http.StatusOK, "success")
+	assert.Equal(t, int64(400), gotTxn.CardTransaction.Amount.Value)
+
+	// The same nonce cannot be used twice.
+	doSignedRequest(t, ctx, cl, state.URL, signed, nil, http.StatusForbidden, "Request nonce has already been used")
+
+	// Any change to the signed request breaks the signature.
+	signed.nonce = nextNonce()
+	doSignedRequest(t, ctx, cl, state.URL, signed, func(req *http.Request) {
+		tampered := bytes.Replace(body, []byte("signed"), []byte("forged"), 1)
+		req.Body = ioutil.NopCloser(bytes.NewReader(tampered))
+	}, http.StatusForbidden, "Request signature does not match")
+	doSignedRequest(t, ctx, cl, state.URL, signed, func(req *http.Request) {
+		req.URL.RawQuery = "page=2"
+	}, http.StatusForbidden, "Request signature does not match")
+
+	wrongSecret := signed
+	wrongSecret.secret = "not the secret"
+	doSignedRequest(t, ctx, cl, state.URL, wrongSecret, nil, http.StatusForbidden, "Request signature does not match")
+
+	unknownKey := signed
+	unknownKey.keyID = auth.SigningKeyPrefix + "unknown"
+	doSignedRequest(t, ctx, cl, state.URL, unknownKey, nil, http.StatusForbidden, "Signing key is not recognised")
+
+	doSignedRequest(t, ctx, cl, state.URL, signed, func(req *http.Request) {
+		req.Header.Set("Authorization", auth.SignatureScheme+" KeyId="+key.KeyID)
+	}, http.StatusForbidden, "Request signature is malformed")
+
+	// Timestamps must be within the clock skew.
+	stale := signed
+	stale.timestamp = now.Add(-6 * time.Minute)
+	doSignedRequest(t, ctx, cl, state.URL, stale, nil, http.StatusForbidden,
+		"Request timestamp is outside the allowed clock skew")
+	stale.timestamp = now.Add(6 * time.Minute)
+	doSignedRequest(t, ctx, cl, state.URL, stale, nil, http.StatusForbidden,
+		"Request timestamp is outside the allowed clock skew")
+
+	oversized := signed
+	oversized.body, oversized.nonce = bytes.Repeat([]byte("x"), auth.MaxSignedBodySize+1), nextNonce()
+	doSignedRequest(t, ctx, cl, state.URL, oversized, nil, http.StatusRequestEntityTooLarge,
+		"Signed request body is too large")
+
+	// Signed requests are limited to the scopes of the key.
+	signed.nonce = nextNonce()
+	doSignedRequest(t, ctx, cl, state.URL, signed, nil, http.StatusOK, "success")
+	signed.method, signed.path, signed.body, signed.nonce = http.MethodGet, "/api/me/card-transactions", nil, nextNonce()
+	doSignedRequest(t, ctx, cl, state.URL, signed, nil, http.StatusForbidden, "Token is missing a required scope")
+	signed.method, signed.path, signed.nonce = http.MethodGet, "/api/users/current", nextNonce()
+	doSignedRequest(t, ctx, cl, state.URL, signed, nil, http.StatusForbidden, "Token is missing a required scope")
+	signed.path, signed.nonce = "/api/auth/signing-keys", nextNonce()
+	doSignedRequest(t, ctx, cl, state.URL, signed, nil, http.StatusForbidden,
+		"Token is not permitted to access this resource")
+
+	// Revoked keys are refused.
+	doRequest(t, ctx, cl, http.MethodDelete, fmt.Sprintf("%s/%d", keysURL, key.ID), withBearer(accessToken), nil,
+		http.StatusOK, "Signing key has been revoked", nil)
+	doRequest(t, ctx, cl, http.MethodDelete, fmt.Sprintf("%s/%d", keysURL, key.ID), withBearer(accessToken), nil,
+		http.StatusNotFound, "Signing key not found", nil)
+	signed.method, signed.path, signed.body, signed.nonce = http.MethodPost, "/api/card-transactions/new", body, nextNonce()
+	doSignedRequest(t, ctx, cl, state.URL, signed, nil, http.StatusForbidden, "Signing key has been revoked")
+}
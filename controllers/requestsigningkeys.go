@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/gorilla/mux"
+)
+
+// RequestSigningKeys lists the caller's request signing keys on GET and
+// issues a new one on POST.
+func RequestSigningKeys(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
+	w.Header().Set("X-XSS-Protection", "1; mode=block")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	switch r.Method {
+	case http.MethodGet:
+		return getRequestSigningKeys(w, r, state)
+	case http.MethodPost:
+		return createRequestSigningKey(w, r, state)
+	}
+
+	return nil
+}
+
+func getRequestSigningKeys(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	userID := auth.PrincipalFromContext(r.Context()).UserID
+
+	key := models.NewRequestSigningKey(state)
+	data, err := key.GetRequestSigningKeys(userID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("signingKeys", data)
+	resp.Respond(w)
+
+	return nil
+}
+
+func createRequestSigningKey(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	userID := auth.PrincipalFromContext(r.Context()).UserID
+
+	key := models.NewRequestSigningKey(state)
+	err := json.NewDecoder(r.Body).Decode(key)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	key.UserID = userID
+	data, err := key.Create()
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "Signing key has been created")
+	resp.Set("signingKey", data)
+	resp.Respond(w)
+
+	return nil
+}
+
+func RevokeRequestSigningKey(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
+	w.Header().Set("X-XSS-Protection", "1; mode=block")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	userID := auth.PrincipalFromContext(r.Context()).UserID
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		err := e.NewError("Invalid signing key ID", []types.ErrorField{
+			{Name: "id", Message: "Signing key ID must be a number"},
+		}, http.StatusBadRequest)
+		e.WriteError(w, err)
+		return err
+	}
+
+	key := models.NewRequestSigningKey(state)
+	err = key.Revoke(id, userID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "Signing key has been revoked")
+	resp.Respond(w)
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/gorilla/mux"
+)
+
+// GetSessions lists the devices the caller is logged in on.
+func GetSessions(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
+	w.Header().Set("X-XSS-Protection", "1; mode=block")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	principal := auth.PrincipalFromContext(r.Context())
+
+	session := models.NewSession(state)
+	data, err := session.GetSessions(principal.UserID, principal.SessionID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("sessions", data)
+	resp.Respond(w)
+
+	return nil
+}
+
+func RevokeSession(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
+	w.Header().Set("X-XSS-Protection", "1; mode=block")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	userID := auth.PrincipalFromContext(r.Context()).UserID
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		err := e.NewError("Invalid session ID", []types.ErrorField{
+			{Name: "id", Message: "Session ID must be a number"},
+		}, http.StatusBadRequest)
+		e.WriteError(w, err)
+		return err
+	}
+
+	session := models.NewSession(state)
+	err = session.Revoke(id, userID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "Session has been revoked")
+	resp.Respond(w)
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package controllers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	firefoxOnWindows = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:80.0) Gecko/20100101 Firefox/80.0"
+	safariOnIPhone   = "Mozilla/5.0 (iPhone; CPU iPhone OS 13_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/13.1.2 Mobile/15E148 Safari/604.1"
+	edgeOnMac        = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/85.0.4183.102 Safari/537.36 Edg/85.0.564.51"
+)
+
+type SessionControllerResponse struct {
+	Message  string             `json:"message"`
+	Status   bool               `json:"status"`
+	Token    auth.TokenResponse `json:"token"`
+	Sessions []models.Session   `json:"sessions"`
+}
+
+func TestSessions(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+	loginURL := state.URL + "/api/auth/login"
+	sessionsURL := state.URL + "/api/me/sessions"
+	credentials := map[string]string{"email": "subzero@dreamrealm.com", "password": "secret"}
+
+	gotResp := new(SessionControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, loginURL, withBearer("", "User-Agent", firefoxOnWindows), credentials,
+		http.StatusOK, "Logged In", gotResp)
+	laptop := gotResp.Token
+	gotResp = new(SessionControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, loginURL, withBearer("", "User-Agent", safariOnIPhone), credentials,
+		http.StatusOK, "Logged In", gotResp)
+	phone := gotResp.Token
+
+	gotResp = new(SessionControllerResponse)
+	doRequest(t, ctx, cl, http.MethodGet, sessionsURL, withBearer(laptop.AccessToken, "User-Agent", firefoxOnWindows),
+		nil, http.StatusOK, "success", gotResp)
+	sessions := gotResp.Sessions
+	require.Len(t, sessions, 2)
+	assert.Equal(t, "Safari on iPhone", sessions[0].DeviceName)
+	assert.False(t, sessions[0].Current)
+	assert.Equal(t, "Firefox on Windows", sessions[1].DeviceName)
+	assert.Equal(t, firefoxOnWindows, sessions[1].UserAgent)
+	assert.Equal(t, "127.0.0.1", sessions[1].IPAddress)
+	assert.True(t, sessions[1].Current)
+	assert.True(t, sessions[1].CreatedAt.Valid)
+	laptopID, phoneID := sessions[1].ID, sessions[0].ID
+
+	// Refreshing keeps the session and records the device it came from.
+	gotResp = new(SessionControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/refresh", withBearer("", "User-Agent", edgeOnMac),
+		auth.RefreshJWTReq{GrantType: "refresh_token", RefreshToken: laptop.RefreshToken},
+		http.StatusOK, "Tokens refreshed", gotResp)
+	laptop = gotResp.Token
+	gotResp = new(SessionControllerResponse)
+	doRequest(t, ctx, cl, http.MethodGet, sessionsURL, withBearer(laptop.AccessToken, "User-Agent", edgeOnMac), nil,
+		http.StatusOK, "success", gotResp)
+	sessions = gotResp.Sessions
+	require.Len(t, sessions, 2)
+	assert.Equal(t, laptopID, sessions[0].ID)
+	assert.Equal(t, "Edge on macOS", sessions[0].DeviceName)
+	assert.True(t, sessions[0].Current)
+
+	// Other users cannot revoke the session.
+	gotResp = new(SessionControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, loginURL, withBearer("", "User-Agent", firefoxOnWindows),
+		map[string]string{"email": "reptile@netherrealm.com", "password": "secret"}, http.StatusOK, "Logged In",
+		gotResp)
+	other := gotResp.Token
+	phoneURL := fmt.Sprintf("%s/%d", sessionsURL, phoneID)
+	doRequest(t, ctx, cl, http.MethodDelete, phoneURL, withBearer(other.AccessToken, "User-Agent", firefoxOnWindows),
+		nil, http.StatusNotFound, "Session not found", nil)
+
+	doRequest(t, ctx, cl, http.MethodDelete, phoneURL, withBearer(laptop.AccessToken, "User-Agent", edgeOnMac), nil,
+		http.StatusOK, "Session has been revoked", nil)
+	doRequest(t, ctx, cl, http.MethodDelete, phoneURL, withBearer(laptop.AccessToken, "User-Agent", edgeOnMac), nil,
+		http.StatusNotFound, "Session not found", nil)
+
+	// The revoked session can neither call the API nor refresh.
+	doRequest(t, ctx, cl, http.MethodGet, sessionsURL, withBearer(phone.AccessToken, "User-Agent", safariOnIPhone), nil,
+		http.StatusForbidden, "Session has been logged out", nil)
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/refresh", withBearer("", "User-Agent", safariOnIPhone),
+		auth.RefreshJWTReq{GrantType: "refresh_token", RefreshToken: phone.RefreshToken},
+		http.StatusForbidden, "refresh token has been revoked", nil)
+
+	gotResp = new(SessionControllerResponse)
+	doRequest(t, ctx, cl, http.MethodGet, sessionsURL, withBearer(laptop.AccessToken, "User-Agent", edgeOnMac), nil,
+		http.StatusOK, "success", gotResp)
+	sessions = gotResp.Sessions
+	require.Len(t, sessions, 1)
+	assert.Equal(t, laptopID, sessions[0].ID)
+
+	// Logging out revokes the session record too.
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/logout",
+		withBearer(laptop.AccessToken, "User-Agent", edgeOnMac), nil, http.StatusOK, "Logged out", nil)
+	session, err := state.DataLayer.GetSessionByID(laptopID)
+	require.NoError(t, err)
+	assert.True(t, session.RevokedAt.Valid)
+}
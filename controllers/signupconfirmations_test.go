@@ -0,0 +1,113 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/datalayer/mockdatalayer"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignUpConfirmation(t *testing.T) {
+	cl := new(http.Client)
+	confirmCallback, nonces := mailRecorder()
+	callbacks := state.NewMockCallbacks(confirmCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+	// The mock mail client expects a single mail, the resend sends another.
+	callbacks.MockMailWG.Add(1)
+	confirmURL := state.URL + "/api/users/confirm/"
+	resendURL := state.URL + "/api/auth/resend-confirmation"
+	credentials := models.User{
+		Email:    "kitana@edenia.com",
+		Password: "secret",
+	}
+	resendRequest := map[string]string{"email": credentials.Email}
+
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/sign-up", nil, credentials, http.StatusOK,
+		"User has been created", nil)
+	firstNonce := receiveToken(t, nonces, signUpRe)
+	assert.Len(t, firstNonce, 32)
+
+	login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest:   credentials,
+		expHTTPStatus: http.StatusForbidden,
+		expLoginResp: AuthResponse{
+			Message: "User has not confirmed their email address",
+			Status:  false,
+		},
+	})
+
+	// Resending is rate limited, answering like an unknown address does.
+	doRequest(t, ctx, cl, http.MethodPost, resendURL, nil, resendRequest,
+		http.StatusOK, "If the account exists and is unconfirmed a confirmation link has been sent", nil)
+	doRequest(t, ctx, cl, http.MethodPost, resendURL, nil, map[string]string{"email": "nobody@edenia.com"},
+		http.StatusOK, "If the account exists and is unconfirmed a confirmation link has been sent", nil)
+
+	dl := state.DataLayer.(*mockdatalayer.MockDataLayer)
+	require.Len(t, dl.SignUpConfirmations, 1)
+	user, err := dl.GetUserByEmail(credentials.Email)
+	require.NoError(t, err)
+	require.True(t, user.ConfirmationSentAt.Valid)
+	user.ConfirmationSentAt.Time = time.Now().Add(-models.ConfirmationResendInterval)
+
+	doRequest(t, ctx, cl, http.MethodPost, resendURL, nil, resendRequest,
+		http.StatusOK, "If the account exists and is unconfirmed a confirmation link has been sent", nil)
+	secondNonce := receiveToken(t, nonces, signUpRe)
+	assert.NotEqual(t, firstNonce, secondNonce)
+
+	// Resending expires the earlier link.
+	doRequest(t, ctx, cl, http.MethodGet, confirmURL+firstNonce, nil, nil,
+		http.StatusGone, "Confirmation link has expired, request a new one", nil)
+	doRequest(t, ctx, cl, http.MethodGet, confirmURL+"bogus", nil, nil,
+		http.StatusBadRequest, "No match found for nonce", nil)
+	doRequest(t, ctx, cl, http.MethodGet, confirmURL+secondNonce, nil, nil,
+		http.StatusOK, "User's email has been confirmed", nil)
+
+	// Nonces are single use.
+	doRequest(t, ctx, cl, http.MethodGet, confirmURL+secondNonce, nil, nil,
+		http.StatusConflict, "Email address has already been confirmed", nil)
+
+	login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest:   credentials,
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	})
+
+	// Confirmed users are not sent another link.
+	user.ConfirmationSentAt.Time = time.Now().Add(-models.ConfirmationResendInterval)
+	doRequest(t, ctx, cl, http.MethodPost, resendURL, nil, resendRequest,
+		http.StatusOK, "If the account exists and is unconfirmed a confirmation link has been sent", nil)
+	assert.Len(t, dl.SignUpConfirmations, 2)
+}
+
+func TestUserStateTransitions(t *testing.T) {
+	tests := []struct {
+		from  datalayer.UserState
+		to    datalayer.UserState
+		valid bool
+	}{
+		{from: datalayer.UserStateUnconfirmed, to: datalayer.UserStateProcessing, valid: true},
+		{from: datalayer.UserStateProcessing, to: datalayer.UserStatePending, valid: true},
+		{from: datalayer.UserStatePending, to: datalayer.UserStateConfirmed, valid: true},
+		{from: datalayer.UserStatePending, to: datalayer.UserStateProcessing, valid: true},
+		{from: datalayer.UserStateUnconfirmed, to: datalayer.UserStatePending, valid: false},
+		{from: datalayer.UserStateConfirmed, to: datalayer.UserStatePending, valid: false},
+		{from: datalayer.UserStateConfirmed, to: datalayer.UserStateConfirmed, valid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.from)+" to "+string(test.to), func(t *testing.T) {
+			assert.Equal(t, test.valid, test.from.CanTransitionTo(test.to))
+		})
+	}
+}
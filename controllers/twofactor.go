@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+func SetupTwoFactor(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
+	w.Header().Set("X-XSS-Protection", "1; mode=block")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	twoFactor := models.NewTwoFactor(state)
+	twoFactor.UserID = auth.PrincipalFromContext(r.Context()).UserID
+	data, err := twoFactor.Setup()
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "Two-factor authentication setup started")
+	resp.Set("twoFactor", data)
+	resp.Respond(w)
+
+	return nil
+}
+
+func VerifyTwoFactor(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
+	w.Header().Set("X-XSS-Protection", "1; mode=block")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	twoFactor := models.NewTwoFactor(state)
+	err := json.NewDecoder(r.Body).Decode(twoFactor)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	twoFactor.UserID = auth.PrincipalFromContext(r.Context()).UserID
+	recoveryCodes, err := twoFactor.Verify()
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "Two-factor authentication enabled")
+	resp.Set("recoveryCodes", recoveryCodes)
+	resp.Respond(w)
+
+	return nil
+}
+
+func DisableTwoFactor(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
+	w.Header().Set("X-XSS-Protection", "1; mode=block")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	twoFactor := models.NewTwoFactor(state)
+	err := json.NewDecoder(r.Body).Decode(twoFactor)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	twoFactor.UserID = auth.PrincipalFromContext(r.Context()).UserID
+	err = twoFactor.Disable()
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "Two-factor authentication disabled")
+	resp.Respond(w)
+
+	return nil
+}
+
+// TwoFactorLogin completes a login started with Authenticate by exchanging
+// the challenge token and a code for a token pair.
+func TwoFactorLogin(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
+	w.Header().Set("X-XSS-Protection", "1; mode=block")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	twoFactor := models.NewTwoFactor(state)
+	err := json.NewDecoder(r.Body).Decode(twoFactor)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	twoFactor.Client = clientInfo(r)
+	data, err := twoFactor.Login()
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	return respondTokens(w, state, "Logged In", data, auth.WantsCookies(r))
+}
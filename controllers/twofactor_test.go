@@ -0,0 +1,189 @@
+package controllers_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/router/auth/totp"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type TwoFactorControllerResponse struct {
+	Message       string                 `json:"message"`
+	Status        bool                   `json:"status"`
+	Fields        []types.ErrorField     `json:"fields"`
+	TwoFactor     models.TwoFactorSetup  `json:"twoFactor"`
+	RecoveryCodes []string               `json:"recoveryCodes"`
+	Challenge     auth.ChallengeResponse `json:"challenge"`
+	Token         auth.TokenResponse     `json:"token"`
+}
+
+// enableTwoFactor enrols the user and returns the secret, the step of the
+// code used for verification and the recovery codes.
+func enableTwoFactor(t *testing.T, ctx context.Context, cl *http.Client, url, accessToken string) (string, int64, []string) {
+	gotResp := new(TwoFactorControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, url+"/api/auth/2fa/setup", withBearer(accessToken), nil,
+		http.StatusOK, "Two-factor authentication setup started", gotResp)
+	secret := gotResp.TwoFactor.Secret
+	require.NotEmpty(t, secret)
+	assert.True(t, strings.HasPrefix(gotResp.TwoFactor.URI, "otpauth://totp/gowebserver:subzero@dreamrealm.com?"))
+
+	doRequest(t, ctx, cl, http.MethodPost, url+"/api/auth/2fa/verify", withBearer(accessToken),
+		map[string]string{"code": "000000"}, http.StatusForbidden, "Invalid two-factor authentication code", nil)
+
+	step := totp.Step(time.Now())
+	code, err := totp.Code(secret, step)
+	require.NoError(t, err)
+	gotResp = new(TwoFactorControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, url+"/api/auth/2fa/verify", withBearer(accessToken),
+		map[string]string{"code": code}, http.StatusOK, "Two-factor authentication enabled", gotResp)
+	require.Len(t, gotResp.RecoveryCodes, models.RecoveryCodeCount)
+
+	return secret, step, gotResp.RecoveryCodes
+}
+
+func TestTwoFactor(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+
+	credentials := map[string]string{
+		"email":    "subzero@dreamrealm.com",
+		"password": "secret",
+	}
+	session := login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest: models.User{
+			Email:    credentials["email"],
+			Password: credentials["password"],
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	})
+
+	secret, step, recoveryCodes := enableTwoFactor(t, ctx, cl, state.URL, session.Token.AccessToken)
+
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/2fa/setup", withBearer(session.Token.AccessToken), nil,
+		http.StatusConflict, "Two-factor authentication is already enabled", nil)
+
+	// The password alone now only yields a challenge.
+	gotResp := new(TwoFactorControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/login", nil, credentials,
+		http.StatusOK, "Two-factor authentication required", gotResp)
+	assert.Empty(t, gotResp.Token.AccessToken)
+	challengeToken := gotResp.Challenge.ChallengeToken
+	require.NotEmpty(t, challengeToken)
+	assert.LessOrEqual(t, gotResp.Challenge.ExpiresIn, time.Now().Unix()+auth.ChallengeTokenLifeSpan)
+
+	// The challenge token is not an access token.
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/2fa/setup", withBearer(challengeToken), nil,
+		http.StatusForbidden, "Token is not an access token", nil)
+
+	// The code used during enrolment cannot be replayed.
+	code, err := totp.Code(secret, step)
+	require.NoError(t, err)
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/2fa/login", nil,
+		map[string]string{"challengeToken": challengeToken, "code": code},
+		http.StatusForbidden, "Invalid two-factor authentication code", nil)
+
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/2fa/login", nil,
+		map[string]string{"challengeToken": session.Token.AccessToken, "code": code},
+		http.StatusForbidden, "Two-factor challenge is invalid or has expired", nil)
+
+	code, err = totp.Code(secret, step+1)
+	require.NoError(t, err)
+	gotResp = new(TwoFactorControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/2fa/login", nil,
+		map[string]string{"challengeToken": challengeToken, "code": code}, http.StatusOK, "Logged In", gotResp)
+	require.NotEmpty(t, gotResp.Token.AccessToken)
+	require.NotEmpty(t, gotResp.Token.RefreshToken)
+	getCurrentUser(t, ctx, cl, state.URL, &AuthResponse{Token: gotResp.Token}, &GetCurrentUserParameters{
+		expHTTPStatus: http.StatusOK,
+		expResponse: UserControllerResponse{
+			Message: "success",
+			Status:  true,
+			User:    models.User{Email: "subzero@dreamrealm.com"},
+		},
+	})
+
+	// Recovery codes work once, with or without formatting.
+	recoveryCode := strings.ToUpper(recoveryCodes[0])
+	gotResp = new(TwoFactorControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/2fa/login", nil,
+		map[string]string{"challengeToken": challengeToken, "code": recoveryCode}, http.StatusOK, "Logged In", gotResp)
+	require.NotEmpty(t, gotResp.Token.AccessToken)
+
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/2fa/login", nil,
+		map[string]string{"challengeToken": challengeToken, "code": recoveryCode},
+		http.StatusForbidden, "Invalid two-factor authentication code", nil)
+
+	// Disabling requires the password as well as a code.
+	accessToken := gotResp.Token.AccessToken
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/2fa/disable", withBearer(accessToken),
+		map[string]string{"password": "wrong", "code": recoveryCodes[1]},
+		http.StatusForbidden, "Invalid login credentials", nil)
+
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/2fa/disable", withBearer(accessToken),
+		map[string]string{"password": "secret", "code": recoveryCodes[1]},
+		http.StatusOK, "Two-factor authentication disabled", nil)
+
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/2fa/disable", withBearer(accessToken),
+		map[string]string{"password": "secret", "code": recoveryCodes[2]},
+		http.StatusBadRequest, "Two-factor authentication is not enabled", nil)
+
+	// Outstanding challenges die with the second factor.
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/2fa/login", nil,
+		map[string]string{"challengeToken": challengeToken, "code": recoveryCodes[2]},
+		http.StatusForbidden, "Two-factor challenge is invalid or has expired", nil)
+
+	gotResp = new(TwoFactorControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/login", nil, credentials,
+		http.StatusOK, "Logged In", gotResp)
+	require.NotEmpty(t, gotResp.Token.AccessToken)
+}
+
+func TestTwoFactorLockout(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+
+	credentials := map[string]string{
+		"email":    "subzero@dreamrealm.com",
+		"password": "secret",
+	}
+	gotResp := new(TwoFactorControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/login", nil, credentials,
+		http.StatusOK, "Logged In", gotResp)
+	secret, step, _ := enableTwoFactor(t, ctx, cl, state.URL, gotResp.Token.AccessToken)
+
+	gotResp = new(TwoFactorControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/login", nil, credentials,
+		http.StatusOK, "Two-factor authentication required", gotResp)
+	challengeToken := gotResp.Challenge.ChallengeToken
+
+	for i := 0; i < models.MaxTwoFactorAttempts; i++ {
+		doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/2fa/login", nil,
+			map[string]string{"challengeToken": challengeToken, "code": "abcdef"},
+			http.StatusForbidden, "Invalid two-factor authentication code", nil)
+	}
+
+	// Even a valid code is refused while the second factor is locked.
+	code, err := totp.Code(secret, step+1)
+	require.NoError(t, err)
+	doRequest(t, ctx, cl, http.MethodPost, state.URL+"/api/auth/2fa/login", nil,
+		map[string]string{"challengeToken": challengeToken, "code": code},
+		http.StatusTooManyRequests, "Too many failed two-factor attempts, try again later", nil)
+}
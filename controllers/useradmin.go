@@ -0,0 +1,301 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/models/pagination"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/gorilla/mux"
+)
+
+func setAdminHeaders(w http.ResponseWriter) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
+	w.Header().Set("X-XSS-Protection", "1; mode=block")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+}
+
+// userIDFromPath reads the ID of the user an administrator acts on.
+func userIDFromPath(w http.ResponseWriter, r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		err := e.NewError("Invalid user ID", []types.ErrorField{
+			{Name: "id", Message: "User ID must be a number"},
+		}, http.StatusBadRequest)
+		e.WriteError(w, err)
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func respondAdminUser(w http.ResponseWriter, message string, user *models.AdminUser) error {
+	resp := response.New(true, message)
+	resp.Set("user", user)
+	resp.Respond(w)
+
+	return nil
+}
+
+// AdminGetUsers lists and searches users a page at a time.
+func AdminGetUsers(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	setAdminHeaders(w)
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	userAdmin := models.NewUserAdmin(state)
+	err := pagination.ParsePagination(state.Logger, r.URL.Query(), userAdmin)
+	if err != nil {
+		e.WriteError(w, err, http.StatusBadRequest)
+		return err
+	}
+	err = userAdmin.SetFilterCriteria(r.URL.Query())
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	data, err := userAdmin.ListUsers()
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("users", data)
+	resp.Respond(w)
+
+	return nil
+}
+
+func AdminGetUser(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	setAdminHeaders(w)
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	id, err := userIDFromPath(w, r)
+	if err != nil {
+		return err
+	}
+
+	user, err := models.NewUserAdmin(state).GetUser(id)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	return respondAdminUser(w, "success", user)
+}
+
+func AdminConfirmUser(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	setAdminHeaders(w)
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	id, err := userIDFromPath(w, r)
+	if err != nil {
+		return err
+	}
+
+	user, err := models.NewUserAdmin(state).ConfirmUser(id)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	return respondAdminUser(w, "User has been confirmed", user)
+}
+
+func AdminDisableUser(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	setAdminHeaders(w)
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	id, err := userIDFromPath(w, r)
+	if err != nil {
+		return err
+	}
+
+	adminID := auth.PrincipalFromContext(r.Context()).UserID
+	user, err := models.NewUserAdmin(state).DisableUser(adminID, id)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	return respondAdminUser(w, "User has been disabled", user)
+}
+
+func AdminEnableUser(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	setAdminHeaders(w)
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	id, err := userIDFromPath(w, r)
+	if err != nil {
+		return err
+	}
+
+	user, err := models.NewUserAdmin(state).EnableUser(id)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	return respondAdminUser(w, "User has been enabled", user)
+}
+
+func AdminSetUserRole(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	setAdminHeaders(w)
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	id, err := userIDFromPath(w, r)
+	if err != nil {
+		return err
+	}
+
+	userAdmin := models.NewUserAdmin(state)
+	err = json.NewDecoder(r.Body).Decode(userAdmin)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	adminID := auth.PrincipalFromContext(r.Context()).UserID
+	user, err := userAdmin.SetRole(adminID, id)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	return respondAdminUser(w, "User role has been changed", user)
+}
+
+func AdminResetPassword(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	setAdminHeaders(w)
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	id, err := userIDFromPath(w, r)
+	if err != nil {
+		return err
+	}
+
+	err = models.NewUserAdmin(state).ResetPassword(id)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "A password reset link has been sent")
+	resp.Respond(w)
+
+	return nil
+}
+
+func AdminResendConfirmation(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	setAdminHeaders(w)
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	id, err := userIDFromPath(w, r)
+	if err != nil {
+		return err
+	}
+
+	err = models.NewUserAdmin(state).ResendConfirmation(id)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "A confirmation link has been sent")
+	resp.Respond(w)
+
+	return nil
+}
+
+// AdminImpersonateUser issues the administrator a token to act as the user.
+// Requests made with it are audited.
+func AdminImpersonateUser(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	setAdminHeaders(w)
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	id, err := userIDFromPath(w, r)
+	if err != nil {
+		return err
+	}
+
+	adminID := auth.PrincipalFromContext(r.Context()).UserID
+	token, err := models.NewUserAdmin(state).Impersonate(adminID, id)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "Impersonation token issued")
+	resp.Set("token", token)
+	resp.Respond(w)
+
+	return nil
+}
+
+func AdminGetImpersonationAudits(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	setAdminHeaders(w)
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	id, err := userIDFromPath(w, r)
+	if err != nil {
+		return err
+	}
+
+	audits := models.NewImpersonationAudits(state)
+	err = pagination.ParsePagination(state.Logger, r.URL.Query(), audits)
+	if err != nil {
+		e.WriteError(w, err, http.StatusBadRequest)
+		return err
+	}
+
+	data, err := audits.GetByUserID(id)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "success")
+	resp.Set("audits", data)
+	resp.Respond(w)
+
+	return nil
+}
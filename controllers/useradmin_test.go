@@ -0,0 +1,173 @@
+package controllers_test
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/state"
+	"github.com/donohutcheon/gowebserver/state/facotory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type UserAdminControllerResponse struct {
+	Message string             `json:"message"`
+	Status  bool               `json:"status"`
+	Fields  []types.ErrorField `json:"fields"`
+	User    models.AdminUser   `json:"user"`
+	Users   []models.AdminUser `json:"users"`
+}
+
+var signUpRe = regexp.MustCompile(`users/confirm/([a-z0-9]+)`)
+
+func TestUserAdmin(t *testing.T) {
+	cl := new(http.Client)
+	callback, sent := mailRecorder()
+	callbacks := state.NewMockCallbacks(callback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+	// The mock mail client expects a single mail, two are sent.
+	callbacks.MockMailWG.Add(1)
+	usersURL := state.URL + "/api/admin/users"
+
+	loginAs := func(email string, expHTTPStatus int, expMessage string) string {
+		resp := login(t, ctx, cl, state.URL, AuthParameters{
+			authRequest:   models.User{Email: email, Password: "secret"},
+			expHTTPStatus: expHTTPStatus,
+			expLoginResp:  AuthResponse{Message: expMessage, Status: expHTTPStatus == http.StatusOK},
+		})
+		return resp.Token.AccessToken
+	}
+	admin := loginAs("subzero@dreamrealm.com", http.StatusOK, "Logged In")
+	user := loginAs("reptile@netherrealm.com", http.StatusOK, "Logged In")
+
+	// Only administrators can manage users.
+	doRequest(t, ctx, cl, http.MethodGet, usersURL, withBearer(user), nil,
+		http.StatusForbidden, "Insufficient role to access this resource", nil)
+
+	kitanaID, err := state.DataLayer.CreateUser("kitana@edenia.com", "hash", datalayer.UserRoleUser)
+	require.NoError(t, err)
+	kitanaURL := fmt.Sprintf("%s/%d", usersURL, kitanaID)
+
+	// Listing, searching and paging.
+	gotResp := new(UserAdminControllerResponse)
+	doRequest(t, ctx, cl, http.MethodGet, usersURL+"?sortField=email&sortDir=desc", withBearer(admin), nil,
+		http.StatusOK, "success", gotResp)
+	require.Len(t, gotResp.Users, 3)
+	assert.Equal(t, "subzero@dreamrealm.com", gotResp.Users[0].Email)
+	assert.Equal(t, "kitana@edenia.com", gotResp.Users[2].Email)
+	assert.Empty(t, gotResp.Users[0].Password)
+
+	gotResp = new(UserAdminControllerResponse)
+	doRequest(t, ctx, cl, http.MethodGet, usersURL+"?count=1&page=1", withBearer(admin), nil,
+		http.StatusOK, "success", gotResp)
+	require.Len(t, gotResp.Users, 1)
+	assert.Equal(t, "reptile@netherrealm.com", gotResp.Users[0].Email)
+
+	gotResp = new(UserAdminControllerResponse)
+	doRequest(t, ctx, cl, http.MethodGet, usersURL+"?search=EDENIA&state=UNCONFIRMED,PENDING", withBearer(admin), nil,
+		http.StatusOK, "success", gotResp)
+	require.Len(t, gotResp.Users, 1)
+	assert.Equal(t, kitanaID, gotResp.Users[0].ID)
+	assert.Equal(t, "UNCONFIRMED", gotResp.Users[0].State)
+
+	gotResp = new(UserAdminControllerResponse)
+	doRequest(t, ctx, cl, http.MethodGet, usersURL+"?role=ADMIN", withBearer(admin), nil,
+		http.StatusOK, "success", gotResp)
+	require.Len(t, gotResp.Users, 1)
+	assert.Equal(t, "subzero@dreamrealm.com", gotResp.Users[0].Email)
+
+	gotResp = new(UserAdminControllerResponse)
+	doRequest(t, ctx, cl, http.MethodGet, usersURL+"?state=LOST", withBearer(admin), nil,
+		http.StatusBadRequest, "state filter is invalid", gotResp)
+	assert.Equal(t, []types.ErrorField{{Name: "state", Message: "Unknown user state LOST"}}, gotResp.Fields)
+	doRequest(t, ctx, cl, http.MethodGet, usersURL+"?sortField=password", withBearer(admin), nil,
+		http.StatusBadRequest, "invalid sort field", nil)
+
+	// Viewing a user shows their confirmation state.
+	doRequest(t, ctx, cl, http.MethodGet, usersURL+"/999", withBearer(admin), nil, http.StatusNotFound,
+		"User not found", nil)
+	gotResp = new(UserAdminControllerResponse)
+	doRequest(t, ctx, cl, http.MethodGet, kitanaURL, withBearer(admin), nil, http.StatusOK, "success", gotResp)
+	assert.Nil(t, gotResp.User.Confirmation)
+
+	doRequest(t, ctx, cl, http.MethodPost, kitanaURL+"/resend-confirmation", withBearer(admin), nil,
+		http.StatusOK, "A confirmation link has been sent", nil)
+	mail := receiveMail(t, sent)
+	assert.Equal(t, []string{"kitana@edenia.com"}, mail.to)
+
+	require.Eventually(t, func() bool {
+		dbUser, err := state.DataLayer.GetUserByID(kitanaID)
+		return err == nil && dbUser.State.String == string(datalayer.UserStatePending)
+	}, 5*time.Second, 10*time.Millisecond)
+	gotResp = new(UserAdminControllerResponse)
+	doRequest(t, ctx, cl, http.MethodGet, kitanaURL, withBearer(admin), nil, http.StatusOK, "success", gotResp)
+	assert.Equal(t, "PENDING", gotResp.User.State)
+	require.NotNil(t, gotResp.User.Confirmation)
+	assert.True(t, gotResp.User.Confirmation.SentAt.Valid)
+	assert.False(t, gotResp.User.Confirmation.UsedAt.Valid)
+
+	// Force-confirming expires the emailed link.
+	gotResp = new(UserAdminControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, kitanaURL+"/confirm", withBearer(admin), nil,
+		http.StatusOK, "User has been confirmed", gotResp)
+	assert.Equal(t, "CONFIRMED", gotResp.User.State)
+	link := signUpRe.FindStringSubmatch(mail.message)
+	require.Len(t, link, 2)
+	doRequest(t, ctx, cl, http.MethodGet, state.URL+"/api/users/confirm/"+link[1], nil, nil, http.StatusGone,
+		"Confirmation link has expired, request a new one", nil)
+	doRequest(t, ctx, cl, http.MethodPost, kitanaURL+"/confirm", withBearer(admin), nil,
+		http.StatusConflict, "User has already been confirmed", nil)
+	doRequest(t, ctx, cl, http.MethodPost, kitanaURL+"/resend-confirmation", withBearer(admin), nil,
+		http.StatusConflict, "User has already been confirmed", nil)
+
+	// Disabling a user ends their sessions and stops them logging in.
+	reptileURL := usersURL + "/2"
+	doRequest(t, ctx, cl, http.MethodPost, usersURL+"/1/disable", withBearer(admin), nil,
+		http.StatusBadRequest, "Administrators cannot disable or change the role of their own account", nil)
+	gotResp = new(UserAdminControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPost, reptileURL+"/disable", withBearer(admin), nil,
+		http.StatusOK, "User has been disabled", gotResp)
+	assert.True(t, gotResp.User.DisabledAt.Valid)
+	doRequest(t, ctx, cl, http.MethodPost, reptileURL+"/disable", withBearer(admin), nil,
+		http.StatusConflict, "User is already disabled", nil)
+
+	doRequest(t, ctx, cl, http.MethodGet, state.URL+"/api/users/current", withBearer(user), nil, http.StatusForbidden,
+		"User account has been disabled", nil)
+	loginAs("reptile@netherrealm.com", http.StatusForbidden, "User account has been disabled")
+
+	doRequest(t, ctx, cl, http.MethodPost, reptileURL+"/enable", withBearer(admin), nil,
+		http.StatusOK, "User has been enabled", nil)
+	doRequest(t, ctx, cl, http.MethodPost, reptileURL+"/enable", withBearer(admin), nil,
+		http.StatusConflict, "User is not disabled", nil)
+	loginAs("reptile@netherrealm.com", http.StatusOK, "Logged In")
+	// Sessions ended by disabling stay ended.
+	doRequest(t, ctx, cl, http.MethodGet, state.URL+"/api/users/current",
+		withBearer(user), nil, http.StatusForbidden, "Session has been logged out", nil)
+
+	// Changing roles.
+	gotResp = new(UserAdminControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPut, reptileURL+"/role", withBearer(admin), map[string]string{"role": "ROOT"},
+		http.StatusBadRequest, "Role is invalid", gotResp)
+	assert.Equal(t, []types.ErrorField{{Name: "role", Message: "Role must be USER or ADMIN"}}, gotResp.Fields)
+	doRequest(t, ctx, cl, http.MethodPut, usersURL+"/1/role", withBearer(admin), map[string]string{"role": "USER"},
+		http.StatusBadRequest, "Administrators cannot disable or change the role of their own account", nil)
+	gotResp = new(UserAdminControllerResponse)
+	doRequest(t, ctx, cl, http.MethodPut, reptileURL+"/role", withBearer(admin), map[string]string{"role": "ADMIN"},
+		http.StatusOK, "User role has been changed", gotResp)
+	assert.Equal(t, []string{"ADMIN", "USER"}, gotResp.User.Roles)
+
+	// Password resets are emailed to the user.
+	doRequest(t, ctx, cl, http.MethodPost, reptileURL+"/password-reset", withBearer(admin), nil,
+		http.StatusOK, "A password reset link has been sent", nil)
+	mail = receiveMail(t, sent)
+	assert.Equal(t, []string{"reptile@netherrealm.com"}, mail.to)
+	assert.True(t, strings.Contains(mail.message, "/reset-password"), mail.message)
+}
@@ -9,6 +9,7 @@ import (
 	e "github.com/donohutcheon/gowebserver/controllers/errors"
 	"github.com/donohutcheon/gowebserver/controllers/response"
 	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/router/auth"
 	"github.com/donohutcheon/gowebserver/state"
 )
 
@@ -39,18 +40,28 @@ func CreateUser(w http.ResponseWriter, r *http.Request, state *state.ServerState
 }
 
 // TODO: Move into usersController
+// GetCurrentUser returns the current user's profile on GET and updates the
+// fields present in the request on PATCH.
 func GetCurrentUser(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
 	w.Header().Set("X-XSS-Protection", "1; mode=block")
 	w.Header().Set("X-Content-Type-Options", "nosniff")
-	w.Header().Set( "Access-Control-Allow-Methods", "OPTIONS,GET,POST,PUT,DELETE")
-	w.Header().Set("Access-Control-Allow-Headers", "authorization")
-
-	if r.Method == http.MethodOptions {
-		return nil
+	w.Header().Set( "Access-Control-Allow-Methods", "OPTIONS,GET,POST,PUT,PATCH,DELETE")
+	w.Header().Set("Access-Control-Allow-Headers", "authorization,content-type")
+
+	switch r.Method {
+	case http.MethodGet:
+		return getCurrentUser(w, r, state)
+	case http.MethodPatch:
+		return updateCurrentUser(w, r, state)
 	}
-	id := r.Context().Value("userID").(int64)
+
+	return nil
+}
+
+func getCurrentUser(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	id := auth.PrincipalFromContext(r.Context()).UserID
 
 	user := models.NewUser(state)
 	err := user.GetUser(id)
@@ -86,34 +97,156 @@ func ConfirmUserSignUp(w http.ResponseWriter, r *http.Request, state *state.Serv
 		return err
 	}
 
-	signUp := models.NewSignUpConfirmation(state)
-	err := signUp.LookupUsingNonce(nonce)
+	// Expired links answer 410 Gone so that the client can offer a resend.
+	user := models.NewUser(state)
+	err := user.ConfirmUser(nonce)
 	if err != nil {
-		err := e.NewError("No match found for nonce", []types.ErrorField{
-			{Name: "nonce", Message: "No match found for nonce"},
-		}, http.StatusBadRequest)
 		e.WriteError(w, err)
 		return err
 	}
 
+	resp := response.New(true, "User's email has been confirmed")
+	resp.Respond(w)
+
+	return nil
+}
+
+func updateCurrentUser(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	update := models.NewProfileUpdate(state)
+	err := json.NewDecoder(r.Body).Decode(update)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	user, err := update.Apply(auth.PrincipalFromContext(r.Context()).UserID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "Profile has been updated")
+	resp.Set("user", user)
+	resp.Respond(w)
+
+	return nil
+}
+
+func ResendConfirmation(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
+	w.Header().Set("X-XSS-Protection", "1; mode=block")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
 	user := models.NewUser(state)
-	err = user.GetUser(signUp.UserID)
+	err := json.NewDecoder(r.Body).Decode(user)
 	if err != nil {
-		err := e.NewError("User not found", []types.ErrorField{},
-			http.StatusInternalServerError)
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
 		e.WriteError(w, err)
 		return err
 	}
 
-	err = user.ConfirmUser(nonce)
+	err = user.ResendConfirmation()
 	if err != nil {
-		err := e.NewError("Failed to confirm user", []types.ErrorField{},
-			http.StatusInternalServerError)
 		e.WriteError(w, err)
 		return err
 	}
 
-	resp := response.New(true, "User's email has been confirmed")
+	resp := response.New(true, "If the account exists and is unconfirmed a confirmation link has been sent")
+	resp.Respond(w)
+
+	return nil
+}
+
+// ChangeEmail starts a change of the current user's email address.
+func ChangeEmail(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
+	w.Header().Set("X-XSS-Protection", "1; mode=block")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	emailChange := models.NewEmailChange(state)
+	err := json.NewDecoder(r.Body).Decode(emailChange)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	err = emailChange.Request(auth.PrincipalFromContext(r.Context()).UserID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "A confirmation link has been sent to the new email address")
+	resp.Respond(w)
+
+	return nil
+}
+
+func ConfirmEmailChange(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
+	w.Header().Set("X-XSS-Protection", "1; mode=block")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	emailChange := models.NewEmailChange(state)
+	emailChange.Token = mux.Vars(r)["token"]
+	err := emailChange.Confirm()
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+
+	resp := response.New(true, "Email address has been changed")
+	resp.Set("email", emailChange.Email)
+	resp.Respond(w)
+
+	return nil
+}
+
+// DeleteCurrentUser schedules the current user's account for deletion.
+func DeleteCurrentUser(w http.ResponseWriter, r *http.Request, state *state.ServerState) error {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("X-FRAME-OPTIONS", "SAMEORIGIN")
+	w.Header().Set("X-XSS-Protection", "1; mode=block")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	deletion := models.NewAccountDeletion(state)
+	err := json.NewDecoder(r.Body).Decode(deletion)
+	if err != nil {
+		err = e.Wrap("Invalid request", http.StatusBadRequest, err)
+		e.WriteError(w, err)
+		return err
+	}
+
+	err = deletion.Request(auth.PrincipalFromContext(r.Context()).UserID)
+	if err != nil {
+		e.WriteError(w, err)
+		return err
+	}
+	auth.ClearSessionCookies(w, state)
+
+	resp := response.New(true, "Account has been scheduled for deletion, log in before it is purged to cancel")
+	resp.Set("purgeAt", deletion.PurgeAt)
 	resp.Respond(w)
 
 	return nil
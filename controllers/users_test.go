@@ -13,6 +13,7 @@ import (
 
 	"github.com/donohutcheon/gowebserver/datalayer"
 	"github.com/donohutcheon/gowebserver/models"
+	"github.com/donohutcheon/gowebserver/router/auth"
 	"github.com/donohutcheon/gowebserver/state"
 	"github.com/donohutcheon/gowebserver/state/facotory"
 	"github.com/stretchr/testify/assert"
@@ -59,6 +60,9 @@ func getCurrentUser(t *testing.T, ctx context.Context, cl *http.Client,
 	assert.Equal(t, params.expResponse.Status, gotResp.Status)
 	assert.Equal(t, params.expResponse.Message, gotResp.Message)
 	assert.Equal(t, params.expResponse.User.Email, gotResp.User.Email)
+	if params.expResponse.User.Roles != nil {
+		assert.Equal(t, params.expResponse.User.Roles, gotResp.User.Roles)
+	}
 
 	return gotResp
 }
@@ -138,6 +142,31 @@ func TestGetCurrentUser(t *testing.T) {
 				expHTTPStatus: http.StatusOK,
 			},
 		},
+		{
+			name: "Plain user",
+			authParameters: AuthParameters{
+				authRequest: models.User{
+					Email:    "reptile@netherrealm.com",
+					Password: "secret",
+				},
+				expHTTPStatus: http.StatusOK,
+				expLoginResp: AuthResponse{
+					Message: "Logged In",
+					Status:  true,
+				},
+			},
+			getCurrentUserParams: GetCurrentUserParameters{
+				expResponse: UserControllerResponse{
+					Message: "success",
+					Status:  true,
+					User: models.User{
+						Email: "reptile@netherrealm.com",
+						Roles: []string{"USER"},
+					},
+				},
+				expHTTPStatus: http.StatusOK,
+			},
+		},
 	}
 
 	callbacks := state.NewMockCallbacks(mailCallback)
@@ -238,4 +267,60 @@ func TestCreateUser(t *testing.T) {
 			login(t, ctx, cl, state.URL, test.authParameters)
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestRoleChangeEndsSession(t *testing.T) {
+	cl := new(http.Client)
+	callbacks := state.NewMockCallbacks(mailCallback)
+	state := facotory.NewForTesting(t, callbacks)
+	ctx := state.Context
+
+	gotAuthResp := login(t, ctx, cl, state.URL, AuthParameters{
+		authRequest: models.User{
+			Email:    "subzero@dreamrealm.com",
+			Password: "secret",
+		},
+		expHTTPStatus: http.StatusOK,
+		expLoginResp: AuthResponse{
+			Message: "Logged In",
+			Status:  true,
+		},
+	})
+
+	// Demoting the user invalidates access tokens claiming the admin role.
+	err := state.DataLayer.SetUserRoleByID(1, datalayer.UserRoleUser)
+	require.NoError(t, err)
+
+	getCurrentUser(t, ctx, cl, state.URL, gotAuthResp, &GetCurrentUserParameters{
+		expResponse: UserControllerResponse{
+			Message: "Session roles have changed, please log in again",
+			Status:  false,
+		},
+		expHTTPStatus: http.StatusForbidden,
+	})
+
+	// Refreshing picks up the new role.
+	gotAuthResp = refreshToken(t, ctx, cl, state.URL, RefreshTokenParameters{
+		request: auth.RefreshJWTReq{
+			GrantType:    "refresh_token",
+			RefreshToken: gotAuthResp.Token.RefreshToken,
+		},
+		expHTTPStatus: http.StatusOK,
+		expResponse: AuthResponse{
+			Message: "Tokens refreshed",
+			Status:  true,
+		},
+	})
+
+	getCurrentUser(t, ctx, cl, state.URL, gotAuthResp, &GetCurrentUserParameters{
+		expResponse: UserControllerResponse{
+			Message: "success",
+			Status:  true,
+			User: models.User{
+				Email: "subzero@dreamrealm.com",
+				Roles: []string{"USER"},
+			},
+		},
+		expHTTPStatus: http.StatusOK,
+	})
+}
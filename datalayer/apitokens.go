@@ -0,0 +1,100 @@
+package datalayer
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type APIToken struct {
+	Model
+	UserID      int64        `json:"userID" db:"user_id"`
+	Name        string       `json:"name" db:"name"`
+	TokenHash   string       `json:"-" db:"token_hash"`
+	TokenPrefix string       `json:"prefix" db:"token_prefix"`
+	Scopes      string       `json:"scopes" db:"scopes"`
+	LastUsedAt  JsonNullTime `json:"lastUsedAt" db:"last_used_at"`
+	ExpiresAt   JsonNullTime `json:"expiresAt" db:"expires_at"`
+	RevokedAt   JsonNullTime `json:"revokedAt" db:"revoked_at"`
+}
+
+func (p *PersistenceDataLayer) CreateAPIToken(apiToken *APIToken) (int64, error) {
+	const cols = "user_id, name, token_hash, token_prefix, scopes, expires_at"
+	var bindCols = ":" + strings.ReplaceAll(cols, ", ", ", :")
+
+	statement := fmt.Sprintf("insert into api_tokens(%s) values (%s)", cols, bindCols)
+	result, err := p.GetConn().NamedExec(statement, apiToken)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (p *PersistenceDataLayer) GetAPITokenByID(id int64) (*APIToken, error) {
+	apiToken := new(APIToken)
+	row := p.GetConn().QueryRowx(`SELECT * FROM api_tokens WHERE id=?`, id)
+	err := row.StructScan(apiToken)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return apiToken, nil
+}
+
+func (p *PersistenceDataLayer) GetAPITokenByHash(tokenHash string) (*APIToken, error) {
+	apiToken := new(APIToken)
+	row := p.GetConn().QueryRowx(`SELECT * FROM api_tokens WHERE token_hash=?`, tokenHash)
+	err := row.StructScan(apiToken)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return apiToken, nil
+}
+
+// GetAPITokensByUserID returns the tokens of a user that have not been revoked.
+func (p *PersistenceDataLayer) GetAPITokensByUserID(userID int64) ([]*APIToken, error) {
+	apiTokens := make([]*APIToken, 0)
+	err := p.GetConn().Select(&apiTokens, `SELECT * FROM api_tokens WHERE user_id=? and revoked_at is null ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return apiTokens, nil
+}
+
+func (p *PersistenceDataLayer) RevokeAPIToken(id, userID int64) error {
+	result, err := p.GetConn().Exec("update api_tokens set revoked_at = now() where id = ? and user_id = ? and revoked_at is null", id, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
+
+func (p *PersistenceDataLayer) SetAPITokenLastUsedAt(id int64, lastUsedAt time.Time) error {
+	_, err := p.GetConn().Exec("update api_tokens set last_used_at = ? where id = ?", lastUsedAt, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
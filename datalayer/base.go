@@ -2,6 +2,7 @@ package datalayer
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
@@ -22,6 +23,11 @@ type PersistenceDataLayer struct {
 
 var (
 	ErrNoData = sql.ErrNoRows
+	// ErrInvalidStateTransition is returned when a user may not move from
+	// their current state to the requested one.
+	ErrInvalidStateTransition = errors.New("invalid user state transition")
+	// ErrDuplicate is returned when a row would violate a unique key.
+	ErrDuplicate = errors.New("duplicate key")
 )
 
 func New() (*PersistenceDataLayer, error){
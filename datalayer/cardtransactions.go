@@ -48,6 +48,49 @@ func (p *PersistenceDataLayer) CreateCardTransaction(cardTransaction *CardTransa
 	return id, nil
 }
 
+// CreateCardTransactions stores all of the card transactions or, if any
+// fails, none of them.
+func (p *PersistenceDataLayer) CreateCardTransactions(cardTransactions []*CardTransaction) ([]int64, error) {
+	const cols = "datetime, amount, currency_scale, currency_code, reference, merchant_name, merchant_city, merchant_country_code, merchant_country_name, merchant_category_code, merchant_category_name, user_id"
+	var bindCols = ":" + strings.ReplaceAll(cols, ", ", ", :")
+	statement := fmt.Sprintf("insert into card_transactions(%s) values (%s)", cols, bindCols)
+
+	tx, err := p.GetConn().Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := tx.PrepareNamed(statement)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	defer stmt.Close()
+
+	ids := make([]int64, 0, len(cardTransactions))
+	for _, cardTransaction := range cardTransactions {
+		result, err := stmt.Exec(cardTransaction)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
 func (p *PersistenceDataLayer) GetCardTransactionByID(id int64) (*CardTransaction, error) {
 	cardTransaction := new(CardTransaction)
 	statement := "SELECT * FROM card_transactions WHERE id=?"
@@ -80,7 +123,7 @@ func (p *PersistenceDataLayer) GetCardTransactionsByUserID(userID int64, sortabl
 	//offset := pageParams.Page * pageParams.FetchCount
 	pagination := pageParams.BuildPagination(dbSortField)
 	//pagination := fmt.Sprintf(" order by %s %s, id %s limit %d, %d", dbSortField, pageParams.SortDir, pageParams.SortDir, offset, pageParams.FetchCount)
-	statement := "SELECT * FROM card_transactions WHERE user_id=? " + filterSQL + pagination
+	statement := "SELECT * FROM card_transactions WHERE user_id=? AND deleted_at IS NULL AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL) " + filterSQL + pagination
 	fmt.Println(statement)
 	var bindValues []interface{}
 	bindValues = append(bindValues, userID)
@@ -105,6 +148,85 @@ func (p *PersistenceDataLayer) GetCardTransactionsByUserID(userID int64, sortabl
 	return cardTransactions, nil
 }
 
+// GetCardTransactionByIDAndUserID returns a card transaction of a user
+// unless it has been deleted.
+func (p *PersistenceDataLayer) GetCardTransactionByIDAndUserID(id, userID int64) (*CardTransaction, error) {
+	cardTransaction := new(CardTransaction)
+	statement := "SELECT * FROM card_transactions WHERE id=? AND user_id=? AND deleted_at IS NULL"
+	row := p.GetConn().QueryRowx(statement, id, userID)
+	err := row.StructScan(cardTransaction)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return cardTransaction, nil
+}
+
+func (p *PersistenceDataLayer) UpdateCardTransaction(cardTransaction *CardTransaction) error {
+	statement := `update card_transactions set datetime = :datetime, amount = :amount, currency_scale = :currency_scale,
+		currency_code = :currency_code, reference = :reference, merchant_name = :merchant_name,
+		merchant_city = :merchant_city, merchant_country_code = :merchant_country_code,
+		merchant_country_name = :merchant_country_name, merchant_category_code = :merchant_category_code,
+		merchant_category_name = :merchant_category_name
+		where id = :id and user_id = :user_id and deleted_at is null`
+	_, err := p.GetConn().NamedExec(statement, cardTransaction)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteCardTransaction soft deletes a card transaction of a user.
+func (p *PersistenceDataLayer) DeleteCardTransaction(id, userID int64) error {
+	result, err := p.GetConn().Exec("update card_transactions set deleted_at = now() where id = ? and user_id = ? and deleted_at is null", id, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
+
+// StreamCardTransactionsByUserID calls fn with each of a user's card
+// transactions that match the filter, in date order, as they are read from
+// the database.  The transactions are never all held in memory.  Reading
+// stops at the first error returned by fn.
+func (p *PersistenceDataLayer) StreamCardTransactionsByUserID(userID int64, filter filters.CardTransactionFilter, fn func(*CardTransaction) error) error {
+	filterSQL, filterValues := GetFilterCriteria(filter)
+	statement := "SELECT * FROM card_transactions WHERE user_id=? AND deleted_at IS NULL AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL) " + filterSQL + " order by datetime, id"
+
+	bindValues := append([]interface{}{userID}, filterValues...)
+	rows, err := p.GetConn().Queryx(statement, bindValues...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		cardTransaction := new(CardTransaction)
+		err = rows.StructScan(cardTransaction)
+		if err != nil {
+			return err
+		}
+
+		err = fn(cardTransaction)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
 func GetFilterCriteria(filter filters.CardTransactionFilter) (string, []interface{}) {
 	builder := new(strings.Builder)
 	var values []interface{}
@@ -46,7 +46,7 @@ func (p *PersistenceDataLayer) GetContactByID(id int64) (*Contact, error) {
 func (p *PersistenceDataLayer) GetContactsByUserID(userID int64) ([]*Contact, error) {
 	contacts := make([]*Contact, 0)
 
-	rows, err := p.GetConn().Query(`SELECT id, name, phone, created_at, updated_at, deleted_at FROM contacts WHERE user_id=?`, userID)
+	rows, err := p.GetConn().Query(`SELECT id, name, phone, created_at, updated_at, deleted_at FROM contacts WHERE user_id=? AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)`, userID)
 	if err == sql.ErrNoRows {
 		fmt.Println(false, "User account does not exist. Please re-login")
 		return nil, ErrNoData
@@ -1,6 +1,8 @@
 package datalayer
 
 import (
+	"time"
+
 	"github.com/donohutcheon/gowebserver/models/filters"
 	"github.com/donohutcheon/gowebserver/models/pagination"
 )
@@ -15,13 +17,62 @@ const (
 	UserStateConfirmed   UserState = "CONFIRMED"
 )
 
+// userStateTransitions is the sign-up state machine.  Users move from
+// UNCONFIRMED through PROCESSING, while the confirmation email is prepared,
+// to PENDING and finally CONFIRMED.  A failed or resent confirmation moves
+// them back to UNCONFIRMED or PROCESSING.  Users whose email address has
+// been verified elsewhere, e.g. by an identity provider, are confirmed
+// directly.
+var userStateTransitions = map[UserState][]UserState{
+	UserStateUnconfirmed: {UserStateProcessing, UserStateConfirmed},
+	UserStateProcessing:  {UserStatePending, UserStateUnconfirmed, UserStateConfirmed},
+	UserStatePending:     {UserStateProcessing, UserStateConfirmed},
+}
+
+// CanTransitionTo reports whether a user in state s may move to state next.
+func (s UserState) CanTransitionTo(next UserState) bool {
+	for _, allowed := range userStateTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+
+	return false
+}
+
+type UserRole string
+
+const (
+	UserRoleUser  UserRole = "USER"
+	UserRoleAdmin UserRole = "ADMIN"
+)
+
 type DataLayer interface {
 	// Users
 	GetUserByEmail(email string) (*User, error)
 	GetUserByID(id int64) (*User, error)
-	CreateUser(email, password string) (int64, error)
+	CreateUser(email, password string, role UserRole) (int64, error)
 	GetUnconfirmedUsers() ([]User, error)
 	SetUserStateByID(id int64, state UserState) error
+	SetUserLoggedOutAtByID(id int64, loggedOutAt time.Time) error
+	SetUserConfirmationSentAtByID(id int64, sentAt time.Time, interval time.Duration) error
+	SetUserPasswordResetSentAtByID(id int64, sentAt time.Time, interval time.Duration) error
+	SetUserPasswordByID(id int64, password string) error
+	SetUserRoleByID(id int64, role UserRole) error
+	SetUserEmailByID(id int64, email string) error
+	SetUserProfileByID(id int64, user *User) error
+	SoftDeleteUserByID(id int64, deletedAt time.Time) error
+	RestoreUserByID(id int64) error
+	GetDeletedUserByEmail(email string) (*User, error)
+	GetUsersDeletedBefore(deletedBefore time.Time) ([]*User, error)
+	PurgeUserByID(id int64) error
+	GetUsers(sortable pagination.Sortable, filter filters.UserFilter) ([]*User, error)
+	DisableUserByID(id int64, disabledAt time.Time) error
+	EnableUserByID(id int64) error
+
+	// User Settings
+	GetUserSettingsByUserID(userID int64) (*UserSettings, error)
+	SaveUserSettings(settings *UserSettings) error
 
 	// Contacts
 	CreateContact(name, phone string, userID int64) (int64, error)
@@ -32,8 +83,129 @@ type DataLayer interface {
 	CreateCardTransaction(*CardTransaction) (int64, error)
 	GetCardTransactionByID(id int64) (*CardTransaction, error)
 	GetCardTransactionsByUserID(userID int64, sortable pagination.Sortable, filter filters.CardTransactionFilter) ([]*CardTransaction, error)
+	GetCardTransactionByIDAndUserID(id, userID int64) (*CardTransaction, error)
+	CreateCardTransactions(cardTransactions []*CardTransaction) ([]int64, error)
+	StreamCardTransactionsByUserID(userID int64, filter filters.CardTransactionFilter, fn func(*CardTransaction) error) error
+	UpdateCardTransaction(cardTransaction *CardTransaction) error
+	DeleteCardTransaction(id, userID int64) error
 
 	// SignUpConfirmations
-	CreateSignUpConfirmation(nonce string, userID int64) (int64, error)
+	CreateSignUpConfirmation(nonce string, userID int64, expiresAt time.Time) (int64, error)
 	LookupSignUpConfirmation(nonce string) (*SignUpConfirmation, error)
+	GetLatestSignUpConfirmationByUserID(userID int64) (*SignUpConfirmation, error)
+	ConsumeSignUpConfirmation(id int64) error
+	ExpireSignUpConfirmationsByUserID(userID int64) error
+
+	// RefreshTokens
+	CreateRefreshToken(jti, familyID string, userID int64, expiresAt time.Time) (int64, error)
+	GetRefreshTokenByJTI(jti string) (*RefreshToken, error)
+	RotateRefreshToken(jti string) error
+	RevokeRefreshTokenFamily(familyID string) error
+	RevokeRefreshTokensByUserID(userID int64) error
+	IsRefreshTokenFamilyRevoked(familyID string) (bool, error)
+
+	// SigningKeys
+	CreateSigningKey(kid, algorithm, privateKey string, expiresAt time.Time) (int64, error)
+	GetActiveSigningKeys() ([]*SigningKey, error)
+
+	// APITokens
+	CreateAPIToken(apiToken *APIToken) (int64, error)
+	GetAPITokenByID(id int64) (*APIToken, error)
+	GetAPITokenByHash(tokenHash string) (*APIToken, error)
+	GetAPITokensByUserID(userID int64) ([]*APIToken, error)
+	RevokeAPIToken(id, userID int64) error
+	SetAPITokenLastUsedAt(id int64, lastUsedAt time.Time) error
+
+	// RequestSigningKeys
+	CreateRequestSigningKey(key *RequestSigningKey) (int64, error)
+	GetRequestSigningKeyByID(id int64) (*RequestSigningKey, error)
+	GetRequestSigningKeyByKeyID(keyID string) (*RequestSigningKey, error)
+	GetRequestSigningKeysByUserID(userID int64) ([]*RequestSigningKey, error)
+	RevokeRequestSigningKey(id, userID int64) error
+	SetRequestSigningKeyLastUsedAt(id int64, lastUsedAt time.Time) error
+
+	// IdempotencyKeys
+	CreateIdempotencyKey(key *IdempotencyKey) (int64, error)
+	GetIdempotencyKey(userID int64, key string) (*IdempotencyKey, error)
+	SetIdempotencyKeyResponse(id int64, statusCode int, headers string, body []byte) error
+	DeleteIdempotencyKey(id int64) error
+	DeleteIdempotencyKeysExpiredBefore(t time.Time) (int64, error)
+
+	// PasswordResets
+	CreatePasswordReset(tokenHash string, userID int64, expiresAt time.Time) (int64, error)
+	LookupPasswordReset(tokenHash string) (*PasswordReset, error)
+	ConsumePasswordReset(id int64) error
+	ConsumePasswordResetsByUserID(userID int64) error
+	ExpirePasswordResetsByUserID(userID int64) error
+
+	// MagicLinks
+	CreateMagicLink(tokenHash string, userID int64, expiresAt time.Time) (int64, error)
+	LookupMagicLink(tokenHash string) (*MagicLink, error)
+	ConsumeMagicLink(id int64) error
+	ExpireMagicLinksByUserID(userID int64) error
+
+	// EmailChanges
+	CreateEmailChange(tokenHash string, userID int64, newEmail string, expiresAt time.Time) (int64, error)
+	LookupEmailChange(tokenHash string) (*EmailChange, error)
+	ConsumeEmailChange(id int64) error
+	ConsumeEmailChangesByUserID(userID int64) error
+
+	// TwoFactor
+	CreateTOTPCredential(userID int64, secret string) (int64, error)
+	GetTOTPCredentialByUserID(userID int64) (*TOTPCredential, error)
+	ConfirmTOTPCredential(userID int64) error
+	SetTOTPCredentialLastUsedStep(userID int64, step int64) error
+	IncrementTOTPFailedAttempts(userID int64) error
+	ResetTOTPFailedAttempts(userID int64) error
+	DeleteTOTPCredentialByUserID(userID int64) error
+	CreateRecoveryCodes(userID int64, codeHashes []string) error
+	ConsumeRecoveryCode(userID int64, codeHash string) error
+	DeleteRecoveryCodesByUserID(userID int64) error
+
+	// LoginThrottles
+	GetLoginThrottle(kind, key string) (*LoginThrottle, error)
+	RecordLoginFailure(kind, key string, at, windowStart time.Time) (*LoginThrottle, error)
+	SetLoginThrottleLockedUntil(kind, key string, lockedUntil time.Time) error
+	DeleteLoginThrottle(kind, key string) error
+
+	// AccountUnlocks
+	CreateAccountUnlock(tokenHash string, userID int64, expiresAt time.Time) (int64, error)
+	LookupAccountUnlock(tokenHash string) (*AccountUnlock, error)
+	ConsumeAccountUnlock(id int64) error
+
+	// Identities
+	CreateIdentity(provider, subject string, userID int64, email string) (int64, error)
+	GetIdentity(provider, subject string) (*Identity, error)
+	CreateOIDCLogin(stateHash, provider, nonce, codeVerifier string, userID int64, expiresAt time.Time) (int64, error)
+	LookupOIDCLogin(stateHash string) (*OIDCLogin, error)
+	ConsumeOIDCLogin(id int64) error
+
+	// Sessions
+	CreateSession(session *Session) (int64, error)
+	GetSessionByID(id int64) (*Session, error)
+	GetSessionByFamilyID(familyID string) (*Session, error)
+	GetSessionsByUserID(userID int64) ([]*Session, error)
+	TouchSession(id int64, userAgent, ipAddress, deviceName string, lastSeenAt time.Time) error
+	RevokeSession(id int64) error
+	RevokeSessionByFamilyID(familyID string) error
+	RevokeSessionsByUserID(userID int64) error
+
+	// Impersonation
+	CreateImpersonationAudit(audit *ImpersonationAudit) (int64, error)
+	GetImpersonationAuditsByUserID(userID int64, sortable pagination.Sortable) ([]*ImpersonationAudit, error)
+
+	// OAuth
+	CreateOAuthClient(client *OAuthClient) (int64, error)
+	GetOAuthClientByID(id int64) (*OAuthClient, error)
+	GetOAuthClientByClientID(clientID string) (*OAuthClient, error)
+	GetOAuthClientsByUserID(userID int64) ([]*OAuthClient, error)
+	DeleteOAuthClient(id, userID int64) error
+	CreateOAuthAuthorizationCode(code *OAuthAuthorizationCode) (int64, error)
+	LookupOAuthAuthorizationCode(codeHash string) (*OAuthAuthorizationCode, error)
+	ConsumeOAuthAuthorizationCode(id int64) error
+	CreateOAuthToken(token *OAuthToken) (int64, error)
+	GetOAuthTokenByAccessHash(accessTokenHash string) (*OAuthToken, error)
+	GetOAuthTokenByRefreshHash(refreshTokenHash string) (*OAuthToken, error)
+	RotateOAuthToken(id int64, oldRefreshTokenHash, accessTokenHash string, accessExpiresAt time.Time, refreshTokenHash string) error
+	RevokeOAuthToken(id int64) error
 }
\ No newline at end of file
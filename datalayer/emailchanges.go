@@ -0,0 +1,70 @@
+package datalayer
+
+import (
+	"database/sql"
+	"time"
+)
+
+type EmailChange struct {
+	Model
+	TokenHash string       `json:"-" db:"token_hash"`
+	UserID    int64        `json:"userID" db:"user_id"`
+	NewEmail  string       `json:"newEmail" db:"new_email"`
+	ExpiresAt JsonNullTime `json:"expiresAt" db:"expires_at"`
+	UsedAt    JsonNullTime `json:"usedAt" db:"used_at"`
+}
+
+func (p *PersistenceDataLayer) CreateEmailChange(tokenHash string, userID int64, newEmail string, expiresAt time.Time) (int64, error) {
+	result, err := p.GetConn().Exec("insert into email_changes(token_hash, user_id, new_email, expires_at) values (?, ?, ?, ?)",
+		tokenHash, userID, newEmail, expiresAt)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (p *PersistenceDataLayer) LookupEmailChange(tokenHash string) (*EmailChange, error) {
+	emailChange := new(EmailChange)
+	row := p.GetConn().QueryRowx(`SELECT * FROM email_changes WHERE token_hash=?`, tokenHash)
+	err := row.StructScan(emailChange)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return emailChange, nil
+}
+
+// ConsumeEmailChange marks an email change as used.  ErrNoData is returned if
+// it was already used, so that a confirmation link only ever works once.
+func (p *PersistenceDataLayer) ConsumeEmailChange(id int64) error {
+	result, err := p.GetConn().Exec("update email_changes set used_at = now() where id = ? and used_at is null", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
+
+func (p *PersistenceDataLayer) ConsumeEmailChangesByUserID(userID int64) error {
+	_, err := p.GetConn().Exec("update email_changes set used_at = now() where user_id = ? and used_at is null", userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package datalayer
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlDuplicateEntry is the MySQL error number of a unique key violation.
+const mysqlDuplicateEntry = 1062
+
+// IdempotencyKey records the first request a user made with an
+// Idempotency-Key header, and the response it got, so that retries of the
+// request are answered with the same response.  StatusCode is null while the
+// first request is still being handled.  ResponseHeaders holds the response
+// header encoded as JSON.
+type IdempotencyKey struct {
+	Model
+	UserID          int64          `json:"userID" db:"user_id"`
+	Key             string         `json:"key" db:"idempotency_key"`
+	RequestHash     string         `json:"-" db:"request_hash"`
+	StatusCode      sql.NullInt64  `json:"-" db:"status_code"`
+	ResponseHeaders sql.NullString `json:"-" db:"response_headers"`
+	ResponseBody    []byte         `json:"-" db:"response_body"`
+	ExpiresAt       JsonNullTime   `json:"expiresAt" db:"expires_at"`
+}
+
+// CreateIdempotencyKey claims a key for a user.  ErrDuplicate is returned if
+// the user already holds the key.
+func (p *PersistenceDataLayer) CreateIdempotencyKey(key *IdempotencyKey) (int64, error) {
+	const cols = "user_id, idempotency_key, request_hash, expires_at"
+	var bindCols = ":" + strings.ReplaceAll(cols, ", ", ", :")
+
+	statement := fmt.Sprintf("insert into idempotency_keys(%s) values (%s)", cols, bindCols)
+	result, err := p.GetConn().NamedExec(statement, key)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry {
+		return 0, ErrDuplicate
+	} else if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (p *PersistenceDataLayer) GetIdempotencyKey(userID int64, key string) (*IdempotencyKey, error) {
+	idempotencyKey := new(IdempotencyKey)
+	row := p.GetConn().QueryRowx(`SELECT * FROM idempotency_keys WHERE user_id=? and idempotency_key=?`, userID, key)
+	err := row.StructScan(idempotencyKey)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return idempotencyKey, nil
+}
+
+// SetIdempotencyKeyResponse stores the response to the request that claimed
+// the key.
+func (p *PersistenceDataLayer) SetIdempotencyKeyResponse(id int64, statusCode int, headers string, body []byte) error {
+	_, err := p.GetConn().Exec("update idempotency_keys set status_code = ?, response_headers = ?, response_body = ? where id = ?",
+		statusCode, headers, body, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *PersistenceDataLayer) DeleteIdempotencyKey(id int64) error {
+	_, err := p.GetConn().Exec("delete from idempotency_keys where id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteIdempotencyKeysExpiredBefore deletes the keys that expired before t
+// and returns how many were deleted.
+func (p *PersistenceDataLayer) DeleteIdempotencyKeysExpiredBefore(t time.Time) (int64, error) {
+	result, err := p.GetConn().Exec("delete from idempotency_keys where expires_at < ?", t)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,105 @@
+package datalayer
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Identity links an account at an external identity provider to a user.
+type Identity struct {
+	Model
+	Provider string `json:"provider" db:"provider"`
+	Subject  string `json:"subject" db:"subject"`
+	UserID   int64  `json:"userID" db:"user_id"`
+	Email    string `json:"email" db:"email"`
+}
+
+// OIDCLogin is a login started at an external identity provider, waiting for
+// the provider to redirect back.  UserID is set when a signed in user is
+// linking the identity to their account rather than logging in.
+type OIDCLogin struct {
+	Model
+	StateHash    string        `json:"-" db:"state_hash"`
+	Provider     string        `json:"provider" db:"provider"`
+	Nonce        string        `json:"-" db:"nonce"`
+	CodeVerifier string        `json:"-" db:"code_verifier"`
+	UserID       sql.NullInt64 `json:"-" db:"user_id"`
+	ExpiresAt    JsonNullTime  `json:"expiresAt" db:"expires_at"`
+	UsedAt       JsonNullTime  `json:"usedAt" db:"used_at"`
+}
+
+func (p *PersistenceDataLayer) CreateIdentity(provider, subject string, userID int64, email string) (int64, error) {
+	result, err := p.GetConn().Exec("insert into identities(provider, subject, user_id, email) values (?, ?, ?, ?)",
+		provider, subject, userID, email)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (p *PersistenceDataLayer) GetIdentity(provider, subject string) (*Identity, error) {
+	identity := new(Identity)
+	row := p.GetConn().QueryRowx(`SELECT * FROM identities WHERE provider=? AND subject=?`, provider, subject)
+	err := row.StructScan(identity)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return identity, nil
+}
+
+// CreateOIDCLogin records a login, or a link to the account of userID when
+// userID is not zero.
+func (p *PersistenceDataLayer) CreateOIDCLogin(stateHash, provider, nonce, codeVerifier string, userID int64, expiresAt time.Time) (int64, error) {
+	result, err := p.GetConn().Exec("insert into oidc_logins(state_hash, provider, nonce, code_verifier, user_id, expires_at) values (?, ?, ?, ?, ?, ?)",
+		stateHash, provider, nonce, codeVerifier, sql.NullInt64{Int64: userID, Valid: userID != 0}, expiresAt)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (p *PersistenceDataLayer) LookupOIDCLogin(stateHash string) (*OIDCLogin, error) {
+	login := new(OIDCLogin)
+	row := p.GetConn().QueryRowx(`SELECT * FROM oidc_logins WHERE state_hash=?`, stateHash)
+	err := row.StructScan(login)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return login, nil
+}
+
+// ConsumeOIDCLogin marks a login as used.  ErrNoData is returned if it was
+// already used, so that a provider response cannot be replayed.
+func (p *PersistenceDataLayer) ConsumeOIDCLogin(id int64) error {
+	result, err := p.GetConn().Exec("update oidc_logins set used_at = now() where id = ? and used_at is null", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
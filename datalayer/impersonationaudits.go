@@ -0,0 +1,66 @@
+package datalayer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/donohutcheon/gowebserver/models/pagination"
+)
+
+// ImpersonationAudit records a request an administrator made while
+// impersonating a user.  Entries outlive the users they refer to.
+type ImpersonationAudit struct {
+	Model
+	ActorID    int64  `json:"actorID" db:"actor_id"`
+	UserID     int64  `json:"userID" db:"user_id"`
+	Method     string `json:"method" db:"method"`
+	Path       string `json:"path" db:"path"`
+	StatusCode int    `json:"statusCode" db:"status_code"`
+	IPAddress  string `json:"ipAddress" db:"ip_address"`
+}
+
+// ImpersonationAuditSortColumns maps the sort fields accepted by the API to
+// table columns.
+var ImpersonationAuditSortColumns = map[string]string{
+	"id":        "id",
+	"createdAt": "created_at",
+	"actorID":   "actor_id",
+}
+
+func (p *PersistenceDataLayer) CreateImpersonationAudit(audit *ImpersonationAudit) (int64, error) {
+	const cols = "actor_id, user_id, method, path, status_code, ip_address"
+	var bindCols = ":" + strings.ReplaceAll(cols, ", ", ", :")
+
+	statement := fmt.Sprintf("insert into impersonation_audits(%s) values (%s)", cols, bindCols)
+	result, err := p.GetConn().NamedExec(statement, audit)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// GetImpersonationAuditsByUserID lists the requests made while impersonating
+// the user a page at a time.
+func (p *PersistenceDataLayer) GetImpersonationAuditsByUserID(userID int64, sortable pagination.Sortable) ([]*ImpersonationAudit, error) {
+	audits := make([]*ImpersonationAudit, 0)
+	pageParams := sortable.GetPagination()
+
+	sortColumn, ok := ImpersonationAuditSortColumns[pageParams.SortField]
+	if !ok {
+		sortColumn = "id"
+	}
+
+	statement := "SELECT * FROM impersonation_audits WHERE user_id = ?" + pageParams.BuildPagination(sortColumn)
+	err := p.GetConn().Select(&audits, statement, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return audits, nil
+}
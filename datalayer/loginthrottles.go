@@ -0,0 +1,122 @@
+package datalayer
+
+import (
+	"database/sql"
+	"time"
+)
+
+type LoginThrottle struct {
+	Model
+	Kind           string       `json:"kind" db:"kind"`
+	ThrottleKey    string       `json:"throttleKey" db:"throttle_key"`
+	FailedAttempts int          `json:"failedAttempts" db:"failed_attempts"`
+	LastFailedAt   JsonNullTime `json:"lastFailedAt" db:"last_failed_at"`
+	LockedUntil    JsonNullTime `json:"lockedUntil" db:"locked_until"`
+}
+
+type AccountUnlock struct {
+	Model
+	TokenHash string       `json:"-" db:"token_hash"`
+	UserID    int64        `json:"userID" db:"user_id"`
+	ExpiresAt JsonNullTime `json:"expiresAt" db:"expires_at"`
+	UsedAt    JsonNullTime `json:"usedAt" db:"used_at"`
+}
+
+func (p *PersistenceDataLayer) GetLoginThrottle(kind, key string) (*LoginThrottle, error) {
+	throttle := new(LoginThrottle)
+	row := p.GetConn().QueryRowx(`SELECT * FROM login_throttles WHERE kind=? AND throttle_key=?`, kind, key)
+	err := row.StructScan(throttle)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return throttle, nil
+}
+
+// RecordLoginFailure counts a failed attempt and returns the updated
+// throttle.  Failures older than windowStart no longer count, so the counter
+// starts over.
+func (p *PersistenceDataLayer) RecordLoginFailure(kind, key string, at, windowStart time.Time) (*LoginThrottle, error) {
+	_, err := p.GetConn().Exec(`insert into login_throttles(kind, throttle_key, failed_attempts, last_failed_at) values (?, ?, 1, ?)
+		on duplicate key update failed_attempts = if(last_failed_at < ?, 1, failed_attempts + 1), last_failed_at = ?`,
+		kind, key, at, windowStart, at)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.GetLoginThrottle(kind, key)
+}
+
+func (p *PersistenceDataLayer) SetLoginThrottleLockedUntil(kind, key string, lockedUntil time.Time) error {
+	result, err := p.GetConn().Exec("update login_throttles set locked_until = ? where kind = ? and throttle_key = ?",
+		lockedUntil, kind, key)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
+
+func (p *PersistenceDataLayer) DeleteLoginThrottle(kind, key string) error {
+	_, err := p.GetConn().Exec("delete from login_throttles where kind = ? and throttle_key = ?", kind, key)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *PersistenceDataLayer) CreateAccountUnlock(tokenHash string, userID int64, expiresAt time.Time) (int64, error) {
+	result, err := p.GetConn().Exec("insert into account_unlocks(token_hash, user_id, expires_at) values (?, ?, ?)",
+		tokenHash, userID, expiresAt)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (p *PersistenceDataLayer) LookupAccountUnlock(tokenHash string) (*AccountUnlock, error) {
+	accountUnlock := new(AccountUnlock)
+	row := p.GetConn().QueryRowx(`SELECT * FROM account_unlocks WHERE token_hash=?`, tokenHash)
+	err := row.StructScan(accountUnlock)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return accountUnlock, nil
+}
+
+// ConsumeAccountUnlock marks an unlock link as used.  ErrNoData is returned if
+// it was already used.
+func (p *PersistenceDataLayer) ConsumeAccountUnlock(id int64) error {
+	result, err := p.GetConn().Exec("update account_unlocks set used_at = now() where id = ? and used_at is null", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package datalayer
+
+import (
+	"database/sql"
+	"time"
+)
+
+// MagicLink is a single use link that logs a user in without a password.
+type MagicLink struct {
+	Model
+	TokenHash string       `json:"-" db:"token_hash"`
+	UserID    int64        `json:"userID" db:"user_id"`
+	ExpiresAt JsonNullTime `json:"expiresAt" db:"expires_at"`
+	UsedAt    JsonNullTime `json:"usedAt" db:"used_at"`
+}
+
+func (p *PersistenceDataLayer) CreateMagicLink(tokenHash string, userID int64, expiresAt time.Time) (int64, error) {
+	result, err := p.GetConn().Exec("insert into magic_links(token_hash, user_id, expires_at) values (?, ?, ?)",
+		tokenHash, userID, expiresAt)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (p *PersistenceDataLayer) LookupMagicLink(tokenHash string) (*MagicLink, error) {
+	magicLink := new(MagicLink)
+	row := p.GetConn().QueryRowx(`SELECT * FROM magic_links WHERE token_hash=?`, tokenHash)
+	err := row.StructScan(magicLink)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return magicLink, nil
+}
+
+// ConsumeMagicLink marks a link as used.  ErrNoData is returned if it was
+// already used, so that a link only ever logs in once.
+func (p *PersistenceDataLayer) ConsumeMagicLink(id int64) error {
+	result, err := p.GetConn().Exec("update magic_links set used_at = now() where id = ? and used_at is null", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
+
+// ExpireMagicLinksByUserID ends the validity of every unused link of the
+// user, e.g. when a new one is sent.
+func (p *PersistenceDataLayer) ExpireMagicLinksByUserID(userID int64) error {
+	_, err := p.GetConn().Exec("update magic_links set expires_at = now() where user_id = ? and used_at is null and expires_at > now()", userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package mockdatalayer
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+)
+
+func (m *MockDataLayer) getNextAPITokenID() int64 {
+	var maxID int64 = 0
+	for _, apiToken := range m.APITokens {
+		if apiToken.ID > maxID {
+			maxID = apiToken.ID
+		}
+	}
+
+	return maxID + 1
+}
+
+func (m *MockDataLayer) CreateAPIToken(apiToken *datalayer.APIToken) (int64, error) {
+	apiToken.CreatedAt = datalayer.JsonNullTime{
+		NullTime: sql.NullTime{
+			Time:  time.Now(),
+			Valid: true,
+		},
+	}
+	apiToken.ID = m.getNextAPITokenID()
+
+	m.APITokens = append(m.APITokens, apiToken)
+
+	return apiToken.ID, nil
+}
+
+func (m *MockDataLayer) GetAPITokenByID(id int64) (*datalayer.APIToken, error) {
+	for _, apiToken := range m.APITokens {
+		if id == apiToken.ID {
+			return apiToken, nil
+		}
+	}
+
+	return nil, datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) GetAPITokenByHash(tokenHash string) (*datalayer.APIToken, error) {
+	for _, apiToken := range m.APITokens {
+		if tokenHash == apiToken.TokenHash {
+			return apiToken, nil
+		}
+	}
+
+	return nil, datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) GetAPITokensByUserID(userID int64) ([]*datalayer.APIToken, error) {
+	apiTokens := make([]*datalayer.APIToken, 0)
+	for _, apiToken := range m.APITokens {
+		if userID == apiToken.UserID && !apiToken.RevokedAt.Valid {
+			apiTokens = append(apiTokens, apiToken)
+		}
+	}
+
+	return apiTokens, nil
+}
+
+func (m *MockDataLayer) RevokeAPIToken(id, userID int64) error {
+	for _, apiToken := range m.APITokens {
+		if id == apiToken.ID && userID == apiToken.UserID && !apiToken.RevokedAt.Valid {
+			apiToken.RevokedAt = datalayer.JsonNullTime{
+				NullTime: sql.NullTime{
+					Time:  time.Now(),
+					Valid: true,
+				},
+			}
+			return nil
+		}
+	}
+
+	return datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) SetAPITokenLastUsedAt(id int64, lastUsedAt time.Time) error {
+	apiToken, err := m.GetAPITokenByID(id)
+	if err != nil {
+		return err
+	}
+
+	apiToken.LastUsedAt = datalayer.JsonNullTime{
+		NullTime: sql.NullTime{
+			Time:  lastUsedAt,
+			Valid: true,
+		},
+	}
+
+	return nil
+}
@@ -3,6 +3,7 @@ package mockdatalayer
 import (
 	"database/sql"
 	"github.com/donohutcheon/gowebserver/models/filters"
+	"sort"
 	"time"
 
 	"github.com/donohutcheon/gowebserver/datalayer"
@@ -34,6 +35,19 @@ func (m *MockDataLayer) CreateCardTransaction(cardTransaction *datalayer.CardTra
 	return cardTransaction.ID, nil
 }
 
+func (m *MockDataLayer) CreateCardTransactions(cardTransactions []*datalayer.CardTransaction) ([]int64, error) {
+	ids := make([]int64, 0, len(cardTransactions))
+	for _, cardTransaction := range cardTransactions {
+		id, err := m.CreateCardTransaction(cardTransaction)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
 func (m *MockDataLayer) GetCardTransactionByID(id int64) (*datalayer.CardTransaction, error) {
 	for _, cardTransaction := range m.CardTransactions {
 		if id == cardTransaction.ID {
@@ -48,7 +62,7 @@ func (m *MockDataLayer) GetCardTransactionsByUserID(userID int64, sortable pagin
 	var cardTransactions []*datalayer.CardTransaction
 	var cardTransaction *datalayer.CardTransaction
 	for _, cardTransaction = range m.CardTransactions {
-		if userID == cardTransaction.UserID {
+		if userID == cardTransaction.UserID && !cardTransaction.DeletedAt.Valid && !m.userDeleted(userID) {
 			cardTransactions = append(cardTransactions, cardTransaction)
 		}
 	}
@@ -58,4 +72,84 @@ func (m *MockDataLayer) GetCardTransactionsByUserID(userID int64, sortable pagin
 	}
 
 	return cardTransactions, nil
-}
\ No newline at end of file
+}
+
+func (m *MockDataLayer) GetCardTransactionByIDAndUserID(id, userID int64) (*datalayer.CardTransaction, error) {
+	for _, cardTransaction := range m.CardTransactions {
+		if id == cardTransaction.ID && userID == cardTransaction.UserID && !cardTransaction.DeletedAt.Valid {
+			return cardTransaction, nil
+		}
+	}
+
+	return nil, datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) UpdateCardTransaction(update *datalayer.CardTransaction) error {
+	cardTransaction, err := m.GetCardTransactionByIDAndUserID(update.ID, update.UserID)
+	if err != nil {
+		// Like the database, updating no rows is not an error.
+		return nil
+	}
+
+	cardTransaction.DateTime = update.DateTime
+	cardTransaction.Amount = update.Amount
+	cardTransaction.CurrencyScale = update.CurrencyScale
+	cardTransaction.CurrencyCode = update.CurrencyCode
+	cardTransaction.Reference = update.Reference
+	cardTransaction.MerchantName = update.MerchantName
+	cardTransaction.MerchantCity = update.MerchantCity
+	cardTransaction.MerchantCountryCode = update.MerchantCountryCode
+	cardTransaction.MerchantCountryName = update.MerchantCountryName
+	cardTransaction.MerchantCategoryCode = update.MerchantCategoryCode
+	cardTransaction.MerchantCategoryName = update.MerchantCategoryName
+	cardTransaction.UpdatedAt = now()
+
+	return nil
+}
+
+func (m *MockDataLayer) DeleteCardTransaction(id, userID int64) error {
+	cardTransaction, err := m.GetCardTransactionByIDAndUserID(id, userID)
+	if err != nil {
+		return err
+	}
+
+	cardTransaction.DeletedAt = now()
+
+	return nil
+}
+
+func matchesCardTransactionFilter(cardTransaction *datalayer.CardTransaction, filter filters.CardTransactionFilter) bool {
+	if filter.Amount.IsSet && (cardTransaction.Amount < filter.Amount.LowerBound || cardTransaction.Amount >= filter.Amount.UpperBound) {
+		return false
+	}
+	if filter.DateTime.IsSet && (cardTransaction.DateTime.Before(filter.DateTime.LowerBound) || !cardTransaction.DateTime.Before(filter.DateTime.UpperBound)) {
+		return false
+	}
+
+	return true
+}
+
+func (m *MockDataLayer) StreamCardTransactionsByUserID(userID int64, filter filters.CardTransactionFilter, fn func(*datalayer.CardTransaction) error) error {
+	if m.userDeleted(userID) {
+		return nil
+	}
+
+	var cardTransactions []*datalayer.CardTransaction
+	for _, cardTransaction := range m.CardTransactions {
+		if userID == cardTransaction.UserID && !cardTransaction.DeletedAt.Valid && matchesCardTransactionFilter(cardTransaction, filter) {
+			cardTransactions = append(cardTransactions, cardTransaction)
+		}
+	}
+	sort.SliceStable(cardTransactions, func(i, j int) bool {
+		return cardTransactions[i].DateTime.Before(cardTransactions[j].DateTime)
+	})
+
+	for _, cardTransaction := range cardTransactions {
+		err := fn(cardTransaction)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
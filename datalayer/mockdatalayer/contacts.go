@@ -34,6 +34,7 @@ func (m *MockDataLayer) CreateContact(name, phone string, userID int64) (int64,
 		},
 		Name: name,
 		Phone: phone,
+		UserID: userID,
 	}
 
 	m.Contacts = append(m.Contacts, contact)
@@ -55,7 +56,7 @@ func (m *MockDataLayer) GetContactsByUserID(userID int64) ([]*datalayer.Contact,
 	var contacts []*datalayer.Contact
 	var contact *datalayer.Contact
 	for _, contact = range m.Contacts {
-		if userID == contact.UserID {
+		if userID == contact.UserID && !m.userDeleted(userID) {
 			contacts = append(contacts, contact)
 		}
 	}
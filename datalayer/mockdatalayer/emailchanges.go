@@ -0,0 +1,88 @@
+package mockdatalayer
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+)
+
+func (m *MockDataLayer) getNextEmailChangeID() int64 {
+	var maxID int64 = math.MinInt64
+	for _, emailChange := range m.EmailChanges {
+		if emailChange.ID > maxID {
+			maxID = emailChange.ID
+		}
+	}
+
+	return maxID + 1
+}
+
+func (m *MockDataLayer) CreateEmailChange(tokenHash string, userID int64, newEmail string, expiresAt time.Time) (int64, error) {
+	emailChange := &datalayer.EmailChange{
+		Model: datalayer.Model{
+			ID: m.getNextEmailChangeID(),
+			CreatedAt: datalayer.JsonNullTime{
+				NullTime: sql.NullTime{
+					Time:  time.Now(),
+					Valid: true,
+				},
+			},
+		},
+		TokenHash: tokenHash,
+		UserID:    userID,
+		NewEmail:  newEmail,
+		ExpiresAt: datalayer.JsonNullTime{
+			NullTime: sql.NullTime{
+				Time:  expiresAt,
+				Valid: true,
+			},
+		},
+	}
+
+	m.EmailChanges = append(m.EmailChanges, emailChange)
+
+	return emailChange.ID, nil
+}
+
+func (m *MockDataLayer) LookupEmailChange(tokenHash string) (*datalayer.EmailChange, error) {
+	for _, emailChange := range m.EmailChanges {
+		if tokenHash == emailChange.TokenHash {
+			return emailChange, nil
+		}
+	}
+
+	return nil, datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) ConsumeEmailChange(id int64) error {
+	for _, emailChange := range m.EmailChanges {
+		if id == emailChange.ID && !emailChange.UsedAt.Valid {
+			emailChange.UsedAt = datalayer.JsonNullTime{
+				NullTime: sql.NullTime{
+					Time:  time.Now(),
+					Valid: true,
+				},
+			}
+			return nil
+		}
+	}
+
+	return datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) ConsumeEmailChangesByUserID(userID int64) error {
+	for _, emailChange := range m.EmailChanges {
+		if userID == emailChange.UserID && !emailChange.UsedAt.Valid {
+			emailChange.UsedAt = datalayer.JsonNullTime{
+				NullTime: sql.NullTime{
+					Time:  time.Now(),
+					Valid: true,
+				},
+			}
+		}
+	}
+
+	return nil
+}
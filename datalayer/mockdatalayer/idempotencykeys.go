@@ -0,0 +1,85 @@
+package mockdatalayer
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+)
+
+func (m *MockDataLayer) getNextIdempotencyKeyID() int64 {
+	var maxID int64 = 0
+	for _, key := range m.IdempotencyKeys {
+		if key.ID > maxID {
+			maxID = key.ID
+		}
+	}
+
+	return maxID + 1
+}
+
+func (m *MockDataLayer) CreateIdempotencyKey(key *datalayer.IdempotencyKey) (int64, error) {
+	for _, k := range m.IdempotencyKeys {
+		if key.UserID == k.UserID && key.Key == k.Key {
+			return 0, datalayer.ErrDuplicate
+		}
+	}
+
+	key.CreatedAt = now()
+	key.ID = m.getNextIdempotencyKeyID()
+
+	m.IdempotencyKeys = append(m.IdempotencyKeys, key)
+
+	return key.ID, nil
+}
+
+func (m *MockDataLayer) GetIdempotencyKey(userID int64, key string) (*datalayer.IdempotencyKey, error) {
+	for _, k := range m.IdempotencyKeys {
+		if userID == k.UserID && key == k.Key {
+			return k, nil
+		}
+	}
+
+	return nil, datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) SetIdempotencyKeyResponse(id int64, statusCode int, headers string, body []byte) error {
+	for _, k := range m.IdempotencyKeys {
+		if id == k.ID {
+			k.StatusCode = sql.NullInt64{Int64: int64(statusCode), Valid: true}
+			k.ResponseHeaders = sql.NullString{String: headers, Valid: true}
+			k.ResponseBody = body
+			k.UpdatedAt = now()
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (m *MockDataLayer) DeleteIdempotencyKey(id int64) error {
+	keys := m.IdempotencyKeys[:0]
+	for _, k := range m.IdempotencyKeys {
+		if id != k.ID {
+			keys = append(keys, k)
+		}
+	}
+	m.IdempotencyKeys = keys
+
+	return nil
+}
+
+func (m *MockDataLayer) DeleteIdempotencyKeysExpiredBefore(t time.Time) (int64, error) {
+	var deleted int64
+	keys := m.IdempotencyKeys[:0]
+	for _, k := range m.IdempotencyKeys {
+		if k.ExpiresAt.Valid && k.ExpiresAt.Time.Before(t) {
+			deleted++
+			continue
+		}
+		keys = append(keys, k)
+	}
+	m.IdempotencyKeys = keys
+
+	return deleted, nil
+}
@@ -0,0 +1,103 @@
+package mockdatalayer
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+)
+
+func (m *MockDataLayer) getNextIdentityID() int64 {
+	var maxID int64 = math.MinInt64
+	for _, identity := range m.Identities {
+		if identity.ID > maxID {
+			maxID = identity.ID
+		}
+	}
+
+	return maxID + 1
+}
+
+func (m *MockDataLayer) getNextOIDCLoginID() int64 {
+	var maxID int64 = math.MinInt64
+	for _, login := range m.OIDCLogins {
+		if login.ID > maxID {
+			maxID = login.ID
+		}
+	}
+
+	return maxID + 1
+}
+
+func (m *MockDataLayer) CreateIdentity(provider, subject string, userID int64, email string) (int64, error) {
+	identity := &datalayer.Identity{
+		Model: datalayer.Model{
+			ID:        m.getNextIdentityID(),
+			CreatedAt: now(),
+		},
+		Provider: provider,
+		Subject:  subject,
+		UserID:   userID,
+		Email:    email,
+	}
+
+	m.Identities = append(m.Identities, identity)
+
+	return identity.ID, nil
+}
+
+func (m *MockDataLayer) GetIdentity(provider, subject string) (*datalayer.Identity, error) {
+	for _, identity := range m.Identities {
+		if provider == identity.Provider && subject == identity.Subject {
+			return identity, nil
+		}
+	}
+
+	return nil, datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) CreateOIDCLogin(stateHash, provider, nonce, codeVerifier string, userID int64, expiresAt time.Time) (int64, error) {
+	login := &datalayer.OIDCLogin{
+		Model: datalayer.Model{
+			ID:        m.getNextOIDCLoginID(),
+			CreatedAt: now(),
+		},
+		StateHash:    stateHash,
+		Provider:     provider,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		UserID:       sql.NullInt64{Int64: userID, Valid: userID != 0},
+		ExpiresAt: datalayer.JsonNullTime{
+			NullTime: sql.NullTime{
+				Time:  expiresAt,
+				Valid: true,
+			},
+		},
+	}
+
+	m.OIDCLogins = append(m.OIDCLogins, login)
+
+	return login.ID, nil
+}
+
+func (m *MockDataLayer) LookupOIDCLogin(stateHash string) (*datalayer.OIDCLogin, error) {
+	for _, login := range m.OIDCLogins {
+		if stateHash == login.StateHash {
+			return login, nil
+		}
+	}
+
+	return nil, datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) ConsumeOIDCLogin(id int64) error {
+	for _, login := range m.OIDCLogins {
+		if id == login.ID && !login.UsedAt.Valid {
+			login.UsedAt = now()
+			return nil
+		}
+	}
+
+	return datalayer.ErrNoData
+}
@@ -0,0 +1,73 @@
+package mockdatalayer
+
+import (
+	"sort"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/models/pagination"
+)
+
+func (m *MockDataLayer) getNextImpersonationAuditID() int64 {
+	var maxID int64 = 0
+	for _, audit := range m.ImpersonationAudits {
+		if audit.ID > maxID {
+			maxID = audit.ID
+		}
+	}
+
+	return maxID + 1
+}
+
+func (m *MockDataLayer) CreateImpersonationAudit(audit *datalayer.ImpersonationAudit) (int64, error) {
+	audit.ID = m.getNextImpersonationAuditID()
+	audit.CreatedAt = now()
+
+	m.ImpersonationAudits = append(m.ImpersonationAudits, audit)
+
+	return audit.ID, nil
+}
+
+func (m *MockDataLayer) GetImpersonationAuditsByUserID(userID int64, sortable pagination.Sortable) ([]*datalayer.ImpersonationAudit, error) {
+	audits := make([]*datalayer.ImpersonationAudit, 0)
+	for _, audit := range m.ImpersonationAudits {
+		if audit.UserID == userID {
+			audits = append(audits, audit)
+		}
+	}
+
+	pageParams := sortable.GetPagination()
+	less := func(a, b *datalayer.ImpersonationAudit) bool {
+		switch pageParams.SortField {
+		case "createdAt":
+			if !a.CreatedAt.Time.Equal(b.CreatedAt.Time) {
+				return a.CreatedAt.Time.Before(b.CreatedAt.Time)
+			}
+		case "actorID":
+			if a.ActorID != b.ActorID {
+				return a.ActorID < b.ActorID
+			}
+		}
+		return a.ID < b.ID
+	}
+	sort.Slice(audits, func(i, j int) bool {
+		if pageParams.SortDir == pagination.SortDirectionDesc {
+			return less(audits[j], audits[i])
+		}
+		return less(audits[i], audits[j])
+	})
+
+	count := int64(10)
+	if pageParams.FetchCount.Valid {
+		count = pageParams.FetchCount.Value
+	}
+	offset := pageParams.Page.Value * count
+	if offset >= int64(len(audits)) {
+		return audits[:0], nil
+	}
+	end := offset + count
+	if end > int64(len(audits)) {
+		end = int64(len(audits))
+	}
+
+	return audits[offset:end], nil
+}
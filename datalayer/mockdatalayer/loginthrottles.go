@@ -0,0 +1,145 @@
+package mockdatalayer
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+)
+
+func (m *MockDataLayer) getNextLoginThrottleID() int64 {
+	var maxID int64 = math.MinInt64
+	for _, throttle := range m.LoginThrottles {
+		if throttle.ID > maxID {
+			maxID = throttle.ID
+		}
+	}
+
+	return maxID + 1
+}
+
+func (m *MockDataLayer) getNextAccountUnlockID() int64 {
+	var maxID int64 = math.MinInt64
+	for _, accountUnlock := range m.AccountUnlocks {
+		if accountUnlock.ID > maxID {
+			maxID = accountUnlock.ID
+		}
+	}
+
+	return maxID + 1
+}
+
+func (m *MockDataLayer) GetLoginThrottle(kind, key string) (*datalayer.LoginThrottle, error) {
+	for _, throttle := range m.LoginThrottles {
+		if kind == throttle.Kind && key == throttle.ThrottleKey {
+			return throttle, nil
+		}
+	}
+
+	return nil, datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) RecordLoginFailure(kind, key string, at, windowStart time.Time) (*datalayer.LoginThrottle, error) {
+	lastFailedAt := datalayer.JsonNullTime{
+		NullTime: sql.NullTime{
+			Time:  at,
+			Valid: true,
+		},
+	}
+
+	throttle, err := m.GetLoginThrottle(kind, key)
+	if err == datalayer.ErrNoData {
+		throttle = &datalayer.LoginThrottle{
+			Model: datalayer.Model{
+				ID:        m.getNextLoginThrottleID(),
+				CreatedAt: now(),
+			},
+			Kind:           kind,
+			ThrottleKey:    key,
+			FailedAttempts: 1,
+			LastFailedAt:   lastFailedAt,
+		}
+		m.LoginThrottles = append(m.LoginThrottles, throttle)
+		return throttle, nil
+	}
+
+	if throttle.LastFailedAt.Time.Before(windowStart) {
+		throttle.FailedAttempts = 1
+	} else {
+		throttle.FailedAttempts++
+	}
+	throttle.LastFailedAt = lastFailedAt
+
+	return throttle, nil
+}
+
+func (m *MockDataLayer) SetLoginThrottleLockedUntil(kind, key string, lockedUntil time.Time) error {
+	throttle, err := m.GetLoginThrottle(kind, key)
+	if err != nil {
+		return err
+	}
+
+	throttle.LockedUntil = datalayer.JsonNullTime{
+		NullTime: sql.NullTime{
+			Time:  lockedUntil,
+			Valid: true,
+		},
+	}
+
+	return nil
+}
+
+func (m *MockDataLayer) DeleteLoginThrottle(kind, key string) error {
+	throttles := m.LoginThrottles[:0]
+	for _, throttle := range m.LoginThrottles {
+		if kind != throttle.Kind || key != throttle.ThrottleKey {
+			throttles = append(throttles, throttle)
+		}
+	}
+	m.LoginThrottles = throttles
+
+	return nil
+}
+
+func (m *MockDataLayer) CreateAccountUnlock(tokenHash string, userID int64, expiresAt time.Time) (int64, error) {
+	accountUnlock := &datalayer.AccountUnlock{
+		Model: datalayer.Model{
+			ID:        m.getNextAccountUnlockID(),
+			CreatedAt: now(),
+		},
+		TokenHash: tokenHash,
+		UserID:    userID,
+		ExpiresAt: datalayer.JsonNullTime{
+			NullTime: sql.NullTime{
+				Time:  expiresAt,
+				Valid: true,
+			},
+		},
+	}
+
+	m.AccountUnlocks = append(m.AccountUnlocks, accountUnlock)
+
+	return accountUnlock.ID, nil
+}
+
+func (m *MockDataLayer) LookupAccountUnlock(tokenHash string) (*datalayer.AccountUnlock, error) {
+	for _, accountUnlock := range m.AccountUnlocks {
+		if tokenHash == accountUnlock.TokenHash {
+			return accountUnlock, nil
+		}
+	}
+
+	return nil, datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) ConsumeAccountUnlock(id int64) error {
+	for _, accountUnlock := range m.AccountUnlocks {
+		if id == accountUnlock.ID && !accountUnlock.UsedAt.Valid {
+			accountUnlock.UsedAt = now()
+			return nil
+		}
+	}
+
+	return datalayer.ErrNoData
+}
@@ -0,0 +1,78 @@
+package mockdatalayer
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+)
+
+func (m *MockDataLayer) getNextMagicLinkID() int64 {
+	var maxID int64 = math.MinInt64
+	for _, magicLink := range m.MagicLinks {
+		if magicLink.ID > maxID {
+			maxID = magicLink.ID
+		}
+	}
+
+	return maxID + 1
+}
+
+func (m *MockDataLayer) CreateMagicLink(tokenHash string, userID int64, expiresAt time.Time) (int64, error) {
+	magicLink := &datalayer.MagicLink{
+		Model: datalayer.Model{
+			ID:        m.getNextMagicLinkID(),
+			CreatedAt: now(),
+		},
+		TokenHash: tokenHash,
+		UserID:    userID,
+		ExpiresAt: datalayer.JsonNullTime{
+			NullTime: sql.NullTime{
+				Time:  expiresAt,
+				Valid: true,
+			},
+		},
+	}
+
+	m.MagicLinks = append(m.MagicLinks, magicLink)
+
+	return magicLink.ID, nil
+}
+
+func (m *MockDataLayer) LookupMagicLink(tokenHash string) (*datalayer.MagicLink, error) {
+	for _, magicLink := range m.MagicLinks {
+		if tokenHash == magicLink.TokenHash {
+			return magicLink, nil
+		}
+	}
+
+	return nil, datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) ConsumeMagicLink(id int64) error {
+	for _, magicLink := range m.MagicLinks {
+		if id == magicLink.ID && !magicLink.UsedAt.Valid {
+			magicLink.UsedAt = now()
+			return nil
+		}
+	}
+
+	return datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) ExpireMagicLinksByUserID(userID int64) error {
+	now := time.Now()
+	for _, magicLink := range m.MagicLinks {
+		if userID == magicLink.UserID && !magicLink.UsedAt.Valid && magicLink.ExpiresAt.Time.After(now) {
+			magicLink.ExpiresAt = datalayer.JsonNullTime{
+				NullTime: sql.NullTime{
+					Time:  now,
+					Valid: true,
+				},
+			}
+		}
+	}
+
+	return nil
+}
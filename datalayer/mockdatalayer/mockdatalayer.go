@@ -14,6 +14,26 @@ type MockDataLayer struct {
 	Contacts            []*datalayer.Contact
 	CardTransactions    []*datalayer.CardTransaction
 	SignUpConfirmations []*datalayer.SignUpConfirmation
+	RefreshTokens       []*datalayer.RefreshToken
+	SigningKeys         []*datalayer.SigningKey
+	APITokens           []*datalayer.APIToken
+	PasswordResets      []*datalayer.PasswordReset
+	EmailChanges        []*datalayer.EmailChange
+	TOTPCredentials     []*datalayer.TOTPCredential
+	RecoveryCodes       []*datalayer.RecoveryCode
+	LoginThrottles      []*datalayer.LoginThrottle
+	AccountUnlocks      []*datalayer.AccountUnlock
+	Identities          []*datalayer.Identity
+	OIDCLogins          []*datalayer.OIDCLogin
+	OAuthClients        []*datalayer.OAuthClient
+	OAuthCodes          []*datalayer.OAuthAuthorizationCode
+	OAuthTokens         []*datalayer.OAuthToken
+	Sessions            []*datalayer.Session
+	UserSettings        []*datalayer.UserSettings
+	ImpersonationAudits []*datalayer.ImpersonationAudit
+	MagicLinks          []*datalayer.MagicLink
+	RequestSigningKeys  []*datalayer.RequestSigningKey
+	IdempotencyKeys     []*datalayer.IdempotencyKey
 	usersFilename       string
 	contactsFilename    string
 	cardTransFilename   string
@@ -51,6 +71,26 @@ func (m *MockDataLayer) ResetAndReload() error {
 	}
 
 	m.CardTransactions = m.CardTransactions[:0]
+	m.SignUpConfirmations = m.SignUpConfirmations[:0]
+	m.RefreshTokens = m.RefreshTokens[:0]
+	m.APITokens = m.APITokens[:0]
+	m.PasswordResets = m.PasswordResets[:0]
+	m.EmailChanges = m.EmailChanges[:0]
+	m.TOTPCredentials = m.TOTPCredentials[:0]
+	m.RecoveryCodes = m.RecoveryCodes[:0]
+	m.LoginThrottles = m.LoginThrottles[:0]
+	m.AccountUnlocks = m.AccountUnlocks[:0]
+	m.Identities = m.Identities[:0]
+	m.OIDCLogins = m.OIDCLogins[:0]
+	m.OAuthClients = m.OAuthClients[:0]
+	m.OAuthCodes = m.OAuthCodes[:0]
+	m.OAuthTokens = m.OAuthTokens[:0]
+	m.Sessions = m.Sessions[:0]
+	m.UserSettings = m.UserSettings[:0]
+	m.ImpersonationAudits = m.ImpersonationAudits[:0]
+	m.MagicLinks = m.MagicLinks[:0]
+	m.RequestSigningKeys = m.RequestSigningKeys[:0]
+	m.IdempotencyKeys = m.IdempotencyKeys[:0]
 
 	return nil
 }
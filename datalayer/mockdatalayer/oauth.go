@@ -0,0 +1,190 @@
+package mockdatalayer
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+)
+
+func (m *MockDataLayer) getNextOAuthClientID() int64 {
+	var maxID int64 = math.MinInt64
+	for _, client := range m.OAuthClients {
+		if client.ID > maxID {
+			maxID = client.ID
+		}
+	}
+
+	return maxID + 1
+}
+
+func (m *MockDataLayer) getNextOAuthCodeID() int64 {
+	var maxID int64 = math.MinInt64
+	for _, code := range m.OAuthCodes {
+		if code.ID > maxID {
+			maxID = code.ID
+		}
+	}
+
+	return maxID + 1
+}
+
+func (m *MockDataLayer) getNextOAuthTokenID() int64 {
+	var maxID int64 = math.MinInt64
+	for _, token := range m.OAuthTokens {
+		if token.ID > maxID {
+			maxID = token.ID
+		}
+	}
+
+	return maxID + 1
+}
+
+func (m *MockDataLayer) CreateOAuthClient(client *datalayer.OAuthClient) (int64, error) {
+	client.ID = m.getNextOAuthClientID()
+	client.CreatedAt = now()
+
+	m.OAuthClients = append(m.OAuthClients, client)
+
+	return client.ID, nil
+}
+
+func (m *MockDataLayer) GetOAuthClientByID(id int64) (*datalayer.OAuthClient, error) {
+	for _, client := range m.OAuthClients {
+		if id == client.ID && !client.DeletedAt.Valid {
+			return client, nil
+		}
+	}
+
+	return nil, datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) GetOAuthClientByClientID(clientID string) (*datalayer.OAuthClient, error) {
+	for _, client := range m.OAuthClients {
+		if clientID == client.ClientID && !client.DeletedAt.Valid {
+			return client, nil
+		}
+	}
+
+	return nil, datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) GetOAuthClientsByUserID(userID int64) ([]*datalayer.OAuthClient, error) {
+	clients := make([]*datalayer.OAuthClient, 0)
+	for _, client := range m.OAuthClients {
+		if userID == client.UserID && !client.DeletedAt.Valid {
+			clients = append(clients, client)
+		}
+	}
+
+	return clients, nil
+}
+
+func (m *MockDataLayer) DeleteOAuthClient(id, userID int64) error {
+	client, err := m.GetOAuthClientByID(id)
+	if err != nil {
+		return err
+	}
+	if userID != client.UserID {
+		return datalayer.ErrNoData
+	}
+
+	client.DeletedAt = now()
+	for _, token := range m.OAuthTokens {
+		if id == token.OAuthClientID && !token.RevokedAt.Valid {
+			token.RevokedAt = now()
+		}
+	}
+
+	return nil
+}
+
+func (m *MockDataLayer) CreateOAuthAuthorizationCode(code *datalayer.OAuthAuthorizationCode) (int64, error) {
+	code.ID = m.getNextOAuthCodeID()
+	code.CreatedAt = now()
+
+	m.OAuthCodes = append(m.OAuthCodes, code)
+
+	return code.ID, nil
+}
+
+func (m *MockDataLayer) LookupOAuthAuthorizationCode(codeHash string) (*datalayer.OAuthAuthorizationCode, error) {
+	for _, code := range m.OAuthCodes {
+		if codeHash == code.CodeHash {
+			return code, nil
+		}
+	}
+
+	return nil, datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) ConsumeOAuthAuthorizationCode(id int64) error {
+	for _, code := range m.OAuthCodes {
+		if id == code.ID && !code.UsedAt.Valid {
+			code.UsedAt = now()
+			return nil
+		}
+	}
+
+	return datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) CreateOAuthToken(token *datalayer.OAuthToken) (int64, error) {
+	token.ID = m.getNextOAuthTokenID()
+	token.CreatedAt = now()
+
+	m.OAuthTokens = append(m.OAuthTokens, token)
+
+	return token.ID, nil
+}
+
+func (m *MockDataLayer) GetOAuthTokenByAccessHash(accessTokenHash string) (*datalayer.OAuthToken, error) {
+	for _, token := range m.OAuthTokens {
+		if accessTokenHash == token.AccessTokenHash {
+			return token, nil
+		}
+	}
+
+	return nil, datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) GetOAuthTokenByRefreshHash(refreshTokenHash string) (*datalayer.OAuthToken, error) {
+	for _, token := range m.OAuthTokens {
+		if token.RefreshTokenHash.Valid && refreshTokenHash == token.RefreshTokenHash.String {
+			return token, nil
+		}
+	}
+
+	return nil, datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) RotateOAuthToken(id int64, oldRefreshTokenHash, accessTokenHash string,
+	accessExpiresAt time.Time, refreshTokenHash string) error {
+	for _, token := range m.OAuthTokens {
+		if id == token.ID && oldRefreshTokenHash == token.RefreshTokenHash.String && !token.RevokedAt.Valid {
+			token.AccessTokenHash = accessTokenHash
+			token.AccessExpiresAt = datalayer.JsonNullTime{
+				NullTime: sql.NullTime{
+					Time:  accessExpiresAt,
+					Valid: true,
+				},
+			}
+			token.RefreshTokenHash = sql.NullString{String: refreshTokenHash, Valid: true}
+			token.UpdatedAt = now()
+			return nil
+		}
+	}
+
+	return datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) RevokeOAuthToken(id int64) error {
+	for _, token := range m.OAuthTokens {
+		if id == token.ID && !token.RevokedAt.Valid {
+			token.RevokedAt = now()
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package mockdatalayer
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+)
+
+func (m *MockDataLayer) getNextPasswordResetID() int64 {
+	var maxID int64 = math.MinInt64
+	for _, passwordReset := range m.PasswordResets {
+		if passwordReset.ID > maxID {
+			maxID = passwordReset.ID
+		}
+	}
+
+	return maxID + 1
+}
+
+func (m *MockDataLayer) CreatePasswordReset(tokenHash string, userID int64, expiresAt time.Time) (int64, error) {
+	passwordReset := &datalayer.PasswordReset{
+		Model: datalayer.Model{
+			ID: m.getNextPasswordResetID(),
+			CreatedAt: datalayer.JsonNullTime{
+				NullTime: sql.NullTime{
+					Time:  time.Now(),
+					Valid: true,
+				},
+			},
+		},
+		TokenHash: tokenHash,
+		UserID:    userID,
+		ExpiresAt: datalayer.JsonNullTime{
+			NullTime: sql.NullTime{
+				Time:  expiresAt,
+				Valid: true,
+			},
+		},
+	}
+
+	m.PasswordResets = append(m.PasswordResets, passwordReset)
+
+	return passwordReset.ID, nil
+}
+
+func (m *MockDataLayer) LookupPasswordReset(tokenHash string) (*datalayer.PasswordReset, error) {
+	for _, passwordReset := range m.PasswordResets {
+		if tokenHash == passwordReset.TokenHash {
+			return passwordReset, nil
+		}
+	}
+
+	return nil, datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) ConsumePasswordReset(id int64) error {
+	for _, passwordReset := range m.PasswordResets {
+		if id == passwordReset.ID && !passwordReset.UsedAt.Valid {
+			passwordReset.UsedAt = datalayer.JsonNullTime{
+				NullTime: sql.NullTime{
+					Time:  time.Now(),
+					Valid: true,
+				},
+			}
+			return nil
+		}
+	}
+
+	return datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) ConsumePasswordResetsByUserID(userID int64) error {
+	for _, passwordReset := range m.PasswordResets {
+		if userID == passwordReset.UserID && !passwordReset.UsedAt.Valid {
+			passwordReset.UsedAt = datalayer.JsonNullTime{
+				NullTime: sql.NullTime{
+					Time:  time.Now(),
+					Valid: true,
+				},
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *MockDataLayer) ExpirePasswordResetsByUserID(userID int64) error {
+	now := time.Now()
+	for _, passwordReset := range m.PasswordResets {
+		if userID == passwordReset.UserID && !passwordReset.UsedAt.Valid && passwordReset.ExpiresAt.Time.After(now) {
+			passwordReset.ExpiresAt = datalayer.JsonNullTime{
+				NullTime: sql.NullTime{
+					Time:  now,
+					Valid: true,
+				},
+			}
+		}
+	}
+
+	return nil
+}
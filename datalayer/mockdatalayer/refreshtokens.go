@@ -0,0 +1,113 @@
+package mockdatalayer
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+)
+
+func (m *MockDataLayer) getNextRefreshTokenID() int64 {
+	var maxID int64 = math.MinInt64
+	for _, refreshToken := range m.RefreshTokens {
+		if refreshToken.ID > maxID {
+			maxID = refreshToken.ID
+		}
+	}
+
+	return maxID + 1
+}
+
+func (m *MockDataLayer) CreateRefreshToken(jti, familyID string, userID int64, expiresAt time.Time) (int64, error) {
+	refreshToken := &datalayer.RefreshToken{
+		Model: datalayer.Model{
+			ID: m.getNextRefreshTokenID(),
+			CreatedAt: datalayer.JsonNullTime{
+				NullTime: sql.NullTime{
+					Time:  time.Now(),
+					Valid: true,
+				},
+			},
+		},
+		JTI:      jti,
+		FamilyID: familyID,
+		UserID:   userID,
+		ExpiresAt: datalayer.JsonNullTime{
+			NullTime: sql.NullTime{
+				Time:  expiresAt,
+				Valid: true,
+			},
+		},
+	}
+
+	m.RefreshTokens = append(m.RefreshTokens, refreshToken)
+
+	return refreshToken.ID, nil
+}
+
+func (m *MockDataLayer) GetRefreshTokenByJTI(jti string) (*datalayer.RefreshToken, error) {
+	for _, refreshToken := range m.RefreshTokens {
+		if jti == refreshToken.JTI {
+			return refreshToken, nil
+		}
+	}
+
+	return nil, datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) RotateRefreshToken(jti string) error {
+	for _, refreshToken := range m.RefreshTokens {
+		if jti == refreshToken.JTI && !refreshToken.RotatedAt.Valid && !refreshToken.RevokedAt.Valid {
+			refreshToken.RotatedAt = datalayer.JsonNullTime{
+				NullTime: sql.NullTime{
+					Time:  time.Now(),
+					Valid: true,
+				},
+			}
+			return nil
+		}
+	}
+
+	return datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) RevokeRefreshTokenFamily(familyID string) error {
+	for _, refreshToken := range m.RefreshTokens {
+		if familyID == refreshToken.FamilyID && !refreshToken.RevokedAt.Valid {
+			refreshToken.RevokedAt = datalayer.JsonNullTime{
+				NullTime: sql.NullTime{
+					Time:  time.Now(),
+					Valid: true,
+				},
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *MockDataLayer) RevokeRefreshTokensByUserID(userID int64) error {
+	for _, refreshToken := range m.RefreshTokens {
+		if userID == refreshToken.UserID && !refreshToken.RevokedAt.Valid {
+			refreshToken.RevokedAt = datalayer.JsonNullTime{
+				NullTime: sql.NullTime{
+					Time:  time.Now(),
+					Valid: true,
+				},
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *MockDataLayer) IsRefreshTokenFamilyRevoked(familyID string) (bool, error) {
+	for _, refreshToken := range m.RefreshTokens {
+		if familyID == refreshToken.FamilyID && refreshToken.RevokedAt.Valid {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
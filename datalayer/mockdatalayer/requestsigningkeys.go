@@ -0,0 +1,86 @@
+package mockdatalayer
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+)
+
+func (m *MockDataLayer) getNextRequestSigningKeyID() int64 {
+	var maxID int64 = 0
+	for _, key := range m.RequestSigningKeys {
+		if key.ID > maxID {
+			maxID = key.ID
+		}
+	}
+
+	return maxID + 1
+}
+
+func (m *MockDataLayer) CreateRequestSigningKey(key *datalayer.RequestSigningKey) (int64, error) {
+	key.CreatedAt = now()
+	key.ID = m.getNextRequestSigningKeyID()
+
+	m.RequestSigningKeys = append(m.RequestSigningKeys, key)
+
+	return key.ID, nil
+}
+
+func (m *MockDataLayer) GetRequestSigningKeyByID(id int64) (*datalayer.RequestSigningKey, error) {
+	for _, key := range m.RequestSigningKeys {
+		if id == key.ID {
+			return key, nil
+		}
+	}
+
+	return nil, datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) GetRequestSigningKeyByKeyID(keyID string) (*datalayer.RequestSigningKey, error) {
+	for _, key := range m.RequestSigningKeys {
+		if keyID == key.KeyID {
+			return key, nil
+		}
+	}
+
+	return nil, datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) GetRequestSigningKeysByUserID(userID int64) ([]*datalayer.RequestSigningKey, error) {
+	keys := make([]*datalayer.RequestSigningKey, 0)
+	for _, key := range m.RequestSigningKeys {
+		if userID == key.UserID && !key.RevokedAt.Valid {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+func (m *MockDataLayer) RevokeRequestSigningKey(id, userID int64) error {
+	for _, key := range m.RequestSigningKeys {
+		if id == key.ID && userID == key.UserID && !key.RevokedAt.Valid {
+			key.RevokedAt = now()
+			return nil
+		}
+	}
+
+	return datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) SetRequestSigningKeyLastUsedAt(id int64, lastUsedAt time.Time) error {
+	key, err := m.GetRequestSigningKeyByID(id)
+	if err != nil {
+		return err
+	}
+
+	key.LastUsedAt = datalayer.JsonNullTime{
+		NullTime: sql.NullTime{
+			Time:  lastUsedAt,
+			Valid: true,
+		},
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package mockdatalayer
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+)
+
+func (m *MockDataLayer) getNextSessionID() int64 {
+	var maxID int64 = 0
+	for _, session := range m.Sessions {
+		if session.ID > maxID {
+			maxID = session.ID
+		}
+	}
+
+	return maxID + 1
+}
+
+func (m *MockDataLayer) CreateSession(session *datalayer.Session) (int64, error) {
+	session.ID = m.getNextSessionID()
+	session.CreatedAt = now()
+
+	m.Sessions = append(m.Sessions, session)
+
+	return session.ID, nil
+}
+
+func (m *MockDataLayer) GetSessionByID(id int64) (*datalayer.Session, error) {
+	for _, session := range m.Sessions {
+		if id == session.ID {
+			return session, nil
+		}
+	}
+
+	return nil, datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) GetSessionByFamilyID(familyID string) (*datalayer.Session, error) {
+	for _, session := range m.Sessions {
+		if familyID == session.FamilyID {
+			return session, nil
+		}
+	}
+
+	return nil, datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) GetSessionsByUserID(userID int64) ([]*datalayer.Session, error) {
+	sessions := make([]*datalayer.Session, 0)
+	for _, session := range m.Sessions {
+		if userID == session.UserID && !session.RevokedAt.Valid {
+			sessions = append(sessions, session)
+		}
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		if sessions[i].LastSeenAt.Time.Equal(sessions[j].LastSeenAt.Time) {
+			return sessions[i].ID > sessions[j].ID
+		}
+		return sessions[i].LastSeenAt.Time.After(sessions[j].LastSeenAt.Time)
+	})
+
+	return sessions, nil
+}
+
+func (m *MockDataLayer) TouchSession(id int64, userAgent, ipAddress, deviceName string, lastSeenAt time.Time) error {
+	session, err := m.GetSessionByID(id)
+	if err != nil {
+		return err
+	}
+
+	session.UserAgent = userAgent
+	session.IPAddress = ipAddress
+	session.DeviceName = deviceName
+	session.LastSeenAt = datalayer.JsonNullTime{
+		NullTime: sql.NullTime{
+			Time:  lastSeenAt,
+			Valid: true,
+		},
+	}
+
+	return nil
+}
+
+func (m *MockDataLayer) RevokeSession(id int64) error {
+	for _, session := range m.Sessions {
+		if id == session.ID && !session.RevokedAt.Valid {
+			session.RevokedAt = now()
+			return nil
+		}
+	}
+
+	return datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) RevokeSessionByFamilyID(familyID string) error {
+	for _, session := range m.Sessions {
+		if familyID == session.FamilyID && !session.RevokedAt.Valid {
+			session.RevokedAt = now()
+		}
+	}
+
+	return nil
+}
+
+func (m *MockDataLayer) RevokeSessionsByUserID(userID int64) error {
+	for _, session := range m.Sessions {
+		if userID == session.UserID && !session.RevokedAt.Valid {
+			session.RevokedAt = now()
+		}
+	}
+
+	return nil
+}
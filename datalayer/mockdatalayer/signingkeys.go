@@ -0,0 +1,64 @@
+package mockdatalayer
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+)
+
+func (m *MockDataLayer) getNextSigningKeyID() int64 {
+	var maxID int64 = math.MinInt64
+	for _, signingKey := range m.SigningKeys {
+		if signingKey.ID > maxID {
+			maxID = signingKey.ID
+		}
+	}
+
+	return maxID + 1
+}
+
+func (m *MockDataLayer) CreateSigningKey(kid, algorithm, privateKey string, expiresAt time.Time) (int64, error) {
+	signingKey := &datalayer.SigningKey{
+		Model: datalayer.Model{
+			ID: m.getNextSigningKeyID(),
+			CreatedAt: datalayer.JsonNullTime{
+				NullTime: sql.NullTime{
+					Time:  time.Now(),
+					Valid: true,
+				},
+			},
+		},
+		KID:        kid,
+		Algorithm:  algorithm,
+		PrivateKey: privateKey,
+		ExpiresAt: datalayer.JsonNullTime{
+			NullTime: sql.NullTime{
+				Time:  expiresAt,
+				Valid: true,
+			},
+		},
+	}
+
+	m.SigningKeys = append(m.SigningKeys, signingKey)
+
+	return signingKey.ID, nil
+}
+
+func (m *MockDataLayer) GetActiveSigningKeys() ([]*datalayer.SigningKey, error) {
+	var signingKeys []*datalayer.SigningKey
+	now := time.Now()
+	for _, signingKey := range m.SigningKeys {
+		if signingKey.ExpiresAt.Time.After(now) && !signingKey.DeletedAt.Valid {
+			signingKeys = append(signingKeys, signingKey)
+		}
+	}
+
+	sort.Slice(signingKeys, func(i, j int) bool {
+		return signingKeys[i].ID > signingKeys[j].ID
+	})
+
+	return signingKeys, nil
+}
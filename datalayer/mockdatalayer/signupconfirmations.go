@@ -1,21 +1,34 @@
 package mockdatalayer
 
 import (
+	"database/sql"
 	"github.com/donohutcheon/gowebserver/datalayer"
 	"math"
+	"time"
 )
 
-func (m *MockDataLayer) CreateSignUpConfirmation(nonce string, userID int64) (int64, error) {
+func (m *MockDataLayer) CreateSignUpConfirmation(nonce string, userID int64, expiresAt time.Time) (int64, error) {
 	id := m.getNextSignUpConfID()
 	signUpConf := datalayer.SignUpConfirmation{
 		Model:  datalayer.Model{
 			ID:        id,
-			CreatedAt: datalayer.JsonNullTime{},
+			CreatedAt: datalayer.JsonNullTime{
+				NullTime: sql.NullTime{
+					Time:  time.Now(),
+					Valid: true,
+				},
+			},
 			UpdatedAt: datalayer.JsonNullTime{},
 			DeletedAt: datalayer.JsonNullTime{},
 		},
 		Nonce:  nonce,
 		UserID: userID,
+		ExpiresAt: datalayer.JsonNullTime{
+			NullTime: sql.NullTime{
+				Time:  expiresAt,
+				Valid: true,
+			},
+		},
 	}
 	m.SignUpConfirmations = append(m.SignUpConfirmations, &signUpConf)
 
@@ -32,6 +45,53 @@ func (m *MockDataLayer) LookupSignUpConfirmation(nonce string) (*datalayer.SignU
 	return nil, datalayer.ErrNoData
 }
 
+func (m *MockDataLayer) GetLatestSignUpConfirmationByUserID(userID int64) (*datalayer.SignUpConfirmation, error) {
+	var latest *datalayer.SignUpConfirmation
+	for _, s := range m.SignUpConfirmations {
+		if userID == s.UserID && (latest == nil || s.ID > latest.ID) {
+			latest = s
+		}
+	}
+
+	if latest == nil {
+		return nil, datalayer.ErrNoData
+	}
+
+	return latest, nil
+}
+
+func (m *MockDataLayer) ConsumeSignUpConfirmation(id int64) error {
+	for _, s := range m.SignUpConfirmations {
+		if id == s.ID && !s.UsedAt.Valid {
+			s.UsedAt = datalayer.JsonNullTime{
+				NullTime: sql.NullTime{
+					Time:  time.Now(),
+					Valid: true,
+				},
+			}
+			return nil
+		}
+	}
+
+	return datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) ExpireSignUpConfirmationsByUserID(userID int64) error {
+	now := time.Now()
+	for _, s := range m.SignUpConfirmations {
+		if userID == s.UserID && !s.UsedAt.Valid && s.ExpiresAt.Time.After(now) {
+			s.ExpiresAt = datalayer.JsonNullTime{
+				NullTime: sql.NullTime{
+					Time:  now,
+					Valid: true,
+				},
+			}
+		}
+	}
+
+	return nil
+}
+
 func (m *MockDataLayer) getNextSignUpConfID() int64 {
 	var maxID int64 = math.MinInt64
 	for _, s := range m.SignUpConfirmations {
@@ -41,4 +101,4 @@ func (m *MockDataLayer) getNextSignUpConfID() int64 {
 	}
 
 	return maxID + 1
-}
\ No newline at end of file
+}
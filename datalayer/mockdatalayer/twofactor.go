@@ -0,0 +1,160 @@
+package mockdatalayer
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+)
+
+func (m *MockDataLayer) getNextTOTPCredentialID() int64 {
+	var maxID int64 = math.MinInt64
+	for _, credential := range m.TOTPCredentials {
+		if credential.ID > maxID {
+			maxID = credential.ID
+		}
+	}
+
+	return maxID + 1
+}
+
+func (m *MockDataLayer) getNextRecoveryCodeID() int64 {
+	var maxID int64 = math.MinInt64
+	for _, recoveryCode := range m.RecoveryCodes {
+		if recoveryCode.ID > maxID {
+			maxID = recoveryCode.ID
+		}
+	}
+
+	return maxID + 1
+}
+
+func now() datalayer.JsonNullTime {
+	return datalayer.JsonNullTime{
+		NullTime: sql.NullTime{
+			Time:  time.Now(),
+			Valid: true,
+		},
+	}
+}
+
+func (m *MockDataLayer) CreateTOTPCredential(userID int64, secret string) (int64, error) {
+	credential := &datalayer.TOTPCredential{
+		Model: datalayer.Model{
+			ID:        m.getNextTOTPCredentialID(),
+			CreatedAt: now(),
+		},
+		UserID: userID,
+		Secret: secret,
+	}
+
+	m.TOTPCredentials = append(m.TOTPCredentials, credential)
+
+	return credential.ID, nil
+}
+
+func (m *MockDataLayer) GetTOTPCredentialByUserID(userID int64) (*datalayer.TOTPCredential, error) {
+	for _, credential := range m.TOTPCredentials {
+		if userID == credential.UserID {
+			return credential, nil
+		}
+	}
+
+	return nil, datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) ConfirmTOTPCredential(userID int64) error {
+	for _, credential := range m.TOTPCredentials {
+		if userID == credential.UserID && !credential.ConfirmedAt.Valid {
+			credential.ConfirmedAt = now()
+			return nil
+		}
+	}
+
+	return datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) SetTOTPCredentialLastUsedStep(userID int64, step int64) error {
+	for _, credential := range m.TOTPCredentials {
+		if userID == credential.UserID && credential.LastUsedStep < step {
+			credential.LastUsedStep = step
+			return nil
+		}
+	}
+
+	return datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) IncrementTOTPFailedAttempts(userID int64) error {
+	for _, credential := range m.TOTPCredentials {
+		if userID == credential.UserID {
+			credential.FailedAttempts++
+			credential.LastFailedAt = now()
+		}
+	}
+
+	return nil
+}
+
+func (m *MockDataLayer) ResetTOTPFailedAttempts(userID int64) error {
+	for _, credential := range m.TOTPCredentials {
+		if userID == credential.UserID {
+			credential.FailedAttempts = 0
+			credential.LastFailedAt = datalayer.JsonNullTime{}
+		}
+	}
+
+	return nil
+}
+
+func (m *MockDataLayer) DeleteTOTPCredentialByUserID(userID int64) error {
+	credentials := m.TOTPCredentials[:0]
+	for _, credential := range m.TOTPCredentials {
+		if userID != credential.UserID {
+			credentials = append(credentials, credential)
+		}
+	}
+	m.TOTPCredentials = credentials
+
+	return nil
+}
+
+func (m *MockDataLayer) CreateRecoveryCodes(userID int64, codeHashes []string) error {
+	for _, codeHash := range codeHashes {
+		recoveryCode := &datalayer.RecoveryCode{
+			Model: datalayer.Model{
+				ID:        m.getNextRecoveryCodeID(),
+				CreatedAt: now(),
+			},
+			UserID:   userID,
+			CodeHash: codeHash,
+		}
+		m.RecoveryCodes = append(m.RecoveryCodes, recoveryCode)
+	}
+
+	return nil
+}
+
+func (m *MockDataLayer) ConsumeRecoveryCode(userID int64, codeHash string) error {
+	for _, recoveryCode := range m.RecoveryCodes {
+		if userID == recoveryCode.UserID && codeHash == recoveryCode.CodeHash && !recoveryCode.UsedAt.Valid {
+			recoveryCode.UsedAt = now()
+			return nil
+		}
+	}
+
+	return datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) DeleteRecoveryCodesByUserID(userID int64) error {
+	recoveryCodes := m.RecoveryCodes[:0]
+	for _, recoveryCode := range m.RecoveryCodes {
+		if userID != recoveryCode.UserID {
+			recoveryCodes = append(recoveryCodes, recoveryCode)
+		}
+	}
+	m.RecoveryCodes = recoveryCodes
+
+	return nil
+}
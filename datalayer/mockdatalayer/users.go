@@ -3,15 +3,19 @@ package mockdatalayer
 import (
 	"database/sql"
 	"math"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/models/filters"
+	"github.com/donohutcheon/gowebserver/models/pagination"
 )
 
 
 func (m *MockDataLayer) GetUserByEmail(email string) (*datalayer.User, error) {
 	for _, user := range m.Users {
-		if user.Email.Valid && email == user.Email.String {
+		if user.Email.Valid && email == user.Email.String && !user.DeletedAt.Valid {
 			return user, nil
 		}
 	}
@@ -21,7 +25,7 @@ func (m *MockDataLayer) GetUserByEmail(email string) (*datalayer.User, error) {
 
 func (m *MockDataLayer) GetUserByID(id int64) (*datalayer.User, error) {
 	for _, user := range m.Users {
-		if id == user.ID {
+		if id == user.ID && !user.DeletedAt.Valid {
 			return user, nil
 		}
 	}
@@ -40,7 +44,7 @@ func (m *MockDataLayer) getNextUserID() int64 {
 	return maxID + 1
 }
 
-func (m *MockDataLayer) CreateUser(email, password string) (int64, error){
+func (m *MockDataLayer) CreateUser(email, password string, role datalayer.UserRole) (int64, error){
 	user, err := m.GetUserByEmail(email)
 	if err != datalayer.ErrNoData {
 		return 0, err
@@ -66,8 +70,12 @@ func (m *MockDataLayer) CreateUser(email, password string) (int64, error){
 			String: password,
 			Valid:  true,
 		},
+		Role: sql.NullString{
+			String: string(role),
+			Valid:  true,
+		},
 		State: sql.NullString{
-			String: "CONFIRMED",
+			String: string(datalayer.UserStateUnconfirmed),
 			Valid:  true,
 		},
 	}
@@ -82,6 +90,401 @@ func (m *MockDataLayer) GetUnconfirmedUsers() ([]datalayer.User, error) {
 	return nil, nil
 }
 
-func (m *MockDataLayer) SetUserStateByID(int64, datalayer.UserState) error {
- return nil
+func (m *MockDataLayer) SetUserStateByID(id int64, state datalayer.UserState) error {
+	user, err := m.GetUserByID(id)
+	if err != nil {
+		return err
+	}
+
+	if !datalayer.UserState(user.State.String).CanTransitionTo(state) {
+		return datalayer.ErrInvalidStateTransition
+	}
+
+	user.State = sql.NullString{
+		String: string(state),
+		Valid:  true,
+	}
+
+	return nil
+}
+
+func (m *MockDataLayer) SetUserLoggedOutAtByID(id int64, loggedOutAt time.Time) error {
+	user, err := m.GetUserByID(id)
+	if err != nil {
+		return err
+	}
+
+	user.LoggedOutAt = datalayer.JsonNullTime{
+		NullTime: sql.NullTime{
+			Time:  loggedOutAt,
+			Valid: true,
+		},
+	}
+
+	return nil
+}
+
+func (m *MockDataLayer) SetUserConfirmationSentAtByID(id int64, sentAt time.Time, interval time.Duration) error {
+	user, err := m.GetUserByID(id)
+	if err != nil {
+		return err
+	}
+
+	if user.ConfirmationSentAt.Valid && user.ConfirmationSentAt.Time.After(sentAt.Add(-interval)) {
+		return datalayer.ErrNoData
+	}
+
+	user.ConfirmationSentAt = datalayer.JsonNullTime{
+		NullTime: sql.NullTime{
+			Time:  sentAt,
+			Valid: true,
+		},
+	}
+
+	return nil
+}
+
+func (m *MockDataLayer) SetUserPasswordResetSentAtByID(id int64, sentAt time.Time, interval time.Duration) error {
+	user, err := m.GetUserByID(id)
+	if err != nil {
+		return err
+	}
+
+	if user.PasswordResetSentAt.Valid && user.PasswordResetSentAt.Time.After(sentAt.Add(-interval)) {
+		return datalayer.ErrNoData
+	}
+
+	user.PasswordResetSentAt = datalayer.JsonNullTime{
+		NullTime: sql.NullTime{
+			Time:  sentAt,
+			Valid: true,
+		},
+	}
+
+	return nil
+}
+
+func (m *MockDataLayer) SetUserPasswordByID(id int64, password string) error {
+	user, err := m.GetUserByID(id)
+	if err != nil {
+		return err
+	}
+
+	user.Password = sql.NullString{
+		String: password,
+		Valid:  true,
+	}
+
+	return nil
+}
+
+func (m *MockDataLayer) SetUserRoleByID(id int64, role datalayer.UserRole) error {
+	user, err := m.GetUserByID(id)
+	if err != nil {
+		return err
+	}
+
+	user.Role = sql.NullString{
+		String: string(role),
+		Valid:  true,
+	}
+
+	return nil
+}
+
+func (m *MockDataLayer) SetUserEmailByID(id int64, email string) error {
+	user, err := m.GetUserByID(id)
+	if err != nil {
+		return err
+	}
+
+	user.Email = sql.NullString{
+		String: email,
+		Valid:  true,
+	}
+
+	return nil
+}
+
+// userDeleted reports whether a user has been soft-deleted.
+func (m *MockDataLayer) userDeleted(id int64) bool {
+	for _, user := range m.Users {
+		if id == user.ID {
+			return user.DeletedAt.Valid
+		}
+	}
+
+	return false
+}
+
+func (m *MockDataLayer) SetUserProfileByID(id int64, profile *datalayer.User) error {
+	user, err := m.GetUserByID(id)
+	if err != nil {
+		return err
+	}
+
+	user.FirstName = profile.FirstName
+	user.Surname = profile.Surname
+	user.Age = profile.Age
+	user.Address = profile.Address
+
+	return nil
+}
+
+func (m *MockDataLayer) SoftDeleteUserByID(id int64, deletedAt time.Time) error {
+	user, err := m.GetUserByID(id)
+	if err != nil {
+		return err
+	}
+
+	user.DeletedAt = datalayer.JsonNullTime{
+		NullTime: sql.NullTime{
+			Time:  deletedAt,
+			Valid: true,
+		},
+	}
+
+	return nil
+}
+
+func (m *MockDataLayer) RestoreUserByID(id int64) error {
+	for _, user := range m.Users {
+		if id == user.ID && user.DeletedAt.Valid {
+			user.DeletedAt = datalayer.JsonNullTime{}
+			return nil
+		}
+	}
+
+	return datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) GetDeletedUserByEmail(email string) (*datalayer.User, error) {
+	var deleted *datalayer.User
+	for _, user := range m.Users {
+		if user.Email.Valid && email == user.Email.String && user.DeletedAt.Valid &&
+			(deleted == nil || user.DeletedAt.Time.After(deleted.DeletedAt.Time)) {
+			deleted = user
+		}
+	}
+
+	if deleted == nil {
+		return nil, datalayer.ErrNoData
+	}
+
+	return deleted, nil
+}
+
+func (m *MockDataLayer) GetUsersDeletedBefore(deletedBefore time.Time) ([]*datalayer.User, error) {
+	users := make([]*datalayer.User, 0)
+	for _, user := range m.Users {
+		if user.DeletedAt.Valid && user.DeletedAt.Time.Before(deletedBefore) {
+			users = append(users, user)
+		}
+	}
+
+	return users, nil
+}
+
+// PurgeUserByID also removes the rows the database removes by cascading.
+func (m *MockDataLayer) PurgeUserByID(id int64) error {
+	index := -1
+	for i, user := range m.Users {
+		if id == user.ID && user.DeletedAt.Valid {
+			index = i
+		}
+	}
+	if index < 0 {
+		return datalayer.ErrNoData
+	}
+	m.Users = append(m.Users[:index], m.Users[index+1:]...)
+
+	contacts := m.Contacts[:0]
+	for _, contact := range m.Contacts {
+		if contact.UserID != id {
+			contacts = append(contacts, contact)
+		}
+	}
+	m.Contacts = contacts
+
+	cardTransactions := m.CardTransactions[:0]
+	for _, cardTransaction := range m.CardTransactions {
+		if cardTransaction.UserID != id {
+			cardTransactions = append(cardTransactions, cardTransaction)
+		}
+	}
+	m.CardTransactions = cardTransactions
+
+	signUpConfirmations := m.SignUpConfirmations[:0]
+	for _, signUp := range m.SignUpConfirmations {
+		if signUp.UserID != id {
+			signUpConfirmations = append(signUpConfirmations, signUp)
+		}
+	}
+	m.SignUpConfirmations = signUpConfirmations
+
+	refreshTokens := m.RefreshTokens[:0]
+	for _, refreshToken := range m.RefreshTokens {
+		if refreshToken.UserID != id {
+			refreshTokens = append(refreshTokens, refreshToken)
+		}
+	}
+	m.RefreshTokens = refreshTokens
+
+	apiTokens := m.APITokens[:0]
+	for _, apiToken := range m.APITokens {
+		if apiToken.UserID != id {
+			apiTokens = append(apiTokens, apiToken)
+		}
+	}
+	m.APITokens = apiTokens
+
+	sessions := m.Sessions[:0]
+	for _, session := range m.Sessions {
+		if session.UserID != id {
+			sessions = append(sessions, session)
+		}
+	}
+	m.Sessions = sessions
+
+	userSettings := m.UserSettings[:0]
+	for _, settings := range m.UserSettings {
+		if settings.UserID != id {
+			userSettings = append(userSettings, settings)
+		}
+	}
+	m.UserSettings = userSettings
+
+	magicLinks := m.MagicLinks[:0]
+	for _, magicLink := range m.MagicLinks {
+		if magicLink.UserID != id {
+			magicLinks = append(magicLinks, magicLink)
+		}
+	}
+	m.MagicLinks = magicLinks
+
+	requestSigningKeys := m.RequestSigningKeys[:0]
+	for _, key := range m.RequestSigningKeys {
+		if key.UserID != id {
+			requestSigningKeys = append(requestSigningKeys, key)
+		}
+	}
+	m.RequestSigningKeys = requestSigningKeys
+
+	idempotencyKeys := m.IdempotencyKeys[:0]
+	for _, key := range m.IdempotencyKeys {
+		if key.UserID != id {
+			idempotencyKeys = append(idempotencyKeys, key)
+		}
+	}
+	m.IdempotencyKeys = idempotencyKeys
+
+	return nil
+}
+
+func matchesStringFilter(filter filters.StringFilter, value string) bool {
+	if !filter.IsSet || len(filter.Value) == 0 {
+		return true
+	}
+	for _, v := range filter.Value {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetUsers filters, sorts and pages the users like the SQL query does.
+func (m *MockDataLayer) GetUsers(sortable pagination.Sortable, filter filters.UserFilter) ([]*datalayer.User, error) {
+	users := make([]*datalayer.User, 0)
+	search := strings.ToLower(filter.Search)
+	for _, user := range m.Users {
+		if user.DeletedAt.Valid {
+			continue
+		}
+		if len(search) > 0 && !strings.Contains(strings.ToLower(user.Email.String), search) &&
+			!strings.Contains(strings.ToLower(user.FirstName.String), search) &&
+			!strings.Contains(strings.ToLower(user.Surname.String), search) {
+			continue
+		}
+		if !matchesStringFilter(filter.States, user.State.String) || !matchesStringFilter(filter.Roles, user.Role.String) {
+			continue
+		}
+		users = append(users, user)
+	}
+
+	pageParams := sortable.GetPagination()
+	less := func(a, b *datalayer.User) bool {
+		switch pageParams.SortField {
+		case "email":
+			if a.Email.String != b.Email.String {
+				return a.Email.String < b.Email.String
+			}
+		case "createdAt":
+			if !a.CreatedAt.Time.Equal(b.CreatedAt.Time) {
+				return a.CreatedAt.Time.Before(b.CreatedAt.Time)
+			}
+		case "state":
+			if a.State.String != b.State.String {
+				return a.State.String < b.State.String
+			}
+		case "role":
+			if a.Role.String != b.Role.String {
+				return a.Role.String < b.Role.String
+			}
+		}
+		return a.ID < b.ID
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if pageParams.SortDir == pagination.SortDirectionDesc {
+			return less(users[j], users[i])
+		}
+		return less(users[i], users[j])
+	})
+
+	count := int64(10)
+	if pageParams.FetchCount.Valid {
+		count = pageParams.FetchCount.Value
+	}
+	offset := pageParams.Page.Value * count
+	if offset >= int64(len(users)) {
+		return users[:0], nil
+	}
+	end := offset + count
+	if end > int64(len(users)) {
+		end = int64(len(users))
+	}
+
+	return users[offset:end], nil
+}
+
+func (m *MockDataLayer) DisableUserByID(id int64, disabledAt time.Time) error {
+	user, err := m.GetUserByID(id)
+	if err != nil {
+		return err
+	} else if user.DisabledAt.Valid {
+		return datalayer.ErrNoData
+	}
+
+	user.DisabledAt = datalayer.JsonNullTime{
+		NullTime: sql.NullTime{
+			Time:  disabledAt,
+			Valid: true,
+		},
+	}
+
+	return nil
+}
+
+func (m *MockDataLayer) EnableUserByID(id int64) error {
+	user, err := m.GetUserByID(id)
+	if err != nil {
+		return err
+	} else if !user.DisabledAt.Valid {
+		return datalayer.ErrNoData
+	}
+
+	user.DisabledAt = datalayer.JsonNullTime{}
+
+	return nil
 }
\ No newline at end of file
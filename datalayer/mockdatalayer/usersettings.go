@@ -0,0 +1,48 @@
+package mockdatalayer
+
+import (
+	"math"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+)
+
+func (m *MockDataLayer) getNextUserSettingsID() int64 {
+	var maxID int64 = math.MinInt64
+	for _, settings := range m.UserSettings {
+		if settings.ID > maxID {
+			maxID = settings.ID
+		}
+	}
+
+	return maxID + 1
+}
+
+func (m *MockDataLayer) GetUserSettingsByUserID(userID int64) (*datalayer.UserSettings, error) {
+	for _, settings := range m.UserSettings {
+		if userID == settings.UserID {
+			return settings, nil
+		}
+	}
+
+	return nil, datalayer.ErrNoData
+}
+
+func (m *MockDataLayer) SaveUserSettings(settings *datalayer.UserSettings) error {
+	existing, err := m.GetUserSettingsByUserID(settings.UserID)
+	if err == datalayer.ErrNoData {
+		saved := *settings
+		saved.ID = m.getNextUserSettingsID()
+		saved.CreatedAt = now()
+		m.UserSettings = append(m.UserSettings, &saved)
+		return nil
+	}
+
+	existing.ThemeName = settings.ThemeName
+	existing.CurrencyCode = settings.CurrencyCode
+	existing.Timezone = settings.Timezone
+	existing.Locale = settings.Locale
+	existing.MagicLinkEnabled = settings.MagicLinkEnabled
+	existing.UpdatedAt = now()
+
+	return nil
+}
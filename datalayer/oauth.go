@@ -0,0 +1,254 @@
+package datalayer
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// OAuthClient is a third-party application registered by a user.
+// Confidential clients authenticate with a secret; public clients, such as
+// mobile apps, have an empty secret hash and rely on PKCE alone.
+type OAuthClient struct {
+	Model
+	ClientID         string `json:"clientID" db:"client_id"`
+	ClientSecretHash string `json:"-" db:"client_secret_hash"`
+	UserID           int64  `json:"userID" db:"user_id"`
+	Name             string `json:"name" db:"name"`
+	RedirectURIs     string `json:"redirectURIs" db:"redirect_uris"`
+	Scopes           string `json:"scopes" db:"scopes"`
+}
+
+// OAuthAuthorizationCode is issued when a user approves a client and is
+// redeemed once at the token endpoint.
+type OAuthAuthorizationCode struct {
+	Model
+	CodeHash      string       `json:"-" db:"code_hash"`
+	OAuthClientID int64        `json:"oauthClientID" db:"oauth_client_id"`
+	UserID        int64        `json:"userID" db:"user_id"`
+	RedirectURI   string       `json:"redirectURI" db:"redirect_uri"`
+	Scopes        string       `json:"scopes" db:"scopes"`
+	CodeChallenge string       `json:"-" db:"code_challenge"`
+	ExpiresAt     JsonNullTime `json:"expiresAt" db:"expires_at"`
+	UsedAt        JsonNullTime `json:"usedAt" db:"used_at"`
+}
+
+// OAuthToken is a grant to a client holding the current access token and,
+// for grants made by a user, the refresh token.
+type OAuthToken struct {
+	Model
+	OAuthClientID    int64          `json:"oauthClientID" db:"oauth_client_id"`
+	UserID           int64          `json:"userID" db:"user_id"`
+	Scopes           string         `json:"scopes" db:"scopes"`
+	AccessTokenHash  string         `json:"-" db:"access_token_hash"`
+	AccessExpiresAt  JsonNullTime   `json:"accessExpiresAt" db:"access_expires_at"`
+	RefreshTokenHash sql.NullString `json:"-" db:"refresh_token_hash"`
+	RefreshExpiresAt JsonNullTime   `json:"refreshExpiresAt" db:"refresh_expires_at"`
+	RevokedAt        JsonNullTime   `json:"revokedAt" db:"revoked_at"`
+}
+
+func (p *PersistenceDataLayer) CreateOAuthClient(client *OAuthClient) (int64, error) {
+	const cols = "client_id, client_secret_hash, user_id, name, redirect_uris, scopes"
+	var bindCols = ":" + strings.ReplaceAll(cols, ", ", ", :")
+
+	statement := fmt.Sprintf("insert into oauth_clients(%s) values (%s)", cols, bindCols)
+	result, err := p.GetConn().NamedExec(statement, client)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (p *PersistenceDataLayer) GetOAuthClientByID(id int64) (*OAuthClient, error) {
+	client := new(OAuthClient)
+	row := p.GetConn().QueryRowx(`SELECT * FROM oauth_clients WHERE id=? and deleted_at is null`, id)
+	err := row.StructScan(client)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func (p *PersistenceDataLayer) GetOAuthClientByClientID(clientID string) (*OAuthClient, error) {
+	client := new(OAuthClient)
+	row := p.GetConn().QueryRowx(`SELECT * FROM oauth_clients WHERE client_id=? and deleted_at is null`, clientID)
+	err := row.StructScan(client)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func (p *PersistenceDataLayer) GetOAuthClientsByUserID(userID int64) ([]*OAuthClient, error) {
+	clients := make([]*OAuthClient, 0)
+	err := p.GetConn().Select(&clients, `SELECT * FROM oauth_clients WHERE user_id=? and deleted_at is null ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return clients, nil
+}
+
+// DeleteOAuthClient removes a client and revokes every grant made to it.
+func (p *PersistenceDataLayer) DeleteOAuthClient(id, userID int64) error {
+	tx, err := p.GetConn().Beginx()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("update oauth_clients set deleted_at = now() where id = ? and user_id = ? and deleted_at is null", id, userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	} else if affected == 0 {
+		tx.Rollback()
+		return ErrNoData
+	}
+
+	_, err = tx.Exec("update oauth_tokens set revoked_at = now() where oauth_client_id = ? and revoked_at is null", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (p *PersistenceDataLayer) CreateOAuthAuthorizationCode(code *OAuthAuthorizationCode) (int64, error) {
+	const cols = "code_hash, oauth_client_id, user_id, redirect_uri, scopes, code_challenge, expires_at"
+	var bindCols = ":" + strings.ReplaceAll(cols, ", ", ", :")
+
+	statement := fmt.Sprintf("insert into oauth_authorization_codes(%s) values (%s)", cols, bindCols)
+	result, err := p.GetConn().NamedExec(statement, code)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (p *PersistenceDataLayer) LookupOAuthAuthorizationCode(codeHash string) (*OAuthAuthorizationCode, error) {
+	code := new(OAuthAuthorizationCode)
+	row := p.GetConn().QueryRowx(`SELECT * FROM oauth_authorization_codes WHERE code_hash=?`, codeHash)
+	err := row.StructScan(code)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return code, nil
+}
+
+// ConsumeOAuthAuthorizationCode marks a code as used.  ErrNoData is returned
+// if it was already used, so that a code cannot be redeemed twice.
+func (p *PersistenceDataLayer) ConsumeOAuthAuthorizationCode(id int64) error {
+	result, err := p.GetConn().Exec("update oauth_authorization_codes set used_at = now() where id = ? and used_at is null", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
+
+func (p *PersistenceDataLayer) CreateOAuthToken(token *OAuthToken) (int64, error) {
+	const cols = "oauth_client_id, user_id, scopes, access_token_hash, access_expires_at, refresh_token_hash, refresh_expires_at"
+	var bindCols = ":" + strings.ReplaceAll(cols, ", ", ", :")
+
+	statement := fmt.Sprintf("insert into oauth_tokens(%s) values (%s)", cols, bindCols)
+	result, err := p.GetConn().NamedExec(statement, token)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (p *PersistenceDataLayer) GetOAuthTokenByAccessHash(accessTokenHash string) (*OAuthToken, error) {
+	token := new(OAuthToken)
+	row := p.GetConn().QueryRowx(`SELECT * FROM oauth_tokens WHERE access_token_hash=?`, accessTokenHash)
+	err := row.StructScan(token)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (p *PersistenceDataLayer) GetOAuthTokenByRefreshHash(refreshTokenHash string) (*OAuthToken, error) {
+	token := new(OAuthToken)
+	row := p.GetConn().QueryRowx(`SELECT * FROM oauth_tokens WHERE refresh_token_hash=?`, refreshTokenHash)
+	err := row.StructScan(token)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// RotateOAuthToken replaces the access and refresh tokens of a grant.  The
+// update only applies while the grant still holds the presented refresh
+// token, otherwise ErrNoData is returned.
+func (p *PersistenceDataLayer) RotateOAuthToken(id int64, oldRefreshTokenHash, accessTokenHash string,
+	accessExpiresAt time.Time, refreshTokenHash string) error {
+	result, err := p.GetConn().Exec(`update oauth_tokens set access_token_hash = ?, access_expires_at = ?,
+		refresh_token_hash = ? where id = ? and refresh_token_hash = ? and revoked_at is null`,
+		accessTokenHash, accessExpiresAt, refreshTokenHash, id, oldRefreshTokenHash)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
+
+func (p *PersistenceDataLayer) RevokeOAuthToken(id int64) error {
+	_, err := p.GetConn().Exec("update oauth_tokens set revoked_at = now() where id = ? and revoked_at is null", id)
+	return err
+}
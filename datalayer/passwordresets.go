@@ -0,0 +1,80 @@
+package datalayer
+
+import (
+	"database/sql"
+	"time"
+)
+
+type PasswordReset struct {
+	Model
+	TokenHash string       `json:"-" db:"token_hash"`
+	UserID    int64        `json:"userID" db:"user_id"`
+	ExpiresAt JsonNullTime `json:"expiresAt" db:"expires_at"`
+	UsedAt    JsonNullTime `json:"usedAt" db:"used_at"`
+}
+
+func (p *PersistenceDataLayer) CreatePasswordReset(tokenHash string, userID int64, expiresAt time.Time) (int64, error) {
+	result, err := p.GetConn().Exec("insert into password_resets(token_hash, user_id, expires_at) values (?, ?, ?)",
+		tokenHash, userID, expiresAt)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (p *PersistenceDataLayer) LookupPasswordReset(tokenHash string) (*PasswordReset, error) {
+	passwordReset := new(PasswordReset)
+	row := p.GetConn().QueryRowx(`SELECT * FROM password_resets WHERE token_hash=?`, tokenHash)
+	err := row.StructScan(passwordReset)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return passwordReset, nil
+}
+
+// ConsumePasswordReset marks a reset as used.  ErrNoData is returned if it
+// was already used, so that a reset token only ever works once.
+func (p *PersistenceDataLayer) ConsumePasswordReset(id int64) error {
+	result, err := p.GetConn().Exec("update password_resets set used_at = now() where id = ? and used_at is null", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
+
+func (p *PersistenceDataLayer) ConsumePasswordResetsByUserID(userID int64) error {
+	_, err := p.GetConn().Exec("update password_resets set used_at = now() where user_id = ? and used_at is null", userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ExpirePasswordResetsByUserID ends the validity of every unused reset of the
+// user, e.g. when a new one is sent.
+func (p *PersistenceDataLayer) ExpirePasswordResetsByUserID(userID int64) error {
+	_, err := p.GetConn().Exec("update password_resets set expires_at = now() where user_id = ? and used_at is null and expires_at > now()", userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package datalayer
+
+import (
+	"database/sql"
+	"time"
+)
+
+type RefreshToken struct {
+	Model
+	JTI       string       `json:"jti" db:"jti"`
+	FamilyID  string       `json:"familyID" db:"family_id"`
+	UserID    int64        `json:"userID" db:"user_id"`
+	ExpiresAt JsonNullTime `json:"expiresAt" db:"expires_at"`
+	RotatedAt JsonNullTime `json:"rotatedAt" db:"rotated_at"`
+	RevokedAt JsonNullTime `json:"revokedAt" db:"revoked_at"`
+}
+
+func (p *PersistenceDataLayer) CreateRefreshToken(jti, familyID string, userID int64, expiresAt time.Time) (int64, error) {
+	result, err := p.GetConn().Exec("insert into refresh_tokens(jti, family_id, user_id, expires_at) values (?, ?, ?, ?)",
+		jti, familyID, userID, expiresAt)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (p *PersistenceDataLayer) GetRefreshTokenByJTI(jti string) (*RefreshToken, error) {
+	refreshToken := new(RefreshToken)
+	row := p.GetConn().QueryRowx(`SELECT * FROM refresh_tokens WHERE jti=?`, jti)
+	err := row.StructScan(refreshToken)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return refreshToken, nil
+}
+
+// RotateRefreshToken marks the refresh token as used.  Only a token that has
+// not been rotated or revoked can be rotated, otherwise ErrNoData is returned.
+func (p *PersistenceDataLayer) RotateRefreshToken(jti string) error {
+	result, err := p.GetConn().Exec("update refresh_tokens set rotated_at = now() where jti = ? and rotated_at is null and revoked_at is null", jti)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
+
+func (p *PersistenceDataLayer) RevokeRefreshTokenFamily(familyID string) error {
+	_, err := p.GetConn().Exec("update refresh_tokens set revoked_at = now() where family_id = ? and revoked_at is null", familyID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *PersistenceDataLayer) RevokeRefreshTokensByUserID(userID int64) error {
+	_, err := p.GetConn().Exec("update refresh_tokens set revoked_at = now() where user_id = ? and revoked_at is null", userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *PersistenceDataLayer) IsRefreshTokenFamilyRevoked(familyID string) (bool, error) {
+	var revoked int
+	err := p.GetConn().Get(&revoked, "SELECT count(*) FROM refresh_tokens WHERE family_id=? and revoked_at is not null", familyID)
+	if err != nil {
+		return false, err
+	}
+
+	return revoked > 0, nil
+}
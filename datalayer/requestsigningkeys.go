@@ -0,0 +1,105 @@
+package datalayer
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RequestSigningKey is a key ID and shared secret with which machine clients
+// sign requests instead of sending a bearer token.  The secret is needed to
+// verify signatures, so unlike API tokens it is not hashed but sealed with
+// SIGNING_KEY_ENCRYPTION_KEY.
+type RequestSigningKey struct {
+	Model
+	UserID     int64        `json:"userID" db:"user_id"`
+	Name       string       `json:"name" db:"name"`
+	KeyID      string       `json:"keyID" db:"key_id"`
+	Secret     string       `json:"-" db:"secret"`
+	Scopes     string       `json:"scopes" db:"scopes"`
+	LastUsedAt JsonNullTime `json:"lastUsedAt" db:"last_used_at"`
+	ExpiresAt  JsonNullTime `json:"expiresAt" db:"expires_at"`
+	RevokedAt  JsonNullTime `json:"revokedAt" db:"revoked_at"`
+}
+
+func (p *PersistenceDataLayer) CreateRequestSigningKey(key *RequestSigningKey) (int64, error) {
+	const cols = "user_id, name, key_id, secret, scopes, expires_at"
+	var bindCols = ":" + strings.ReplaceAll(cols, ", ", ", :")
+
+	statement := fmt.Sprintf("insert into request_signing_keys(%s) values (%s)", cols, bindCols)
+	result, err := p.GetConn().NamedExec(statement, key)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (p *PersistenceDataLayer) GetRequestSigningKeyByID(id int64) (*RequestSigningKey, error) {
+	key := new(RequestSigningKey)
+	row := p.GetConn().QueryRowx(`SELECT * FROM request_signing_keys WHERE id=?`, id)
+	err := row.StructScan(key)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (p *PersistenceDataLayer) GetRequestSigningKeyByKeyID(keyID string) (*RequestSigningKey, error) {
+	key := new(RequestSigningKey)
+	row := p.GetConn().QueryRowx(`SELECT * FROM request_signing_keys WHERE key_id=?`, keyID)
+	err := row.StructScan(key)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// GetRequestSigningKeysByUserID returns the keys of a user that have not been
+// revoked.
+func (p *PersistenceDataLayer) GetRequestSigningKeysByUserID(userID int64) ([]*RequestSigningKey, error) {
+	keys := make([]*RequestSigningKey, 0)
+	err := p.GetConn().Select(&keys, `SELECT * FROM request_signing_keys WHERE user_id=? and revoked_at is null ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (p *PersistenceDataLayer) RevokeRequestSigningKey(id, userID int64) error {
+	result, err := p.GetConn().Exec("update request_signing_keys set revoked_at = now() where id = ? and user_id = ? and revoked_at is null", id, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
+
+func (p *PersistenceDataLayer) SetRequestSigningKeyLastUsedAt(id int64, lastUsedAt time.Time) error {
+	_, err := p.GetConn().Exec("update request_signing_keys set last_used_at = ? where id = ?", lastUsedAt, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
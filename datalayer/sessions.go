@@ -0,0 +1,109 @@
+package datalayer
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Session is a login on a device.  It lives as long as its refresh token
+// family and records where it was last used from.
+type Session struct {
+	Model
+	UserID     int64        `json:"userID" db:"user_id"`
+	FamilyID   string       `json:"-" db:"family_id"`
+	UserAgent  string       `json:"userAgent" db:"user_agent"`
+	IPAddress  string       `json:"ipAddress" db:"ip_address"`
+	DeviceName string       `json:"deviceName" db:"device_name"`
+	LastSeenAt JsonNullTime `json:"lastSeenAt" db:"last_seen_at"`
+	RevokedAt  JsonNullTime `json:"revokedAt" db:"revoked_at"`
+}
+
+func (p *PersistenceDataLayer) CreateSession(session *Session) (int64, error) {
+	const cols = "user_id, family_id, user_agent, ip_address, device_name, last_seen_at"
+	var bindCols = ":" + strings.ReplaceAll(cols, ", ", ", :")
+
+	statement := fmt.Sprintf("insert into sessions(%s) values (%s)", cols, bindCols)
+	result, err := p.GetConn().NamedExec(statement, session)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (p *PersistenceDataLayer) GetSessionByID(id int64) (*Session, error) {
+	session := new(Session)
+	row := p.GetConn().QueryRowx(`SELECT * FROM sessions WHERE id=?`, id)
+	err := row.StructScan(session)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (p *PersistenceDataLayer) GetSessionByFamilyID(familyID string) (*Session, error) {
+	session := new(Session)
+	row := p.GetConn().QueryRowx(`SELECT * FROM sessions WHERE family_id=?`, familyID)
+	err := row.StructScan(session)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// GetSessionsByUserID returns the sessions of a user that have not been
+// revoked, most recently used first.
+func (p *PersistenceDataLayer) GetSessionsByUserID(userID int64) ([]*Session, error) {
+	sessions := make([]*Session, 0)
+	err := p.GetConn().Select(&sessions, `SELECT * FROM sessions WHERE user_id=? and revoked_at is null ORDER BY last_seen_at desc, id desc`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (p *PersistenceDataLayer) TouchSession(id int64, userAgent, ipAddress, deviceName string, lastSeenAt time.Time) error {
+	_, err := p.GetConn().Exec("update sessions set user_agent = ?, ip_address = ?, device_name = ?, last_seen_at = ? where id = ?",
+		userAgent, ipAddress, deviceName, lastSeenAt, id)
+	return err
+}
+
+func (p *PersistenceDataLayer) RevokeSession(id int64) error {
+	result, err := p.GetConn().Exec("update sessions set revoked_at = now() where id = ? and revoked_at is null", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
+
+func (p *PersistenceDataLayer) RevokeSessionByFamilyID(familyID string) error {
+	_, err := p.GetConn().Exec("update sessions set revoked_at = now() where family_id = ? and revoked_at is null", familyID)
+	return err
+}
+
+func (p *PersistenceDataLayer) RevokeSessionsByUserID(userID int64) error {
+	_, err := p.GetConn().Exec("update sessions set revoked_at = now() where user_id = ? and revoked_at is null", userID)
+	return err
+}
@@ -0,0 +1,39 @@
+package datalayer
+
+import (
+	"time"
+)
+
+type SigningKey struct {
+	Model
+	KID        string       `json:"kid" db:"kid"`
+	Algorithm  string       `json:"algorithm" db:"algorithm"`
+	PrivateKey string       `json:"-" db:"private_key"`
+	ExpiresAt  JsonNullTime `json:"expiresAt" db:"expires_at"`
+}
+
+func (p *PersistenceDataLayer) CreateSigningKey(kid, algorithm, privateKey string, expiresAt time.Time) (int64, error) {
+	result, err := p.GetConn().Exec("insert into signing_keys(kid, algorithm, private_key, expires_at) values (?, ?, ?, ?)",
+		kid, algorithm, privateKey, expiresAt)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// GetActiveSigningKeys returns the keys that have not yet expired, newest first.
+func (p *PersistenceDataLayer) GetActiveSigningKeys() ([]*SigningKey, error) {
+	var signingKeys []*SigningKey
+	err := p.GetConn().Select(&signingKeys, `SELECT * FROM signing_keys WHERE expires_at > now() and deleted_at is null ORDER BY created_at desc, id desc`)
+	if err != nil {
+		return nil, err
+	}
+
+	return signingKeys, nil
+}
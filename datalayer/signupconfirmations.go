@@ -2,25 +2,26 @@ package datalayer
 
 import (
 	"database/sql"
-	"log"
+	"time"
 )
 
 type SignUpConfirmation struct {
 	Model
-	Nonce  string `json:"name" db:"nonce"`
-	UserID int64  `json:"user_id" db:"user_id"`
+	Nonce     string       `json:"name" db:"nonce"`
+	UserID    int64        `json:"user_id" db:"user_id"`
+	ExpiresAt JsonNullTime `json:"expiresAt" db:"expires_at"`
+	UsedAt    JsonNullTime `json:"usedAt" db:"used_at"`
 }
 
-func (p *PersistenceDataLayer) CreateSignUpConfirmation(nonce string, userID int64) (int64, error) {
-	result, err := p.GetConn().Exec("insert into sign_up_confirmations(nonce, user_id) values (?, ?)", nonce, userID)
+func (p *PersistenceDataLayer) CreateSignUpConfirmation(nonce string, userID int64, expiresAt time.Time) (int64, error) {
+	result, err := p.GetConn().Exec("insert into sign_up_confirmations(nonce, user_id, expires_at) values (?, ?, ?)",
+		nonce, userID, expiresAt)
 	if err != nil {
 		return 0, err
 	}
 
 	id, err := result.LastInsertId()
 	if err != nil {
-		// TODO: remove logging
-		log.Fatal(err)
 		return 0, err
 	}
 
@@ -40,4 +41,47 @@ func (p *PersistenceDataLayer) LookupSignUpConfirmation(nonce string) (*SignUpCo
 	}
 
 	return signUp, nil
-}
\ No newline at end of file
+}
+
+func (p *PersistenceDataLayer) GetLatestSignUpConfirmationByUserID(userID int64) (*SignUpConfirmation, error) {
+	signUp := new(SignUpConfirmation)
+	statement := "SELECT * FROM sign_up_confirmations WHERE user_id=? ORDER BY created_at DESC, id DESC LIMIT 1"
+	row := p.GetConn().QueryRowx(statement, userID)
+	err := row.StructScan(signUp)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return signUp, nil
+}
+
+// ConsumeSignUpConfirmation marks a confirmation as used.  ErrNoData is
+// returned if it was already used, so that a nonce only ever works once.
+func (p *PersistenceDataLayer) ConsumeSignUpConfirmation(id int64) error {
+	result, err := p.GetConn().Exec("update sign_up_confirmations set used_at = now() where id = ? and used_at is null", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
+
+// ExpireSignUpConfirmationsByUserID ends the validity of every unused
+// confirmation of the user, e.g. when a new one is sent.
+func (p *PersistenceDataLayer) ExpireSignUpConfirmationsByUserID(userID int64) error {
+	_, err := p.GetConn().Exec("update sign_up_confirmations set expires_at = now() where user_id = ? and used_at is null and expires_at > now()", userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
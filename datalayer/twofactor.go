@@ -0,0 +1,157 @@
+package datalayer
+
+import (
+	"database/sql"
+)
+
+type TOTPCredential struct {
+	Model
+	UserID         int64        `json:"userID" db:"user_id"`
+	Secret         string       `json:"-" db:"secret"`
+	ConfirmedAt    JsonNullTime `json:"confirmedAt" db:"confirmed_at"`
+	LastUsedStep   int64        `json:"-" db:"last_used_step"`
+	FailedAttempts int          `json:"-" db:"failed_attempts"`
+	LastFailedAt   JsonNullTime `json:"-" db:"last_failed_at"`
+}
+
+type RecoveryCode struct {
+	Model
+	UserID   int64        `json:"userID" db:"user_id"`
+	CodeHash string       `json:"-" db:"code_hash"`
+	UsedAt   JsonNullTime `json:"usedAt" db:"used_at"`
+}
+
+func (p *PersistenceDataLayer) CreateTOTPCredential(userID int64, secret string) (int64, error) {
+	result, err := p.GetConn().Exec("insert into totp_credentials(user_id, secret) values (?, ?)", userID, secret)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (p *PersistenceDataLayer) GetTOTPCredentialByUserID(userID int64) (*TOTPCredential, error) {
+	credential := new(TOTPCredential)
+	row := p.GetConn().QueryRowx(`SELECT * FROM totp_credentials WHERE user_id=?`, userID)
+	err := row.StructScan(credential)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return credential, nil
+}
+
+func (p *PersistenceDataLayer) ConfirmTOTPCredential(userID int64) error {
+	result, err := p.GetConn().Exec("update totp_credentials set confirmed_at = now() where user_id = ? and confirmed_at is null", userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
+
+// SetTOTPCredentialLastUsedStep records the time step of an accepted code.
+// ErrNoData is returned if the step is not newer than the last one used, so
+// that a code cannot be replayed.
+func (p *PersistenceDataLayer) SetTOTPCredentialLastUsedStep(userID int64, step int64) error {
+	result, err := p.GetConn().Exec("update totp_credentials set last_used_step = ? where user_id = ? and last_used_step < ?",
+		step, userID, step)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
+
+func (p *PersistenceDataLayer) IncrementTOTPFailedAttempts(userID int64) error {
+	_, err := p.GetConn().Exec("update totp_credentials set failed_attempts = failed_attempts + 1, last_failed_at = now() where user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *PersistenceDataLayer) ResetTOTPFailedAttempts(userID int64) error {
+	_, err := p.GetConn().Exec("update totp_credentials set failed_attempts = 0, last_failed_at = null where user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *PersistenceDataLayer) DeleteTOTPCredentialByUserID(userID int64) error {
+	_, err := p.GetConn().Exec("delete from totp_credentials where user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *PersistenceDataLayer) CreateRecoveryCodes(userID int64, codeHashes []string) error {
+	tx, err := p.GetConn().Beginx()
+	if err != nil {
+		return err
+	}
+
+	for _, codeHash := range codeHashes {
+		_, err = tx.Exec("insert into recovery_codes(user_id, code_hash) values (?, ?)", userID, codeHash)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ConsumeRecoveryCode marks a recovery code as used.  ErrNoData is returned
+// if the code does not exist or was already used.
+func (p *PersistenceDataLayer) ConsumeRecoveryCode(userID int64, codeHash string) error {
+	result, err := p.GetConn().Exec("update recovery_codes set used_at = now() where user_id = ? and code_hash = ? and used_at is null",
+		userID, codeHash)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
+
+func (p *PersistenceDataLayer) DeleteRecoveryCodesByUserID(userID int64) error {
+	_, err := p.GetConn().Exec("delete from recovery_codes where user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
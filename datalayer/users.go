@@ -2,6 +2,11 @@ package datalayer
 
 import (
 	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/models/filters"
+	"github.com/donohutcheon/gowebserver/models/pagination"
 )
 
 type User struct {
@@ -11,11 +16,27 @@ type User struct {
 	Role     sql.NullString `db:"role"`
 	State     sql.NullString `db:"state"`
 	LoggedOutAt JsonNullTime `db:"logged_out_at"`
+	FirstName sql.NullString `db:"first_name"`
+	Surname   sql.NullString `db:"surname"`
+	Age       sql.NullInt64  `db:"age"`
+	Address   sql.NullString `db:"address"`
+	DisabledAt JsonNullTime  `db:"disabled_at"`
+	ConfirmationSentAt JsonNullTime `db:"confirmation_sent_at"`
+	PasswordResetSentAt JsonNullTime `db:"password_reset_sent_at"`
+}
+
+// UserSortColumns maps the sort fields of a user listing to their columns.
+var UserSortColumns = map[string]string{
+	"id":        "id",
+	"email":     "email",
+	"createdAt": "created_at",
+	"state":     "state",
+	"role":      "role",
 }
 
 func (p *PersistenceDataLayer) GetUserByEmail(email string) (*User, error) {
 	user := new(User)
-	row := p.GetConn().QueryRowx(`select * from users where email = ?`, email)
+	row := p.GetConn().QueryRowx(`select * from users where email = ? and deleted_at is null`, email)
 	err := row.StructScan(user)
 	if err == sql.ErrNoRows {
 		return nil, ErrNoData
@@ -28,7 +49,7 @@ func (p *PersistenceDataLayer) GetUserByEmail(email string) (*User, error) {
 
 func (p *PersistenceDataLayer) GetUserByID(id int64) (*User, error) {
 	user := new(User)
-	row := p.GetConn().QueryRowx(`SELECT * FROM users WHERE id=?`, id)
+	row := p.GetConn().QueryRowx(`SELECT * FROM users WHERE id=? AND deleted_at IS NULL`, id)
 	err := row.StructScan(user)
 	if err == sql.ErrNoRows {
 		return nil, ErrNoData
@@ -39,8 +60,8 @@ func (p *PersistenceDataLayer) GetUserByID(id int64) (*User, error) {
 	return user, nil
 }
 
-func (p *PersistenceDataLayer) CreateUser(email, password string) (int64, error){
-	result, err := p.GetConn().Exec("insert into users(email, password, state) values (?, ?, ?)", email, password, UserStateUnconfirmed)
+func (p *PersistenceDataLayer) CreateUser(email, password string, role UserRole) (int64, error){
+	result, err := p.GetConn().Exec("insert into users(email, password, role, state) values (?, ?, ?, ?)", email, password, role, UserStateUnconfirmed)
 	if err != nil {
 		return 0, err
 	}
@@ -55,7 +76,7 @@ func (p *PersistenceDataLayer) CreateUser(email, password string) (int64, error)
 
 func (p *PersistenceDataLayer) GetUnconfirmedUsers() ([]User, error) {
 	var users []User
-	err := p.GetConn().Select(&users, `SELECT * FROM users WHERE state=?`, UserStateUnconfirmed)
+	err := p.GetConn().Select(&users, `SELECT * FROM users WHERE state=? AND deleted_at IS NULL`, UserStateUnconfirmed)
 	if err == sql.ErrNoRows {
 		return nil, ErrNoData
 	} else if err != nil {
@@ -65,8 +86,303 @@ func (p *PersistenceDataLayer) GetUnconfirmedUsers() ([]User, error) {
 	return users, nil
 }
 
+// SetUserStateByID moves a user to a new state.  ErrInvalidStateTransition is
+// returned if the state machine does not allow the move from the user's
+// current state.
 func (p *PersistenceDataLayer) SetUserStateByID(id int64, state UserState) error {
-	result, err := p.GetConn().Exec("update users set state = ? where id = ?", state, id)
+	tx, err := p.GetConn().Beginx()
+	if err != nil {
+		return err
+	}
+
+	var current sql.NullString
+	err = tx.Get(&current, "select state from users where id = ? for update", id)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return ErrNoData
+	} else if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if !UserState(current.String).CanTransitionTo(state) {
+		tx.Rollback()
+		return ErrInvalidStateTransition
+	}
+
+	_, err = tx.Exec("update users set state = ? where id = ?", state, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (p *PersistenceDataLayer) SetUserLoggedOutAtByID(id int64, loggedOutAt time.Time) error {
+	result, err := p.GetConn().Exec("update users set logged_out_at = ? where id = ?", loggedOutAt, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
+
+// SetUserConfirmationSentAtByID records that a confirmation link was sent.
+// ErrNoData is returned if one was already sent within interval, so that of
+// concurrent resends only one is sent.
+func (p *PersistenceDataLayer) SetUserConfirmationSentAtByID(id int64, sentAt time.Time, interval time.Duration) error {
+	result, err := p.GetConn().Exec("update users set confirmation_sent_at = ? where id = ? and (confirmation_sent_at is null or confirmation_sent_at <= ?)",
+		sentAt, id, sentAt.Add(-interval))
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
+
+// SetUserPasswordResetSentAtByID records that a password reset link was sent,
+// like SetUserConfirmationSentAtByID.
+func (p *PersistenceDataLayer) SetUserPasswordResetSentAtByID(id int64, sentAt time.Time, interval time.Duration) error {
+	result, err := p.GetConn().Exec("update users set password_reset_sent_at = ? where id = ? and (password_reset_sent_at is null or password_reset_sent_at <= ?)",
+		sentAt, id, sentAt.Add(-interval))
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
+
+func (p *PersistenceDataLayer) SetUserPasswordByID(id int64, password string) error {
+	result, err := p.GetConn().Exec("update users set password = ? where id = ?", password, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
+
+func (p *PersistenceDataLayer) SetUserRoleByID(id int64, role UserRole) error {
+	result, err := p.GetConn().Exec("update users set role = ? where id = ?", role, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
+
+// SetUserProfileByID stores the profile fields of the user.  Unlike the
+// other setters the affected rows are not checked, an update that leaves the
+// profile unchanged affects no rows.
+func (p *PersistenceDataLayer) SetUserProfileByID(id int64, user *User) error {
+	_, err := p.GetConn().Exec("update users set first_name = ?, surname = ?, age = ?, address = ? where id = ?",
+		user.FirstName, user.Surname, user.Age, user.Address, id)
+
+	return err
+}
+
+func (p *PersistenceDataLayer) SetUserEmailByID(id int64, email string) error {
+	result, err := p.GetConn().Exec("update users set email = ? where id = ?", email, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
+
+// SoftDeleteUserByID hides a user from every query until the user is purged
+// or restored.
+func (p *PersistenceDataLayer) SoftDeleteUserByID(id int64, deletedAt time.Time) error {
+	result, err := p.GetConn().Exec("update users set deleted_at = ? where id = ? and deleted_at is null", deletedAt, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
+
+func (p *PersistenceDataLayer) RestoreUserByID(id int64) error {
+	result, err := p.GetConn().Exec("update users set deleted_at = null where id = ? and deleted_at is not null", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
+
+func (p *PersistenceDataLayer) GetDeletedUserByEmail(email string) (*User, error) {
+	user := new(User)
+	row := p.GetConn().QueryRowx(`select * from users where email = ? and deleted_at is not null order by deleted_at desc limit 1`, email)
+	err := row.StructScan(user)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (p *PersistenceDataLayer) GetUsersDeletedBefore(deletedBefore time.Time) ([]*User, error) {
+	users := make([]*User, 0)
+	err := p.GetConn().Select(&users, `SELECT * FROM users WHERE deleted_at IS NOT NULL AND deleted_at < ?`, deletedBefore)
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// PurgeUserByID permanently deletes a soft-deleted user and their data.
+// Tables not listed are removed by their foreign key cascades.
+func (p *PersistenceDataLayer) PurgeUserByID(id int64) error {
+	tx, err := p.GetConn().Beginx()
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"contacts", "card_transactions", "sign_up_confirmations"} {
+		_, err = tx.Exec("delete from "+table+" where user_id = ?", id)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	result, err := tx.Exec("delete from users where id = ? and deleted_at is not null", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	} else if affected == 0 {
+		tx.Rollback()
+		return ErrNoData
+	}
+
+	return tx.Commit()
+}
+
+// GetUsers lists the users matching the filter a page at a time.
+// Soft-deleted users are left out.
+func (p *PersistenceDataLayer) GetUsers(sortable pagination.Sortable, filter filters.UserFilter) ([]*User, error) {
+	users := make([]*User, 0)
+	pageParams := sortable.GetPagination()
+
+	builder := new(strings.Builder)
+	var bindValues []interface{}
+	if len(filter.Search) > 0 {
+		builder.WriteString(" and (email like ? or first_name like ? or surname like ?)")
+		pattern := "%" + escapeLike(filter.Search) + "%"
+		bindValues = append(bindValues, pattern, pattern, pattern)
+	}
+	for column, values := range map[string]filters.StringFilter{"state": filter.States, "role": filter.Roles} {
+		if !values.IsSet || len(values.Value) == 0 {
+			continue
+		}
+		builder.WriteString(" and " + column + " in (?" + strings.Repeat(", ?", len(values.Value)-1) + ")")
+		for _, value := range values.Value {
+			bindValues = append(bindValues, value)
+		}
+	}
+
+	sortColumn, ok := UserSortColumns[pageParams.SortField]
+	if !ok {
+		sortColumn = "id"
+	}
+
+	statement := "SELECT * FROM users WHERE deleted_at IS NULL" + builder.String() + pageParams.BuildPagination(sortColumn)
+	err := p.GetConn().Select(&users, statement, bindValues...)
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// DisableUserByID stops the user from logging in until they are enabled.
+func (p *PersistenceDataLayer) DisableUserByID(id int64, disabledAt time.Time) error {
+	result, err := p.GetConn().Exec("update users set disabled_at = ? where id = ? and disabled_at is null", disabledAt, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNoData
+	}
+
+	return nil
+}
+
+func (p *PersistenceDataLayer) EnableUserByID(id int64) error {
+	result, err := p.GetConn().Exec("update users set disabled_at = null where id = ? and disabled_at is not null", id)
 	if err != nil {
 		return err
 	}
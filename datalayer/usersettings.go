@@ -0,0 +1,41 @@
+package datalayer
+
+import (
+	"database/sql"
+)
+
+type UserSettings struct {
+	Model
+	UserID       int64  `json:"userID" db:"user_id"`
+	ThemeName    string `json:"themeName" db:"theme_name"`
+	CurrencyCode string `json:"currencyCode" db:"currency_code"`
+	Timezone     string `json:"timezone" db:"timezone"`
+	Locale       string `json:"locale" db:"locale"`
+	// MagicLinkEnabled lets the user log in with links sent to their email
+	// address.
+	MagicLinkEnabled bool `json:"magicLinkEnabled" db:"magic_link_enabled"`
+}
+
+func (p *PersistenceDataLayer) GetUserSettingsByUserID(userID int64) (*UserSettings, error) {
+	settings := new(UserSettings)
+	row := p.GetConn().QueryRowx(`SELECT * FROM user_settings WHERE user_id=?`, userID)
+	err := row.StructScan(settings)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+// SaveUserSettings creates the settings of a user or replaces the existing
+// ones.
+func (p *PersistenceDataLayer) SaveUserSettings(settings *UserSettings) error {
+	_, err := p.GetConn().Exec("insert into user_settings(user_id, theme_name, currency_code, timezone, locale, magic_link_enabled) "+
+		"values (?, ?, ?, ?, ?, ?) on duplicate key update theme_name = values(theme_name), currency_code = values(currency_code), "+
+		"timezone = values(timezone), locale = values(locale), magic_link_enabled = values(magic_link_enabled)",
+		settings.UserID, settings.ThemeName, settings.CurrencyCode, settings.Timezone, settings.Locale, settings.MagicLinkEnabled)
+
+	return err
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/state"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type AccountDeletion struct {
+	Password    string    `json:"password,omitempty"`
+	PurgeAt     time.Time `json:"purgeAt"`
+	serverState *state.ServerState
+}
+
+func NewAccountDeletion(state *state.ServerState) *AccountDeletion {
+	deletion := new(AccountDeletion)
+	deletion.serverState = state
+	return deletion
+}
+
+// Request soft-deletes the user and ends all of their sessions.  The account
+// and its data are purged once the grace period has passed unless the user
+// logs in again before then.
+func (d *AccountDeletion) Request(userID int64) error {
+	dl := d.serverState.DataLayer
+	dbUser, err := dl.GetUserByID(userID)
+	if err == datalayer.ErrNoData {
+		return ErrUserDoesNotExist
+	} else if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to query user [%d] from database", userID), http.StatusInternalServerError, err)
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(dbUser.Password.String), []byte(d.Password))
+	if err != nil {
+		return ErrPasswordIncorrect
+	}
+	d.Password = ""
+
+	user := NewUser(d.serverState)
+	user.ID = userID
+	err = user.LogoutAll()
+	if err != nil {
+		return err
+	}
+
+	deletedAt := time.Now()
+	err = dl.SoftDeleteUserByID(userID, deletedAt)
+	if err == datalayer.ErrNoData {
+		return ErrUserDoesNotExist
+	} else if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to delete user [%d]", userID), http.StatusInternalServerError, err)
+	}
+	d.PurgeAt = deletedAt.Add(d.serverState.DeletionGracePeriod)
+
+	return nil
+}
+
+// restoreUser cancels the pending deletion of a user who has logged in again.
+func restoreUser(state *state.ServerState, userID int64) error {
+	err := state.DataLayer.RestoreUserByID(userID)
+	if err == datalayer.ErrNoData {
+		// Another login restored the user first.
+		return nil
+	} else if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to restore user [%d]", userID), http.StatusInternalServerError, err)
+	}
+	state.Logger.Printf("Cancelled deletion of user %d", userID)
+
+	return nil
+}
+
+// getRecoverableUser returns the soft-deleted user with the email address
+// whose grace period has not yet passed.
+func getRecoverableUser(state *state.ServerState, email string) (*datalayer.User, error) {
+	dbUser, err := state.DataLayer.GetDeletedUserByEmail(email)
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Since(dbUser.DeletedAt.Time) > state.DeletionGracePeriod {
+		return nil, datalayer.ErrNoData
+	}
+
+	return dbUser, nil
+}
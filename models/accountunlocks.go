@@ -0,0 +1,50 @@
+package models
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/router/auth/throttle"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+type AccountUnlock struct {
+	Token       string `json:"token,omitempty"`
+	serverState *state.ServerState
+}
+
+func NewAccountUnlock(state *state.ServerState) *AccountUnlock {
+	accountUnlock := new(AccountUnlock)
+	accountUnlock.serverState = state
+	return accountUnlock
+}
+
+// Unlock lifts a login lockout using the link emailed when the account was
+// locked.
+func (a *AccountUnlock) Unlock() error {
+	dl := a.serverState.DataLayer
+
+	dbUnlock, err := dl.LookupAccountUnlock(auth.HashToken(a.Token))
+	if err == datalayer.ErrNoData {
+		return ErrAccountUnlockInvalid
+	} else if err != nil {
+		return e.Wrap("Failed to query account unlock from database", http.StatusInternalServerError, err)
+	}
+
+	if dbUnlock.UsedAt.Valid || dbUnlock.ExpiresAt.Time.Before(time.Now()) {
+		return ErrAccountUnlockInvalid
+	}
+
+	err = dl.ConsumeAccountUnlock(dbUnlock.ID)
+	if err == datalayer.ErrNoData {
+		return ErrAccountUnlockInvalid
+	} else if err != nil {
+		return e.Wrap("Failed to consume account unlock", http.StatusInternalServerError, err)
+	}
+
+	return a.serverState.Throttle.Reset(throttle.KindAccount, strconv.FormatInt(dbUnlock.UserID, 10))
+}
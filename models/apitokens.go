@@ -0,0 +1,157 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+type APIToken struct {
+	datalayer.Model
+	Name        string                 `json:"name"`
+	Scopes      []string               `json:"scopes"`
+	Prefix      string                 `json:"prefix"`
+	Token       string                 `json:"token,omitempty"`
+	ExpiresIn   int64                  `json:"expiresIn,omitempty"`
+	LastUsedAt  datalayer.JsonNullTime `json:"lastUsedAt"`
+	ExpiresAt   datalayer.JsonNullTime `json:"expiresAt"`
+	UserID      int64                  `json:"-"`
+	serverState *state.ServerState
+}
+
+func NewAPIToken(state *state.ServerState) *APIToken {
+	apiToken := new(APIToken)
+	apiToken.serverState = state
+	return apiToken
+}
+
+func (a *APIToken) convert(apiToken *datalayer.APIToken) {
+	a.ID = apiToken.ID
+	a.CreatedAt = apiToken.CreatedAt
+	a.UpdatedAt = apiToken.UpdatedAt
+	a.DeletedAt = apiToken.DeletedAt
+	a.Name = apiToken.Name
+	a.Scopes = auth.SplitScopes(apiToken.Scopes)
+	a.Prefix = apiToken.TokenPrefix
+	a.LastUsedAt = apiToken.LastUsedAt
+	a.ExpiresAt = apiToken.ExpiresAt
+	a.UserID = apiToken.UserID
+}
+
+func (a *APIToken) validate() error {
+	var fields []types.ErrorField
+	if len(a.Name) == 0 {
+		fields = append(fields, types.ErrorField{Name: "name", Message: "API token name is required"})
+	}
+
+	if len(a.Scopes) == 0 {
+		fields = append(fields, types.ErrorField{Name: "scopes", Message: "At least one scope is required"})
+	}
+	for _, scope := range a.Scopes {
+		if !auth.IsValidScope(scope) {
+			fields = append(fields, types.ErrorField{Name: "scopes", Message: fmt.Sprintf("Unknown scope %s", scope)})
+		}
+	}
+
+	if a.ExpiresIn < 0 || a.ExpiresIn > auth.APITokenLifeSpan {
+		fields = append(fields, types.ErrorField{
+			Name:    "expiresIn",
+			Message: fmt.Sprintf("Expiry must be between 1 and %d seconds", auth.APITokenLifeSpan),
+		})
+	}
+
+	if a.UserID <= 0 {
+		return ErrUserDoesNotExist
+	}
+
+	if len(fields) > 0 {
+		return e.NewError("Invalid API token request", fields, http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+// Create issues a new API token.  The plain token is only returned here; only
+// its hash is stored.
+func (a *APIToken) Create() (*APIToken, error) {
+	err := a.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	token, prefix, tokenHash, err := auth.GenerateAPIToken()
+	if err != nil {
+		return nil, e.Wrap("api token creation failed", http.StatusInternalServerError, err)
+	}
+
+	expiresIn := a.ExpiresIn
+	if expiresIn == 0 {
+		expiresIn = auth.APITokenLifeSpan
+	}
+
+	dl := a.serverState.DataLayer
+	id, err := dl.CreateAPIToken(&datalayer.APIToken{
+		UserID:      a.UserID,
+		Name:        a.Name,
+		TokenHash:   tokenHash,
+		TokenPrefix: prefix,
+		Scopes:      auth.JoinScopes(a.Scopes),
+		ExpiresAt: datalayer.JsonNullTime{
+			NullTime: sql.NullTime{
+				Time:  time.Now().Add(time.Duration(expiresIn) * time.Second),
+				Valid: true,
+			},
+		},
+	})
+	if err != nil {
+		return nil, e.Wrap("api token creation failed", http.StatusInternalServerError, err)
+	}
+
+	dbAPIToken, err := dl.GetAPITokenByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	apiToken := NewAPIToken(a.serverState)
+	apiToken.convert(dbAPIToken)
+	apiToken.Token = token
+
+	return apiToken, nil
+}
+
+func (a *APIToken) GetAPITokens(userID int64) ([]*APIToken, error) {
+	dl := a.serverState.DataLayer
+	apiTokens := make([]*APIToken, 0)
+
+	dbAPITokens, err := dl.GetAPITokensByUserID(userID)
+	if err != nil && err != datalayer.ErrNoData {
+		return nil, e.Wrap(fmt.Sprintf("Failed to query API tokens for user [%d]", userID), http.StatusInternalServerError, err)
+	}
+
+	for _, dbAPIToken := range dbAPITokens {
+		apiToken := NewAPIToken(a.serverState)
+		apiToken.convert(dbAPIToken)
+		apiTokens = append(apiTokens, apiToken)
+	}
+
+	return apiTokens, nil
+}
+
+func (a *APIToken) Revoke(id, userID int64) error {
+	dl := a.serverState.DataLayer
+	err := dl.RevokeAPIToken(id, userID)
+	if err == datalayer.ErrNoData {
+		return ErrAPITokenNotFound
+	} else if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to revoke API token [%d]", id), http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"fmt"
 	e "github.com/donohutcheon/gowebserver/controllers/errors"
 	"github.com/donohutcheon/gowebserver/controllers/response/types"
 	"github.com/donohutcheon/gowebserver/models/filters"
@@ -158,11 +159,15 @@ func (c *CardTransaction) CreateCardTransaction() (*CardTransaction, error) {
 	return data, nil
 }
 
-func (c *CardTransaction) GetCardTransaction(id int64) (*CardTransaction, error) {
+// GetCardTransaction returns a card transaction of the user.  Transactions
+// of other users are not found.
+func (c *CardTransaction) GetCardTransaction(id, userID int64) (*CardTransaction, error) {
 	dl := c.serverState.DataLayer
-	dbCardTransaction, err := dl.GetCardTransactionByID(id)
+	dbCardTransaction, err := dl.GetCardTransactionByIDAndUserID(id, userID)
 	if err == datalayer.ErrNoData {
-		return nil, err // TODO: return proper error with code
+		return nil, ErrCardTransactionNotFound
+	} else if err != nil {
+		return nil, e.Wrap(fmt.Sprintf("Failed to query card transaction [%d] from database", id), http.StatusInternalServerError, err)
 	}
 
 	cardTransaction := newFromDBCardTransaction(dbCardTransaction)
@@ -170,6 +175,19 @@ func (c *CardTransaction) GetCardTransaction(id int64) (*CardTransaction, error)
 	return cardTransaction, nil
 }
 
+// DeleteCardTransaction soft deletes a card transaction of the user.
+func (c *CardTransaction) DeleteCardTransaction(id, userID int64) error {
+	dl := c.serverState.DataLayer
+	err := dl.DeleteCardTransaction(id, userID)
+	if err == datalayer.ErrNoData {
+		return ErrCardTransactionNotFound
+	} else if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to delete card transaction [%d]", id), http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
+
 func (c *CardTransaction) GetCardTransactionsByUserID(userID int64) ([]*CardTransaction, error) {
 	dl := c.serverState.DataLayer
 	cardTransactions := make([]*CardTransaction, 0)
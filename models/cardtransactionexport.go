@@ -0,0 +1,214 @@
+package models
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+)
+
+type ExportFormat string
+
+const (
+	ExportFormatCSV    ExportFormat = "csv"
+	ExportFormatNDJSON ExportFormat = "ndjson"
+	ExportFormatJSON   ExportFormat = "json"
+)
+
+// ContentType returns the media type of exports in the format.
+func (f ExportFormat) ContentType() string {
+	switch f {
+	case ExportFormatCSV:
+		return "text/csv; charset=utf-8"
+	case ExportFormatNDJSON:
+		return "application/x-ndjson"
+	}
+
+	return "application/json"
+}
+
+// ParseExportFormat reads the format of an export, which defaults to CSV.
+func ParseExportFormat(format string) (ExportFormat, error) {
+	switch f := ExportFormat(strings.ToLower(format)); f {
+	case "":
+		return ExportFormatCSV, nil
+	case ExportFormatCSV, ExportFormatNDJSON, ExportFormatJSON:
+		return f, nil
+	}
+
+	return "", e.NewError("Invalid export format", []types.ErrorField{
+		{Name: "format", Message: "Format must be one of csv, ndjson, json"},
+	}, http.StatusBadRequest)
+}
+
+// String formats the value as a decimal number, e.g. -350 with a scale of 2
+// is -3.50.
+func (v CurrencyValue) String() string {
+	digits := strconv.FormatInt(v.Value, 10)
+	sign := ""
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = "-", digits[1:]
+	}
+	if v.Scale <= 0 {
+		return sign + digits
+	}
+	if len(digits) <= v.Scale {
+		digits = strings.Repeat("0", v.Scale-len(digits)+1) + digits
+	}
+
+	return sign + digits[:len(digits)-v.Scale] + "." + digits[len(digits)-v.Scale:]
+}
+
+// cardTransactionWriter writes card transactions in an export format.
+type cardTransactionWriter interface {
+	begin() error
+	write(c *CardTransaction) error
+	end() error
+}
+
+// csvExportColumns are named after the fields of the import column mapping
+// so that exports can be imported again, with a dateFormat of RFC3339.
+var csvExportColumns = []string{
+	"id",
+	"dateTime",
+	"amount",
+	"currencyCode",
+	"reference",
+	"merchantName",
+	"merchantCity",
+	"merchantCountryCode",
+	"merchantCountryName",
+	"merchantCategoryCode",
+	"merchantCategoryName",
+}
+
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvExportWriter) begin() error {
+	return c.w.Write(csvExportColumns)
+}
+
+func (c *csvExportWriter) write(t *CardTransaction) error {
+	return c.w.Write([]string{
+		strconv.FormatInt(t.ID, 10),
+		t.DateTime.Format(time.RFC3339),
+		t.Amount.String(),
+		t.CurrencyCode,
+		csvText(t.Reference),
+		csvText(t.MerchantName),
+		csvText(t.MerchantCity),
+		csvText(t.MerchantCountryCode),
+		csvText(t.MerchantCountryName),
+		csvText(t.MerchantCategoryCode),
+		csvText(t.MerchantCategoryName),
+	})
+}
+
+// csvText prefixes text that a spreadsheet would evaluate as a formula with a
+// quote so that it is shown as text.
+func csvText(s string) string {
+	if len(s) > 0 && strings.ContainsRune("=+-@", rune(s[0])) {
+		return "'" + s
+	}
+
+	return s
+}
+
+func (c *csvExportWriter) end() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type ndjsonExportWriter struct {
+	encoder *json.Encoder
+}
+
+func (n *ndjsonExportWriter) begin() error {
+	return nil
+}
+
+func (n *ndjsonExportWriter) write(t *CardTransaction) error {
+	return n.encoder.Encode(t)
+}
+
+func (n *ndjsonExportWriter) end() error {
+	return nil
+}
+
+// jsonExportWriter writes a JSON array one element at a time.
+type jsonExportWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (j *jsonExportWriter) begin() error {
+	_, err := io.WriteString(j.w, "[")
+	return err
+}
+
+func (j *jsonExportWriter) write(t *CardTransaction) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	if j.count > 0 {
+		_, err = io.WriteString(j.w, ",\n")
+		if err != nil {
+			return err
+		}
+	}
+	j.count++
+
+	_, err = j.w.Write(b)
+	return err
+}
+
+func (j *jsonExportWriter) end() error {
+	_, err := io.WriteString(j.w, "]\n")
+	return err
+}
+
+func newCardTransactionWriter(w io.Writer, format ExportFormat) cardTransactionWriter {
+	switch format {
+	case ExportFormatNDJSON:
+		return &ndjsonExportWriter{encoder: json.NewEncoder(w)}
+	case ExportFormatJSON:
+		return &jsonExportWriter{w: w}
+	}
+
+	return &csvExportWriter{w: csv.NewWriter(w)}
+}
+
+// ExportCardTransactions writes the user's card transactions that match the
+// filter criteria to w as they are read from the database.  Once writing has
+// started errors can no longer be reported in the response, so an export
+// that fails part way is cut short.
+func (c *CardTransaction) ExportCardTransactions(w io.Writer, format ExportFormat, userID int64) error {
+	writer := newCardTransactionWriter(w, format)
+	err := writer.begin()
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	dl := c.serverState.DataLayer
+	err = dl.StreamCardTransactionsByUserID(userID, c.filter, func(dbCardTransaction *datalayer.CardTransaction) error {
+		count++
+		return writer.write(newFromDBCardTransaction(dbCardTransaction))
+	})
+	if err != nil {
+		return fmt.Errorf("export of card transactions for user [%d] failed after %d rows: %w", userID, count, err)
+	}
+
+	return writer.end()
+}
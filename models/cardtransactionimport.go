@@ -0,0 +1,204 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/models/statements"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// CardTransactionImport loads the card transactions of a bank statement.
+type CardTransactionImport struct {
+	Format      statements.Format
+	Options     statements.Options
+	DryRun      bool
+	serverState *state.ServerState
+}
+
+func NewCardTransactionImport(state *state.ServerState) *CardTransactionImport {
+	cardTransactionImport := new(CardTransactionImport)
+	cardTransactionImport.serverState = state
+	return cardTransactionImport
+}
+
+// SetParameters reads the format, CSV column mapping, default currency, date
+// format and dry run flag of an import.  The format defaults to the
+// extension of the statement's file name.
+func (i *CardTransactionImport) SetParameters(filename string, params url.Values) error {
+	var fields []types.ErrorField
+	invalid := func(name, message string) {
+		fields = append(fields, types.ErrorField{Name: name, Message: message})
+	}
+
+	format := statements.Format(strings.ToLower(params.Get("format")))
+	if len(format) == 0 {
+		format, _ = statements.FormatFromName(filename)
+	}
+	if !statements.IsFormat(format) {
+		invalid("format", "Format must be one of csv, ofx, qif")
+	}
+	i.Format = format
+
+	if mapping := params.Get("mapping"); len(mapping) > 0 {
+		err := json.Unmarshal([]byte(mapping), &i.Options.Mapping)
+		if err != nil {
+			invalid("mapping", "Mapping must be a JSON object of field names to column headers")
+		} else if err = i.Options.Mapping.Validate(); err != nil {
+			invalid("mapping", fmt.Sprintf("Mapping is invalid, %s", err.Error()))
+		}
+	} else if format == statements.FormatCSV {
+		invalid("mapping", "Mapping is required for CSV statements")
+	}
+
+	i.Options.CurrencyCode = strings.ToUpper(params.Get("currencyCode"))
+	if len(i.Options.CurrencyCode) > 0 && !currencyCodeRe.MatchString(i.Options.CurrencyCode) {
+		invalid("currencyCode", "Currency code must be a three letter ISO 4217 code such as ZAR")
+	}
+
+	i.Options.DateFormat = params.Get("dateFormat")
+
+	if dryRun := params.Get("dryRun"); len(dryRun) > 0 {
+		var err error
+		i.DryRun, err = strconv.ParseBool(dryRun)
+		if err != nil {
+			invalid("dryRun", "Dry run must be true or false")
+		}
+	}
+
+	if len(fields) > 0 {
+		return e.NewError("Invalid import request", fields, http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+type rowErrorField struct {
+	row   int
+	field types.ErrorField
+}
+
+func newRowErrorField(row int, field, message string) rowErrorField {
+	return rowErrorField{
+		row: row,
+		field: types.ErrorField{
+			Name:    fmt.Sprintf("transactions[%d].%s", row, field),
+			Message: message,
+		},
+	}
+}
+
+// validateImported checks a statement transaction against the rules of card
+// transaction updates, so that imported transactions can be edited later.
+func validateImported(txn *statements.Transaction) []rowErrorField {
+	update := &CardTransactionUpdate{
+		DateTime:             &txn.DateTime,
+		Amount:               &CurrencyValue{Value: txn.Amount, Scale: txn.Scale},
+		CurrencyCode:         &txn.CurrencyCode,
+		Reference:            &txn.Reference,
+		MerchantName:         &txn.MerchantName,
+		MerchantCity:         &txn.MerchantCity,
+		MerchantCountryCode:  &txn.MerchantCountryCode,
+		MerchantCountryName:  &txn.MerchantCountryName,
+		MerchantCategoryCode: &txn.MerchantCategoryCode,
+		MerchantCategoryName: &txn.MerchantCategoryName,
+	}
+
+	err := update.validate()
+	controllerErr, ok := err.(*e.ControllerError)
+	if !ok {
+		return nil
+	}
+
+	rowErrors := make([]rowErrorField, 0, len(controllerErr.Fields))
+	for _, field := range controllerErr.Fields {
+		rowErrors = append(rowErrors, newRowErrorField(txn.Row, field.Name, field.Message))
+	}
+
+	return rowErrors
+}
+
+// Import reads the statement and stores its transactions for the user.
+// Statements with invalid transactions are not stored at all.  On a dry run
+// nothing is stored and the transactions that would be are returned along
+// with the errors of the invalid ones.
+func (i *CardTransactionImport) Import(r io.Reader, userID int64) ([]*CardTransaction, []types.ErrorField, error) {
+	txns, parseErrors, err := statements.Parse(r, i.Format, i.Options)
+	if err != nil {
+		return nil, nil, e.NewError("Statement could not be read", []types.ErrorField{
+			{Name: "file", Message: err.Error()},
+		}, http.StatusBadRequest)
+	}
+
+	rowErrors := make([]rowErrorField, 0, len(parseErrors))
+	for _, parseError := range parseErrors {
+		rowErrors = append(rowErrors, newRowErrorField(parseError.Row, parseError.Field, parseError.Message))
+	}
+
+	cardTransactions := make([]*CardTransaction, 0, len(txns))
+	for _, txn := range txns {
+		errs := validateImported(txn)
+		if len(errs) > 0 {
+			rowErrors = append(rowErrors, errs...)
+			continue
+		}
+
+		cardTransactions = append(cardTransactions, &CardTransaction{
+			DateTime:             txn.DateTime,
+			Amount:               CurrencyValue{Value: txn.Amount, Scale: txn.Scale},
+			CurrencyCode:         txn.CurrencyCode,
+			Reference:            txn.Reference,
+			MerchantName:         txn.MerchantName,
+			MerchantCity:         txn.MerchantCity,
+			MerchantCountryCode:  txn.MerchantCountryCode,
+			MerchantCountryName:  txn.MerchantCountryName,
+			MerchantCategoryCode: txn.MerchantCategoryCode,
+			MerchantCategoryName: txn.MerchantCategoryName,
+			UserID:               userID,
+		})
+	}
+
+	if len(cardTransactions) == 0 && len(rowErrors) == 0 {
+		return nil, nil, ErrImportEmpty
+	}
+
+	sort.SliceStable(rowErrors, func(a, b int) bool {
+		return rowErrors[a].row < rowErrors[b].row
+	})
+	fields := make([]types.ErrorField, 0, len(rowErrors))
+	for _, rowError := range rowErrors {
+		fields = append(fields, rowError.field)
+	}
+
+	if i.DryRun {
+		return cardTransactions, fields, nil
+	}
+	if len(fields) > 0 {
+		return nil, nil, e.NewError("Statement has invalid transactions, nothing was imported", fields, http.StatusBadRequest)
+	}
+
+	dbCardTransactions := make([]*datalayer.CardTransaction, 0, len(cardTransactions))
+	for _, cardTransaction := range cardTransactions {
+		dbCardTransactions = append(dbCardTransactions, cardTransaction.convertToDB())
+	}
+
+	ids, err := i.serverState.DataLayer.CreateCardTransactions(dbCardTransactions)
+	if err != nil {
+		return nil, nil, e.Wrap("Failed to import card transactions", http.StatusInternalServerError, err)
+	}
+	for n, id := range ids {
+		cardTransactions[n].ID = id
+	}
+	i.serverState.Logger.Printf("Imported %d card transactions for user %d", len(ids), userID)
+
+	return cardTransactions, fields, nil
+}
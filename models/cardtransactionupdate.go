@@ -0,0 +1,128 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+const (
+	maxCardTransactionFieldLength = 255
+	maxCurrencyScale              = 18
+)
+
+// CardTransactionUpdate is a partial update of a card transaction.  Fields
+// that are left out of the request keep their current value.
+type CardTransactionUpdate struct {
+	DateTime             *time.Time     `json:"dateTime"`
+	Amount               *CurrencyValue `json:"amount"`
+	CurrencyCode         *string        `json:"currencyCode"`
+	Reference            *string        `json:"reference"`
+	MerchantName         *string        `json:"merchantName"`
+	MerchantCity         *string        `json:"merchantCity"`
+	MerchantCountryCode  *string        `json:"merchantCountryCode"`
+	MerchantCountryName  *string        `json:"merchantCountryName"`
+	MerchantCategoryCode *string        `json:"merchantCategoryCode"`
+	MerchantCategoryName *string        `json:"merchantCategoryName"`
+	serverState          *state.ServerState
+}
+
+func NewCardTransactionUpdate(state *state.ServerState) *CardTransactionUpdate {
+	update := new(CardTransactionUpdate)
+	update.serverState = state
+	return update
+}
+
+func (u *CardTransactionUpdate) validate() error {
+	var fields []types.ErrorField
+	invalid := func(name, message string) {
+		fields = append(fields, types.ErrorField{Name: name, Message: message})
+	}
+
+	if u.DateTime != nil && u.DateTime.IsZero() {
+		invalid("dateTime", "Date and time is required")
+	}
+	if u.Amount != nil && (u.Amount.Scale < 0 || u.Amount.Scale > maxCurrencyScale) {
+		invalid("amount.scale", fmt.Sprintf("Scale must be between 0 and %d", maxCurrencyScale))
+	}
+	if u.CurrencyCode != nil && !currencyCodeRe.MatchString(*u.CurrencyCode) {
+		invalid("currencyCode", "Currency code must be a three letter ISO 4217 code such as ZAR")
+	}
+	if u.MerchantName != nil && len(strings.TrimSpace(*u.MerchantName)) == 0 {
+		invalid("merchantName", "Merchant name is required")
+	}
+
+	for _, field := range []struct {
+		name  string
+		value *string
+	}{
+		{"reference", u.Reference},
+		{"merchantName", u.MerchantName},
+		{"merchantCity", u.MerchantCity},
+		{"merchantCountryCode", u.MerchantCountryCode},
+		{"merchantCountryName", u.MerchantCountryName},
+		{"merchantCategoryCode", u.MerchantCategoryCode},
+		{"merchantCategoryName", u.MerchantCategoryName},
+	} {
+		if field.value != nil && utf8.RuneCountInString(*field.value) > maxCardTransactionFieldLength {
+			invalid(field.name, fmt.Sprintf("Must be at most %d characters long", maxCardTransactionFieldLength))
+		}
+	}
+
+	if len(fields) > 0 {
+		return e.NewError("Invalid card transaction update", fields, http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+func updateString(s *string, current string) string {
+	if s == nil {
+		return current
+	}
+
+	return strings.TrimSpace(*s)
+}
+
+// Apply validates the update and stores it, returning the updated card
+// transaction.  Only the user's own transactions can be updated.
+func (u *CardTransactionUpdate) Apply(id, userID int64) (*CardTransaction, error) {
+	err := u.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	cardTransaction, err := NewCardTransaction(u.serverState).GetCardTransaction(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.DateTime != nil {
+		cardTransaction.DateTime = *u.DateTime
+	}
+	if u.Amount != nil {
+		cardTransaction.Amount = *u.Amount
+	}
+	cardTransaction.CurrencyCode = updateString(u.CurrencyCode, cardTransaction.CurrencyCode)
+	cardTransaction.Reference = updateString(u.Reference, cardTransaction.Reference)
+	cardTransaction.MerchantName = updateString(u.MerchantName, cardTransaction.MerchantName)
+	cardTransaction.MerchantCity = updateString(u.MerchantCity, cardTransaction.MerchantCity)
+	cardTransaction.MerchantCountryCode = updateString(u.MerchantCountryCode, cardTransaction.MerchantCountryCode)
+	cardTransaction.MerchantCountryName = updateString(u.MerchantCountryName, cardTransaction.MerchantCountryName)
+	cardTransaction.MerchantCategoryCode = updateString(u.MerchantCategoryCode, cardTransaction.MerchantCategoryCode)
+	cardTransaction.MerchantCategoryName = updateString(u.MerchantCategoryName, cardTransaction.MerchantCategoryName)
+	cardTransaction.UserID = userID
+
+	err = u.serverState.DataLayer.UpdateCardTransaction(cardTransaction.convertToDB())
+	if err != nil {
+		return nil, e.Wrap(fmt.Sprintf("Failed to update card transaction [%d]", id), http.StatusInternalServerError, err)
+	}
+
+	return NewCardTransaction(u.serverState).GetCardTransaction(id, userID)
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type EmailChange struct {
+	Email       string `json:"email,omitempty"`
+	Password    string `json:"password,omitempty"`
+	Token       string `json:"token,omitempty"`
+	serverState *state.ServerState
+}
+
+func NewEmailChange(state *state.ServerState) *EmailChange {
+	emailChange := new(EmailChange)
+	emailChange.serverState = state
+	return emailChange
+}
+
+// Request records a pending change of the user's email address.  The address
+// only changes once the link sent to the new address has been followed.
+func (c *EmailChange) Request(userID int64) error {
+	if !strings.Contains(c.Email, "@") {
+		return ErrValidationEmail
+	}
+
+	dl := c.serverState.DataLayer
+	dbUser, err := dl.GetUserByID(userID)
+	if err == datalayer.ErrNoData {
+		return ErrUserDoesNotExist
+	} else if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to query user [%d] from database", userID), http.StatusInternalServerError, err)
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(dbUser.Password.String), []byte(c.Password))
+	if err != nil {
+		return ErrPasswordIncorrect
+	}
+
+	err = validateEmailUnique(dl, c.Email)
+	if err != nil {
+		return err
+	}
+
+	c.serverState.Channels.ChangeEmails <- datalayer.EmailChange{
+		UserID:   userID,
+		NewEmail: c.Email,
+	}
+
+	return nil
+}
+
+// Confirm swaps the user's email address for the one being confirmed.
+func (c *EmailChange) Confirm() error {
+	dl := c.serverState.DataLayer
+
+	if len(c.Token) == 0 {
+		return ErrEmailChangeInvalid
+	}
+
+	dbChange, err := dl.LookupEmailChange(auth.HashToken(c.Token))
+	if err == datalayer.ErrNoData {
+		return ErrEmailChangeInvalid
+	} else if err != nil {
+		return e.Wrap("Failed to query email change from database", http.StatusInternalServerError, err)
+	}
+
+	if dbChange.UsedAt.Valid || dbChange.ExpiresAt.Time.Before(time.Now()) {
+		return ErrEmailChangeInvalid
+	}
+
+	// The address may have been taken since the change was requested.
+	err = validateEmailUnique(dl, dbChange.NewEmail)
+	if err != nil {
+		return err
+	}
+
+	err = dl.ConsumeEmailChange(dbChange.ID)
+	if err == datalayer.ErrNoData {
+		return ErrEmailChangeInvalid
+	} else if err != nil {
+		return e.Wrap("Failed to consume email change", http.StatusInternalServerError, err)
+	}
+
+	err = dl.SetUserEmailByID(dbChange.UserID, dbChange.NewEmail)
+	if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to update email of user [%d]", dbChange.UserID), http.StatusInternalServerError, err)
+	}
+
+	c.Email = dbChange.NewEmail
+
+	return nil
+}
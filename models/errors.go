@@ -23,11 +23,21 @@ var (
 		http.StatusBadRequest)
 
 	ErrValidationPassword = e.NewError("Password is required", []types.ErrorField{
-		{Name: "password", Message: "Password must be longer than 6 characters"},
+		{Name: "password", Message: "Password is required"},
 	}, http.StatusBadRequest)
 
 	ErrUserDoesNotExist = e.NewError("User does not exist", nil, http.StatusForbidden)
 
+	ErrSignUpConfirmationNotFound = e.NewError("No match found for nonce", []types.ErrorField{
+		{Name: "nonce", Message: "No match found for nonce"},
+	}, http.StatusBadRequest)
+
+	ErrSignUpConfirmationExpired = e.NewError("Confirmation link has expired, request a new one", []types.ErrorField{
+		{Name: "nonce", Message: "Confirmation link has expired"},
+	}, http.StatusGone)
+
+	ErrSignUpConfirmationUsed = e.NewError("Email address has already been confirmed", nil, http.StatusConflict)
+
 	ErrEmailExists      = e.NewError("Email address already exists", []types.ErrorField{
 		{Name: "email", Message: "Email address already exists"},
 	}, http.StatusBadRequest)
@@ -41,4 +51,80 @@ var (
 	ErrValidationPhone = e.NewError("Contact phone number is required", []types.ErrorField{
 		{Name: "phone", Message: "Contact phone number is required"},
 	}, http.StatusBadRequest)
+
+	ErrAPITokenNotFound = e.NewError("API token not found", nil, http.StatusNotFound)
+
+	ErrCardTransactionNotFound = e.NewError("Card transaction not found", nil, http.StatusNotFound)
+
+	ErrImportEmpty = e.NewError("Statement has no transactions", []types.ErrorField{
+		{Name: "file", Message: "Statement has no transactions"},
+	}, http.StatusBadRequest)
+
+	ErrSigningKeyNotFound = e.NewError("Signing key not found", nil, http.StatusNotFound)
+
+	ErrPasswordResetInvalid = e.NewError("Password reset link is invalid or has expired", []types.ErrorField{
+		{Name: "token", Message: "Password reset link is invalid or has expired"},
+	}, http.StatusBadRequest)
+
+	ErrPasswordIncorrect = e.NewError("Password is incorrect", []types.ErrorField{
+		{Name: "password", Message: "Password is incorrect"},
+	}, http.StatusForbidden)
+
+	ErrEmailChangeInvalid = e.NewError("Email change link is invalid or has expired", []types.ErrorField{
+		{Name: "token", Message: "Email change link is invalid or has expired"},
+	}, http.StatusBadRequest)
+
+	ErrTwoFactorEnabled = e.NewError("Two-factor authentication is already enabled", nil, http.StatusConflict)
+
+	ErrTwoFactorNotEnabled = e.NewError("Two-factor authentication is not enabled", nil, http.StatusBadRequest)
+
+	ErrTwoFactorNotPending = e.NewError("Two-factor authentication setup has not been started", nil, http.StatusBadRequest)
+
+	ErrTwoFactorCodeInvalid = e.NewError("Invalid two-factor authentication code", []types.ErrorField{
+		{Name: "code", Message: "Invalid two-factor authentication code"},
+	}, http.StatusForbidden)
+
+	ErrTwoFactorLocked = e.NewError("Too many failed two-factor attempts, try again later", nil, http.StatusTooManyRequests)
+
+	ErrAccountUnlockInvalid = e.NewError("Unlock link is invalid or has expired", []types.ErrorField{
+		{Name: "token", Message: "Unlock link is invalid or has expired"},
+	}, http.StatusBadRequest)
+
+	ErrMagicLinkInvalid = e.NewError("Login link is invalid or has expired", []types.ErrorField{
+		{Name: "token", Message: "Login link is invalid or has expired"},
+	}, http.StatusBadRequest)
+
+	ErrMagicLinkDisabled = e.NewError("Login links are turned off for this account", nil, http.StatusForbidden)
+
+	ErrOIDCProviderNotFound = e.NewError("Identity provider not found", nil, http.StatusNotFound)
+
+	ErrOIDCLoginInvalid = e.NewError("Login request is invalid or has expired", nil, http.StatusBadRequest)
+
+	ErrOIDCEmailNotVerified = e.NewError("Email address has not been verified by the identity provider", nil, http.StatusForbidden)
+
+	ErrOIDCAccountExists = e.NewError("An account with this email address already exists, log in and link the identity provider from your account", nil, http.StatusConflict)
+
+	ErrOIDCIdentityLinked = e.NewError("Identity is already linked to another account", nil, http.StatusConflict)
+
+	ErrOAuthClientNotFound = e.NewError("OAuth client not found", nil, http.StatusNotFound)
+
+	ErrSessionNotFound = e.NewError("Session not found", nil, http.StatusNotFound)
+
+	ErrAdminUserNotFound = e.NewError("User not found", nil, http.StatusNotFound)
+
+	ErrAdminUserConfirmed = e.NewError("User has already been confirmed", nil, http.StatusConflict)
+
+	ErrAdminUserDisabled = e.NewError("User is already disabled", nil, http.StatusConflict)
+
+	ErrAdminUserEnabled = e.NewError("User is not disabled", nil, http.StatusConflict)
+
+	ErrAdminSelf = e.NewError("Administrators cannot disable or change the role of their own account", nil, http.StatusBadRequest)
+
+	ErrAdminRoleInvalid = e.NewError("Role is invalid", []types.ErrorField{
+		{Name: "role", Message: "Role must be USER or ADMIN"},
+	}, http.StatusBadRequest)
+
+	ErrAdminImpersonateAdmin = e.NewError("Administrators cannot be impersonated", nil, http.StatusBadRequest)
+
+	ErrAdminImpersonateDisabled = e.NewError("Disabled users cannot be impersonated", nil, http.StatusConflict)
 )
@@ -0,0 +1,9 @@
+package filters
+
+// UserFilter narrows a listing of users.  Search matches part of the email
+// address, first name or surname.
+type UserFilter struct {
+	Search string
+	States StringFilter
+	Roles  StringFilter
+}
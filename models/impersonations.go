@@ -0,0 +1,77 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/models/pagination"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// Impersonate issues the administrator a short-lived token to act as the
+// user.  Administrators cannot be impersonated, which also stops
+// administrators impersonating themselves.
+func (a *UserAdmin) Impersonate(adminID, id int64) (*auth.ImpersonationResponse, error) {
+	dbUser, err := a.getUser(id)
+	if err != nil {
+		return nil, err
+	}
+	if adminID == id || auth.CheckRoles(auth.RolesForUser(dbUser), []string{auth.RoleAdmin}) == nil {
+		return nil, ErrAdminImpersonateAdmin
+	}
+	if dbUser.DisabledAt.Valid {
+		return nil, ErrAdminImpersonateDisabled
+	}
+
+	token, err := auth.CreateImpersonationToken(a.serverState, adminID, dbUser)
+	if err != nil {
+		return nil, e.Wrap("Failed to create impersonation token", http.StatusInternalServerError, err)
+	}
+	a.serverState.Logger.Printf("Administrator %d is impersonating user %d", adminID, id)
+
+	return token, nil
+}
+
+// ImpersonationAudits lists the requests administrators made while
+// impersonating a user.
+type ImpersonationAudits struct {
+	serverState *state.ServerState
+	pagination  pagination.Parameters
+}
+
+func NewImpersonationAudits(state *state.ServerState) *ImpersonationAudits {
+	audits := new(ImpersonationAudits)
+	audits.serverState = state
+	return audits
+}
+
+func (i *ImpersonationAudits) GetSortFields() map[string]bool {
+	fields := make(map[string]bool)
+	for field := range datalayer.ImpersonationAuditSortColumns {
+		fields[field] = true
+	}
+	return fields
+}
+
+func (i *ImpersonationAudits) SetSortParameters(parameters pagination.Parameters) {
+	i.pagination = parameters
+}
+
+func (i *ImpersonationAudits) GetPagination() pagination.Parameters {
+	return i.pagination
+}
+
+// GetByUserID returns a page of the audit trail of a user.  The trail is
+// kept after the user is purged, so the user need not exist.
+func (i *ImpersonationAudits) GetByUserID(userID int64) ([]*datalayer.ImpersonationAudit, error) {
+	audits, err := i.serverState.DataLayer.GetImpersonationAuditsByUserID(userID, i)
+	if err != nil {
+		return nil, e.Wrap(fmt.Sprintf("Failed to query impersonation audits of user [%d] from database", userID),
+			http.StatusInternalServerError, err)
+	}
+
+	return audits, nil
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+type MagicLink struct {
+	Email       string `json:"email,omitempty"`
+	Token       string `json:"token,omitempty"`
+	serverState *state.ServerState
+}
+
+func NewMagicLink(state *state.ServerState) *MagicLink {
+	magicLink := new(MagicLink)
+	magicLink.serverState = state
+	return magicLink
+}
+
+// Request queues a login link email.  Unknown addresses, and accounts that
+// cannot log in with a link, are silently ignored so that the endpoint
+// cannot be used to discover accounts.
+func (m *MagicLink) Request() error {
+	if !strings.Contains(m.Email, "@") {
+		return ErrValidationEmail
+	}
+
+	logger := m.serverState.Logger
+	dbUser, err := m.serverState.DataLayer.GetUserByEmail(m.Email)
+	if err == datalayer.ErrNoData {
+		logger.Printf("Magic link requested for unknown email address")
+		return nil
+	} else if err != nil {
+		return e.Wrap("Failed to query user from database", http.StatusInternalServerError, err)
+	}
+
+	user := NewUser(m.serverState)
+	err = user.GetUser(dbUser.ID)
+	if err != nil {
+		return err
+	}
+
+	if datalayer.UserState(dbUser.State.String) != datalayer.UserStateConfirmed || user.disabled ||
+		!user.Settings.MagicLinkEnabled {
+		logger.Printf("Magic link requested for user %d who cannot log in with one", dbUser.ID)
+		return nil
+	}
+
+	m.serverState.Channels.MagicLinks <- *dbUser
+
+	return nil
+}
+
+func (m *MagicLink) lookup() (*datalayer.MagicLink, error) {
+	if len(m.Token) == 0 {
+		return nil, ErrMagicLinkInvalid
+	}
+
+	dbLink, err := m.serverState.DataLayer.LookupMagicLink(auth.HashToken(m.Token))
+	if err == datalayer.ErrNoData {
+		return nil, ErrMagicLinkInvalid
+	} else if err != nil {
+		return nil, e.Wrap("Failed to query magic link from database", http.StatusInternalServerError, err)
+	}
+
+	if dbLink.UsedAt.Valid || dbLink.ExpiresAt.Time.Before(time.Now()) {
+		return nil, ErrMagicLinkInvalid
+	}
+
+	return dbLink, nil
+}
+
+// Check verifies a link without using it and returns when it expires.
+// Opening the link only checks it, logging in needs a separate confirmation,
+// so that links followed by mail scanners keep working.
+func (m *MagicLink) Check() (datalayer.JsonNullTime, error) {
+	dbLink, err := m.lookup()
+	if err != nil {
+		return datalayer.JsonNullTime{}, err
+	}
+
+	return dbLink.ExpiresAt, nil
+}
+
+// Login uses up the link and logs the user in, asking for the second factor
+// first when two-factor authentication is enabled.
+func (m *MagicLink) Login(client auth.Client) (*auth.TokenResponse, *auth.ChallengeResponse, error) {
+	dbLink, err := m.lookup()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user := NewUser(m.serverState)
+	err = user.GetUser(dbLink.UserID)
+	if err == ErrUserDoesNotExist {
+		return nil, nil, ErrMagicLinkInvalid
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	// The user may have turned links off after this one was sent.
+	if !user.Settings.MagicLinkEnabled {
+		return nil, nil, ErrMagicLinkDisabled
+	}
+
+	err = m.serverState.DataLayer.ConsumeMagicLink(dbLink.ID)
+	if err == datalayer.ErrNoData {
+		return nil, nil, ErrMagicLinkInvalid
+	} else if err != nil {
+		return nil, nil, e.Wrap("Failed to consume magic link", http.StatusInternalServerError, err)
+	}
+	user.Password = ""
+
+	return user.issueTokens(client, false)
+}
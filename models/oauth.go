@@ -0,0 +1,687 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+const (
+	oauthClientIDPrefix     = "gwc_"
+	oauthClientSecretPrefix = "gwcs_"
+)
+
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeRefreshToken      = "refresh_token"
+)
+
+// OAuthClient is a third-party application allowed to request access to
+// users' accounts.  Clients are public when they cannot keep a secret, e.g.
+// mobile apps, and must then rely on PKCE alone.
+type OAuthClient struct {
+	datalayer.Model
+	ClientID     string   `json:"clientID"`
+	ClientSecret string   `json:"clientSecret,omitempty"`
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirectURIs"`
+	Scopes       []string `json:"scopes"`
+	Public       bool     `json:"public"`
+	UserID       int64    `json:"-"`
+	serverState  *state.ServerState
+}
+
+func NewOAuthClient(state *state.ServerState) *OAuthClient {
+	client := new(OAuthClient)
+	client.serverState = state
+	return client
+}
+
+func (c *OAuthClient) convert(client *datalayer.OAuthClient) {
+	c.ID = client.ID
+	c.CreatedAt = client.CreatedAt
+	c.UpdatedAt = client.UpdatedAt
+	c.DeletedAt = client.DeletedAt
+	c.ClientID = client.ClientID
+	c.Name = client.Name
+	c.RedirectURIs = auth.SplitScopes(client.RedirectURIs)
+	c.Scopes = auth.SplitScopes(client.Scopes)
+	c.Public = len(client.ClientSecretHash) == 0
+	c.UserID = client.UserID
+}
+
+func (c *OAuthClient) validate() error {
+	var fields []types.ErrorField
+	if len(c.Name) == 0 {
+		fields = append(fields, types.ErrorField{Name: "name", Message: "Client name is required"})
+	}
+
+	if len(c.RedirectURIs) == 0 {
+		fields = append(fields, types.ErrorField{Name: "redirectURIs", Message: "At least one redirect URI is required"})
+	}
+	for _, redirectURI := range c.RedirectURIs {
+		if !isValidRedirectURI(redirectURI) {
+			fields = append(fields, types.ErrorField{
+				Name:    "redirectURIs",
+				Message: fmt.Sprintf("Redirect URI %s must be an absolute https or loopback http URI", redirectURI),
+			})
+		}
+	}
+
+	if len(c.Scopes) == 0 {
+		fields = append(fields, types.ErrorField{Name: "scopes", Message: "At least one scope is required"})
+	}
+	for _, scope := range c.Scopes {
+		if !auth.IsValidScope(scope) {
+			fields = append(fields, types.ErrorField{Name: "scopes", Message: fmt.Sprintf("Unknown scope %s", scope)})
+		}
+	}
+
+	if c.UserID <= 0 {
+		return ErrUserDoesNotExist
+	}
+
+	if len(fields) > 0 {
+		return e.NewError("Invalid OAuth client request", fields, http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+func isValidRedirectURI(redirectURI string) bool {
+	u, err := url.Parse(redirectURI)
+	if err != nil || !u.IsAbs() || len(u.Fragment) > 0 {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	}
+
+	return false
+}
+
+// Create registers a new client.  The client secret is only returned here;
+// only its hash is stored.
+func (c *OAuthClient) Create() (*OAuthClient, error) {
+	err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	clientID, _, err := auth.GenerateOAuthToken(oauthClientIDPrefix)
+	if err != nil {
+		return nil, e.Wrap("OAuth client creation failed", http.StatusInternalServerError, err)
+	}
+
+	var clientSecret, clientSecretHash string
+	if !c.Public {
+		clientSecret, clientSecretHash, err = auth.GenerateOAuthToken(oauthClientSecretPrefix)
+		if err != nil {
+			return nil, e.Wrap("OAuth client creation failed", http.StatusInternalServerError, err)
+		}
+	}
+
+	dl := c.serverState.DataLayer
+	id, err := dl.CreateOAuthClient(&datalayer.OAuthClient{
+		ClientID:         clientID,
+		ClientSecretHash: clientSecretHash,
+		UserID:           c.UserID,
+		Name:             c.Name,
+		RedirectURIs:     auth.JoinScopes(c.RedirectURIs),
+		Scopes:           auth.JoinScopes(c.Scopes),
+	})
+	if err != nil {
+		return nil, e.Wrap("OAuth client creation failed", http.StatusInternalServerError, err)
+	}
+
+	dbClient, err := dl.GetOAuthClientByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	client := NewOAuthClient(c.serverState)
+	client.convert(dbClient)
+	client.ClientSecret = clientSecret
+
+	return client, nil
+}
+
+func (c *OAuthClient) GetOAuthClients(userID int64) ([]*OAuthClient, error) {
+	dl := c.serverState.DataLayer
+	clients := make([]*OAuthClient, 0)
+
+	dbClients, err := dl.GetOAuthClientsByUserID(userID)
+	if err != nil && err != datalayer.ErrNoData {
+		return nil, e.Wrap(fmt.Sprintf("Failed to query OAuth clients for user [%d]", userID), http.StatusInternalServerError, err)
+	}
+
+	for _, dbClient := range dbClients {
+		client := NewOAuthClient(c.serverState)
+		client.convert(dbClient)
+		clients = append(clients, client)
+	}
+
+	return clients, nil
+}
+
+// Delete removes a client, revoking every token issued to it.
+func (c *OAuthClient) Delete(id, userID int64) error {
+	dl := c.serverState.DataLayer
+	err := dl.DeleteOAuthClient(id, userID)
+	if err == datalayer.ErrNoData {
+		return ErrOAuthClientNotFound
+	} else if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to delete OAuth client [%d]", id), http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
+
+// OAuthAuthorization is a request by a client for access to the signed in
+// user's account.  The parameters are those of the authorization endpoint in
+// RFC 6749 section 4.1.1, and PKCE with S256 is required.
+type OAuthAuthorization struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	// Approve records the user's decision on the consent screen.
+	Approve     bool  `json:"approve"`
+	UserID      int64 `json:"-"`
+	serverState *state.ServerState
+}
+
+// OAuthConsent describes what the consent screen asks the user to approve.
+type OAuthConsent struct {
+	ClientID    string   `json:"clientID"`
+	ClientName  string   `json:"clientName"`
+	RedirectURI string   `json:"redirectURI"`
+	Scopes      []string `json:"scopes"`
+}
+
+func NewOAuthAuthorization(state *state.ServerState) *OAuthAuthorization {
+	authorization := new(OAuthAuthorization)
+	authorization.serverState = state
+	return authorization
+}
+
+// validate checks the request and resolves the client and the scopes to
+// grant.  Errors are reported to the user rather than redirected, since the
+// redirect URI cannot be trusted until it has been checked.
+func (a *OAuthAuthorization) validate() (*datalayer.OAuthClient, []string, error) {
+	client, err := a.serverState.DataLayer.GetOAuthClientByClientID(a.ClientID)
+	if err == datalayer.ErrNoData {
+		return nil, nil, e.NewError("Invalid authorization request", []types.ErrorField{
+			{Name: "client_id", Message: "Unknown client"},
+		}, http.StatusBadRequest)
+	} else if err != nil {
+		return nil, nil, e.Wrap("Failed to query OAuth client from database", http.StatusInternalServerError, err)
+	}
+
+	var fields []types.ErrorField
+	if !containsString(auth.SplitScopes(client.RedirectURIs), a.RedirectURI) {
+		fields = append(fields, types.ErrorField{Name: "redirect_uri", Message: "Redirect URI is not registered for this client"})
+	}
+
+	if a.ResponseType != "code" {
+		fields = append(fields, types.ErrorField{Name: "response_type", Message: "Only the code response type is supported"})
+	}
+
+	allowed := auth.SplitScopes(client.Scopes)
+	scopes := auth.SplitScopes(a.Scope)
+	if len(scopes) == 0 {
+		scopes = allowed
+	}
+	for _, scope := range scopes {
+		if !containsString(allowed, scope) {
+			fields = append(fields, types.ErrorField{Name: "scope", Message: fmt.Sprintf("Scope %s is not allowed for this client", scope)})
+		}
+	}
+
+	if len(a.CodeChallenge) == 0 || a.CodeChallengeMethod != "S256" {
+		fields = append(fields, types.ErrorField{Name: "code_challenge", Message: "A PKCE code challenge using S256 is required"})
+	}
+
+	if len(fields) > 0 {
+		return nil, nil, e.NewError("Invalid authorization request", fields, http.StatusBadRequest)
+	}
+
+	return client, scopes, nil
+}
+
+// Consent validates the request and returns what the user is asked to
+// approve.
+func (a *OAuthAuthorization) Consent() (*OAuthConsent, error) {
+	client, scopes, err := a.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	consent := &OAuthConsent{
+		ClientID:    client.ClientID,
+		ClientName:  client.Name,
+		RedirectURI: a.RedirectURI,
+		Scopes:      scopes,
+	}
+
+	return consent, nil
+}
+
+// Decide records the user's decision and returns the URL to send the user
+// back to the client with, carrying either an authorization code or the
+// access_denied error.
+func (a *OAuthAuthorization) Decide() (string, error) {
+	client, scopes, err := a.validate()
+	if err != nil {
+		return "", err
+	}
+
+	redirectURI, err := url.Parse(a.RedirectURI)
+	if err != nil {
+		return "", e.Wrap("Invalid redirect URI", http.StatusBadRequest, err)
+	}
+	query := redirectURI.Query()
+	if len(a.State) > 0 {
+		query.Set("state", a.State)
+	}
+
+	if !a.Approve {
+		query.Set("error", auth.OAuthErrAccessDenied)
+		redirectURI.RawQuery = query.Encode()
+		return redirectURI.String(), nil
+	}
+
+	code, codeHash, err := auth.GenerateOAuthToken("")
+	if err != nil {
+		return "", e.Wrap("Failed to create authorization code", http.StatusInternalServerError, err)
+	}
+
+	_, err = a.serverState.DataLayer.CreateOAuthAuthorizationCode(&datalayer.OAuthAuthorizationCode{
+		CodeHash:      codeHash,
+		OAuthClientID: client.ID,
+		UserID:        a.UserID,
+		RedirectURI:   a.RedirectURI,
+		Scopes:        auth.JoinScopes(scopes),
+		CodeChallenge: a.CodeChallenge,
+		ExpiresAt:     nullTime(time.Now().Add(auth.AuthorizationCodeLifeSpan * time.Second)),
+	})
+	if err != nil {
+		return "", e.Wrap("Failed to save authorization code", http.StatusInternalServerError, err)
+	}
+
+	query.Set("code", code)
+	redirectURI.RawQuery = query.Encode()
+
+	return redirectURI.String(), nil
+}
+
+// OAuthTokenRequest holds the form parameters of the token, introspection
+// and revocation endpoints along with the client credentials.  All errors
+// returned by its methods are *auth.OAuthError.
+type OAuthTokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+	Scope        string
+	Token        string
+	ClientID     string
+	ClientSecret string
+	serverState  *state.ServerState
+}
+
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+// OAuthIntrospection is the introspection response of RFC 7662.  Inactive
+// tokens carry no other information.
+type OAuthIntrospection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+func NewOAuthTokenRequest(state *state.ServerState) *OAuthTokenRequest {
+	req := new(OAuthTokenRequest)
+	req.serverState = state
+	return req
+}
+
+func (o *OAuthTokenRequest) authenticateClient() (*datalayer.OAuthClient, error) {
+	if len(o.ClientID) == 0 {
+		return nil, auth.NewOAuthError(auth.OAuthErrInvalidClient, "Client authentication failed")
+	}
+
+	client, err := o.serverState.DataLayer.GetOAuthClientByClientID(o.ClientID)
+	if err == datalayer.ErrNoData {
+		return nil, auth.NewOAuthError(auth.OAuthErrInvalidClient, "Client authentication failed")
+	} else if err != nil {
+		return nil, auth.WrapOAuthError("Failed to query OAuth client from database", err)
+	}
+
+	if len(client.ClientSecretHash) == 0 {
+		if len(o.ClientSecret) > 0 {
+			return nil, auth.NewOAuthError(auth.OAuthErrInvalidClient, "Client authentication failed")
+		}
+		return client, nil
+	}
+
+	if !auth.SecretMatches(o.ClientSecret, client.ClientSecretHash) {
+		return nil, auth.NewOAuthError(auth.OAuthErrInvalidClient, "Client authentication failed")
+	}
+
+	return client, nil
+}
+
+// Grant issues tokens for the authorization_code, refresh_token and
+// client_credentials grants.
+func (o *OAuthTokenRequest) Grant() (*OAuthTokenResponse, error) {
+	client, err := o.authenticateClient()
+	if err != nil {
+		return nil, err
+	}
+
+	switch o.GrantType {
+	case GrantTypeAuthorizationCode:
+		return o.grantAuthorizationCode(client)
+	case GrantTypeRefreshToken:
+		return o.grantRefreshToken(client)
+	case GrantTypeClientCredentials:
+		return o.grantClientCredentials(client)
+	}
+
+	return nil, auth.NewOAuthError(auth.OAuthErrUnsupportedGrantType, "Grant type is not supported")
+}
+
+func (o *OAuthTokenRequest) grantAuthorizationCode(client *datalayer.OAuthClient) (*OAuthTokenResponse, error) {
+	dl := o.serverState.DataLayer
+	errInvalidCode := auth.NewOAuthError(auth.OAuthErrInvalidGrant, "Authorization code is invalid or has expired")
+
+	code, err := dl.LookupOAuthAuthorizationCode(auth.HashToken(o.Code))
+	if err == datalayer.ErrNoData {
+		return nil, errInvalidCode
+	} else if err != nil {
+		return nil, auth.WrapOAuthError("Failed to query authorization code from database", err)
+	}
+
+	if code.OAuthClientID != client.ID || code.UsedAt.Valid || code.ExpiresAt.Time.Before(time.Now()) {
+		return nil, errInvalidCode
+	}
+	if code.RedirectURI != o.RedirectURI {
+		return nil, auth.NewOAuthError(auth.OAuthErrInvalidGrant, "Redirect URI does not match the authorization request")
+	}
+	if !auth.VerifyCodeChallenge(o.CodeVerifier, code.CodeChallenge) {
+		return nil, auth.NewOAuthError(auth.OAuthErrInvalidGrant, "PKCE code verifier does not match the code challenge")
+	}
+
+	err = dl.ConsumeOAuthAuthorizationCode(code.ID)
+	if err == datalayer.ErrNoData {
+		return nil, errInvalidCode
+	} else if err != nil {
+		return nil, auth.WrapOAuthError("Failed to consume authorization code", err)
+	}
+
+	return o.issue(client, code.UserID, code.Scopes, true)
+}
+
+func (o *OAuthTokenRequest) grantRefreshToken(client *datalayer.OAuthClient) (*OAuthTokenResponse, error) {
+	dl := o.serverState.DataLayer
+	errInvalidToken := auth.NewOAuthError(auth.OAuthErrInvalidGrant, "Refresh token is invalid or has expired")
+
+	refreshTokenHash := auth.HashToken(o.RefreshToken)
+	grant, err := dl.GetOAuthTokenByRefreshHash(refreshTokenHash)
+	if err == datalayer.ErrNoData {
+		return nil, errInvalidToken
+	} else if err != nil {
+		return nil, auth.WrapOAuthError("Failed to query refresh token from database", err)
+	}
+
+	if grant.OAuthClientID != client.ID || grant.RevokedAt.Valid || grant.RefreshExpiresAt.Time.Before(time.Now()) {
+		return nil, errInvalidToken
+	}
+
+	user, err := dl.GetUserByID(grant.UserID)
+	if err == datalayer.ErrNoData {
+		return nil, errInvalidToken
+	} else if err != nil {
+		return nil, auth.WrapOAuthError("Failed to query user from database", err)
+	}
+	if (user.LoggedOutAt.Valid && grant.CreatedAt.Time.Before(user.LoggedOutAt.Time)) || user.DisabledAt.Valid {
+		return nil, errInvalidToken
+	}
+
+	accessToken, accessTokenHash, err := auth.GenerateOAuthToken(auth.OAuthAccessTokenPrefix)
+	if err != nil {
+		return nil, auth.WrapOAuthError("Failed to create access token", err)
+	}
+	refreshToken, newRefreshTokenHash, err := auth.GenerateOAuthToken(auth.OAuthRefreshTokenPrefix)
+	if err != nil {
+		return nil, auth.WrapOAuthError("Failed to create refresh token", err)
+	}
+
+	err = dl.RotateOAuthToken(grant.ID, refreshTokenHash, accessTokenHash,
+		time.Now().Add(auth.OAuthAccessTokenLifeSpan*time.Second), newRefreshTokenHash)
+	if err == datalayer.ErrNoData {
+		return nil, errInvalidToken
+	} else if err != nil {
+		return nil, auth.WrapOAuthError("Failed to rotate tokens", err)
+	}
+
+	resp := &OAuthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    auth.OAuthAccessTokenLifeSpan,
+		RefreshToken: refreshToken,
+		Scope:        grant.Scopes,
+	}
+
+	return resp, nil
+}
+
+// grantClientCredentials issues a token acting for the user that registered
+// the client, so that developers can reach their own data.
+func (o *OAuthTokenRequest) grantClientCredentials(client *datalayer.OAuthClient) (*OAuthTokenResponse, error) {
+	if len(client.ClientSecretHash) == 0 {
+		return nil, auth.NewOAuthError(auth.OAuthErrUnauthorizedClient, "Public clients cannot use the client credentials grant")
+	}
+
+	allowed := auth.SplitScopes(client.Scopes)
+	scopes := auth.SplitScopes(o.Scope)
+	if len(scopes) == 0 {
+		scopes = allowed
+	}
+	for _, scope := range scopes {
+		if !containsString(allowed, scope) {
+			return nil, auth.NewOAuthError(auth.OAuthErrInvalidScope, fmt.Sprintf("Scope %s is not allowed for this client", scope))
+		}
+	}
+
+	return o.issue(client, client.UserID, auth.JoinScopes(scopes), false)
+}
+
+func (o *OAuthTokenRequest) issue(client *datalayer.OAuthClient, userID int64, scopes string, withRefresh bool) (*OAuthTokenResponse, error) {
+	accessToken, accessTokenHash, err := auth.GenerateOAuthToken(auth.OAuthAccessTokenPrefix)
+	if err != nil {
+		return nil, auth.WrapOAuthError("Failed to create access token", err)
+	}
+
+	now := time.Now()
+	grant := &datalayer.OAuthToken{
+		OAuthClientID:   client.ID,
+		UserID:          userID,
+		Scopes:          scopes,
+		AccessTokenHash: accessTokenHash,
+		AccessExpiresAt: nullTime(now.Add(auth.OAuthAccessTokenLifeSpan * time.Second)),
+	}
+
+	var refreshToken string
+	if withRefresh {
+		var refreshTokenHash string
+		refreshToken, refreshTokenHash, err = auth.GenerateOAuthToken(auth.OAuthRefreshTokenPrefix)
+		if err != nil {
+			return nil, auth.WrapOAuthError("Failed to create refresh token", err)
+		}
+		grant.RefreshTokenHash = sql.NullString{String: refreshTokenHash, Valid: true}
+		grant.RefreshExpiresAt = nullTime(now.Add(auth.OAuthRefreshTokenLifeSpan * time.Second))
+	}
+
+	_, err = o.serverState.DataLayer.CreateOAuthToken(grant)
+	if err != nil {
+		return nil, auth.WrapOAuthError("Failed to save tokens", err)
+	}
+
+	resp := &OAuthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    auth.OAuthAccessTokenLifeSpan,
+		RefreshToken: refreshToken,
+		Scope:        scopes,
+	}
+
+	return resp, nil
+}
+
+// lookupToken finds the grant holding an access or refresh token.
+func (o *OAuthTokenRequest) lookupToken() (grant *datalayer.OAuthToken, isAccessToken bool, err error) {
+	dl := o.serverState.DataLayer
+	tokenHash := auth.HashToken(o.Token)
+
+	grant, err = dl.GetOAuthTokenByAccessHash(tokenHash)
+	if err == nil {
+		return grant, true, nil
+	} else if err != datalayer.ErrNoData {
+		return nil, false, auth.WrapOAuthError("Failed to query token from database", err)
+	}
+
+	grant, err = dl.GetOAuthTokenByRefreshHash(tokenHash)
+	if err == nil {
+		return grant, false, nil
+	} else if err != datalayer.ErrNoData {
+		return nil, false, auth.WrapOAuthError("Failed to query token from database", err)
+	}
+
+	return nil, false, nil
+}
+
+// Introspect describes a token issued to the calling client.  Tokens of other
+// clients are reported as inactive.
+func (o *OAuthTokenRequest) Introspect() (*OAuthIntrospection, error) {
+	client, err := o.authenticateClient()
+	if err != nil {
+		return nil, err
+	}
+
+	inactive := &OAuthIntrospection{Active: false}
+	grant, isAccessToken, err := o.lookupToken()
+	if err != nil {
+		return nil, err
+	} else if grant == nil || grant.OAuthClientID != client.ID || grant.RevokedAt.Valid {
+		return inactive, nil
+	}
+
+	// Tokens of users that are disabled or have since logged out everywhere
+	// are rejected on use, so they are not active either.
+	user, err := o.serverState.DataLayer.GetUserByID(grant.UserID)
+	if err == datalayer.ErrNoData {
+		return inactive, nil
+	} else if err != nil {
+		return nil, auth.WrapOAuthError("Failed to query user from database", err)
+	}
+	if (user.LoggedOutAt.Valid && grant.CreatedAt.Time.Before(user.LoggedOutAt.Time)) || user.DisabledAt.Valid {
+		return inactive, nil
+	}
+
+	introspection := &OAuthIntrospection{
+		Active:   true,
+		Scope:    grant.Scopes,
+		ClientID: client.ClientID,
+		Subject:  strconv.FormatInt(grant.UserID, 10),
+	}
+
+	expiresAt := grant.RefreshExpiresAt.Time
+	issuedAt := grant.CreatedAt.Time
+	if isAccessToken {
+		expiresAt = grant.AccessExpiresAt.Time
+		introspection.TokenType = "Bearer"
+		if grant.UpdatedAt.Valid {
+			issuedAt = grant.UpdatedAt.Time
+		}
+	}
+	if expiresAt.Before(time.Now()) {
+		return inactive, nil
+	}
+	introspection.ExpiresAt = expiresAt.Unix()
+	introspection.IssuedAt = issuedAt.Unix()
+
+	return introspection, nil
+}
+
+// Revoke revokes the grant holding an access or refresh token issued to the
+// calling client.  Unknown tokens are ignored as RFC 7009 requires.
+func (o *OAuthTokenRequest) Revoke() error {
+	client, err := o.authenticateClient()
+	if err != nil {
+		return err
+	}
+
+	grant, _, err := o.lookupToken()
+	if err != nil {
+		return err
+	} else if grant == nil || grant.OAuthClientID != client.ID {
+		return nil
+	}
+
+	err = o.serverState.DataLayer.RevokeOAuthToken(grant.ID)
+	if err != nil {
+		return auth.WrapOAuthError("Failed to revoke token", err)
+	}
+
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func nullTime(t time.Time) datalayer.JsonNullTime {
+	return datalayer.JsonNullTime{
+		NullTime: sql.NullTime{
+			Time:  t,
+			Valid: true,
+		},
+	}
+}
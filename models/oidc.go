@@ -0,0 +1,247 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/provider/oidc"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// OIDCLoginLifeSpan is how long the user has to sign in at the provider.
+const OIDCLoginLifeSpan = 10 * time.Minute
+
+// OIDCLogin signs a user in with an external identity provider.
+type OIDCLogin struct {
+	Provider string
+	// State is the value round tripped through the provider and BrowserState
+	// the copy kept in a cookie, which ties the callback to the browser that
+	// started the login.
+	State        string
+	BrowserState string
+	Code         string
+	Client       auth.Client
+	// UserID is the signed in user linking the identity to their account.
+	// It is set on Start, and by Callback when the login was a link.
+	UserID      int64
+	serverState *state.ServerState
+}
+
+func NewOIDCLogin(state *state.ServerState) *OIDCLogin {
+	login := new(OIDCLogin)
+	login.serverState = state
+	return login
+}
+
+// Start records a new login, or a link when UserID is set, and returns the
+// provider URL to redirect to.  The generated state is set on the login.
+func (o *OIDCLogin) Start(ctx context.Context) (string, error) {
+	provider, err := o.provider()
+	if err != nil {
+		return "", err
+	}
+
+	loginState, err := auth.NewSecret()
+	if err != nil {
+		return "", e.Wrap("Failed to start login", http.StatusInternalServerError, err)
+	}
+	nonce, err := auth.NewSecret()
+	if err != nil {
+		return "", e.Wrap("Failed to start login", http.StatusInternalServerError, err)
+	}
+	codeVerifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		return "", e.Wrap("Failed to start login", http.StatusInternalServerError, err)
+	}
+
+	_, err = o.serverState.DataLayer.CreateOIDCLogin(auth.HashToken(loginState), o.Provider, nonce, codeVerifier,
+		o.UserID, time.Now().Add(OIDCLoginLifeSpan))
+	if err != nil {
+		return "", e.Wrap("Failed to save login", http.StatusInternalServerError, err)
+	}
+
+	redirectURL, err := provider.AuthCodeURL(ctx, loginState, nonce, oidc.CodeChallenge(codeVerifier))
+	if err != nil {
+		return "", e.Wrap("Identity provider is unavailable", http.StatusBadGateway, err)
+	}
+	o.State = loginState
+
+	return redirectURL, nil
+}
+
+// Callback completes the login when the provider redirects back.  An unknown
+// identity creates a new confirmed user, unless an account already uses its
+// email address.  Such an account must link the identity itself, in which
+// case no tokens are returned and UserID is set.
+func (o *OIDCLogin) Callback(ctx context.Context) (*auth.TokenResponse, *auth.ChallengeResponse, error) {
+	dl := o.serverState.DataLayer
+
+	provider, err := o.provider()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(o.State) == 0 || o.State != o.BrowserState {
+		return nil, nil, ErrOIDCLoginInvalid
+	}
+
+	dbLogin, err := dl.LookupOIDCLogin(auth.HashToken(o.State))
+	if err == datalayer.ErrNoData {
+		return nil, nil, ErrOIDCLoginInvalid
+	} else if err != nil {
+		return nil, nil, e.Wrap("Failed to query login from database", http.StatusInternalServerError, err)
+	}
+
+	if dbLogin.Provider != o.Provider || dbLogin.UsedAt.Valid || dbLogin.ExpiresAt.Time.Before(time.Now()) {
+		return nil, nil, ErrOIDCLoginInvalid
+	}
+
+	err = dl.ConsumeOIDCLogin(dbLogin.ID)
+	if err == datalayer.ErrNoData {
+		return nil, nil, ErrOIDCLoginInvalid
+	} else if err != nil {
+		return nil, nil, e.Wrap("Failed to consume login", http.StatusInternalServerError, err)
+	}
+
+	idToken, err := provider.Exchange(ctx, o.Code, dbLogin.CodeVerifier, dbLogin.Nonce)
+	if err != nil {
+		return nil, nil, e.Wrap("Identity provider login failed", http.StatusForbidden, err)
+	}
+
+	if dbLogin.UserID.Valid {
+		o.UserID = dbLogin.UserID.Int64
+		return nil, nil, o.linkIdentity(idToken)
+	}
+
+	userID, err := o.loginIdentity(idToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user := NewUser(o.serverState)
+	err = user.GetUser(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user.issueTokens(o.Client, false)
+}
+
+// linkIdentity links the identity to the signed in user that started the
+// link.  The account is left as it is, so linking never confirms it.
+func (o *OIDCLogin) linkIdentity(idToken *oidc.IDToken) error {
+	dl := o.serverState.DataLayer
+
+	identity, err := dl.GetIdentity(o.Provider, idToken.Subject)
+	if err == nil {
+		if identity.UserID != o.UserID {
+			return ErrOIDCIdentityLinked
+		}
+		return nil
+	} else if err != datalayer.ErrNoData {
+		return e.Wrap("Failed to query identity from database", http.StatusInternalServerError, err)
+	}
+
+	_, err = dl.GetUserByID(o.UserID)
+	if err == datalayer.ErrNoData {
+		return ErrOIDCLoginInvalid
+	} else if err != nil {
+		return e.Wrap("Failed to query user from database", http.StatusInternalServerError, err)
+	}
+
+	_, err = dl.CreateIdentity(o.Provider, idToken.Subject, o.UserID, idToken.Email)
+	if err != nil {
+		return e.Wrap("Failed to save identity", http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
+
+// loginIdentity returns the user linked to the identity, creating one if the
+// email address is not in use.
+func (o *OIDCLogin) loginIdentity(idToken *oidc.IDToken) (int64, error) {
+	dl := o.serverState.DataLayer
+
+	identity, err := dl.GetIdentity(o.Provider, idToken.Subject)
+	if err == nil {
+		return identity.UserID, nil
+	} else if err != datalayer.ErrNoData {
+		return 0, e.Wrap("Failed to query identity from database", http.StatusInternalServerError, err)
+	}
+
+	// Only an address the provider vouches for may be given an account.
+	if !bool(idToken.EmailVerified) || !strings.Contains(idToken.Email, "@") {
+		return 0, ErrOIDCEmailNotVerified
+	}
+
+	// Whoever controls the identity need not own an existing account with the
+	// same address, so it is never linked automatically.  Deleted accounts
+	// can only be recovered with their password.
+	_, err = dl.GetUserByEmail(idToken.Email)
+	if err == nil {
+		return 0, ErrOIDCAccountExists
+	} else if err != datalayer.ErrNoData {
+		return 0, e.Wrap("Failed to query user from database", http.StatusInternalServerError, err)
+	}
+	_, err = dl.GetDeletedUserByEmail(idToken.Email)
+	if err == nil {
+		return 0, ErrOIDCAccountExists
+	} else if err != datalayer.ErrNoData {
+		return 0, e.Wrap("Failed to query user from database", http.StatusInternalServerError, err)
+	}
+
+	userID, err := o.createUser(idToken.Email)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = dl.CreateIdentity(o.Provider, idToken.Subject, userID, idToken.Email)
+	if err != nil {
+		return 0, e.Wrap("Failed to save identity", http.StatusInternalServerError, err)
+	}
+
+	return userID, nil
+}
+
+// createUser creates a confirmed user with an unusable random password.  A
+// password can be set later through the password reset flow.
+func (o *OIDCLogin) createUser(email string) (int64, error) {
+	dl := o.serverState.DataLayer
+
+	secret, err := auth.NewSecret()
+	if err != nil {
+		return 0, e.Wrap("Failed to create user", http.StatusInternalServerError, err)
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, e.Wrap("Failed to create user", http.StatusInternalServerError, err)
+	}
+
+	userID, err := dl.CreateUser(email, string(hashedPassword), datalayer.UserRoleUser)
+	if err != nil {
+		return 0, e.Wrap("Failed to create user", http.StatusInternalServerError, err)
+	}
+
+	err = dl.SetUserStateByID(userID, datalayer.UserStateConfirmed)
+	if err != nil {
+		return 0, e.Wrap(fmt.Sprintf("Failed to confirm user [%d]", userID), http.StatusInternalServerError, err)
+	}
+
+	return userID, nil
+}
+
+func (o *OIDCLogin) provider() (*oidc.Provider, error) {
+	provider, ok := o.serverState.Providers.OIDC[o.Provider]
+	if !ok {
+		return nil, ErrOIDCProviderNotFound
+	}
+
+	return provider, nil
+}
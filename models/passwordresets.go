@@ -0,0 +1,122 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordResetInterval is how long users wait between password reset
+// emails.
+const PasswordResetInterval = time.Minute
+
+type PasswordReset struct {
+	Email       string `json:"email,omitempty"`
+	Token       string `json:"token,omitempty"`
+	Password    string `json:"password,omitempty"`
+	serverState *state.ServerState
+}
+
+func NewPasswordReset(state *state.ServerState) *PasswordReset {
+	passwordReset := new(PasswordReset)
+	passwordReset.serverState = state
+	return passwordReset
+}
+
+// Request queues a password reset email, expiring earlier links.  Links are
+// sent at most once every PasswordResetInterval.  Unknown and rate limited
+// addresses are silently ignored so that the endpoint cannot be used to
+// discover accounts.
+func (p *PasswordReset) Request() error {
+	if !strings.Contains(p.Email, "@") {
+		return ErrValidationEmail
+	}
+
+	dl := p.serverState.DataLayer
+	dbUser, err := dl.GetUserByEmail(p.Email)
+	if err == datalayer.ErrNoData {
+		p.serverState.Logger.Printf("Password reset requested for unknown email address")
+		return nil
+	} else if err != nil {
+		return e.Wrap("Failed to query user from database", http.StatusInternalServerError, err)
+	}
+
+	err = dl.SetUserPasswordResetSentAtByID(dbUser.ID, time.Now(), PasswordResetInterval)
+	if err == datalayer.ErrNoData {
+		p.serverState.Logger.Printf("Password reset for user %d ignored, a link was sent recently", dbUser.ID)
+		return nil
+	} else if err != nil {
+		return e.Wrap("Failed to record password reset", http.StatusInternalServerError, err)
+	}
+
+	p.serverState.Channels.ResetPasswords <- *dbUser
+
+	return nil
+}
+
+// Reset sets a new password using a reset token and ends every existing
+// session of the user.
+func (p *PasswordReset) Reset() error {
+	dl := p.serverState.DataLayer
+
+	if len(p.Token) == 0 {
+		return ErrPasswordResetInvalid
+	}
+
+	dbReset, err := dl.LookupPasswordReset(auth.HashToken(p.Token))
+	if err == datalayer.ErrNoData {
+		return ErrPasswordResetInvalid
+	} else if err != nil {
+		return e.Wrap("Failed to query password reset from database", http.StatusInternalServerError, err)
+	}
+
+	if dbReset.UsedAt.Valid || dbReset.ExpiresAt.Time.Before(time.Now()) {
+		return ErrPasswordResetInvalid
+	}
+
+	dbUser, err := dl.GetUserByID(dbReset.UserID)
+	if err == datalayer.ErrNoData {
+		return ErrUserDoesNotExist
+	} else if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to query user [%d] from database", dbReset.UserID), http.StatusInternalServerError, err)
+	}
+
+	err = validatePassword(p.serverState, dbUser.Email.String, p.Password)
+	if err != nil {
+		return err
+	}
+
+	err = dl.ConsumePasswordReset(dbReset.ID)
+	if err == datalayer.ErrNoData {
+		return ErrPasswordResetInvalid
+	} else if err != nil {
+		return e.Wrap("Failed to consume password reset", http.StatusInternalServerError, err)
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(p.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return e.Wrap("Failed to hash password", http.StatusInternalServerError, err)
+	}
+
+	err = dl.SetUserPasswordByID(dbReset.UserID, string(hashedPassword))
+	if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to update password of user [%d]", dbReset.UserID), http.StatusInternalServerError, err)
+	}
+
+	err = dl.ConsumePasswordResetsByUserID(dbReset.UserID)
+	if err != nil {
+		return e.Wrap("Failed to invalidate password resets", http.StatusInternalServerError, err)
+	}
+
+	user := NewUser(p.serverState)
+	user.ID = dbReset.UserID
+
+	return user.LogoutAll()
+}
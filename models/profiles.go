@@ -0,0 +1,203 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+const (
+	maxNameLength    = 255
+	maxAddressLength = 512
+	maxAge           = 150
+)
+
+// Themes lists the themes the web app can render.
+var Themes = []string{"default", "light", "dark"}
+
+var (
+	currencyCodeRe = regexp.MustCompile(`^[A-Z]{3}$`)
+	// localeRe matches the language, script and region subtags of a BCP 47
+	// language tag, e.g. en, en-ZA or zh-Hant-TW.
+	localeRe = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z][a-z]{3})?(-([A-Z]{2}|[0-9]{3}))?$`)
+)
+
+// ProfileUpdate is a partial update of a user's profile.  Fields that are
+// left out of the request keep their current value.
+type ProfileUpdate struct {
+	FirstName   *string         `json:"firstName"`
+	Surname     *string         `json:"surname"`
+	Age         *int            `json:"age"`
+	Address     *string         `json:"address"`
+	Settings    *SettingsUpdate `json:"settings"`
+	serverState *state.ServerState
+}
+
+type SettingsUpdate struct {
+	ThemeName    *string `json:"themeName"`
+	CurrencyCode *string `json:"currencyCode"`
+	Timezone     *string `json:"timezone"`
+	Locale       *string `json:"locale"`
+	// MagicLinkEnabled turns logging in with emailed links on or off.
+	MagicLinkEnabled *bool `json:"magicLinkEnabled"`
+}
+
+func NewProfileUpdate(state *state.ServerState) *ProfileUpdate {
+	update := new(ProfileUpdate)
+	update.serverState = state
+	return update
+}
+
+func (p *ProfileUpdate) validate() error {
+	var fields []types.ErrorField
+	invalid := func(name, message string) {
+		fields = append(fields, types.ErrorField{Name: name, Message: message})
+	}
+
+	if p.FirstName != nil && utf8.RuneCountInString(strings.TrimSpace(*p.FirstName)) > maxNameLength {
+		invalid("firstName", fmt.Sprintf("First name must be at most %d characters long", maxNameLength))
+	}
+	if p.Surname != nil && utf8.RuneCountInString(strings.TrimSpace(*p.Surname)) > maxNameLength {
+		invalid("surname", fmt.Sprintf("Surname must be at most %d characters long", maxNameLength))
+	}
+	if p.Age != nil && (*p.Age < 0 || *p.Age > maxAge) {
+		invalid("age", fmt.Sprintf("Age must be between 0 and %d", maxAge))
+	}
+	if p.Address != nil && utf8.RuneCountInString(strings.TrimSpace(*p.Address)) > maxAddressLength {
+		invalid("address", fmt.Sprintf("Address must be at most %d characters long", maxAddressLength))
+	}
+
+	if s := p.Settings; s != nil {
+		if s.ThemeName != nil && !isTheme(*s.ThemeName) {
+			invalid("settings.themeName", "Theme must be one of "+strings.Join(Themes, ", "))
+		}
+		if s.CurrencyCode != nil && !currencyCodeRe.MatchString(*s.CurrencyCode) {
+			invalid("settings.currencyCode", "Currency code must be a three letter ISO 4217 code such as ZAR")
+		}
+		if s.Timezone != nil && !isTimezone(*s.Timezone) {
+			invalid("settings.timezone", "Timezone must be an IANA time zone such as Africa/Johannesburg")
+		}
+		if s.Locale != nil && !localeRe.MatchString(*s.Locale) {
+			invalid("settings.locale", "Locale must be a language tag such as en-ZA")
+		}
+	}
+
+	if len(fields) > 0 {
+		return e.NewError("Invalid profile update", fields, http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+func isTheme(name string) bool {
+	for _, theme := range Themes {
+		if theme == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isTimezone accepts the names of the IANA time zone database.  The empty
+// name and Local are accepted by time.LoadLocation but are not zones.
+func isTimezone(name string) bool {
+	if len(name) == 0 || name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+
+	return err == nil
+}
+
+func nullString(s *string, current sql.NullString) sql.NullString {
+	if s == nil {
+		return current
+	}
+	trimmed := strings.TrimSpace(*s)
+
+	return sql.NullString{String: trimmed, Valid: len(trimmed) > 0}
+}
+
+// Apply validates the update and stores it, returning the updated user.
+func (p *ProfileUpdate) Apply(userID int64) (*User, error) {
+	err := p.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	user := NewUser(p.serverState)
+	err = user.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	dl := p.serverState.DataLayer
+	dbUser, err := dl.GetUserByID(userID)
+	if err == datalayer.ErrNoData {
+		return nil, ErrUserDoesNotExist
+	} else if err != nil {
+		return nil, e.Wrap(fmt.Sprintf("Failed to query user [%d] from database", userID), http.StatusInternalServerError, err)
+	}
+
+	profile := *dbUser
+	profile.FirstName = nullString(p.FirstName, dbUser.FirstName)
+	profile.Surname = nullString(p.Surname, dbUser.Surname)
+	profile.Address = nullString(p.Address, dbUser.Address)
+	if p.Age != nil {
+		profile.Age = sql.NullInt64{Int64: int64(*p.Age), Valid: true}
+	}
+
+	err = dl.SetUserProfileByID(userID, &profile)
+	if err != nil {
+		return nil, e.Wrap(fmt.Sprintf("Failed to update profile of user [%d]", userID), http.StatusInternalServerError, err)
+	}
+
+	if s := p.Settings; s != nil {
+		settings := datalayer.UserSettings{
+			UserID:           userID,
+			ThemeName:        user.Settings.ThemeName,
+			CurrencyCode:     user.Settings.CurrencyCode,
+			Timezone:         user.Settings.Timezone,
+			Locale:           user.Settings.Locale,
+			MagicLinkEnabled: user.Settings.MagicLinkEnabled,
+		}
+		if s.ThemeName != nil {
+			settings.ThemeName = *s.ThemeName
+		}
+		if s.CurrencyCode != nil {
+			settings.CurrencyCode = *s.CurrencyCode
+		}
+		if s.Timezone != nil {
+			settings.Timezone = *s.Timezone
+		}
+		if s.Locale != nil {
+			settings.Locale = *s.Locale
+		}
+		if s.MagicLinkEnabled != nil {
+			settings.MagicLinkEnabled = *s.MagicLinkEnabled
+		}
+
+		err = dl.SaveUserSettings(&settings)
+		if err != nil {
+			return nil, e.Wrap(fmt.Sprintf("Failed to save settings of user [%d]", userID), http.StatusInternalServerError, err)
+		}
+	}
+
+	err = user.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = ""
+
+	return user, nil
+}
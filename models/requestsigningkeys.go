@@ -0,0 +1,162 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// RequestSigningKey is a key with which a client signs its requests.
+type RequestSigningKey struct {
+	datalayer.Model
+	Name        string                 `json:"name"`
+	Scopes      []string               `json:"scopes"`
+	KeyID       string                 `json:"keyID"`
+	Secret      string                 `json:"secret,omitempty"`
+	ExpiresIn   int64                  `json:"expiresIn,omitempty"`
+	LastUsedAt  datalayer.JsonNullTime `json:"lastUsedAt"`
+	ExpiresAt   datalayer.JsonNullTime `json:"expiresAt"`
+	UserID      int64                  `json:"-"`
+	serverState *state.ServerState
+}
+
+func NewRequestSigningKey(state *state.ServerState) *RequestSigningKey {
+	key := new(RequestSigningKey)
+	key.serverState = state
+	return key
+}
+
+func (k *RequestSigningKey) convert(key *datalayer.RequestSigningKey) {
+	k.ID = key.ID
+	k.CreatedAt = key.CreatedAt
+	k.UpdatedAt = key.UpdatedAt
+	k.DeletedAt = key.DeletedAt
+	k.Name = key.Name
+	k.Scopes = auth.SplitScopes(key.Scopes)
+	k.KeyID = key.KeyID
+	k.LastUsedAt = key.LastUsedAt
+	k.ExpiresAt = key.ExpiresAt
+	k.UserID = key.UserID
+}
+
+func (k *RequestSigningKey) validate() error {
+	var fields []types.ErrorField
+	if len(k.Name) == 0 {
+		fields = append(fields, types.ErrorField{Name: "name", Message: "Signing key name is required"})
+	}
+
+	if len(k.Scopes) == 0 {
+		fields = append(fields, types.ErrorField{Name: "scopes", Message: "At least one scope is required"})
+	}
+	for _, scope := range k.Scopes {
+		if !auth.IsValidScope(scope) {
+			fields = append(fields, types.ErrorField{Name: "scopes", Message: fmt.Sprintf("Unknown scope %s", scope)})
+		}
+	}
+
+	if k.ExpiresIn < 0 || k.ExpiresIn > auth.SigningKeyLifeSpan {
+		fields = append(fields, types.ErrorField{
+			Name:    "expiresIn",
+			Message: fmt.Sprintf("Expiry must be between 1 and %d seconds", auth.SigningKeyLifeSpan),
+		})
+	}
+
+	if k.UserID <= 0 {
+		return ErrUserDoesNotExist
+	}
+
+	if len(fields) > 0 {
+		return e.NewError("Invalid signing key request", fields, http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+// Create issues a new signing key.  The secret is only returned here.
+func (k *RequestSigningKey) Create() (*RequestSigningKey, error) {
+	err := k.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	keyID, secret, err := auth.GenerateSigningKey()
+	if err != nil {
+		return nil, e.Wrap("signing key creation failed", http.StatusInternalServerError, err)
+	}
+
+	expiresIn := k.ExpiresIn
+	if expiresIn == 0 {
+		expiresIn = auth.SigningKeyLifeSpan
+	}
+
+	sealed, err := k.serverState.Keys.Seal(keyID, []byte(secret))
+	if err != nil {
+		return nil, e.Wrap("signing key creation failed", http.StatusInternalServerError, err)
+	}
+
+	dl := k.serverState.DataLayer
+	id, err := dl.CreateRequestSigningKey(&datalayer.RequestSigningKey{
+		UserID: k.UserID,
+		Name:   k.Name,
+		KeyID:  keyID,
+		Secret: sealed,
+		Scopes: auth.JoinScopes(k.Scopes),
+		ExpiresAt: datalayer.JsonNullTime{
+			NullTime: sql.NullTime{
+				Time:  time.Now().Add(time.Duration(expiresIn) * time.Second),
+				Valid: true,
+			},
+		},
+	})
+	if err != nil {
+		return nil, e.Wrap("signing key creation failed", http.StatusInternalServerError, err)
+	}
+
+	dbKey, err := dl.GetRequestSigningKeyByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	key := NewRequestSigningKey(k.serverState)
+	key.convert(dbKey)
+	key.Secret = secret
+
+	return key, nil
+}
+
+func (k *RequestSigningKey) GetRequestSigningKeys(userID int64) ([]*RequestSigningKey, error) {
+	dl := k.serverState.DataLayer
+	keys := make([]*RequestSigningKey, 0)
+
+	dbKeys, err := dl.GetRequestSigningKeysByUserID(userID)
+	if err != nil && err != datalayer.ErrNoData {
+		return nil, e.Wrap(fmt.Sprintf("Failed to query signing keys for user [%d]", userID), http.StatusInternalServerError, err)
+	}
+
+	for _, dbKey := range dbKeys {
+		key := NewRequestSigningKey(k.serverState)
+		key.convert(dbKey)
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func (k *RequestSigningKey) Revoke(id, userID int64) error {
+	dl := k.serverState.DataLayer
+	err := dl.RevokeRequestSigningKey(id, userID)
+	if err == datalayer.ErrNoData {
+		return ErrSigningKeyNotFound
+	} else if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to revoke signing key [%d]", id), http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
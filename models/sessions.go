@@ -0,0 +1,95 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// Session is a device the user is logged in on.
+type Session struct {
+	ID          int64                  `json:"id"`
+	DeviceName  string                 `json:"deviceName"`
+	UserAgent   string                 `json:"userAgent"`
+	IPAddress   string                 `json:"ipAddress"`
+	CreatedAt   datalayer.JsonNullTime `json:"createdAt"`
+	LastSeenAt  datalayer.JsonNullTime `json:"lastSeenAt"`
+	Current     bool                   `json:"current"`
+	serverState *state.ServerState
+}
+
+func NewSession(state *state.ServerState) *Session {
+	session := new(Session)
+	session.serverState = state
+	return session
+}
+
+func (s *Session) convert(session *datalayer.Session) {
+	s.ID = session.ID
+	s.DeviceName = session.DeviceName
+	s.UserAgent = session.UserAgent
+	s.IPAddress = session.IPAddress
+	s.CreatedAt = session.CreatedAt
+	s.LastSeenAt = session.LastSeenAt
+}
+
+// GetSessions lists the sessions of a user that can still be refreshed,
+// marking the one the request was made from.
+func (s *Session) GetSessions(userID, currentSessionID int64) ([]*Session, error) {
+	dl := s.serverState.DataLayer
+	sessions := make([]*Session, 0)
+
+	dbSessions, err := dl.GetSessionsByUserID(userID)
+	if err != nil && err != datalayer.ErrNoData {
+		return nil, e.Wrap(fmt.Sprintf("Failed to query sessions for user [%d]", userID), http.StatusInternalServerError, err)
+	}
+
+	expiredBefore := time.Now().Add(-auth.RefreshTokenLifeSpan * time.Second)
+	for _, dbSession := range dbSessions {
+		if dbSession.LastSeenAt.Time.Before(expiredBefore) {
+			continue
+		}
+
+		session := NewSession(s.serverState)
+		session.convert(dbSession)
+		session.Current = dbSession.ID == currentSessionID
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+// Revoke logs a session out.  Its access tokens are refused from then on and
+// its refresh token family is revoked.
+func (s *Session) Revoke(id, userID int64) error {
+	dl := s.serverState.DataLayer
+	dbSession, err := dl.GetSessionByID(id)
+	if err == datalayer.ErrNoData {
+		return ErrSessionNotFound
+	} else if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to query session [%d]", id), http.StatusInternalServerError, err)
+	}
+
+	if dbSession.UserID != userID {
+		return ErrSessionNotFound
+	}
+
+	err = dl.RevokeSession(id)
+	if err == datalayer.ErrNoData {
+		return ErrSessionNotFound
+	} else if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to revoke session [%d]", id), http.StatusInternalServerError, err)
+	}
+
+	err = dl.RevokeRefreshTokenFamily(dbSession.FamilyID)
+	if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to revoke session [%d]", id), http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package statements
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// CSVMapping maps the fields of a transaction to the headers of CSV
+// columns, e.g. {"dateTime": "Date", "amount": "Amount"}.
+type CSVMapping map[string]string
+
+// CSVFields lists the transaction fields a CSV column can be mapped to.
+var CSVFields = []string{
+	"dateTime",
+	"amount",
+	"currencyCode",
+	"reference",
+	"merchantName",
+	"merchantCity",
+	"merchantCountryCode",
+	"merchantCountryName",
+	"merchantCategoryCode",
+	"merchantCategoryName",
+}
+
+// DefaultCSVDateFormat is the layout of CSV dates when none is given.
+const DefaultCSVDateFormat = "2006-01-02"
+
+func isCSVField(field string) bool {
+	for _, f := range CSVFields {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validate checks that the mapping only maps known fields and maps the
+// fields every transaction needs.
+func (m CSVMapping) Validate() error {
+	for field := range m {
+		if !isCSVField(field) {
+			return fmt.Errorf("unknown field %s", field)
+		}
+	}
+	for _, field := range []string{"dateTime", "amount"} {
+		if len(m[field]) == 0 {
+			return fmt.Errorf("%s must be mapped to a column", field)
+		}
+	}
+
+	return nil
+}
+
+func parseCSV(r io.Reader, options Options) ([]*Transaction, []RowError, error) {
+	mapping := options.Mapping
+	err := mapping.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dateFormat := options.DateFormat
+	if len(dateFormat) == 0 {
+		dateFormat = DefaultCSVDateFormat
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("statement is empty")
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	fieldColumns := make(map[string]int)
+	for field, name := range mapping {
+		i, ok := columns[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("column %s of %s is not in the header", name, field)
+		}
+		fieldColumns[field] = i
+	}
+
+	var transactions []*Transaction
+	var rowErrors []RowError
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+		if row > MaxTransactions {
+			return nil, nil, fmt.Errorf("statement has more than %d transactions", MaxTransactions)
+		}
+
+		value := func(field string) string {
+			i, ok := fieldColumns[field]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		txn := &Transaction{
+			Row:                  row,
+			CurrencyCode:         value("currencyCode"),
+			Reference:            value("reference"),
+			MerchantName:         value("merchantName"),
+			MerchantCity:         value("merchantCity"),
+			MerchantCountryCode:  value("merchantCountryCode"),
+			MerchantCountryName:  value("merchantCountryName"),
+			MerchantCategoryCode: value("merchantCategoryCode"),
+			MerchantCategoryName: value("merchantCategoryName"),
+		}
+		if len(txn.CurrencyCode) == 0 {
+			txn.CurrencyCode = options.CurrencyCode
+		}
+
+		valid := true
+		txn.DateTime, err = time.Parse(dateFormat, value("dateTime"))
+		if err != nil {
+			rowErrors = append(rowErrors, RowError{Row: row, Field: "dateTime", Message: "Date must match " + dateFormat})
+			valid = false
+		}
+		txn.Amount, txn.Scale, err = parseAmount(value("amount"))
+		if err != nil {
+			rowErrors = append(rowErrors, RowError{Row: row, Field: "amount", Message: "Amount must be a decimal number"})
+			valid = false
+		}
+
+		if valid {
+			transactions = append(transactions, txn)
+		}
+	}
+
+	return transactions, rowErrors, nil
+}
@@ -0,0 +1,138 @@
+package statements
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseOFX reads OFX 1.x statements, which are SGML where elements need not
+// be closed, and OFX 2.x statements, which are XML.  Both are read as a
+// stream of tags, each with the text up to the next tag as its value.
+func parseOFX(r io.Reader, options Options) ([]*Transaction, []RowError, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	content := string(b)
+	start := strings.Index(strings.ToUpper(content), "<OFX>")
+	if start < 0 {
+		return nil, nil, fmt.Errorf("statement is not OFX")
+	}
+	content = content[start:]
+
+	var transactions []*Transaction
+	var rowErrors []RowError
+	currencyCode := options.CurrencyCode
+	var elements map[string]string
+	row := 0
+	for {
+		open := strings.IndexByte(content, '<')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(content[open:], '>')
+		if end < 0 {
+			return nil, nil, fmt.Errorf("statement has an unterminated tag")
+		}
+		tag := strings.ToUpper(strings.TrimSpace(content[open+1 : open+end]))
+		content = content[open+end+1:]
+
+		value := content
+		if next := strings.IndexByte(content, '<'); next >= 0 {
+			value = content[:next]
+		}
+		value = strings.TrimSpace(html.UnescapeString(value))
+
+		switch {
+		case tag == "STMTTRN":
+			elements = make(map[string]string)
+		case tag == "/STMTTRN" && elements != nil:
+			row++
+			if row > MaxTransactions {
+				return nil, nil, fmt.Errorf("statement has more than %d transactions", MaxTransactions)
+			}
+			txn, errs := newOFXTransaction(row, elements, currencyCode)
+			if len(errs) > 0 {
+				rowErrors = append(rowErrors, errs...)
+			} else {
+				transactions = append(transactions, txn)
+			}
+			elements = nil
+		case tag == "CURDEF" && len(value) > 0:
+			currencyCode = value
+		case elements != nil && !strings.HasPrefix(tag, "/"):
+			elements[tag] = value
+		}
+	}
+
+	return transactions, rowErrors, nil
+}
+
+func newOFXTransaction(row int, elements map[string]string, currencyCode string) (*Transaction, []RowError) {
+	var rowErrors []RowError
+	txn := &Transaction{
+		Row:          row,
+		CurrencyCode: currencyCode,
+		Reference:    elements["MEMO"],
+		MerchantName: elements["NAME"],
+		MerchantCity: elements["CITY"],
+	}
+	// Transactions in a foreign currency carry their own.
+	if len(elements["CURSYM"]) > 0 {
+		txn.CurrencyCode = elements["CURSYM"]
+	}
+
+	var err error
+	txn.DateTime, err = parseOFXDate(elements["DTPOSTED"])
+	if err != nil {
+		rowErrors = append(rowErrors, RowError{Row: row, Field: "dateTime", Message: "DTPOSTED must be an OFX date"})
+	}
+	txn.Amount, txn.Scale, err = parseAmount(elements["TRNAMT"])
+	if err != nil {
+		rowErrors = append(rowErrors, RowError{Row: row, Field: "amount", Message: "TRNAMT must be a decimal number"})
+	}
+
+	return txn, rowErrors
+}
+
+var ofxDateLayouts = map[int]string{
+	8:  "20060102",
+	12: "200601021504",
+	14: "20060102150405",
+}
+
+// parseOFXDate reads dates such as 20200425194623.000[-5:EST].  Dates
+// without a time zone are in UTC.
+func parseOFXDate(s string) (time.Time, error) {
+	location := time.UTC
+	if i := strings.IndexByte(s, '['); i >= 0 {
+		zone := strings.TrimSuffix(s[i+1:], "]")
+		s = s[:i]
+
+		offset := zone
+		if j := strings.IndexByte(zone, ':'); j >= 0 {
+			offset = zone[:j]
+		}
+		hours, err := strconv.ParseFloat(offset, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		location = time.FixedZone(zone, int(hours*3600))
+	}
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		s = s[:i]
+	}
+
+	layout, ok := ofxDateLayouts[len(s)]
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid OFX date %s", s)
+	}
+
+	return time.ParseInLocation(layout, s, location)
+}
@@ -0,0 +1,121 @@
+package statements
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// qifDateLayouts are tried in turn when no date format is given.  QIF dates
+// are usually month first, with ' before two digit years from 2000.
+var qifDateLayouts = []string{"1/2/2006", "1/2/06", "2006-01-02"}
+
+// qifTransactionTypes are the account types whose records are transactions.
+var qifTransactionTypes = map[string]bool{
+	"BANK":  true,
+	"CCARD": true,
+	"CASH":  true,
+	"OTH A": true,
+	"OTH L": true,
+}
+
+// parseQIF reads the transactions of QIF statements.  Records are lines
+// starting with a field code and end with ^.  Other record types, such as
+// account and category lists, are skipped.
+func parseQIF(r io.Reader, options Options) ([]*Transaction, []RowError, error) {
+	var transactions []*Transaction
+	var rowErrors []RowError
+	inTransactions := false
+	fields := make(map[byte]string)
+	row := 0
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+
+		switch line[0] {
+		case '!':
+			header := strings.ToUpper(line)
+			inTransactions = strings.HasPrefix(header, "!TYPE:") && qifTransactionTypes[strings.TrimPrefix(header, "!TYPE:")]
+			fields = make(map[byte]string)
+		case '^':
+			if inTransactions && len(fields) > 0 {
+				row++
+				if row > MaxTransactions {
+					return nil, nil, fmt.Errorf("statement has more than %d transactions", MaxTransactions)
+				}
+				txn, errs := newQIFTransaction(row, fields, options)
+				if len(errs) > 0 {
+					rowErrors = append(rowErrors, errs...)
+				} else {
+					transactions = append(transactions, txn)
+				}
+			}
+			fields = make(map[byte]string)
+		default:
+			// Only the first of repeated fields, such as address lines, is
+			// kept.
+			if _, ok := fields[line[0]]; !ok {
+				fields[line[0]] = strings.TrimSpace(line[1:])
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return transactions, rowErrors, nil
+}
+
+func newQIFTransaction(row int, fields map[byte]string, options Options) (*Transaction, []RowError) {
+	var rowErrors []RowError
+	txn := &Transaction{
+		Row:                  row,
+		CurrencyCode:         options.CurrencyCode,
+		Reference:            fields['M'],
+		MerchantName:         fields['P'],
+		MerchantCategoryName: fields['L'],
+	}
+
+	var err error
+	txn.DateTime, err = parseQIFDate(fields['D'], options.DateFormat)
+	if err != nil {
+		message := "Date must be a QIF date such as 4/25/2020"
+		if len(options.DateFormat) > 0 {
+			message = "Date must match " + options.DateFormat
+		}
+		rowErrors = append(rowErrors, RowError{Row: row, Field: "dateTime", Message: message})
+	}
+
+	amount := fields['T']
+	if len(amount) == 0 {
+		amount = fields['U']
+	}
+	txn.Amount, txn.Scale, err = parseAmount(amount)
+	if err != nil {
+		rowErrors = append(rowErrors, RowError{Row: row, Field: "amount", Message: "Amount must be a decimal number"})
+	}
+
+	return txn, rowErrors
+}
+
+func parseQIFDate(s, dateFormat string) (time.Time, error) {
+	if len(dateFormat) > 0 {
+		return time.Parse(dateFormat, s)
+	}
+
+	s = strings.ReplaceAll(strings.ReplaceAll(s, "'", "/"), " ", "")
+	for _, layout := range qifDateLayouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid QIF date %s", s)
+}
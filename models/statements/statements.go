@@ -0,0 +1,118 @@
+// Package statements parses bank statement exports into transactions.  Rows
+// that cannot be parsed are reported with their position in the statement so
+// that the rest of the statement can still be checked.
+package statements
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	FormatCSV Format = "csv"
+	FormatOFX Format = "ofx"
+	FormatQIF Format = "qif"
+)
+
+// MaxTransactions limits how many transactions a statement can hold.
+const MaxTransactions = 10000
+
+// MaxStatementSize limits the size of an uploaded statement.
+const MaxStatementSize = 10 << 20
+
+// Transaction is a transaction read from a statement.  Fields that are not
+// in the statement are left empty.  Row counts the transactions of the
+// statement from 1.
+type Transaction struct {
+	Row                  int
+	DateTime             time.Time
+	Amount               int64
+	Scale                int
+	CurrencyCode         string
+	Reference            string
+	MerchantName         string
+	MerchantCity         string
+	MerchantCountryCode  string
+	MerchantCountryName  string
+	MerchantCategoryCode string
+	MerchantCategoryName string
+}
+
+// RowError describes a field of a transaction that could not be read.
+type RowError struct {
+	Row     int
+	Field   string
+	Message string
+}
+
+func (r RowError) Error() string {
+	return fmt.Sprintf("transaction %d %s: %s", r.Row, r.Field, r.Message)
+}
+
+// Options controls how a statement is read.
+type Options struct {
+	// CurrencyCode is used for transactions that do not state a currency.
+	CurrencyCode string
+	// DateFormat is the Go time layout of dates in CSV and QIF statements.
+	DateFormat string
+	// Mapping maps the columns of a CSV statement.
+	Mapping CSVMapping
+}
+
+// FormatFromName guesses the format of a statement from its file name.
+func FormatFromName(name string) (Format, bool) {
+	format := Format(strings.TrimPrefix(strings.ToLower(path.Ext(name)), "."))
+	return format, IsFormat(format)
+}
+
+func IsFormat(format Format) bool {
+	return format == FormatCSV || format == FormatOFX || format == FormatQIF
+}
+
+// Parse reads the transactions of a statement.  An error is only returned
+// when the statement as a whole cannot be read, problems with individual
+// transactions are returned as row errors and the transaction is left out.
+func Parse(r io.Reader, format Format, options Options) ([]*Transaction, []RowError, error) {
+	switch format {
+	case FormatCSV:
+		return parseCSV(r, options)
+	case FormatOFX:
+		return parseOFX(r, options)
+	case FormatQIF:
+		return parseQIF(r, options)
+	}
+
+	return nil, nil, fmt.Errorf("unknown statement format %s", format)
+}
+
+// parseAmount reads a decimal amount such as -1,234.50 into its value and
+// scale, e.g. -123450 and 2.
+func parseAmount(s string) (int64, int, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", "")
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		// Accounting notation for negative amounts.
+		s = "-" + s[1:len(s)-1]
+	}
+	if len(s) == 0 {
+		return 0, 0, fmt.Errorf("amount is required")
+	}
+
+	scale := 0
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		scale = len(s) - i - 1
+		s = s[:i] + s[i+1:]
+	}
+
+	value, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("amount must be a decimal number")
+	}
+
+	return value, scale, nil
+}
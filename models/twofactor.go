@@ -0,0 +1,333 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/router/auth/totp"
+	"github.com/donohutcheon/gowebserver/state"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	TwoFactorIssuer = "gowebserver"
+	// RecoveryCodeCount is the number of single use recovery codes issued
+	// when two-factor authentication is enabled.
+	RecoveryCodeCount = 10
+	// MaxTwoFactorAttempts consecutive wrong codes lock the second factor for
+	// TwoFactorLockoutPeriod.
+	MaxTwoFactorAttempts   = 5
+	TwoFactorLockoutPeriod = 15 * time.Minute
+)
+
+type TwoFactor struct {
+	UserID         int64  `json:"-"`
+	Code           string `json:"code,omitempty"`
+	Password       string `json:"password,omitempty"`
+	ChallengeToken string `json:"challengeToken,omitempty"`
+	// Client is the device completing a login.
+	Client      auth.Client `json:"-"`
+	serverState *state.ServerState
+}
+
+type TwoFactorSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+func NewTwoFactor(state *state.ServerState) *TwoFactor {
+	twoFactor := new(TwoFactor)
+	twoFactor.serverState = state
+	return twoFactor
+}
+
+// Setup starts enrolment by generating a new secret.  Two-factor
+// authentication is only enabled once a code from the secret is verified.
+func (t *TwoFactor) Setup() (*TwoFactorSetup, error) {
+	dl := t.serverState.DataLayer
+
+	credential, err := dl.GetTOTPCredentialByUserID(t.UserID)
+	if err != nil && err != datalayer.ErrNoData {
+		return nil, e.Wrap("Failed to query two-factor credential", http.StatusInternalServerError, err)
+	} else if err == nil && credential.ConfirmedAt.Valid {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	dbUser, err := dl.GetUserByID(t.UserID)
+	if err == datalayer.ErrNoData {
+		return nil, ErrUserDoesNotExist
+	} else if err != nil {
+		return nil, e.Wrap(fmt.Sprintf("Failed to query user [%d] from database", t.UserID), http.StatusInternalServerError, err)
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, e.Wrap("Failed to generate two-factor secret", http.StatusInternalServerError, err)
+	}
+
+	// Replace any enrolment that was started but never verified.
+	err = dl.DeleteTOTPCredentialByUserID(t.UserID)
+	if err != nil {
+		return nil, e.Wrap("Failed to remove two-factor credential", http.StatusInternalServerError, err)
+	}
+
+	_, err = dl.CreateTOTPCredential(t.UserID, secret)
+	if err != nil {
+		return nil, e.Wrap("Failed to save two-factor credential", http.StatusInternalServerError, err)
+	}
+
+	setup := &TwoFactorSetup{
+		Secret: secret,
+		URI:    totp.URI(TwoFactorIssuer, dbUser.Email.String, secret),
+	}
+
+	return setup, nil
+}
+
+// Verify completes enrolment and returns the recovery codes.  The codes are
+// only stored hashed so this is the only time they can be shown.
+func (t *TwoFactor) Verify() ([]string, error) {
+	dl := t.serverState.DataLayer
+
+	credential, err := dl.GetTOTPCredentialByUserID(t.UserID)
+	if err == datalayer.ErrNoData {
+		return nil, ErrTwoFactorNotPending
+	} else if err != nil {
+		return nil, e.Wrap("Failed to query two-factor credential", http.StatusInternalServerError, err)
+	}
+
+	if credential.ConfirmedAt.Valid {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	err = t.verifyCode(credential)
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodes := make([]string, 0, RecoveryCodeCount)
+	codeHashes := make([]string, 0, RecoveryCodeCount)
+	for i := 0; i < RecoveryCodeCount; i++ {
+		recoveryCode, err := newRecoveryCode()
+		if err != nil {
+			return nil, e.Wrap("Failed to generate recovery codes", http.StatusInternalServerError, err)
+		}
+		recoveryCodes = append(recoveryCodes, recoveryCode)
+		codeHashes = append(codeHashes, auth.HashToken(normalizeCode(recoveryCode)))
+	}
+
+	err = dl.DeleteRecoveryCodesByUserID(t.UserID)
+	if err != nil {
+		return nil, e.Wrap("Failed to remove recovery codes", http.StatusInternalServerError, err)
+	}
+
+	err = dl.CreateRecoveryCodes(t.UserID, codeHashes)
+	if err != nil {
+		return nil, e.Wrap("Failed to save recovery codes", http.StatusInternalServerError, err)
+	}
+
+	err = dl.ConfirmTOTPCredential(t.UserID)
+	if err == datalayer.ErrNoData {
+		return nil, ErrTwoFactorEnabled
+	} else if err != nil {
+		return nil, e.Wrap("Failed to enable two-factor authentication", http.StatusInternalServerError, err)
+	}
+
+	return recoveryCodes, nil
+}
+
+// Disable turns off two-factor authentication.  Both the password and a
+// current code or recovery code are required.
+func (t *TwoFactor) Disable() error {
+	dl := t.serverState.DataLayer
+
+	credential, err := t.enabledCredential()
+	if err != nil {
+		return err
+	}
+
+	dbUser, err := dl.GetUserByID(t.UserID)
+	if err == datalayer.ErrNoData {
+		return ErrUserDoesNotExist
+	} else if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to query user [%d] from database", t.UserID), http.StatusInternalServerError, err)
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(dbUser.Password.String), []byte(t.Password))
+	if err != nil {
+		return ErrLoginFailed
+	}
+
+	err = t.verifyCode(credential)
+	if err != nil {
+		return err
+	}
+
+	err = dl.DeleteTOTPCredentialByUserID(t.UserID)
+	if err != nil {
+		return e.Wrap("Failed to remove two-factor credential", http.StatusInternalServerError, err)
+	}
+
+	err = dl.DeleteRecoveryCodesByUserID(t.UserID)
+	if err != nil {
+		return e.Wrap("Failed to remove recovery codes", http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
+
+// Login exchanges a challenge token and a code for a token pair.
+func (t *TwoFactor) Login() (*auth.TokenResponse, error) {
+	tk, err := auth.ParseChallengeToken(t.serverState, t.ChallengeToken)
+	if err != nil {
+		return nil, err
+	}
+	t.UserID = tk.UserID
+
+	credential, err := t.enabledCredential()
+	if err == ErrTwoFactorNotEnabled {
+		// Two-factor authentication was disabled after the challenge was issued.
+		return nil, auth.ErrChallengeInvalid
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = t.verifyCode(credential)
+	if err != nil {
+		return nil, err
+	}
+
+	if tk.Restore {
+		err = restoreUser(t.serverState, t.UserID)
+		if err != nil {
+			return nil, err
+		}
+
+		err = auth.ValidateSession(t.serverState, tk)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tokenResp, err := auth.CreateToken(t.serverState, t.UserID, t.Client)
+	if err != nil {
+		return nil, e.Wrap("token creation failed", http.StatusInternalServerError, err)
+	}
+
+	return tokenResp, nil
+}
+
+// IsTwoFactorEnabled reports whether a user has verified two-factor
+// authentication.
+func IsTwoFactorEnabled(state *state.ServerState, userID int64) (bool, error) {
+	credential, err := state.DataLayer.GetTOTPCredentialByUserID(userID)
+	if err == datalayer.ErrNoData {
+		return false, nil
+	} else if err != nil {
+		return false, e.Wrap("Failed to query two-factor credential", http.StatusInternalServerError, err)
+	}
+
+	return credential.ConfirmedAt.Valid, nil
+}
+
+func (t *TwoFactor) enabledCredential() (*datalayer.TOTPCredential, error) {
+	credential, err := t.serverState.DataLayer.GetTOTPCredentialByUserID(t.UserID)
+	if err == datalayer.ErrNoData {
+		return nil, ErrTwoFactorNotEnabled
+	} else if err != nil {
+		return nil, e.Wrap("Failed to query two-factor credential", http.StatusInternalServerError, err)
+	}
+
+	if !credential.ConfirmedAt.Valid {
+		return nil, ErrTwoFactorNotEnabled
+	}
+
+	return credential, nil
+}
+
+// verifyCode accepts either a TOTP code or an unused recovery code.  Each
+// TOTP time step and each recovery code only works once.
+func (t *TwoFactor) verifyCode(credential *datalayer.TOTPCredential) error {
+	dl := t.serverState.DataLayer
+
+	if credential.FailedAttempts >= MaxTwoFactorAttempts &&
+		credential.LastFailedAt.Valid && time.Since(credential.LastFailedAt.Time) < TwoFactorLockoutPeriod {
+		return ErrTwoFactorLocked
+	}
+
+	code := normalizeCode(t.Code)
+	var err error
+	if isTOTPCode(code) {
+		step, ok := totp.Validate(credential.Secret, code, time.Now())
+		if ok {
+			err = dl.SetTOTPCredentialLastUsedStep(t.UserID, step)
+		} else {
+			err = datalayer.ErrNoData
+		}
+	} else if len(code) > 0 {
+		err = dl.ConsumeRecoveryCode(t.UserID, auth.HashToken(code))
+	} else {
+		err = datalayer.ErrNoData
+	}
+
+	if err == datalayer.ErrNoData {
+		err = dl.IncrementTOTPFailedAttempts(t.UserID)
+		if err != nil {
+			return e.Wrap("Failed to record two-factor attempt", http.StatusInternalServerError, err)
+		}
+		return ErrTwoFactorCodeInvalid
+	} else if err != nil {
+		return e.Wrap("Failed to verify two-factor code", http.StatusInternalServerError, err)
+	}
+
+	if credential.FailedAttempts > 0 {
+		err = dl.ResetTOTPFailedAttempts(t.UserID)
+		if err != nil {
+			return e.Wrap("Failed to record two-factor attempt", http.StatusInternalServerError, err)
+		}
+	}
+
+	return nil
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != totp.Digits {
+		return false
+	}
+
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// normalizeCode strips the formatting users tend to type along with a code.
+func normalizeCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	code = strings.ReplaceAll(code, " ", "")
+	return code
+}
+
+// newRecoveryCode returns a random code formatted as two groups of five hex
+// characters.
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 5)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	code := hex.EncodeToString(b)
+	return code[:5] + "-" + code[5:], nil
+}
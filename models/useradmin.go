@@ -0,0 +1,305 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/models/filters"
+	"github.com/donohutcheon/gowebserver/models/pagination"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// AdminUser is the view of a user offered to administrators.
+type AdminUser struct {
+	User
+	State        string                 `json:"state"`
+	DisabledAt   datalayer.JsonNullTime `json:"disabledAt"`
+	LoggedOutAt  datalayer.JsonNullTime `json:"loggedOutAt"`
+	Confirmation *ConfirmationStatus    `json:"confirmation,omitempty"`
+}
+
+// ConfirmationStatus describes the latest sign-up confirmation link sent to
+// a user.
+type ConfirmationStatus struct {
+	SentAt    datalayer.JsonNullTime `json:"sentAt"`
+	ExpiresAt datalayer.JsonNullTime `json:"expiresAt"`
+	UsedAt    datalayer.JsonNullTime `json:"usedAt"`
+}
+
+// UserAdmin carries out the user management actions of administrators.
+type UserAdmin struct {
+	Role        string `json:"role,omitempty"`
+	serverState *state.ServerState
+	pagination  pagination.Parameters
+	filter      filters.UserFilter
+}
+
+func NewUserAdmin(state *state.ServerState) *UserAdmin {
+	userAdmin := new(UserAdmin)
+	userAdmin.serverState = state
+	return userAdmin
+}
+
+func (a *UserAdmin) GetSortFields() map[string]bool {
+	fields := make(map[string]bool)
+	for field := range datalayer.UserSortColumns {
+		fields[field] = true
+	}
+	return fields
+}
+
+func (a *UserAdmin) SetSortParameters(parameters pagination.Parameters) {
+	a.pagination = parameters
+}
+
+func (a *UserAdmin) GetPagination() pagination.Parameters {
+	return a.pagination
+}
+
+// SetFilterCriteria reads the search text and the comma separated states
+// and roles to list.
+func (a *UserAdmin) SetFilterCriteria(queryParams url.Values) error {
+	a.filter.Search = strings.TrimSpace(queryParams.Get("search"))
+
+	if s := queryParams.Get("state"); len(s) > 0 {
+		a.filter.States = filters.StringFilter{Value: strings.Split(s, ","), IsSet: true}
+		for _, userState := range a.filter.States.Value {
+			if !isUserState(datalayer.UserState(userState)) {
+				return e.NewError("state filter is invalid", []types.ErrorField{
+					{Name: "state", Message: fmt.Sprintf("Unknown user state %s", userState)},
+				}, http.StatusBadRequest)
+			}
+		}
+	}
+
+	if s := queryParams.Get("role"); len(s) > 0 {
+		a.filter.Roles = filters.StringFilter{Value: strings.Split(s, ","), IsSet: true}
+		for _, role := range a.filter.Roles.Value {
+			if !isUserRole(datalayer.UserRole(role)) {
+				return e.NewError("role filter is invalid", []types.ErrorField{
+					{Name: "role", Message: fmt.Sprintf("Unknown role %s", role)},
+				}, http.StatusBadRequest)
+			}
+		}
+	}
+
+	return nil
+}
+
+func isUserState(userState datalayer.UserState) bool {
+	switch userState {
+	case datalayer.UserStateUnconfirmed, datalayer.UserStateProcessing, datalayer.UserStatePending, datalayer.UserStateConfirmed:
+		return true
+	}
+
+	return false
+}
+
+func isUserRole(role datalayer.UserRole) bool {
+	return role == datalayer.UserRoleUser || role == datalayer.UserRoleAdmin
+}
+
+func (a *UserAdmin) newAdminUser(dbUser *datalayer.User) *AdminUser {
+	user := new(AdminUser)
+	user.serverState = a.serverState
+	user.convert(*dbUser)
+	user.Password = ""
+	user.State = dbUser.State.String
+	user.DisabledAt = dbUser.DisabledAt
+	user.LoggedOutAt = dbUser.LoggedOutAt
+
+	return user
+}
+
+// ListUsers returns a page of the users matching the filter criteria.
+func (a *UserAdmin) ListUsers() ([]*AdminUser, error) {
+	dbUsers, err := a.serverState.DataLayer.GetUsers(a, a.filter)
+	if err != nil {
+		return nil, e.Wrap("Failed to query users from database", http.StatusInternalServerError, err)
+	}
+
+	users := make([]*AdminUser, 0, len(dbUsers))
+	for _, dbUser := range dbUsers {
+		users = append(users, a.newAdminUser(dbUser))
+	}
+
+	return users, nil
+}
+
+func (a *UserAdmin) getUser(id int64) (*datalayer.User, error) {
+	dbUser, err := a.serverState.DataLayer.GetUserByID(id)
+	if err == datalayer.ErrNoData {
+		return nil, ErrAdminUserNotFound
+	} else if err != nil {
+		return nil, e.Wrap(fmt.Sprintf("Failed to query user [%d] from database", id), http.StatusInternalServerError, err)
+	}
+
+	return dbUser, nil
+}
+
+// GetUser returns a user with their settings and the state of their latest
+// sign-up confirmation.
+func (a *UserAdmin) GetUser(id int64) (*AdminUser, error) {
+	dbUser, err := a.getUser(id)
+	if err != nil {
+		return nil, err
+	}
+
+	user := a.newAdminUser(dbUser)
+	err = user.loadSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	signUp, err := a.serverState.DataLayer.GetLatestSignUpConfirmationByUserID(id)
+	if err == nil {
+		user.Confirmation = &ConfirmationStatus{
+			SentAt:    signUp.CreatedAt,
+			ExpiresAt: signUp.ExpiresAt,
+			UsedAt:    signUp.UsedAt,
+		}
+	} else if err != datalayer.ErrNoData {
+		return nil, e.Wrap("Failed to query sign-up confirmation from database", http.StatusInternalServerError, err)
+	}
+
+	return user, nil
+}
+
+// ConfirmUser confirms a user without the link from the confirmation email,
+// which stops working.
+func (a *UserAdmin) ConfirmUser(id int64) (*AdminUser, error) {
+	dbUser, err := a.getUser(id)
+	if err != nil {
+		return nil, err
+	}
+	if datalayer.UserState(dbUser.State.String) == datalayer.UserStateConfirmed {
+		return nil, ErrAdminUserConfirmed
+	}
+
+	dl := a.serverState.DataLayer
+	err = dl.SetUserStateByID(id, datalayer.UserStateConfirmed)
+	if err == datalayer.ErrInvalidStateTransition {
+		return nil, ErrAdminUserConfirmed
+	} else if err != nil {
+		return nil, e.Wrap(fmt.Sprintf("Failed to confirm user [%d]", id), http.StatusInternalServerError, err)
+	}
+
+	err = dl.ExpireSignUpConfirmationsByUserID(id)
+	if err != nil {
+		return nil, e.Wrap("Failed to expire sign-up confirmations", http.StatusInternalServerError, err)
+	}
+	a.serverState.Logger.Printf("Administrator confirmed user %d", id)
+
+	return a.GetUser(id)
+}
+
+// DisableUser stops a user from logging in and ends all of their sessions.
+// Administrators cannot disable themselves.
+func (a *UserAdmin) DisableUser(adminID, id int64) (*AdminUser, error) {
+	if adminID == id {
+		return nil, ErrAdminSelf
+	}
+
+	dbUser, err := a.getUser(id)
+	if err != nil {
+		return nil, err
+	}
+	if dbUser.DisabledAt.Valid {
+		return nil, ErrAdminUserDisabled
+	}
+
+	err = a.serverState.DataLayer.DisableUserByID(id, time.Now())
+	if err == datalayer.ErrNoData {
+		return nil, ErrAdminUserDisabled
+	} else if err != nil {
+		return nil, e.Wrap(fmt.Sprintf("Failed to disable user [%d]", id), http.StatusInternalServerError, err)
+	}
+
+	user := NewUser(a.serverState)
+	user.ID = id
+	err = user.LogoutAll()
+	if err != nil {
+		return nil, err
+	}
+	a.serverState.Logger.Printf("Administrator %d disabled user %d", adminID, id)
+
+	return a.GetUser(id)
+}
+
+func (a *UserAdmin) EnableUser(id int64) (*AdminUser, error) {
+	dbUser, err := a.getUser(id)
+	if err != nil {
+		return nil, err
+	}
+	if !dbUser.DisabledAt.Valid {
+		return nil, ErrAdminUserEnabled
+	}
+
+	err = a.serverState.DataLayer.EnableUserByID(id)
+	if err == datalayer.ErrNoData {
+		return nil, ErrAdminUserEnabled
+	} else if err != nil {
+		return nil, e.Wrap(fmt.Sprintf("Failed to enable user [%d]", id), http.StatusInternalServerError, err)
+	}
+	a.serverState.Logger.Printf("Administrator enabled user %d", id)
+
+	return a.GetUser(id)
+}
+
+// SetRole changes the role of a user.  Administrators cannot change their
+// own role so that at least one administrator remains.
+func (a *UserAdmin) SetRole(adminID, id int64) (*AdminUser, error) {
+	if !isUserRole(datalayer.UserRole(a.Role)) {
+		return nil, ErrAdminRoleInvalid
+	}
+	if adminID == id {
+		return nil, ErrAdminSelf
+	}
+
+	_, err := a.getUser(id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.serverState.DataLayer.SetUserRoleByID(id, datalayer.UserRole(a.Role))
+	if err != nil && err != datalayer.ErrNoData {
+		return nil, e.Wrap(fmt.Sprintf("Failed to change role of user [%d]", id), http.StatusInternalServerError, err)
+	}
+	a.serverState.Logger.Printf("Administrator %d changed role of user %d to %s", adminID, id, a.Role)
+
+	return a.GetUser(id)
+}
+
+// ResetPassword emails the user a password reset link.
+func (a *UserAdmin) ResetPassword(id int64) error {
+	dbUser, err := a.getUser(id)
+	if err != nil {
+		return err
+	}
+
+	a.serverState.Channels.ResetPasswords <- *dbUser
+
+	return nil
+}
+
+// ResendConfirmation emails an unconfirmed user a new confirmation link.
+// Unlike users, administrators are not limited in how often they can resend.
+func (a *UserAdmin) ResendConfirmation(id int64) error {
+	dbUser, err := a.getUser(id)
+	if err != nil {
+		return err
+	}
+	if datalayer.UserState(dbUser.State.String) == datalayer.UserStateConfirmed {
+		return ErrAdminUserConfirmed
+	}
+
+	a.serverState.Channels.ConfirmUsers <- *dbUser
+
+	return nil
+}
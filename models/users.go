@@ -4,18 +4,48 @@ import (
 	"database/sql"
 	"fmt"
 	e "github.com/donohutcheon/gowebserver/controllers/errors"
-	"github.com/donohutcheon/gowebserver/controllers/response/types"
 	"github.com/donohutcheon/gowebserver/datalayer"
 	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/router/auth/throttle"
 	"github.com/donohutcheon/gowebserver/state"
 	"golang.org/x/crypto/bcrypt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// ConfirmationResendInterval is how long users wait between sign-up
+// confirmation emails.
+const ConfirmationResendInterval = time.Minute
+
 type Settings struct {
-	ID int `json:"id"`
-	ThemeName string `json:"themeName"`
+	ID               int64  `json:"id"`
+	ThemeName        string `json:"themeName"`
+	CurrencyCode     string `json:"currencyCode"`
+	Timezone         string `json:"timezone"`
+	Locale           string `json:"locale"`
+	MagicLinkEnabled bool   `json:"magicLinkEnabled"`
+}
+
+// DefaultSettings are used until a user saves their own settings.
+var DefaultSettings = Settings{
+	ThemeName:    "default",
+	CurrencyCode: "ZAR",
+	Timezone:     "UTC",
+	Locale:       "en-ZA",
+	// Users who rarely log in tend to forget their password, so magic links
+	// are allowed until turned off.
+	MagicLinkEnabled: true,
+}
+
+func (s *Settings) convert(settings datalayer.UserSettings) {
+	s.ID = settings.ID
+	s.ThemeName = settings.ThemeName
+	s.CurrencyCode = settings.CurrencyCode
+	s.Timezone = settings.Timezone
+	s.Locale = settings.Locale
+	s.MagicLinkEnabled = settings.MagicLinkEnabled
 }
 
 type User struct {
@@ -29,6 +59,7 @@ type User struct {
 	Roles        []string  `json:"roles"`
 	Settings     Settings  `json:"settings"`
 	Password     string    `json:"password,omitempty"`
+	disabled     bool
 	/*AccessToken  string    `json:"accessToken,omitempty" sql:"-"`
 	RefreshToken string    `json:"refreshToken,omitempty" sql:"-"`
 	LoggedOutAt  time.Time `json:"loggedOutAt,omitempty"`*/
@@ -51,9 +82,27 @@ func (u *User) convert(user datalayer.User) {
 	if user.Password.Valid {
 		u.Password = user.Password.String
 	}
-	u.Roles = []string{"ADMIN","USER"}
-	u.Settings.ID = 0
-	u.Settings.ThemeName = "default"
+	u.FirstName = user.FirstName.String
+	u.Surname = user.Surname.String
+	u.Age = int(user.Age.Int64)
+	u.Address = user.Address.String
+	u.Roles = auth.RolesForUser(&user)
+	u.disabled = user.DisabledAt.Valid
+	u.Settings = DefaultSettings
+}
+
+// loadSettings replaces the default settings with the ones the user saved.
+func (u *User) loadSettings() error {
+	settings, err := u.serverState.DataLayer.GetUserSettingsByUserID(u.ID)
+	if err == datalayer.ErrNoData {
+		return nil
+	} else if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to query settings of user [%d] from database", u.ID), http.StatusInternalServerError, err)
+	}
+
+	u.Settings.convert(*settings)
+
+	return nil
 }
 
 //Validate incoming user details...
@@ -62,14 +111,25 @@ func (u *User) validate() error {
 		return ErrValidationEmail
 	}
 
-	if len(u.Password) < 6 {
-		return ErrValidationPassword
+	err := validatePassword(u.serverState, u.Email, u.Password)
+	if err != nil {
+		return err
 	}
 
-	//Email must be unique
-	//check for errors and duplicate emails
-	dl := u.serverState.DataLayer
-	_, err := dl.GetUserByEmail(u.Email)
+	return validateEmailUnique(u.serverState.DataLayer, u.Email)
+}
+
+//Email must be unique
+//check for errors and duplicate emails
+func validateEmailUnique(dl datalayer.DataLayer, email string) error {
+	_, err := dl.GetUserByEmail(email)
+	if err != sql.ErrNoRows {
+		return ErrEmailExists
+	}
+
+	// Deleted accounts keep their address until they are purged so that they
+	// can still be recovered.
+	_, err = dl.GetDeletedUserByEmail(email)
 	if err != sql.ErrNoRows {
 		return ErrEmailExists
 	}
@@ -77,6 +137,20 @@ func (u *User) validate() error {
 	return nil
 }
 
+// validatePassword checks a new password against the password policy.
+func validatePassword(state *state.ServerState, email, password string) error {
+	if len(password) == 0 {
+		return ErrValidationPassword
+	}
+
+	fields := state.PasswordPolicy.Check(email, password)
+	if len(fields) > 0 {
+		return e.NewError("Password does not meet the password policy", fields, http.StatusBadRequest)
+	}
+
+	return nil
+}
+
 func (u *User) Create() (*User, error) {
 	logger := u.serverState.Logger
 	err := u.validate()
@@ -89,8 +163,7 @@ func (u *User) Create() (*User, error) {
 	u.Password = string(hashedPassword)
 
 	dl := u.serverState.DataLayer
-	// TODO: Include roles
-	id, err :=  dl.CreateUser(u.Email, u.Password)
+	id, err :=  dl.CreateUser(u.Email, u.Password, datalayer.UserRoleUser)
 	if err != nil {
 		logger.Fatal(err) // TODO: remove
 		return nil, err
@@ -102,6 +175,10 @@ func (u *User) Create() (*User, error) {
 	}
 
 	// Send confirmation Email
+	err = dl.SetUserConfirmationSentAtByID(id, time.Now(), 0)
+	if err != nil {
+		return nil, err
+	}
 	u.serverState.Channels.ConfirmUsers <- *dbUser
 
 	user := new(User)
@@ -112,35 +189,152 @@ func (u *User) Create() (*User, error) {
 	return user, nil
 }
 
-func (u *User) Login(email, password string) (*auth.TokenResponse, error) {
+// Login checks the credentials of a user.  Users with two-factor
+// authentication enabled receive a challenge instead of a token pair.
+// Failed attempts are throttled per account and per client IP address.
+// Logging in to a deleted account during its grace period restores it.
+func (u *User) Login(email, password string, client auth.Client) (*auth.TokenResponse, *auth.ChallengeResponse, error) {
+	ip := client.IP
+	loginThrottle := u.serverState.Throttle
+	err := loginThrottle.Check(throttle.KindIP, ip)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	dataLayer := u.serverState.DataLayer
 	dbUser, err := dataLayer.GetUserByEmail(email)
+	restore := false
+	if err == sql.ErrNoRows {
+		dbUser, err = getRecoverableUser(u.serverState, email)
+		restore = err == nil
+	}
 	if err == sql.ErrNoRows {
-		return nil, ErrLoginFailed
+		_, err = loginThrottle.Fail(throttle.KindIP, ip)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrLoginFailed
 	} else if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	accountKey := strconv.FormatInt(dbUser.ID, 10)
+	err = loginThrottle.Check(throttle.KindAccount, accountKey)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	if datalayer.UserState(dbUser.State.String) != datalayer.UserStateConfirmed {
-		return nil, ErrUserNotConfirmed
+		return nil, nil, ErrUserNotConfirmed
 	}
 
 	u.convert(*dbUser)
 
 	err = bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 	if err != nil && err == bcrypt.ErrMismatchedHashAndPassword { //Password does not match!
-		return nil, ErrLoginFailed
+		_, err = loginThrottle.Fail(throttle.KindIP, ip)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		locked, err := loginThrottle.Fail(throttle.KindAccount, accountKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		if locked {
+			// Send the unlock link
+			u.serverState.Channels.UnlockAccounts <- *dbUser
+		}
+		return nil, nil, ErrLoginFailed
 	}
 	// Worked! Logged In
 	u.Password = ""
 
+	err = loginThrottle.Reset(throttle.KindAccount, accountKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return u.issueTokens(client, restore)
+}
+
+// issueTokens completes a login once the user has been identified, asking
+// for the second factor first when two-factor authentication is enabled.
+// When restore is set the pending deletion of the user is only cancelled
+// once the login has fully succeeded.
+func (u *User) issueTokens(client auth.Client, restore bool) (*auth.TokenResponse, *auth.ChallengeResponse, error) {
+	if u.disabled {
+		return nil, nil, auth.ErrAccountDisabled
+	}
+
+	twoFactorEnabled, err := IsTwoFactorEnabled(u.serverState, u.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if twoFactorEnabled {
+		challenge, err := auth.CreateChallengeToken(u.serverState, u.ID, restore)
+		if err != nil {
+			return nil, nil, e.Wrap("challenge creation failed", http.StatusInternalServerError, err)
+		}
+		return nil, challenge, nil
+	}
+
+	if restore {
+		err = restoreUser(u.serverState, u.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		u.DeletedAt = datalayer.JsonNullTime{}
+	}
+
 	// Create JWT token
-	tokenResp, err := auth.CreateToken(u.ID)
+	tokenResp, err := auth.CreateToken(u.serverState, u.ID, client)
 	if err != nil {
-		return nil, e.Wrap("token creation failed", http.StatusInternalServerError, err)
+		return nil, nil, e.Wrap("token creation failed", http.StatusInternalServerError, err)
 	}
 
-	return tokenResp, nil
+	return tokenResp, nil, nil
+}
+
+// Logout ends the session identified by the token family.
+func (u *User) Logout(familyID string) error {
+	dl := u.serverState.DataLayer
+	err := dl.RevokeRefreshTokenFamily(familyID)
+	if err != nil {
+		return e.Wrap("Failed to revoke session", http.StatusInternalServerError, err)
+	}
+
+	err = dl.RevokeSessionByFamilyID(familyID)
+	if err != nil {
+		return e.Wrap("Failed to revoke session", http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
+
+// LogoutAll ends every session of the user, including API tokens, by
+// stamping the time after which tokens are accepted again.
+func (u *User) LogoutAll() error {
+	dl := u.serverState.DataLayer
+	err := dl.SetUserLoggedOutAtByID(u.ID, time.Now())
+	if err == datalayer.ErrNoData {
+		return ErrUserDoesNotExist
+	} else if err != nil {
+		return e.Wrap(fmt.Sprintf("Failed to log out user [%d]", u.ID), http.StatusInternalServerError, err)
+	}
+
+	err = dl.RevokeRefreshTokensByUserID(u.ID)
+	if err != nil {
+		return e.Wrap("Failed to revoke sessions", http.StatusInternalServerError, err)
+	}
+
+	err = dl.RevokeSessionsByUserID(u.ID)
+	if err != nil {
+		return e.Wrap("Failed to revoke sessions", http.StatusInternalServerError, err)
+	}
+
+	return nil
 }
 
 func (u *User) GetUser(id int64) (error) {
@@ -154,33 +348,104 @@ func (u *User) GetUser(id int64) (error) {
 
 	u.convert(*dbUser)
 
-	return nil
+	return u.loadSettings()
 }
 
+// ConfirmUser confirms the email address of a user with the nonce from the
+// sign-up confirmation link.  Each nonce works once and only until it expires.
 func (u *User) ConfirmUser(nonce string) error {
 	logger := u.serverState.Logger
 	dl := u.serverState.DataLayer
 
 	signUp, err := dl.LookupSignUpConfirmation(nonce)
-	if err != nil {
-		return e.NewError("User confirmation not found", []types.ErrorField{
-			{Name: "nonce", Message: "Nonce not found"},
-		}, http.StatusNotFound)
+	if err == datalayer.ErrNoData {
+		return ErrSignUpConfirmationNotFound
+	} else if err != nil {
+		return e.Wrap("Failed to query sign-up confirmation from database", http.StatusInternalServerError, err)
+	}
+	logger.Printf("Received nonce confirmation for user %d", signUp.UserID)
+
+	if signUp.UsedAt.Valid {
+		return ErrSignUpConfirmationUsed
+	}
+	// Nonces from before confirmations expired have no expiry and must be resent.
+	if !signUp.ExpiresAt.Valid || signUp.ExpiresAt.Time.Before(time.Now()) {
+		return ErrSignUpConfirmationExpired
+	}
+
+	err = dl.ConsumeSignUpConfirmation(signUp.ID)
+	if err == datalayer.ErrNoData {
+		return ErrSignUpConfirmationUsed
+	} else if err != nil {
+		return e.Wrap("Failed to consume sign-up confirmation", http.StatusInternalServerError, err)
 	}
-	logger.Printf("Received nonce confirmation for user %d %s", signUp.UserID, nonce)
 
 	err = dl.SetUserStateByID(signUp.UserID, datalayer.UserStateConfirmed)
-	if err != nil {
+	if err == datalayer.ErrInvalidStateTransition {
+		return ErrSignUpConfirmationUsed
+	} else if err != nil {
 		return e.Wrap(fmt.Sprintf("Failed to confirm user [%d]", signUp.UserID), http.StatusInternalServerError, err)
 	}
 
+	u.ID = signUp.UserID
+
+	return nil
+}
+
+// ResendConfirmation queues a new sign-up confirmation email, expiring
+// earlier links.  Links are sent at most once every
+// ConfirmationResendInterval.  Unknown, already confirmed and rate limited
+// addresses are silently ignored, so that the response does not reveal
+// which addresses are registered.
+func (u *User) ResendConfirmation() error {
+	if !strings.Contains(u.Email, "@") {
+		return ErrValidationEmail
+	}
+
+	dl := u.serverState.DataLayer
+	dbUser, err := dl.GetUserByEmail(u.Email)
+	if err == datalayer.ErrNoData {
+		u.serverState.Logger.Printf("Confirmation resend requested for unknown email address")
+		return nil
+	} else if err != nil {
+		return e.Wrap("Failed to query user from database", http.StatusInternalServerError, err)
+	}
+
+	if datalayer.UserState(dbUser.State.String) == datalayer.UserStateConfirmed {
+		return nil
+	}
+
+	// The send is recorded before queueing, as the link itself is only saved
+	// once the email goes out.
+	err = dl.SetUserConfirmationSentAtByID(dbUser.ID, time.Now(), ConfirmationResendInterval)
+	if err == datalayer.ErrNoData {
+		u.serverState.Logger.Printf("Confirmation resend for user %d ignored, a link was sent recently", dbUser.ID)
+		return nil
+	} else if err != nil {
+		return e.Wrap("Failed to record confirmation resend", http.StatusInternalServerError, err)
+	}
+
+	u.serverState.Channels.ConfirmUsers <- *dbUser
+
 	return nil
 }
 
+// GetAPIToken issues a full access API token for the dashboard.  It is listed
+// and revoked like any other API token.
 func (u *User) GetAPIToken() (*auth.APITokenResponse, error) {
-	tokenResp, err := auth.CreateAPIToken(u.ID)
+	apiToken := NewAPIToken(u.serverState)
+	apiToken.UserID = u.ID
+	apiToken.Name = "Dashboard"
+	apiToken.Scopes = auth.Scopes()
+
+	created, err := apiToken.Create()
 	if err != nil {
-		return nil, e.Wrap("api token creation failed", http.StatusInternalServerError, err)
+		return nil, err
+	}
+
+	tokenResp := &auth.APITokenResponse{
+		ExpiresIn: created.ExpiresAt.Time.Unix(),
+		APIToken:  created.Token,
 	}
 
 	return tokenResp, nil
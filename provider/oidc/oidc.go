@@ -0,0 +1,387 @@
+// Package oidc signs users in with external OpenID Connect identity providers
+// using the authorization code flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/donohutcheon/gowebserver/router/auth/keys"
+)
+
+const (
+	// leeway allows for clock drift between us and the identity provider.
+	leeway         = time.Minute
+	reloadInterval = time.Minute
+)
+
+var (
+	ErrUnknownKey       = errors.New("identity provider signing key is not recognised")
+	ErrIssuerMismatch   = errors.New("ID token was issued by another issuer")
+	ErrAudienceMismatch = errors.New("ID token was issued to another client")
+	ErrNonceMismatch    = errors.New("ID token nonce does not match the login request")
+	ErrTokenExpired     = errors.New("ID token has expired")
+	ErrNoIDToken        = errors.New("token response did not include an ID token")
+)
+
+type Config struct {
+	// Name identifies the provider in URLs, e.g. /api/auth/oidc/google/start.
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// ConfigFromEnv reads the providers listed in OIDC_PROVIDERS.  Each provider
+// is configured by OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID,
+// OIDC_<NAME>_CLIENT_SECRET and optionally OIDC_<NAME>_REDIRECT_URL and
+// OIDC_<NAME>_SCOPES.
+func ConfigFromEnv(baseURL string) ([]Config, error) {
+	var configs []Config
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if len(name) == 0 {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		config := Config{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if len(config.Issuer) == 0 || len(config.ClientID) == 0 {
+			return nil, fmt.Errorf("%sISSUER and %sCLIENT_ID are required", prefix, prefix)
+		}
+		if len(config.RedirectURL) == 0 {
+			config.RedirectURL = fmt.Sprintf("%s/api/auth/oidc/%s/callback", baseURL, name)
+		}
+
+		configs = append(configs, config)
+	}
+
+	return configs, nil
+}
+
+// NewProviders creates a provider for each configuration keyed by name.
+func NewProviders(configs []Config) map[string]*Provider {
+	providers := make(map[string]*Provider)
+	for _, config := range configs {
+		providers[config.Name] = New(config)
+	}
+
+	return providers
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type Provider struct {
+	config     Config
+	client     *http.Client
+	mutex      sync.Mutex
+	discovery  *discovery
+	keys       map[string]interface{}
+	lastReload time.Time
+}
+
+func New(config Config) *Provider {
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+
+	return &Provider{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		keys:   make(map[string]interface{}),
+	}
+}
+
+// IDToken holds the claims of a verified ID token.
+type IDToken struct {
+	Issuer        string       `json:"iss"`
+	Subject       string       `json:"sub"`
+	Audience      audience     `json:"aud"`
+	ExpiresAt     int64        `json:"exp"`
+	IssuedAt      int64        `json:"iat"`
+	Nonce         string       `json:"nonce"`
+	Email         string       `json:"email"`
+	EmailVerified flexibleBool `json:"email_verified"`
+}
+
+// Valid checks the token lifetime for jwt.Parse.  The remaining claims are
+// checked in Exchange.
+func (t *IDToken) Valid() error {
+	if t.ExpiresAt == 0 || time.Now().After(time.Unix(t.ExpiresAt, 0).Add(leeway)) {
+		return ErrTokenExpired
+	}
+
+	return nil
+}
+
+// audience accepts both forms of the aud claim, a string or a list.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if json.Unmarshal(b, &single) == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var list []string
+	err := json.Unmarshal(b, &list)
+	if err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// flexibleBool accepts true as well as "true", which some providers send.
+type flexibleBool bool
+
+func (f *flexibleBool) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	*f = flexibleBool(s == "true")
+	return nil
+}
+
+// NewCodeVerifier returns a random PKCE code verifier.
+func NewCodeVerifier() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge returns the S256 PKCE challenge of a verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the URL the user is redirected to for signing in.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.config.ClientID)
+	params.Set("redirect_uri", p.config.RedirectURL)
+	params.Set("scope", strings.Join(p.config.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return d.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified ID token.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*IDToken, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+
+	var tokenResp struct {
+		IDToken string `json:"id_token"`
+	}
+	err = p.do(req, &tokenResp)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	if len(tokenResp.IDToken) == 0 {
+		return nil, ErrNoIDToken
+	}
+
+	return p.verify(ctx, tokenResp.IDToken, nonce)
+}
+
+func (p *Provider) verify(ctx context.Context, rawToken, nonce string) (*IDToken, error) {
+	idToken := new(IDToken)
+	parser := &jwt.Parser{
+		ValidMethods: []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg()},
+	}
+	_, err := parser.ParseWithClaims(rawToken, idToken, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if idToken.Issuer != p.config.Issuer {
+		return nil, ErrIssuerMismatch
+	}
+
+	found := false
+	for _, aud := range idToken.Audience {
+		if aud == p.config.ClientID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, ErrAudienceMismatch
+	}
+
+	if idToken.Nonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+
+	return idToken, nil
+}
+
+// key resolves a signing key, reloading the key set when the provider has
+// rotated in a key we have not seen yet.
+func (p *Provider) key(ctx context.Context, kid string) (interface{}, error) {
+	p.mutex.Lock()
+	key, ok := p.keys[kid]
+	stale := time.Since(p.lastReload) > reloadInterval
+	p.mutex.Unlock()
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, ErrUnknownKey
+	}
+
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	jwks := new(keys.JSONWebKeySet)
+	err = p.do(req, jwks)
+	if err != nil {
+		return nil, fmt.Errorf("key set request failed: %w", err)
+	}
+
+	loaded := make(map[string]interface{})
+	for _, jwk := range jwks.Keys {
+		if len(jwk.Use) > 0 && jwk.Use != "sig" {
+			continue
+		}
+		publicKey, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		loaded[jwk.KeyID] = publicKey
+	}
+
+	p.mutex.Lock()
+	p.keys = loaded
+	p.lastReload = time.Now()
+	p.mutex.Unlock()
+
+	key, ok = loaded[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	return key, nil
+}
+
+func (p *Provider) discover(ctx context.Context) (*discovery, error) {
+	p.mutex.Lock()
+	d := p.discovery
+	p.mutex.Unlock()
+	if d != nil {
+		return d, nil
+	}
+
+	wellKnown := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	d = new(discovery)
+	err = p.do(req, d)
+	if err != nil {
+		return nil, fmt.Errorf("discovery failed: %w", err)
+	}
+
+	if d.Issuer != p.config.Issuer {
+		return nil, ErrIssuerMismatch
+	}
+
+	p.mutex.Lock()
+	p.discovery = d
+	p.mutex.Unlock()
+
+	return d, nil
+}
+
+func (p *Provider) do(req *http.Request, v interface{}) error {
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d %s", req.URL.Path, res.StatusCode, string(body))
+	}
+
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// APITokenPrefix marks opaque API tokens so they can be told apart from JWTs.
+const APITokenPrefix = "gwapi_"
+
+const apiTokenDisplayLength = 12
+
+// lastUsedResolution limits how often the last used timestamp is written.
+const lastUsedResolution = time.Minute
+
+var (
+	ErrAPITokenUnknown = e.NewError("API token is not recognised", nil, http.StatusForbidden)
+	ErrAPITokenRevoked = e.NewError("API token has been revoked", nil, http.StatusForbidden)
+	ErrAPITokenExpired = e.NewError("API token has expired", nil, http.StatusForbidden)
+)
+
+// GenerateAPIToken returns a new random API token along with the prefix shown
+// to the user and the hash that is persisted.  The token itself is never
+// stored.
+func GenerateAPIToken() (token, displayPrefix, tokenHash string, err error) {
+	b := make([]byte, 32)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	token = APITokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, token[:apiTokenDisplayLength], HashToken(token), nil
+}
+
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenPrefix)
+}
+
+// AuthenticateAPIToken resolves an API token presented as a bearer token into
+// the principal it acts for.
+func AuthenticateAPIToken(state *state.ServerState, token string) (*Principal, error) {
+	dl := state.DataLayer
+
+	apiToken, err := dl.GetAPITokenByHash(HashToken(token))
+	if err == datalayer.ErrNoData {
+		return nil, ErrAPITokenUnknown
+	} else if err != nil {
+		return nil, e.Wrap("API token lookup failed", http.StatusInternalServerError, err)
+	}
+
+	if apiToken.RevokedAt.Valid {
+		return nil, ErrAPITokenRevoked
+	}
+
+	now := time.Now()
+	if apiToken.ExpiresAt.Valid && apiToken.ExpiresAt.Time.Before(now) {
+		return nil, ErrAPITokenExpired
+	}
+
+	user, err := dl.GetUserByID(apiToken.UserID)
+	if err == datalayer.ErrNoData {
+		return nil, ErrSessionUserNotFound
+	} else if err != nil {
+		return nil, e.Wrap("user lookup failed", http.StatusInternalServerError, err)
+	}
+
+	if user.DisabledAt.Valid {
+		return nil, ErrAccountDisabled
+	}
+
+	if user.LoggedOutAt.Valid && apiToken.CreatedAt.Time.Before(user.LoggedOutAt.Time) {
+		return nil, ErrSessionLoggedOut
+	}
+
+	if !apiToken.LastUsedAt.Valid || now.Sub(apiToken.LastUsedAt.Time) > lastUsedResolution {
+		err = dl.SetAPITokenLastUsedAt(apiToken.ID, now)
+		if err != nil {
+			state.Logger.Printf("failed to update last used time of API token %d %s", apiToken.ID, err.Error())
+		}
+	}
+
+	principal := &Principal{
+		UserID:     apiToken.UserID,
+		Roles:      RolesForUser(user),
+		Scopes:     SplitScopes(apiToken.Scopes),
+		APITokenID: apiToken.ID,
+	}
+
+	return principal, nil
+}
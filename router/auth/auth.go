@@ -1,22 +1,57 @@
 package auth
 
 import (
-	"fmt"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	e "github.com/donohutcheon/gowebserver/controllers/errors"
-
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/state"
 )
 
 const AccessTokenLifeSpan = 36000
 const RefreshTokenLifeSpan = 864000
 const APITokenLifeSpan = 31536000
+const ChallengeTokenLifeSpan = 300
+const ImpersonationTokenLifeSpan = 900
+
+// Token types distinguish the purpose of a JWT so that, for example, a
+// refresh or challenge token is never accepted as an access token.  Tokens
+// issued before the claim existed have no type and are treated as access
+// tokens.
+const (
+	TokenTypeAccess    = "access"
+	TokenTypeRefresh   = "refresh"
+	TokenTypeChallenge = "2fa_challenge"
+	// Impersonation tokens act as a user on behalf of the administrator
+	// named in the actor claim.
+	TokenTypeImpersonation = "impersonation"
+)
+
+var (
+	ErrRefreshTokenUnknown = e.NewError("refresh token is not recognised", nil, http.StatusForbidden)
+	ErrRefreshTokenRevoked = e.NewError("refresh token has been revoked", nil, http.StatusForbidden)
+	ErrRefreshTokenReused  = e.NewError("refresh token has already been used, session revoked", nil, http.StatusForbidden)
+	ErrSessionLoggedOut    = e.NewError("Session has been logged out", nil, http.StatusForbidden)
+	ErrSessionUserNotFound = e.NewError("User account does not exist", nil, http.StatusForbidden)
+	ErrAccountDisabled     = e.NewError("User account has been disabled", nil, http.StatusForbidden)
+	ErrTokenTypeInvalid    = e.NewError("Token is not an access token", nil, http.StatusForbidden)
+)
 
 type JSONWebToken struct {
-	UserID int64 `json:"userID"`
+	UserID    int64    `json:"userID"`
+	ActorID   int64    `json:"actorID,omitempty"`
+	FamilyID  string   `json:"fid,omitempty"`
+	SessionID int64    `json:"sid,omitempty"`
+	TokenType string   `json:"typ,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	// Restore marks a challenge issued to a user whose deletion is cancelled
+	// once the second factor is given.
+	Restore bool `json:"restore,omitempty"`
 	jwt.StandardClaims
 }
 
@@ -27,8 +62,9 @@ type RefreshJWTReq struct {
 
 type TokenResponse struct {
 	ExpiresIn int64 `json:"expiresIn"`
-	AccessToken string  `json:"accessToken" sql:"-"`
-	RefreshToken string  `json:"refreshToken" sql:"-"`
+	// The tokens are left out of the body when they are set in cookies.
+	AccessToken string  `json:"accessToken,omitempty" sql:"-"`
+	RefreshToken string  `json:"refreshToken,omitempty" sql:"-"`
 }
 
 type APITokenResponse struct {
@@ -36,44 +72,94 @@ type APITokenResponse struct {
 	APIToken string `json:"apiToken" sql:"-"`
 }
 
-func CreateToken(userID int64) (*TokenResponse, error){
+// CreateToken issues an access and refresh token pair for a new session on the
+// client's device.  The refresh token starts a new token family which is
+// rotated on each refresh.
+func CreateToken(state *state.ServerState, userID int64, client Client) (*TokenResponse, error) {
+	familyID, err := newTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	sessionID, err := touchSession(state, userID, familyID, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return createTokenPair(state, userID, familyID, sessionID)
+}
+
+func createTokenPair(state *state.ServerState, userID int64, familyID string, sessionID int64) (*TokenResponse, error) {
+	user, err := state.DataLayer.GetUserByID(userID)
+	if err == datalayer.ErrNoData {
+		return nil, ErrSessionUserNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
 	token := new(TokenResponse)
 	now := time.Now()
 	epochSecs := now.Unix()
 	expireDateTime := epochSecs + AccessTokenLifeSpan
 	token.ExpiresIn = expireDateTime
 	accessToken := &JSONWebToken{
-		UserID: userID,
+		UserID:    userID,
+		FamilyID:  familyID,
+		SessionID: sessionID,
+		TokenType: TokenTypeAccess,
+		Roles:     RolesForUser(user),
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: expireDateTime,
 			IssuedAt:  epochSecs,
 		},
 	}
 
-	signedAccessToken := jwt.NewWithClaims(jwt.GetSigningMethod("HS256"), accessToken)
-	accessTokenString, _ := signedAccessToken.SignedString([]byte(os.Getenv("token_password")))
+	accessTokenString, err := state.Keys.Sign(accessToken)
+	if err != nil {
+		return nil, err
+	}
 	token.AccessToken = accessTokenString
 
+	jti, err := newTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	refreshExpireDateTime := epochSecs + RefreshTokenLifeSpan
 	refreshToken := &JSONWebToken{
-		UserID: userID,
+		UserID:    userID,
+		FamilyID:  familyID,
+		SessionID: sessionID,
+		TokenType: TokenTypeRefresh,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: epochSecs + RefreshTokenLifeSpan,
+			Id:        jti,
+			ExpiresAt: refreshExpireDateTime,
 			IssuedAt:  epochSecs,
 		},
 	}
-	signedRefreshToken := jwt.NewWithClaims(jwt.GetSigningMethod("HS256"), refreshToken)
-	refreshTokenString, _ := signedRefreshToken.SignedString([]byte(os.Getenv("token_password")))
+	refreshTokenString, err := state.Keys.Sign(refreshToken)
+	if err != nil {
+		return nil, err
+	}
 	token.RefreshToken = refreshTokenString
 
+	_, err = state.DataLayer.CreateRefreshToken(jti, familyID, userID, time.Unix(refreshExpireDateTime, 0))
+	if err != nil {
+		return nil, err
+	}
+
 	return token, nil
 }
 
-func RefreshToken(rawToken string) (*TokenResponse, error) {
+// RefreshToken exchanges a refresh token for a new token pair in the same
+// family.  A refresh token can only be used once; presenting a token that
+// has already been rotated revokes every token in its family.  The session is
+// updated with the client the refresh came from.
+func RefreshToken(state *state.ServerState, rawToken string, client Client) (*TokenResponse, error) {
+	dl := state.DataLayer
 	tk := new(JSONWebToken)
 
-	token, err := jwt.ParseWithClaims(rawToken, tk, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("token_password")), nil
-	})
+	token, err := jwt.ParseWithClaims(rawToken, tk, state.Keys.Keyfunc)
 	if err != nil { //Malformed token, returns with http code 403 as usual
 		return nil, e.Wrap("Token rejected", http.StatusForbidden, err)
 	}
@@ -82,10 +168,46 @@ func RefreshToken(rawToken string) (*TokenResponse, error) {
 		return nil, e.NewError("token is not valid", nil, http.StatusForbidden)
 	}
 
-	fmt.Printf("UserID %d", tk.UserID)
+	if len(tk.Id) == 0 || len(tk.FamilyID) == 0 || (len(tk.TokenType) > 0 && tk.TokenType != TokenTypeRefresh) {
+		return nil, ErrRefreshTokenUnknown
+	}
+
+	dbRefreshToken, err := dl.GetRefreshTokenByJTI(tk.Id)
+	if err == datalayer.ErrNoData {
+		return nil, ErrRefreshTokenUnknown
+	} else if err != nil {
+		return nil, e.Wrap("refresh token lookup failed", http.StatusInternalServerError, err)
+	}
+
+	if dbRefreshToken.RevokedAt.Valid {
+		return nil, ErrRefreshTokenRevoked
+	}
+
+	err = ValidateSession(state, tk)
+	if err != nil {
+		return nil, err
+	}
+
+	err = dl.RotateRefreshToken(tk.Id)
+	if err == datalayer.ErrNoData {
+		// The token was already exchanged, so either the client or an attacker
+		// holds a stolen copy.  Kill the whole family to be safe.
+		err = dl.RevokeRefreshTokenFamily(dbRefreshToken.FamilyID)
+		if err != nil {
+			return nil, e.Wrap("refresh token revocation failed", http.StatusInternalServerError, err)
+		}
+		return nil, ErrRefreshTokenReused
+	} else if err != nil {
+		return nil, e.Wrap("refresh token rotation failed", http.StatusInternalServerError, err)
+	}
+
+	sessionID, err := touchSession(state, dbRefreshToken.UserID, dbRefreshToken.FamilyID, client)
+	if err != nil {
+		return nil, e.Wrap("session update failed", http.StatusInternalServerError, err)
+	}
 
 	//Create JWT token
-	tokenResp, err := CreateToken(tk.UserID)
+	tokenResp, err := createTokenPair(state, dbRefreshToken.UserID, dbRefreshToken.FamilyID, sessionID)
 	if err != nil {
 		return nil, e.Wrap("token creation failed", http.StatusInternalServerError, err)
 	}
@@ -93,29 +215,90 @@ func RefreshToken(rawToken string) (*TokenResponse, error) {
 	return tokenResp, nil
 }
 
-func CreateAPIToken(userID int64) (*APITokenResponse, error){
-	now := time.Now()
-	epochSecs := now.Unix()
-	expireDateTime := epochSecs + APITokenLifeSpan
+// IsAccessToken reports whether the token may be used to call the API.
+func IsAccessToken(tk *JSONWebToken) bool {
+	return len(tk.TokenType) == 0 || tk.TokenType == TokenTypeAccess
+}
 
-	accessToken := &JSONWebToken{
-		UserID: userID,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expireDateTime,
-			IssuedAt:  epochSecs,
-		},
+// ValidateSession rejects tokens of disabled users, tokens issued before the
+// user last logged out of all sessions, tokens of a revoked session or token
+// family and tokens claiming a role the user no longer has.  Disabling a user
+// also logs them out, so the disabled check comes first.
+func ValidateSession(state *state.ServerState, tk *JSONWebToken) error {
+	dl := state.DataLayer
+	user, err := dl.GetUserByID(tk.UserID)
+	if err == datalayer.ErrNoData {
+		return ErrSessionUserNotFound
+	} else if err != nil {
+		return e.Wrap("user lookup failed", http.StatusInternalServerError, err)
+	}
+
+	if user.DisabledAt.Valid {
+		return ErrAccountDisabled
+	}
+
+	if user.LoggedOutAt.Valid && tk.IssuedAt < user.LoggedOutAt.Time.Unix() {
+		return ErrSessionLoggedOut
+	}
+
+	if !containsAll(RolesForUser(user), tk.Roles) {
+		return ErrSessionRolesChanged
+	}
+
+	if tk.SessionID != 0 {
+		session, err := dl.GetSessionByID(tk.SessionID)
+		if err == datalayer.ErrNoData {
+			return ErrSessionLoggedOut
+		} else if err != nil {
+			return e.Wrap("session lookup failed", http.StatusInternalServerError, err)
+		}
+		if session.UserID != tk.UserID || session.RevokedAt.Valid {
+			return ErrSessionLoggedOut
+		}
+		return nil
 	}
 
-	signedAccessToken := jwt.NewWithClaims(jwt.GetSigningMethod("HS256"), accessToken)
-	apiTokenString, err := signedAccessToken.SignedString([]byte(os.Getenv("token_password")))
+	// Tokens issued before sessions were recorded.
+	if len(tk.FamilyID) == 0 {
+		return nil
+	}
+
+	revoked, err := dl.IsRefreshTokenFamilyRevoked(tk.FamilyID)
 	if err != nil {
-		return nil, err
+		return e.Wrap("session lookup failed", http.StatusInternalServerError, err)
+	} else if revoked {
+		return ErrSessionLoggedOut
 	}
 
-	token := &APITokenResponse{
-		ExpiresIn: expireDateTime,
-		APIToken: apiTokenString,
+	return nil
+}
+
+// newTokenID returns a random identifier suitable for the jti and token
+// family claims.
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
 	}
 
-	return token, nil
+	return hex.EncodeToString(b), nil
+}
+
+// NewSecret returns a random hex encoded secret for single use links.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// HashToken returns the digest under which opaque tokens are stored, so that
+// a leaked table does not leak usable tokens.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+var ErrChallengeInvalid = e.NewError("Two-factor challenge is invalid or has expired", nil, http.StatusForbidden)
+
+type ChallengeResponse struct {
+	ExpiresIn      int64  `json:"expiresIn"`
+	ChallengeToken string `json:"challengeToken"`
+}
+
+// CreateChallengeToken issues a short-lived token proving that the password
+// check passed.  It is exchanged, together with a second factor, for a
+// normal token pair.  Restore is set for users who are still deleted.
+func CreateChallengeToken(state *state.ServerState, userID int64, restore bool) (*ChallengeResponse, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	epochSecs := time.Now().Unix()
+	expireDateTime := epochSecs + ChallengeTokenLifeSpan
+	challengeToken := &JSONWebToken{
+		UserID:    userID,
+		TokenType: TokenTypeChallenge,
+		Restore:   restore,
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			ExpiresAt: expireDateTime,
+			IssuedAt:  epochSecs,
+		},
+	}
+
+	challengeTokenString, err := state.Keys.Sign(challengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChallengeResponse{
+		ExpiresIn:      expireDateTime,
+		ChallengeToken: challengeTokenString,
+	}, nil
+}
+
+// ParseChallengeToken verifies a challenge token and returns its claims.
+// Challenges to restore a deleted user are validated by the caller once the
+// user has been restored.
+func ParseChallengeToken(state *state.ServerState, rawToken string) (*JSONWebToken, error) {
+	tk := new(JSONWebToken)
+	token, err := jwt.ParseWithClaims(rawToken, tk, state.Keys.Keyfunc)
+	if err != nil || !token.Valid {
+		return nil, ErrChallengeInvalid
+	}
+
+	if tk.TokenType != TokenTypeChallenge {
+		return nil, ErrChallengeInvalid
+	}
+
+	if !tk.Restore {
+		err = ValidateSession(state, tk)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tk, nil
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// Browsers opt into cookie authentication by sending AuthModeHeader with
+// AuthModeCookie on login.  Tokens are then kept in HttpOnly cookies, out of
+// reach of scripts, and state-changing requests must echo the CSRF cookie in
+// CSRFHeader.
+const (
+	AuthModeHeader     = "X-Auth-Mode"
+	AuthModeCookie     = "cookie"
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	CSRFCookie         = "csrf_token"
+	CSRFHeader         = "X-CSRF-Token"
+)
+
+const (
+	accessTokenCookiePath  = "/api/"
+	refreshTokenCookiePath = "/api/auth/refresh"
+)
+
+var ErrCSRFTokenInvalid = e.NewError("Missing or invalid CSRF token", nil, http.StatusForbidden)
+
+// WantsCookies reports whether the client asked for cookie authentication.
+func WantsCookies(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get(AuthModeHeader), AuthModeCookie)
+}
+
+// SetSessionCookies stores a token pair in cookies along with a new CSRF
+// token.
+func SetSessionCookies(w http.ResponseWriter, state *state.ServerState, token *TokenResponse) error {
+	csrfToken, err := NewSecret()
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, sessionCookie(state, AccessTokenCookie, token.AccessToken, accessTokenCookiePath, AccessTokenLifeSpan, true))
+	http.SetCookie(w, sessionCookie(state, RefreshTokenCookie, token.RefreshToken, refreshTokenCookiePath, RefreshTokenLifeSpan, true))
+	// The CSRF token is readable by the SPA so that it can echo it back.
+	http.SetCookie(w, sessionCookie(state, CSRFCookie, csrfToken, "/", RefreshTokenLifeSpan, false))
+
+	return nil
+}
+
+// ClearSessionCookies removes the cookies set by SetSessionCookies.
+func ClearSessionCookies(w http.ResponseWriter, state *state.ServerState) {
+	http.SetCookie(w, sessionCookie(state, AccessTokenCookie, "", accessTokenCookiePath, -1, true))
+	http.SetCookie(w, sessionCookie(state, RefreshTokenCookie, "", refreshTokenCookiePath, -1, true))
+	http.SetCookie(w, sessionCookie(state, CSRFCookie, "", "/", -1, false))
+}
+
+func sessionCookie(state *state.ServerState, name, value, path string, maxAge int, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   maxAge,
+		HttpOnly: httpOnly,
+		// Plain http is only used in development.
+		Secure:   !strings.HasPrefix(state.URL, "http://"),
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+// CheckCSRF verifies the double-submitted CSRF token of a cookie
+// authenticated request.  Safe methods are not checked.
+func CheckCSRF(r *http.Request) error {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+
+	cookie, err := r.Cookie(CSRFCookie)
+	if err != nil || len(cookie.Value) == 0 {
+		return ErrCSRFTokenInvalid
+	}
+
+	header := r.Header.Get(CSRFHeader)
+	if subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) != 1 {
+		return ErrCSRFTokenInvalid
+	}
+
+	return nil
+}
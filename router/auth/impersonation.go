@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// ImpersonatedByHeader is set on every response to a request made with an
+// impersonation token and carries the ID of the administrator.
+const ImpersonatedByHeader = "X-Impersonated-By"
+
+var (
+	ErrImpersonationForbidden = e.NewError("This action is not allowed while impersonating a user", nil, http.StatusForbidden)
+	ErrImpersonationEnded     = e.NewError("Impersonation has ended", nil, http.StatusForbidden)
+)
+
+type ImpersonationResponse struct {
+	UserID      int64  `json:"userID"`
+	ExpiresIn   int64  `json:"expiresIn"`
+	AccessToken string `json:"accessToken"`
+}
+
+// CreateImpersonationToken issues a short-lived access token that acts as
+// the user on behalf of an administrator.  There is no refresh token, the
+// administrator asks for a new token once it expires.
+func CreateImpersonationToken(state *state.ServerState, actorID int64, user *datalayer.User) (*ImpersonationResponse, error) {
+	epochSecs := time.Now().Unix()
+	expireDateTime := epochSecs + ImpersonationTokenLifeSpan
+	impersonationToken := &JSONWebToken{
+		UserID:    user.ID,
+		ActorID:   actorID,
+		TokenType: TokenTypeImpersonation,
+		Roles:     RolesForUser(user),
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: expireDateTime,
+			IssuedAt:  epochSecs,
+		},
+	}
+
+	accessTokenString, err := state.Keys.Sign(impersonationToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ImpersonationResponse{
+		UserID:      user.ID,
+		ExpiresIn:   expireDateTime,
+		AccessToken: accessTokenString,
+	}, nil
+}
+
+// IsImpersonationToken reports whether the token was issued to an
+// administrator impersonating a user.
+func IsImpersonationToken(tk *JSONWebToken) bool {
+	return tk.TokenType == TokenTypeImpersonation && tk.ActorID != 0
+}
+
+// ValidateImpersonation checks the session of the impersonated user and that
+// the administrator is still allowed to impersonate.  Logging the
+// administrator out of all sessions ends their impersonations too.
+func ValidateImpersonation(state *state.ServerState, tk *JSONWebToken) error {
+	err := ValidateSession(state, tk)
+	if err != nil {
+		return err
+	}
+
+	actor, err := state.DataLayer.GetUserByID(tk.ActorID)
+	if err == datalayer.ErrNoData {
+		return ErrImpersonationEnded
+	} else if err != nil {
+		return e.Wrap("user lookup failed", http.StatusInternalServerError, err)
+	}
+
+	if actor.DisabledAt.Valid || (actor.LoggedOutAt.Valid && tk.IssuedAt < actor.LoggedOutAt.Time.Unix()) {
+		return ErrImpersonationEnded
+	}
+
+	if CheckRoles(RolesForUser(actor), []string{RoleAdmin}) != nil {
+		return ErrImpersonationEnded
+	}
+
+	return nil
+}
+
+// AuditImpersonation records a request made while impersonating a user.  The
+// response has been sent by then, so failures are only logged.
+func AuditImpersonation(state *state.ServerState, principal *Principal, r *http.Request, statusCode int) {
+	audit := &datalayer.ImpersonationAudit{
+		ActorID:    principal.ActorID,
+		UserID:     principal.UserID,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		StatusCode: statusCode,
+		IPAddress:  ClientIP(r),
+	}
+
+	_, err := state.DataLayer.CreateImpersonationAudit(audit)
+	if err != nil {
+		state.Logger.Printf("failed to audit request %s %s by administrator %d impersonating user %d: %v",
+			audit.Method, audit.Path, audit.ActorID, audit.UserID, err)
+	}
+}
@@ -0,0 +1,96 @@
+package keys
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+const (
+	// EncryptionKeySize is the size of SIGNING_KEY_ENCRYPTION_KEY once
+	// decoded, selecting AES-256.
+	EncryptionKeySize = 32
+	// encryptedPrefix marks a secret sealed with the encryption key.  Secrets
+	// without it were stored before encryption was configured.
+	encryptedPrefix = "aes-gcm:"
+)
+
+// Seal encrypts a secret stored outside the key store, such as the shared
+// secret of a request signing key, in the same way as private keys.
+func (k *KeyStore) Seal(kid string, secret []byte) (string, error) {
+	return sealSecret(k.config.EncryptionKey, kid, secret)
+}
+
+// Open returns the secret stored by Seal.
+func (k *KeyStore) Open(kid, stored string) ([]byte, error) {
+	return openSecret(k.config.EncryptionKey, kid, stored)
+}
+
+// sealSecret encrypts a secret, e.g. a PEM encoded private key, with AES-GCM,
+// binding it to its key ID so that it cannot be moved to another row.
+// Without an encryption key the secret is returned as is.
+func sealSecret(encryptionKey []byte, kid string, secret []byte) (string, error) {
+	if len(encryptionKey) == 0 {
+		return string(secret), nil
+	}
+
+	gcm, err := newGCM(encryptionKey)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, secret, []byte(kid))
+
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openSecret returns the secret stored by sealSecret.
+func openSecret(encryptionKey []byte, kid, stored string) ([]byte, error) {
+	if !strings.HasPrefix(stored, encryptedPrefix) {
+		return []byte(stored), nil
+	}
+
+	if len(encryptionKey) == 0 {
+		return nil, fmt.Errorf("signing key %s is encrypted but SIGNING_KEY_ENCRYPTION_KEY is not set", kid)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("signing key %s could not be decoded: %w", kid, err)
+	}
+
+	gcm, err := newGCM(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("signing key %s is truncated", kid)
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	secret, err := gcm.Open(nil, nonce, ciphertext, []byte(kid))
+	if err != nil {
+		return nil, fmt.Errorf("signing key %s could not be decrypted: %w", kid, err)
+	}
+
+	return secret, nil
+}
+
+func newGCM(encryptionKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,409 @@
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/donohutcheon/gowebserver/datalayer"
+)
+
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+	AlgorithmEdDSA = "EdDSA"
+	// AlgorithmHS256 signs tokens with the shared token_password secret.  It
+	// is only kept for migrating existing deployments.
+	AlgorithmHS256 = "HS256"
+)
+
+const (
+	DefaultRotationPeriod     = 30 * 24 * time.Hour
+	DefaultVerificationPeriod = 365 * 24 * time.Hour
+	reloadInterval            = time.Minute
+)
+
+var (
+	ErrUnknownKey       = errors.New("token signing key is not recognised")
+	ErrAlgorithmInvalid = errors.New("token signing algorithm does not match key")
+)
+
+type Config struct {
+	// Algorithm used to sign new tokens.
+	Algorithm string
+	// LegacySecret is the shared secret used in HS256 mode.
+	LegacySecret string
+	// AcceptLegacy allows HS256 tokens without a key ID to be verified while
+	// signing with an asymmetric algorithm, so that sessions survive the
+	// migration.
+	AcceptLegacy bool
+	// RotationPeriod is how long a key is used for signing before a new key
+	// replaces it.
+	RotationPeriod time.Duration
+	// VerificationPeriod is how long a key keeps verifying tokens after it
+	// stops signing.  It must outlive the longest token lifespan.
+	VerificationPeriod time.Duration
+	// EncryptionKey encrypts private keys before they are stored.  Without it
+	// private keys are stored as plaintext PEM.
+	EncryptionKey []byte
+}
+
+// ConfigFromEnv reads the signing configuration from JWT_SIGNING_ALG,
+// JWT_KEY_ROTATION_PERIOD, JWT_KEY_VERIFICATION_PERIOD,
+// JWT_ACCEPT_LEGACY_TOKENS, SIGNING_KEY_ENCRYPTION_KEY and token_password.
+func ConfigFromEnv() (Config, error) {
+	config := Config{
+		Algorithm:          AlgorithmRS256,
+		LegacySecret:       os.Getenv("token_password"),
+		AcceptLegacy:       os.Getenv("JWT_ACCEPT_LEGACY_TOKENS") == "true",
+		RotationPeriod:     DefaultRotationPeriod,
+		VerificationPeriod: DefaultVerificationPeriod,
+	}
+
+	if alg := os.Getenv("JWT_SIGNING_ALG"); len(alg) > 0 {
+		config.Algorithm = alg
+	}
+
+	if period := os.Getenv("JWT_KEY_ROTATION_PERIOD"); len(period) > 0 {
+		d, err := time.ParseDuration(period)
+		if err != nil {
+			return config, fmt.Errorf("invalid JWT_KEY_ROTATION_PERIOD: %w", err)
+		}
+		config.RotationPeriod = d
+	}
+
+	if period := os.Getenv("JWT_KEY_VERIFICATION_PERIOD"); len(period) > 0 {
+		d, err := time.ParseDuration(period)
+		if err != nil {
+			return config, fmt.Errorf("invalid JWT_KEY_VERIFICATION_PERIOD: %w", err)
+		}
+		config.VerificationPeriod = d
+	}
+
+	if encryptionKey := os.Getenv("SIGNING_KEY_ENCRYPTION_KEY"); len(encryptionKey) > 0 {
+		b, err := base64.StdEncoding.DecodeString(encryptionKey)
+		if err != nil {
+			return config, fmt.Errorf("invalid SIGNING_KEY_ENCRYPTION_KEY: %w", err)
+		}
+		if len(b) != EncryptionKeySize {
+			return config, fmt.Errorf("invalid SIGNING_KEY_ENCRYPTION_KEY: must be %d bytes encoded as base64",
+				EncryptionKeySize)
+		}
+		config.EncryptionKey = b
+	}
+
+	return config, nil
+}
+
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	private   interface{}
+	public    interface{}
+}
+
+// KeyStore holds the keys used to sign and verify tokens.  Keys are persisted
+// through the datalayer so that every instance of the server shares them.
+type KeyStore struct {
+	dl         datalayer.DataLayer
+	config     Config
+	mutex      sync.RWMutex
+	keys       map[string]*Key
+	current    *Key
+	lastReload time.Time
+}
+
+func New(dl datalayer.DataLayer, config Config) (*KeyStore, error) {
+	switch config.Algorithm {
+	case AlgorithmRS256, AlgorithmES256, AlgorithmEdDSA, AlgorithmHS256:
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %s", config.Algorithm)
+	}
+
+	k := &KeyStore{
+		dl:     dl,
+		config: config,
+		keys:   make(map[string]*Key),
+	}
+
+	err := k.Refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// Algorithm returns the algorithm used to sign new tokens.
+func (k *KeyStore) Algorithm() string {
+	return k.config.Algorithm
+}
+
+// RotationPeriod returns how long a key is used for signing.
+func (k *KeyStore) RotationPeriod() time.Duration {
+	return k.config.RotationPeriod
+}
+
+// Sign signs the claims with the current key and sets the kid header.
+func (k *KeyStore) Sign(claims jwt.Claims) (string, error) {
+	if k.config.Algorithm == AlgorithmHS256 {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString([]byte(k.config.LegacySecret))
+	}
+
+	k.mutex.RLock()
+	current := k.current
+	k.mutex.RUnlock()
+	if current == nil {
+		return "", ErrUnknownKey
+	}
+
+	token := jwt.NewWithClaims(current.Method, claims)
+	token.Header["kid"] = current.ID
+
+	return token.SignedString(current.private)
+}
+
+// Keyfunc resolves the verification key of a token for jwt.Parse.
+func (k *KeyStore) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if len(kid) == 0 {
+		if !k.acceptsLegacy() || token.Method != jwt.SigningMethodHS256 {
+			return nil, ErrUnknownKey
+		}
+		return []byte(k.config.LegacySecret), nil
+	}
+
+	key, ok := k.lookup(kid)
+	if !ok {
+		// Another instance may have rotated in a key we have not seen yet.
+		err := k.reloadIfStale()
+		if err != nil {
+			return nil, err
+		}
+
+		key, ok = k.lookup(kid)
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, ErrAlgorithmInvalid
+	}
+
+	return key.public, nil
+}
+
+// VerificationKeys returns every key currently accepted for verification.
+func (k *KeyStore) VerificationKeys() []*Key {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	keys := make([]*Key, 0, len(k.keys))
+	for _, key := range k.keys {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// Refresh reloads the keys from the datalayer and rotates in a new signing
+// key when the current one is older than the rotation period.
+func (k *KeyStore) Refresh() error {
+	err := k.reload()
+	if err != nil {
+		return err
+	}
+
+	if k.config.Algorithm == AlgorithmHS256 {
+		return nil
+	}
+
+	k.mutex.RLock()
+	current := k.current
+	k.mutex.RUnlock()
+	if current != nil && time.Since(current.CreatedAt) < k.config.RotationPeriod {
+		return nil
+	}
+
+	return k.Rotate()
+}
+
+// Rotate generates a new signing key.  Previous keys remain available for
+// verification until they expire.
+func (k *KeyStore) Rotate() error {
+	if k.config.Algorithm == AlgorithmHS256 {
+		return nil
+	}
+
+	privateKey, err := generateKey(k.config.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	kid, err := newKeyID()
+	if err != nil {
+		return err
+	}
+
+	stored, err := sealSecret(k.config.EncryptionKey, kid, privatePEM)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(k.config.RotationPeriod + k.config.VerificationPeriod)
+	_, err = k.dl.CreateSigningKey(kid, k.config.Algorithm, stored, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	return k.reload()
+}
+
+func (k *KeyStore) acceptsLegacy() bool {
+	if len(k.config.LegacySecret) == 0 {
+		return false
+	}
+
+	return k.config.Algorithm == AlgorithmHS256 || k.config.AcceptLegacy
+}
+
+func (k *KeyStore) lookup(kid string) (*Key, bool) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+func (k *KeyStore) reloadIfStale() error {
+	k.mutex.RLock()
+	stale := time.Since(k.lastReload) > reloadInterval
+	k.mutex.RUnlock()
+	if !stale {
+		return nil
+	}
+
+	return k.reload()
+}
+
+func (k *KeyStore) reload() error {
+	dbKeys, err := k.dl.GetActiveSigningKeys()
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*Key)
+	var current *Key
+	for _, dbKey := range dbKeys {
+		key, err := parseKey(dbKey, k.config.EncryptionKey)
+		if err != nil {
+			return err
+		}
+		keys[key.ID] = key
+
+		if dbKey.Algorithm != k.config.Algorithm {
+			continue
+		}
+		if current == nil || key.CreatedAt.After(current.CreatedAt) {
+			current = key
+		}
+	}
+
+	k.mutex.Lock()
+	k.keys = keys
+	k.current = current
+	k.lastReload = time.Now()
+	k.mutex.Unlock()
+
+	return nil
+}
+
+func parseKey(dbKey *datalayer.SigningKey, encryptionKey []byte) (*Key, error) {
+	privatePEM, err := openSecret(encryptionKey, dbKey.KID, dbKey.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(privatePEM)
+	if block == nil {
+		return nil, fmt.Errorf("signing key %s is not PEM encoded", dbKey.KID)
+	}
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("signing key %s could not be parsed: %w", dbKey.KID, err)
+	}
+
+	key := &Key{
+		ID:        dbKey.KID,
+		CreatedAt: dbKey.CreatedAt.Time,
+		ExpiresAt: dbKey.ExpiresAt.Time,
+		private:   privateKey,
+	}
+
+	switch pk := privateKey.(type) {
+	case *rsa.PrivateKey:
+		key.Method = jwt.SigningMethodRS256
+		key.public = &pk.PublicKey
+	case *ecdsa.PrivateKey:
+		key.Method = jwt.SigningMethodES256
+		key.public = &pk.PublicKey
+	case ed25519.PrivateKey:
+		key.Method = EdDSA
+		key.public = pk.Public()
+	default:
+		return nil, fmt.Errorf("signing key %s has unsupported type %T", dbKey.KID, privateKey)
+	}
+
+	if key.Method.Alg() != dbKey.Algorithm {
+		return nil, fmt.Errorf("signing key %s does not match algorithm %s", dbKey.KID, dbKey.Algorithm)
+	}
+
+	return key, nil
+}
+
+func generateKey(algorithm string) (interface{}, error) {
+	switch algorithm {
+	case AlgorithmRS256:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmES256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgorithmEdDSA:
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		return privateKey, err
+	}
+
+	return nil, fmt.Errorf("unsupported signing algorithm %s", algorithm)
+}
+
+func newKeyID() (string, error) {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// Opaque OAuth tokens carry a prefix so they can be told apart from JWTs and
+// API tokens.
+const (
+	OAuthAccessTokenPrefix  = "gwoat_"
+	OAuthRefreshTokenPrefix = "gwort_"
+)
+
+const OAuthAccessTokenLifeSpan = 3600
+const OAuthRefreshTokenLifeSpan = 2592000
+const AuthorizationCodeLifeSpan = 60
+
+// Error codes of RFC 6749 section 5.2, RFC 7009 and the authorization
+// endpoint.
+const (
+	OAuthErrInvalidRequest       = "invalid_request"
+	OAuthErrInvalidClient        = "invalid_client"
+	OAuthErrInvalidGrant         = "invalid_grant"
+	OAuthErrUnauthorizedClient   = "unauthorized_client"
+	OAuthErrUnsupportedGrantType = "unsupported_grant_type"
+	OAuthErrInvalidScope         = "invalid_scope"
+	OAuthErrAccessDenied         = "access_denied"
+	OAuthErrServerError          = "server_error"
+)
+
+var ErrOAuthTokenInvalid = e.NewError("OAuth token is invalid or has expired", nil, http.StatusForbidden)
+
+// OAuthError is the error body the token, introspection and revocation
+// endpoints answer with, as OAuth client libraries expect it rather than the
+// usual response envelope.
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	StatusCode  int    `json:"-"`
+	Err         error  `json:"-"`
+}
+
+func NewOAuthError(code, description string) *OAuthError {
+	statusCode := http.StatusBadRequest
+	switch code {
+	case OAuthErrInvalidClient:
+		statusCode = http.StatusUnauthorized
+	case OAuthErrServerError:
+		statusCode = http.StatusInternalServerError
+	}
+
+	return &OAuthError{Code: code, Description: description, StatusCode: statusCode}
+}
+
+func WrapOAuthError(description string, err error) *OAuthError {
+	oauthErr := NewOAuthError(OAuthErrServerError, description)
+	oauthErr.Err = err
+	return oauthErr
+}
+
+func (o *OAuthError) Error() string {
+	if o.Err != nil {
+		return o.Code + " " + o.Description + " " + o.Err.Error()
+	}
+
+	return o.Code + " " + o.Description
+}
+
+// GenerateOAuthToken returns a new random token with the given prefix and the
+// hash that is persisted.  It is also used for client IDs, secrets and
+// authorization codes.
+func GenerateOAuthToken(prefix string) (token, tokenHash string, err error) {
+	b := make([]byte, 32)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", "", err
+	}
+
+	token = prefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+func IsOAuthToken(token string) bool {
+	return strings.HasPrefix(token, OAuthAccessTokenPrefix)
+}
+
+// SecretMatches compares a presented secret with a stored hash in constant
+// time.
+func SecretMatches(secret, secretHash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashToken(secret)), []byte(secretHash)) == 1
+}
+
+// VerifyCodeChallenge checks a PKCE code verifier against the S256 challenge
+// of RFC 7636.
+func VerifyCodeChallenge(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// AuthenticateOAuthToken resolves an OAuth access token presented as a bearer
+// token into the principal it acts for.
+func AuthenticateOAuthToken(state *state.ServerState, token string) (*Principal, error) {
+	dl := state.DataLayer
+
+	oauthToken, err := dl.GetOAuthTokenByAccessHash(HashToken(token))
+	if err == datalayer.ErrNoData {
+		return nil, ErrOAuthTokenInvalid
+	} else if err != nil {
+		return nil, e.Wrap("OAuth token lookup failed", http.StatusInternalServerError, err)
+	}
+
+	if oauthToken.RevokedAt.Valid || oauthToken.AccessExpiresAt.Time.Before(time.Now()) {
+		return nil, ErrOAuthTokenInvalid
+	}
+
+	user, err := dl.GetUserByID(oauthToken.UserID)
+	if err == datalayer.ErrNoData {
+		return nil, ErrSessionUserNotFound
+	} else if err != nil {
+		return nil, e.Wrap("user lookup failed", http.StatusInternalServerError, err)
+	}
+
+	if user.DisabledAt.Valid {
+		return nil, ErrAccountDisabled
+	}
+
+	if user.LoggedOutAt.Valid && oauthToken.CreatedAt.Time.Before(user.LoggedOutAt.Time) {
+		return nil, ErrSessionLoggedOut
+	}
+
+	principal := &Principal{
+		UserID:        oauthToken.UserID,
+		Roles:         RolesForUser(user),
+		Scopes:        SplitScopes(oauthToken.Scopes),
+		OAuthClientID: oauthToken.OAuthClientID,
+	}
+
+	return principal, nil
+}
@@ -0,0 +1,197 @@
+// Package passwords enforces the password policy: a minimum length, required
+// character classes, no reuse of the email address and no passwords known
+// from data breaches.
+package passwords
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+)
+
+const (
+	DefaultMinLength    = 8
+	DefaultBreachedList = "data/breached-passwords.txt"
+)
+
+// rangeLength is the length of the hash prefixes the breached list is
+// indexed by, as in the Pwned Passwords range API.
+const rangeLength = 5
+
+// minLocalPartLength keeps very short email local parts from ruling out
+// most passwords.
+const minLocalPartLength = 3
+
+type Config struct {
+	MinLength     int
+	RequireLower  bool
+	RequireUpper  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// BreachedList is a file of upper case SHA-1 hashes of breached
+	// passwords, one per line and optionally followed by ":count" like the
+	// Pwned Passwords downloads.  Empty disables the check.
+	BreachedList string
+}
+
+// ConfigFromEnv reads the configuration from PASSWORD_MIN_LENGTH,
+// PASSWORD_REQUIRE_LOWER, PASSWORD_REQUIRE_UPPER, PASSWORD_REQUIRE_DIGIT,
+// PASSWORD_REQUIRE_SYMBOL and PASSWORD_BREACHED_LIST.
+func ConfigFromEnv() (Config, error) {
+	config := Config{
+		MinLength:    DefaultMinLength,
+		BreachedList: DefaultBreachedList,
+	}
+
+	if s := os.Getenv("PASSWORD_MIN_LENGTH"); len(s) > 0 {
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return config, fmt.Errorf("invalid PASSWORD_MIN_LENGTH: %w", err)
+		}
+		config.MinLength = i
+	}
+
+	bools := map[string]*bool{
+		"PASSWORD_REQUIRE_LOWER":  &config.RequireLower,
+		"PASSWORD_REQUIRE_UPPER":  &config.RequireUpper,
+		"PASSWORD_REQUIRE_DIGIT":  &config.RequireDigit,
+		"PASSWORD_REQUIRE_SYMBOL": &config.RequireSymbol,
+	}
+	for name, value := range bools {
+		if s := os.Getenv(name); len(s) > 0 {
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return config, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			*value = b
+		}
+	}
+
+	if s, ok := os.LookupEnv("PASSWORD_BREACHED_LIST"); ok {
+		config.BreachedList = s
+	}
+
+	return config, nil
+}
+
+type Policy struct {
+	config Config
+	// breached maps hash prefixes to the set of hash suffixes in that range.
+	breached map[string]map[string]struct{}
+}
+
+// New loads the breached password list and returns the policy.
+func New(config Config) (*Policy, error) {
+	p := &Policy{
+		config:   config,
+		breached: make(map[string]map[string]struct{}),
+	}
+
+	if len(config.BreachedList) == 0 {
+		return p, nil
+	}
+
+	f, err := os.Open(config.BreachedList)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if len(entry) == 0 || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		hash := strings.ToUpper(strings.SplitN(entry, ":", 2)[0])
+		if len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("invalid hash on line %d of breached password list", line)
+		}
+
+		prefix, suffix := hash[:rangeLength], hash[rangeLength:]
+		if p.breached[prefix] == nil {
+			p.breached[prefix] = make(map[string]struct{})
+		}
+		p.breached[prefix][suffix] = struct{}{}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read breached password list: %w", err)
+	}
+
+	return p, nil
+}
+
+// Check returns a field error for every rule the password breaks.
+func (p *Policy) Check(email, password string) []types.ErrorField {
+	var fields []types.ErrorField
+	fail := func(message string) {
+		fields = append(fields, types.ErrorField{Name: "password", Message: message})
+	}
+
+	if len([]rune(password)) < p.config.MinLength {
+		fail(fmt.Sprintf("Password must be at least %d characters long", p.config.MinLength))
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	if p.config.RequireLower && !lower {
+		fail("Password must contain a lower case letter")
+	}
+	if p.config.RequireUpper && !upper {
+		fail("Password must contain an upper case letter")
+	}
+	if p.config.RequireDigit && !digit {
+		fail("Password must contain a digit")
+	}
+	if p.config.RequireSymbol && !symbol {
+		fail("Password must contain a symbol")
+	}
+
+	localPart := strings.ToLower(strings.SplitN(email, "@", 2)[0])
+	if len(localPart) >= minLocalPartLength && strings.Contains(strings.ToLower(password), localPart) {
+		fail("Password must not contain your email address")
+	}
+
+	if p.IsBreached(password) {
+		fail("Password has appeared in a data breach, choose another")
+	}
+
+	return fields
+}
+
+// IsBreached reports whether the password is on the breached password list.
+// Lookups go through the hash prefix ranges so that a remote range service
+// could stand in for the local list.
+func (p *Policy) IsBreached(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, ok := p.breached[hash[:rangeLength]]
+	if !ok {
+		return false
+	}
+
+	_, ok = suffixes[hash[rangeLength:]]
+	return ok
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"context"
+)
+
+// Principal identifies the caller of an authenticated request.
+type Principal struct {
+	UserID int64
+	// FamilyID is the refresh token family of a session and is empty for API
+	// tokens, as is SessionID.
+	FamilyID  string
+	SessionID int64
+	Roles     []string
+	// Scopes restricts API and OAuth tokens and signed requests.  It is nil
+	// for sessions, which are not scope restricted.
+	Scopes        []string
+	APITokenID    int64
+	OAuthClientID int64
+	SigningKeyID  int64
+	// ActorID is the administrator impersonating the user, if any.
+	ActorID int64
+}
+
+type contextKey int
+
+const principalKey contextKey = iota
+
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsImpersonated reports whether an administrator is acting as the user.
+func (p *Principal) IsImpersonated() bool {
+	return p.ActorID != 0
+}
+
+// NewContext returns a copy of ctx carrying the principal.
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, principal)
+}
+
+// PrincipalFromContext returns the principal set by the authentication
+// middleware, or nil on public routes.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey).(*Principal)
+	return principal
+}
@@ -0,0 +1,84 @@
+// Package replay stops signed requests from being replayed.  A request
+// carries the time it was signed, which must be within the clock skew of the
+// server clock, and a nonce which is only accepted once while that time is.
+package replay
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+)
+
+const DefaultClockSkew = 5 * time.Minute
+
+var (
+	ErrClockSkew = e.NewError("Request timestamp is outside the allowed clock skew", nil, http.StatusForbidden)
+	ErrReplayed  = e.NewError("Request nonce has already been used", nil, http.StatusForbidden)
+)
+
+// ClockSkewFromEnv reads the allowed clock skew from SIGNATURE_CLOCK_SKEW.
+func ClockSkewFromEnv() (time.Duration, error) {
+	s := os.Getenv("SIGNATURE_CLOCK_SKEW")
+	if len(s) == 0 {
+		return DefaultClockSkew, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid SIGNATURE_CLOCK_SKEW: %w", err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid SIGNATURE_CLOCK_SKEW: %s is not positive", s)
+	}
+
+	return d, nil
+}
+
+// Guard remembers the nonces seen in memory.  Nonces are forgotten once
+// their timestamp falls outside the clock skew, as the request would be
+// refused for its timestamp by then.  Each server instance has its own
+// guard.
+type Guard struct {
+	clockSkew time.Duration
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	nextPrune time.Time
+}
+
+func New(clockSkew time.Duration) *Guard {
+	return &Guard{
+		clockSkew: clockSkew,
+		seen:      make(map[string]time.Time),
+	}
+}
+
+// Check accepts a request signed at timestamp with a nonce, which is scoped
+// by the caller, e.g. to the signing key.
+func (g *Guard) Check(nonce string, timestamp, now time.Time) error {
+	if timestamp.Before(now.Add(-g.clockSkew)) || timestamp.After(now.Add(g.clockSkew)) {
+		return ErrClockSkew
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if now.After(g.nextPrune) {
+		for n, expiresAt := range g.seen {
+			if expiresAt.Before(now) {
+				delete(g.seen, n)
+			}
+		}
+		g.nextPrune = now.Add(g.clockSkew)
+	}
+
+	if expiresAt, ok := g.seen[nonce]; ok && !expiresAt.Before(now) {
+		return ErrReplayed
+	}
+	g.seen[nonce] = timestamp.Add(g.clockSkew)
+
+	return nil
+}
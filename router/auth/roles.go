@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"net/http"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/datalayer"
+)
+
+const (
+	RoleUser  = string(datalayer.UserRoleUser)
+	RoleAdmin = string(datalayer.UserRoleAdmin)
+)
+
+var (
+	ErrRoleMissing         = e.NewError("Insufficient role to access this resource", nil, http.StatusForbidden)
+	ErrSessionRolesChanged = e.NewError("Session roles have changed, please log in again", nil, http.StatusForbidden)
+)
+
+// RolesForUser expands the role persisted for a user into the roles it
+// grants.  Administrators are users too, and users without a role are
+// treated as plain users.
+func RolesForUser(user *datalayer.User) []string {
+	if user.Role.Valid && user.Role.String == RoleAdmin {
+		return []string{RoleAdmin, RoleUser}
+	}
+
+	return []string{RoleUser}
+}
+
+// CheckRoles verifies that the granted roles include at least one of the
+// required ones.
+func CheckRoles(granted, required []string) error {
+	if len(required) == 0 {
+		return nil
+	}
+
+	for _, r := range required {
+		for _, g := range granted {
+			if g == r {
+				return nil
+			}
+		}
+	}
+
+	return ErrRoleMissing
+}
+
+func containsAll(granted, claimed []string) bool {
+	for _, c := range claimed {
+		found := false
+		for _, g := range granted {
+			if g == c {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+)
+
+const (
+	ScopeProfileRead       = "profile:read"
+	ScopeProfileWrite      = "profile:write"
+	ScopeTransactionsRead  = "transactions:read"
+	ScopeTransactionsWrite = "transactions:write"
+	ScopeContactsRead      = "contacts:read"
+)
+
+var (
+	ErrScopeRouteNotAllowed = e.NewError("Token is not permitted to access this resource", nil, http.StatusForbidden)
+	ErrScopeMissing         = e.NewError("Token is missing a required scope", nil, http.StatusForbidden)
+)
+
+// Scopes lists every scope a token can be granted.
+func Scopes() []string {
+	return []string{
+		ScopeProfileRead,
+		ScopeProfileWrite,
+		ScopeTransactionsRead,
+		ScopeTransactionsWrite,
+		ScopeContactsRead,
+	}
+}
+
+func IsValidScope(scope string) bool {
+	for _, s := range Scopes() {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// JoinScopes and SplitScopes convert between a scope list and the space
+// delimited form used in storage.
+func JoinScopes(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+func SplitScopes(scopes string) []string {
+	return strings.Fields(scopes)
+}
+
+// CheckScopes verifies that the granted scopes cover the required ones.  A
+// route that declares no scopes cannot be accessed with a scoped token.
+func CheckScopes(granted, required []string) error {
+	if len(required) == 0 {
+		return ErrScopeRouteNotAllowed
+	}
+
+	for _, r := range required {
+		found := false
+		for _, g := range granted {
+			if g == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return ErrScopeMissing
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+const maxUserAgentLength = 512
+
+// Client describes the device a login or refresh came from.
+type Client struct {
+	UserAgent string
+	IP        string
+}
+
+type userAgentPattern struct {
+	token string
+	name  string
+}
+
+// Patterns are checked in order, so that e.g. Edge, which also claims to be
+// Chrome and Safari, is recognised first.
+var (
+	browserPatterns = []userAgentPattern{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+		{"okhttp/", "Android app"},
+		{"CFNetwork/", "iOS app"},
+	}
+	platformPatterns = []userAgentPattern{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"CrOS", "Chrome OS"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// ClientIP returns the address of the caller.  Behind a proxy, such as the
+// Heroku router, set TRUST_PROXY_HEADERS=true to use the address the proxy
+// appended to X-Forwarded-For instead.
+func ClientIP(r *http.Request) string {
+	if os.Getenv("TRUST_PROXY_HEADERS") == "true" {
+		forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+		ip := strings.TrimSpace(forwarded[len(forwarded)-1])
+		if len(ip) > 0 {
+			return ip
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// DeviceName approximates a human readable device name such as
+// "Firefox on Windows" from a user agent.
+func DeviceName(userAgent string) string {
+	browser := matchUserAgent(userAgent, browserPatterns)
+	platform := matchUserAgent(userAgent, platformPatterns)
+
+	switch {
+	case len(browser) > 0 && len(platform) > 0:
+		return browser + " on " + platform
+	case len(browser) > 0:
+		return browser
+	case len(platform) > 0:
+		return platform
+	}
+
+	return "Unknown device"
+}
+
+func matchUserAgent(userAgent string, patterns []userAgentPattern) string {
+	for _, pattern := range patterns {
+		if strings.Contains(userAgent, pattern.token) {
+			return pattern.name
+		}
+	}
+
+	return ""
+}
+
+// touchSession records a login or refresh of the session of a token family,
+// creating the session if the family has none yet, and returns its ID.
+func touchSession(state *state.ServerState, userID int64, familyID string, client Client) (int64, error) {
+	dl := state.DataLayer
+	userAgent := client.UserAgent
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	now := time.Now()
+
+	session, err := dl.GetSessionByFamilyID(familyID)
+	if err == nil {
+		err = dl.TouchSession(session.ID, userAgent, client.IP, DeviceName(userAgent), now)
+		if err != nil {
+			return 0, err
+		}
+		return session.ID, nil
+	} else if err != datalayer.ErrNoData {
+		return 0, err
+	}
+
+	// Families started before sessions were recorded get one on refresh.
+	session = &datalayer.Session{
+		UserID:     userID,
+		FamilyID:   familyID,
+		UserAgent:  userAgent,
+		IPAddress:  client.IP,
+		DeviceName: DeviceName(userAgent),
+	}
+	session.LastSeenAt.Time = now
+	session.LastSeenAt.Valid = true
+
+	return dl.CreateSession(session)
+}
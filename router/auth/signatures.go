@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// SignatureScheme is the Authorization scheme of signed requests, e.g.
+//
+//	Authorization: GW-HMAC-SHA256 KeyId=gwkey_..., Timestamp=1600000000, Nonce=..., Signature=...
+//
+// The signature is the hex encoded HMAC-SHA256, keyed by the secret of the
+// signing key, of the string returned by StringToSign.
+const SignatureScheme = "GW-HMAC-SHA256"
+
+// SigningKeyPrefix marks the IDs of request signing keys.
+const SigningKeyPrefix = "gwkey_"
+
+// SigningKeyLifeSpan is the longest a signing key can be valid for, in
+// seconds.
+const SigningKeyLifeSpan = 31536000
+
+// MaxSignedBodySize limits the body of a signed request, which is read into
+// memory to be digested.
+const MaxSignedBodySize = 1 << 20
+
+const maxNonceLength = 128
+
+var (
+	ErrSignatureMalformed = e.NewError("Request signature is malformed", nil, http.StatusForbidden)
+	ErrSignatureInvalid   = e.NewError("Request signature does not match", nil, http.StatusForbidden)
+	ErrSigningKeyUnknown  = e.NewError("Signing key is not recognised", nil, http.StatusForbidden)
+	ErrSigningKeyRevoked  = e.NewError("Signing key has been revoked", nil, http.StatusForbidden)
+	ErrSigningKeyExpired  = e.NewError("Signing key has expired", nil, http.StatusForbidden)
+	ErrSignedBodyTooLarge = e.NewError("Signed request body is too large", nil, http.StatusRequestEntityTooLarge)
+)
+
+// RequestSignature holds the parameters of a signed request's Authorization
+// header.
+type RequestSignature struct {
+	KeyID     string
+	Timestamp time.Time
+	Nonce     string
+	Signature string
+}
+
+// GenerateSigningKey returns a new key ID and the secret shared with the
+// client.
+func GenerateSigningKey() (keyID, secret string, err error) {
+	b := make([]byte, 16)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", "", err
+	}
+
+	secret, err = NewSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	return SigningKeyPrefix + hex.EncodeToString(b), secret, nil
+}
+
+func IsSignedRequest(authorization string) bool {
+	return strings.HasPrefix(authorization, SignatureScheme+" ")
+}
+
+// ParseSignature reads the parameters of a signed request's Authorization
+// header.  Every parameter must be given exactly once.
+func ParseSignature(authorization string) (*RequestSignature, error) {
+	if !IsSignedRequest(authorization) {
+		return nil, ErrSignatureMalformed
+	}
+
+	params := make(map[string]string)
+	for _, param := range strings.Split(strings.TrimPrefix(authorization, SignatureScheme+" "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) != 2 || len(kv[1]) == 0 {
+			return nil, ErrSignatureMalformed
+		}
+		if _, ok := params[kv[0]]; ok {
+			return nil, ErrSignatureMalformed
+		}
+		params[kv[0]] = kv[1]
+	}
+	if len(params) != 4 {
+		return nil, ErrSignatureMalformed
+	}
+
+	unix, err := strconv.ParseInt(params["Timestamp"], 10, 64)
+	if err != nil {
+		return nil, ErrSignatureMalformed
+	}
+
+	sig := &RequestSignature{
+		KeyID:     params["KeyId"],
+		Timestamp: time.Unix(unix, 0),
+		Nonce:     params["Nonce"],
+		Signature: params["Signature"],
+	}
+	if len(sig.KeyID) == 0 || len(sig.Nonce) == 0 || len(sig.Nonce) > maxNonceLength || len(sig.Signature) == 0 {
+		return nil, ErrSignatureMalformed
+	}
+
+	return sig, nil
+}
+
+// StringToSign returns the string a client signs, which covers the method,
+// the path and query, the digest of the body, the timestamp and the nonce.
+func StringToSign(method, requestURI string, timestamp time.Time, nonce string, body []byte) string {
+	digest := sha256.Sum256(body)
+	return strings.Join([]string{
+		SignatureScheme,
+		strconv.FormatInt(timestamp.Unix(), 10),
+		nonce,
+		method,
+		requestURI,
+		hex.EncodeToString(digest[:]),
+	}, "\n")
+}
+
+// SignRequest returns the hex encoded signature of stringToSign.
+func SignRequest(secret, stringToSign string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(stringToSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// readSignedBody reads the body so that it can be digested and puts it back
+// for the handler.
+func readSignedBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+
+	// One byte past the limit tells an oversized body apart.
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxSignedBodySize+1))
+	if err != nil {
+		return nil, e.Wrap("Failed to read request body", http.StatusBadRequest, err)
+	}
+	if len(body) > MaxSignedBodySize {
+		// Like http.MaxBytesReader, close the connection instead of reading
+		// the rest of the body.
+		w.Header().Set("Connection", "close")
+		return nil, ErrSignedBodyTooLarge
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	return body, nil
+}
+
+// AuthenticateSignedRequest verifies the signature of a request and resolves
+// it into the principal it acts for.  Nonces are only accepted once.
+func AuthenticateSignedRequest(state *state.ServerState, w http.ResponseWriter, r *http.Request) (*Principal, error) {
+	sig, err := ParseSignature(r.Header.Get("Authorization"))
+	if err != nil {
+		return nil, err
+	}
+
+	dl := state.DataLayer
+	key, err := dl.GetRequestSigningKeyByKeyID(sig.KeyID)
+	if err == datalayer.ErrNoData {
+		return nil, ErrSigningKeyUnknown
+	} else if err != nil {
+		return nil, e.Wrap("Signing key lookup failed", http.StatusInternalServerError, err)
+	}
+
+	body, err := readSignedBody(w, r)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := state.Keys.Open(key.KeyID, key.Secret)
+	if err != nil {
+		return nil, e.Wrap("Signing key could not be opened", http.StatusInternalServerError, err)
+	}
+
+	expected := SignRequest(string(secret), StringToSign(r.Method, r.URL.RequestURI(), sig.Timestamp, sig.Nonce, body))
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(sig.Signature))) {
+		return nil, ErrSignatureInvalid
+	}
+
+	if key.RevokedAt.Valid {
+		return nil, ErrSigningKeyRevoked
+	}
+
+	now := time.Now()
+	if key.ExpiresAt.Valid && key.ExpiresAt.Time.Before(now) {
+		return nil, ErrSigningKeyExpired
+	}
+
+	// Only signed requests reach the nonce cache, so that nonces cannot be
+	// used up by anyone without the secret.
+	err = state.Signatures.Check(key.KeyID+":"+sig.Nonce, sig.Timestamp, now)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := dl.GetUserByID(key.UserID)
+	if err == datalayer.ErrNoData {
+		return nil, ErrSessionUserNotFound
+	} else if err != nil {
+		return nil, e.Wrap("user lookup failed", http.StatusInternalServerError, err)
+	}
+
+	if user.DisabledAt.Valid {
+		return nil, ErrAccountDisabled
+	}
+
+	if user.LoggedOutAt.Valid && key.CreatedAt.Time.Before(user.LoggedOutAt.Time) {
+		return nil, ErrSessionLoggedOut
+	}
+
+	if !key.LastUsedAt.Valid || now.Sub(key.LastUsedAt.Time) > lastUsedResolution {
+		err = dl.SetRequestSigningKeyLastUsedAt(key.ID, now)
+		if err != nil {
+			state.Logger.Printf("failed to update last used time of signing key %d %s", key.ID, err.Error())
+		}
+	}
+
+	principal := &Principal{
+		UserID:       key.UserID,
+		Roles:        RolesForUser(user),
+		Scopes:       SplitScopes(key.Scopes),
+		SigningKeyID: key.ID,
+	}
+
+	return principal, nil
+}
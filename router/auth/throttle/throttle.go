@@ -0,0 +1,202 @@
+// Package throttle slows down and eventually locks out repeated failed
+// logins, both per account and per client IP address.
+package throttle
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/datalayer"
+)
+
+const (
+	KindAccount = "account"
+	KindIP      = "ip"
+)
+
+const (
+	DefaultFreeAttempts     = 3
+	DefaultIPFreeAttempts   = 10
+	DefaultBaseDelay        = time.Second
+	DefaultAccountThreshold = 10
+	DefaultIPThreshold      = 50
+	DefaultLockoutDuration  = 30 * time.Minute
+)
+
+const (
+	msgBackoff = "Too many failed login attempts, try again later"
+	msgLocked  = "Account is temporarily locked, check your email to unlock it"
+)
+
+type Config struct {
+	// FreeAttempts and IPFreeAttempts are the number of failures allowed
+	// before backoff starts.  Addresses get more leeway as they may be shared.
+	FreeAttempts   int
+	IPFreeAttempts int
+	// BaseDelay is the first backoff delay.  It doubles with every further
+	// failure up to the lockout duration.
+	BaseDelay time.Duration
+	// AccountThreshold and IPThreshold are the failures after which an
+	// account or address is locked out for LockoutDuration.
+	AccountThreshold int
+	IPThreshold      int
+	// LockoutDuration is also how long failures are remembered.
+	LockoutDuration time.Duration
+}
+
+// ConfigFromEnv reads the configuration from LOGIN_FREE_ATTEMPTS,
+// LOGIN_IP_FREE_ATTEMPTS, LOGIN_BACKOFF_BASE, LOGIN_LOCKOUT_THRESHOLD, LOGIN_IP_LOCKOUT_THRESHOLD and
+// LOGIN_LOCKOUT_DURATION.
+func ConfigFromEnv() (Config, error) {
+	config := Config{
+		FreeAttempts:     DefaultFreeAttempts,
+		IPFreeAttempts:   DefaultIPFreeAttempts,
+		BaseDelay:        DefaultBaseDelay,
+		AccountThreshold: DefaultAccountThreshold,
+		IPThreshold:      DefaultIPThreshold,
+		LockoutDuration:  DefaultLockoutDuration,
+	}
+
+	ints := map[string]*int{
+		"LOGIN_FREE_ATTEMPTS":        &config.FreeAttempts,
+		"LOGIN_IP_FREE_ATTEMPTS":     &config.IPFreeAttempts,
+		"LOGIN_LOCKOUT_THRESHOLD":    &config.AccountThreshold,
+		"LOGIN_IP_LOCKOUT_THRESHOLD": &config.IPThreshold,
+	}
+	for name, value := range ints {
+		if s := os.Getenv(name); len(s) > 0 {
+			i, err := strconv.Atoi(s)
+			if err != nil {
+				return config, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			*value = i
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"LOGIN_BACKOFF_BASE":     &config.BaseDelay,
+		"LOGIN_LOCKOUT_DURATION": &config.LockoutDuration,
+	}
+	for name, value := range durations {
+		if s := os.Getenv(name); len(s) > 0 {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return config, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			*value = d
+		}
+	}
+
+	return config, nil
+}
+
+type Throttle struct {
+	dl     datalayer.DataLayer
+	config Config
+}
+
+func New(dl datalayer.DataLayer, config Config) *Throttle {
+	return &Throttle{
+		dl:     dl,
+		config: config,
+	}
+}
+
+// Check returns an error carrying a Retry-After header while the key is
+// backing off or locked out.
+func (t *Throttle) Check(kind, key string) error {
+	throttle, err := t.dl.GetLoginThrottle(kind, key)
+	if err == datalayer.ErrNoData {
+		return nil
+	} else if err != nil {
+		return e.Wrap("Failed to query login attempts", http.StatusInternalServerError, err)
+	}
+
+	if !throttle.LockedUntil.Valid {
+		return nil
+	}
+
+	retryAfter := time.Until(throttle.LockedUntil.Time)
+	if retryAfter <= 0 {
+		return nil
+	}
+
+	message := msgBackoff
+	if kind == KindAccount && throttle.FailedAttempts >= t.config.AccountThreshold {
+		message = msgLocked
+	}
+
+	return lockedError(message, retryAfter)
+}
+
+// Fail records a failed attempt and reports whether it locked the key out.
+func (t *Throttle) Fail(kind, key string) (bool, error) {
+	now := time.Now()
+	throttle, err := t.dl.RecordLoginFailure(kind, key, now, now.Add(-t.config.LockoutDuration))
+	if err != nil {
+		return false, e.Wrap("Failed to record login attempt", http.StatusInternalServerError, err)
+	}
+
+	freeAttempts, threshold := t.config.FreeAttempts, t.config.AccountThreshold
+	if kind == KindIP {
+		freeAttempts, threshold = t.config.IPFreeAttempts, t.config.IPThreshold
+	}
+
+	delay, locked := t.delay(throttle.FailedAttempts, freeAttempts, threshold)
+	if delay == 0 {
+		return false, nil
+	}
+
+	err = t.dl.SetLoginThrottleLockedUntil(kind, key, now.Add(delay))
+	if err != nil {
+		return false, e.Wrap("Failed to record login attempt", http.StatusInternalServerError, err)
+	}
+
+	// Only the failure that crosses the threshold reports the lockout, so
+	// that callers notify the user once.
+	return locked && throttle.FailedAttempts == threshold, nil
+}
+
+// Reset forgets the failures of a key, e.g. after a successful login or an
+// unlock.
+func (t *Throttle) Reset(kind, key string) error {
+	err := t.dl.DeleteLoginThrottle(kind, key)
+	if err != nil {
+		return e.Wrap("Failed to reset login attempts", http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
+
+// delay returns how long to refuse attempts after the given number of
+// failures and whether that amounts to a lockout.
+func (t *Throttle) delay(failures, freeAttempts, threshold int) (time.Duration, bool) {
+	if failures >= threshold {
+		return t.config.LockoutDuration, true
+	}
+
+	if failures <= freeAttempts {
+		return 0, false
+	}
+
+	exponent := failures - freeAttempts - 1
+	delay := time.Duration(float64(t.config.BaseDelay) * math.Pow(2, float64(exponent)))
+	if delay <= 0 || delay > t.config.LockoutDuration {
+		delay = t.config.LockoutDuration
+	}
+
+	return delay, false
+}
+
+func lockedError(message string, retryAfter time.Duration) error {
+	err := e.NewError(message, nil, http.StatusTooManyRequests)
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	err.Header = http.Header{}
+	err.Header.Set("Retry-After", strconv.FormatInt(seconds, 10))
+	return err
+}
@@ -0,0 +1,317 @@
+// Package idempotency lets clients safely retry requests.  A request sent
+// with an Idempotency-Key header is handled once per user and key; retries
+// with the same key are answered with the stored response of the first
+// request instead of being handled again.
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	e "github.com/donohutcheon/gowebserver/controllers/errors"
+	"github.com/donohutcheon/gowebserver/controllers/response/types"
+	"github.com/donohutcheon/gowebserver/datalayer"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+const (
+	// Header carries the key chosen by the client.
+	Header = "Idempotency-Key"
+	// ReplayedHeader is set on responses replayed from a stored response.
+	ReplayedHeader = "Idempotent-Replayed"
+
+	DefaultWindow = 24 * time.Hour
+
+	// MaxKeyLength is the longest key accepted.
+	MaxKeyLength = 255
+	// MaxRequestSize limits the body of a request with a key, which is read
+	// into memory to be hashed.
+	MaxRequestSize = 16 << 20
+
+	// inProgressRetryAfter is the Retry-After sent while the first request
+	// is still being handled.
+	inProgressRetryAfter = 1
+)
+
+// unstoredHeaders describe the connection rather than the response, and are
+// not replayed.
+var unstoredHeaders = []string{"Connection", "Content-Length", "Date", "Transfer-Encoding"}
+
+var (
+	ErrInvalidKey = e.NewError("Invalid idempotency key", []types.ErrorField{
+		{
+			Name:    Header,
+			Message: fmt.Sprintf("must be 1 to %d printable ASCII characters", MaxKeyLength),
+			Direct:  true,
+		},
+	}, http.StatusBadRequest)
+	ErrKeyReused       = e.NewError("Idempotency key has already been used with a different request", nil, http.StatusUnprocessableEntity)
+	ErrRequestTooLarge = e.NewError("Request body is too large", nil, http.StatusRequestEntityTooLarge)
+	ErrInternal        = e.NewError("Internal server error", nil, http.StatusInternalServerError)
+)
+
+// WindowFromEnv reads how long keys are remembered from IDEMPOTENCY_WINDOW.
+func WindowFromEnv() (time.Duration, error) {
+	s := os.Getenv("IDEMPOTENCY_WINDOW")
+	if len(s) == 0 {
+		return DefaultWindow, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid IDEMPOTENCY_WINDOW: %w", err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid IDEMPOTENCY_WINDOW: %s is not positive", s)
+	}
+
+	return d, nil
+}
+
+// Middleware wraps a handler of an authenticated route so that requests with
+// an Idempotency-Key header are handled at most once per key within the
+// window.  Requests without the header are passed through.
+func Middleware(state *state.ServerState, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := r.Header[http.CanonicalHeaderKey(Header)]
+		principal := auth.PrincipalFromContext(r.Context())
+		if !ok || principal == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) != 1 || !validKey(key[0]) {
+			e.WriteError(w, ErrInvalidKey)
+			return
+		}
+
+		requestHash, err := hashRequest(w, r)
+		if err != nil {
+			e.WriteError(w, err)
+			return
+		}
+
+		claimed, stored, err := claim(state, principal.UserID, key[0], requestHash)
+		if err != nil {
+			e.WriteError(w, err)
+			return
+		}
+		if stored != nil {
+			replay(state, w, stored)
+			return
+		}
+
+		serve(state, claimed, next, w, r)
+	})
+}
+
+func validKey(key string) bool {
+	if len(key) == 0 || len(key) > MaxKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hashRequest digests the method, URI and body of the request, and puts the
+// body back for the handler.
+func hashRequest(w http.ResponseWriter, r *http.Request) (string, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		// One byte past the limit tells an oversized body apart.
+		body, err = ioutil.ReadAll(io.LimitReader(r.Body, MaxRequestSize+1))
+		if err != nil {
+			return "", e.Wrap("Failed to read request body", http.StatusBadRequest, err)
+		}
+		if len(body) > MaxRequestSize {
+			// Like http.MaxBytesReader, close the connection instead of
+			// reading the rest of the body.
+			w.Header().Set("Connection", "close")
+			return "", ErrRequestTooLarge
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	h := sha256.New()
+	h.Write([]byte(r.Method + "\n" + r.URL.RequestURI() + "\n"))
+	h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// claim takes the key for the request.  If the key was already taken within
+// the window, the stored response is returned instead, or an error if it
+// was taken by a different request or the first request is still being
+// handled.
+func claim(state *state.ServerState, userID int64, key, requestHash string) (*datalayer.IdempotencyKey, *datalayer.IdempotencyKey, error) {
+	dl := state.DataLayer
+	now := time.Now()
+
+	idempotencyKey := &datalayer.IdempotencyKey{
+		UserID:      userID,
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt: datalayer.JsonNullTime{
+			NullTime: sql.NullTime{
+				Time:  now.Add(state.IdempotencyWindow),
+				Valid: true,
+			},
+		},
+	}
+
+	// A key that expired but was not yet purged is taken over, so at most
+	// two attempts are needed.
+	for attempt := 0; attempt < 2; attempt++ {
+		id, err := dl.CreateIdempotencyKey(idempotencyKey)
+		if err == nil {
+			idempotencyKey.ID = id
+			return idempotencyKey, nil, nil
+		} else if err != datalayer.ErrDuplicate {
+			state.Logger.Printf("failed to create idempotency key %s", err.Error())
+			return nil, nil, ErrInternal
+		}
+
+		existing, err := dl.GetIdempotencyKey(userID, key)
+		if err == datalayer.ErrNoData {
+			continue
+		} else if err != nil {
+			state.Logger.Printf("failed to get idempotency key %s", err.Error())
+			return nil, nil, ErrInternal
+		}
+
+		if existing.ExpiresAt.Valid && existing.ExpiresAt.Time.Before(now) {
+			err = dl.DeleteIdempotencyKey(existing.ID)
+			if err != nil {
+				state.Logger.Printf("failed to delete idempotency key %d %s", existing.ID, err.Error())
+				return nil, nil, ErrInternal
+			}
+			continue
+		}
+
+		if existing.RequestHash != requestHash {
+			return nil, nil, ErrKeyReused
+		} else if !existing.StatusCode.Valid {
+			return nil, nil, inProgressError()
+		}
+
+		return nil, existing, nil
+	}
+
+	return nil, nil, inProgressError()
+}
+
+func inProgressError() error {
+	err := e.NewError("A request with this idempotency key is still in progress", nil, http.StatusConflict)
+	err.Header = http.Header{}
+	err.Header.Set("Retry-After", strconv.Itoa(inProgressRetryAfter))
+	return err
+}
+
+// serve handles the request that claimed the key and stores its response.
+// Server errors are not stored, and free the key for a retry, as does a
+// panic.
+func serve(state *state.ServerState, claimed *datalayer.IdempotencyKey, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	dl := state.DataLayer
+	recorder := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+
+	stored := false
+	defer func() {
+		if stored {
+			return
+		}
+		err := dl.DeleteIdempotencyKey(claimed.ID)
+		if err != nil {
+			state.Logger.Printf("failed to delete idempotency key %d %s", claimed.ID, err.Error())
+		}
+	}()
+
+	next.ServeHTTP(recorder, r)
+
+	if recorder.statusCode >= http.StatusInternalServerError {
+		return
+	}
+
+	header := recorder.header
+	if header == nil {
+		header = w.Header().Clone()
+	}
+	for _, name := range unstoredHeaders {
+		header.Del(name)
+	}
+	headers, err := json.Marshal(header)
+	if err != nil {
+		state.Logger.Printf("failed to encode idempotency key response headers %d %s", claimed.ID, err.Error())
+		return
+	}
+
+	err = dl.SetIdempotencyKeyResponse(claimed.ID, recorder.statusCode, string(headers), recorder.body.Bytes())
+	if err != nil {
+		state.Logger.Printf("failed to store idempotency key response %d %s", claimed.ID, err.Error())
+		return
+	}
+	stored = true
+}
+
+func replay(state *state.ServerState, w http.ResponseWriter, stored *datalayer.IdempotencyKey) {
+	var header http.Header
+	if stored.ResponseHeaders.Valid {
+		err := json.Unmarshal([]byte(stored.ResponseHeaders.String), &header)
+		if err != nil {
+			state.Logger.Printf("failed to decode idempotency key response headers %d %s", stored.ID, err.Error())
+			e.WriteError(w, ErrInternal)
+			return
+		}
+	}
+
+	for name, values := range header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(int(stored.StatusCode.Int64))
+	w.Write(stored.ResponseBody)
+}
+
+// responseRecorder passes the response through while keeping a copy of it.
+// The header is copied when it is sent, as later changes are not.
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	header      http.Header
+	body        bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(statusCode int) {
+	if !rec.wroteHeader {
+		rec.statusCode = statusCode
+		rec.wroteHeader = true
+		rec.header = rec.ResponseWriter.Header().Clone()
+	}
+	rec.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.wroteHeader = true
+		rec.header = rec.ResponseWriter.Header().Clone()
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
@@ -1,7 +1,6 @@
 package router
 
 import (
-	"context"
 	"fmt"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/donohutcheon/gowebserver/controllers/errors"
@@ -11,11 +10,13 @@ import (
 	"reflect"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/donohutcheon/gowebserver/controllers/response"
-	"github.com/donohutcheon/gowebserver/models/auth"
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/router/idempotency"
 	"github.com/donohutcheon/gowebserver/router/routes"
 	"github.com/donohutcheon/gowebserver/state"
 	"github.com/gorilla/mux"
@@ -107,7 +108,7 @@ func JwtAuthentication (next http.Handler, state *state.ServerState, registry ma
 		w.Header().Set("X-XSS-Protection", "1; mode=block")
 		w.Header().Set("X-Content-Type-Options", "nosniff")
 		if r.Header.Get("Access-Control-Request-Headers") != "" {
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Auth-Mode, X-CSRF-Token, Idempotency-Key")
 		}
 
 		if r.Method == http.MethodOptions {
@@ -123,6 +124,7 @@ func JwtAuthentication (next http.Handler, state *state.ServerState, registry ma
 
 		//check if request does not need authentication, serve the request if it doesn't need it
 		var isPublicMatch bool
+		var routeEntry routes.RouteEntry
 		err := state.Router.Walk(func (route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
 			pathTemplate, err := route.GetPathTemplate()
 			if err != nil {
@@ -148,6 +150,7 @@ func JwtAuthentication (next http.Handler, state *state.ServerState, registry ma
 					return nil
 				}
 				isPublicMatch = v.Public
+				routeEntry = v
 				return nil
 			}
 
@@ -165,7 +168,25 @@ func JwtAuthentication (next http.Handler, state *state.ServerState, registry ma
 			return
 		}
 
+		// Wrapped per request, as next is shared by all requests.
+		handler := next
+		if containsMethod(routeEntry.Idempotency, r.Method) {
+			handler = idempotency.Middleware(state, next)
+		}
+
 		tokenHeader := r.Header.Get("Authorization")
+		if tokenHeader == "" {
+			// Browsers using cookie authentication, which needs CSRF protection.
+			cookie, err := r.Cookie(auth.AccessTokenCookie)
+			if err == nil && len(cookie.Value) > 0 {
+				err = auth.CheckCSRF(r)
+				if err != nil {
+					errors.WriteError(w, err)
+					return
+				}
+				tokenHeader = "Bearer " + cookie.Value
+			}
+		}
 		if tokenHeader == "" {
 			resp := response.New(false, "Missing auth token")
 			w.WriteHeader(http.StatusForbidden)
@@ -174,6 +195,31 @@ func JwtAuthentication (next http.Handler, state *state.ServerState, registry ma
 			return
 		}
 
+		if auth.IsSignedRequest(tokenHeader) {
+			principal, err := auth.AuthenticateSignedRequest(state, w, r)
+			if err != nil {
+				errors.WriteError(w, err)
+				return
+			}
+
+			// Signed requests are scoped like API tokens.
+			err = auth.CheckScopes(principal.Scopes, routeEntry.Scopes[r.Method])
+			if err != nil {
+				errors.WriteError(w, err)
+				return
+			}
+
+			err = auth.CheckRoles(principal.Roles, routeEntry.Roles)
+			if err != nil {
+				errors.WriteError(w, err)
+				return
+			}
+
+			r = r.WithContext(auth.NewContext(r.Context(), principal))
+			handler.ServeHTTP(w, r)
+			return
+		}
+
 		splitted := strings.Split(tokenHeader, " ") //The token normally comes in format `Bearer {token-body}`, we check if the retrieved token matched this requirement
 		if len(splitted) != 2 {
 			resp := response.New(false, "Invalid/Malformed auth token")
@@ -184,11 +230,40 @@ func JwtAuthentication (next http.Handler, state *state.ServerState, registry ma
 		}
 
 		tokenPart := splitted[1] //Grab the token part, what we are truly interested in
+		if auth.IsAPIToken(tokenPart) || auth.IsOAuthToken(tokenPart) {
+			var principal *auth.Principal
+			if auth.IsAPIToken(tokenPart) {
+				principal, err = auth.AuthenticateAPIToken(state, tokenPart)
+			} else {
+				principal, err = auth.AuthenticateOAuthToken(state, tokenPart)
+			}
+			if err != nil {
+				errors.WriteError(w, err)
+				return
+			}
+
+			// API and OAuth tokens only reach the routes and methods their
+			// scopes allow.
+			err = auth.CheckScopes(principal.Scopes, routeEntry.Scopes[r.Method])
+			if err != nil {
+				errors.WriteError(w, err)
+				return
+			}
+
+			err = auth.CheckRoles(principal.Roles, routeEntry.Roles)
+			if err != nil {
+				errors.WriteError(w, err)
+				return
+			}
+
+			r = r.WithContext(auth.NewContext(r.Context(), principal))
+			handler.ServeHTTP(w, r)
+			return
+		}
+
 		tk := &auth.JSONWebToken{}
 
-		token, err := jwt.ParseWithClaims(tokenPart, tk, func(token *jwt.Token) (interface{}, error) {
-			return []byte(os.Getenv("token_password")), nil
-		})
+		token, err := jwt.ParseWithClaims(tokenPart, tk, state.Keys.Keyfunc)
 
 		if err != nil { //Malformed token, returns with http code 403 as usual
 			message := fmt.Sprintf("Token rejected, %s", err.Error())
@@ -207,14 +282,85 @@ func JwtAuthentication (next http.Handler, state *state.ServerState, registry ma
 			return
 		}
 
+		impersonating := auth.IsImpersonationToken(tk)
+		if !auth.IsAccessToken(tk) && !impersonating {
+			errors.WriteError(w, auth.ErrTokenTypeInvalid)
+			return
+		}
+
+		if impersonating {
+			err = auth.ValidateImpersonation(state, tk)
+		} else {
+			err = auth.ValidateSession(state, tk)
+		}
+		if err != nil {
+			errors.WriteError(w, err)
+			return
+		}
+
+		principal := &auth.Principal{
+			UserID:    tk.UserID,
+			FamilyID:  tk.FamilyID,
+			SessionID: tk.SessionID,
+			Roles:     tk.Roles,
+			ActorID:   tk.ActorID,
+		}
+		if len(principal.Roles) == 0 {
+			// Tokens issued before roles were added to the claims.
+			principal.Roles = []string{auth.RoleUser}
+		}
+
+		if impersonating {
+			// Every request made while impersonating is audited, including
+			// the refused ones.
+			recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+			defer func() {
+				auth.AuditImpersonation(state, principal, r, recorder.statusCode)
+			}()
+			w = recorder
+			w.Header().Set(auth.ImpersonatedByHeader, strconv.FormatInt(principal.ActorID, 10))
+			w.Header().Set("Access-Control-Expose-Headers", auth.ImpersonatedByHeader)
+
+			if containsMethod(routeEntry.NoImpersonation, r.Method) {
+				errors.WriteError(w, auth.ErrImpersonationForbidden)
+				return
+			}
+		}
+
+		err = auth.CheckRoles(principal.Roles, routeEntry.Roles)
+		if err != nil {
+			errors.WriteError(w, err)
+			return
+		}
+
 		//Everything went well, proceed with the request and set the caller to the user retrieved from the parsed token
 		fmt.Printf("User %d", tk.UserID) //Useful for monitoring
-		ctx := context.WithValue(r.Context(), "userID", tk.UserID)
-		r = r.WithContext(ctx)
-		next.ServeHTTP(w, r) //proceed in the middleware chain!
+		r = r.WithContext(auth.NewContext(r.Context(), principal))
+		handler.ServeHTTP(w, r) //proceed in the middleware chain!
 	})
 }
 
+// statusRecorder remembers the status code written to a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (s *statusRecorder) WriteHeader(statusCode int) {
+	s.statusCode = statusCode
+	s.ResponseWriter.WriteHeader(statusCode)
+}
+
+func containsMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
 // ServeHTTP inspects the URL path to locate a file within the static dir
 // on the SPA handler. If a file is found, it will be served. If not, the
 // file located at the index path on the SPA handler will be served. This
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/donohutcheon/gowebserver/controllers"
+	"github.com/donohutcheon/gowebserver/router/auth"
 	"github.com/donohutcheon/gowebserver/state"
 )
 
@@ -14,6 +15,18 @@ type RouteEntry struct {
 	Handler HandlerFunc
 	Methods []string
 	Public bool
+	// Scopes lists, per HTTP method, the scopes an API token needs to use the
+	// route.  API tokens are refused on methods without scopes.
+	Scopes map[string][]string
+	// Roles restricts the route to callers holding at least one of the roles.
+	// Routes without roles are open to every authenticated caller.
+	Roles []string
+	// NoImpersonation lists the HTTP methods refused to administrators
+	// impersonating a user, such as changing credentials or issuing tokens.
+	NoImpersonation []string
+	// Idempotency lists the HTTP methods on which an Idempotency-Key header
+	// makes retries replay the response of the first request.
+	Idempotency []string
 }
 
 func GetRouteRegistry() map[string]RouteEntry {
@@ -26,6 +39,11 @@ func GetRouteRegistry() map[string]RouteEntry {
 			Methods: []string{http.MethodGet},
 			Public:  true,
 		},
+		"/.well-known/jwks.json" : {
+			Handler: controllers.GetJWKS,
+			Methods: []string{http.MethodGet, http.MethodOptions},
+			Public:  true,
+		},
 		"/api/auth/sign-up" : {
 			Handler: controllers.CreateUser,
 			Methods: []string{http.MethodPost, http.MethodOptions},
@@ -33,34 +51,269 @@ func GetRouteRegistry() map[string]RouteEntry {
 		},
 		"/api/users/current" : {
 			Handler: controllers.GetCurrentUser,
-			Methods: []string{http.MethodGet, http.MethodOptions},
+			Methods: []string{http.MethodGet, http.MethodPatch, http.MethodOptions},
+			Scopes: map[string][]string{
+				http.MethodGet:   {auth.ScopeProfileRead},
+				http.MethodPatch: {auth.ScopeProfileWrite},
+			},
 		},
 		"/api/auth/login" : {
 			Handler: controllers.Authenticate,
 			Methods: []string{http.MethodPost, http.MethodOptions},
 			Public:  true,
 		},
+		"/api/auth/2fa/setup" : {
+			Handler: controllers.SetupTwoFactor,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			NoImpersonation: []string{http.MethodPost},
+		},
+		"/api/auth/2fa/verify" : {
+			Handler: controllers.VerifyTwoFactor,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			NoImpersonation: []string{http.MethodPost},
+		},
+		"/api/auth/2fa/disable" : {
+			Handler: controllers.DisableTwoFactor,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			NoImpersonation: []string{http.MethodPost},
+		},
+		"/api/auth/2fa/login" : {
+			Handler: controllers.TwoFactorLogin,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			Public:  true,
+		},
 		"/api/auth/api-token" : {
 			Handler: controllers.GetAPIToken,
 			Methods: []string{http.MethodGet, http.MethodOptions},
+			NoImpersonation: []string{http.MethodGet},
+		},
+		"/api/auth/api-tokens" : {
+			Handler: controllers.APITokens,
+			Methods: []string{http.MethodGet, http.MethodPost, http.MethodOptions},
+			NoImpersonation: []string{http.MethodPost},
+		},
+		"/api/auth/api-tokens/{id}" : {
+			Handler: controllers.RevokeAPIToken,
+			Methods: []string{http.MethodDelete, http.MethodOptions},
+			NoImpersonation: []string{http.MethodDelete},
+		},
+		"/api/auth/signing-keys" : {
+			Handler: controllers.RequestSigningKeys,
+			Methods: []string{http.MethodGet, http.MethodPost, http.MethodOptions},
+			NoImpersonation: []string{http.MethodPost},
+		},
+		"/api/auth/signing-keys/{id}" : {
+			Handler: controllers.RevokeRequestSigningKey,
+			Methods: []string{http.MethodDelete, http.MethodOptions},
+			NoImpersonation: []string{http.MethodDelete},
+		},
+		"/api/oauth/clients" : {
+			Handler: controllers.OAuthClients,
+			Methods: []string{http.MethodGet, http.MethodPost, http.MethodOptions},
+			NoImpersonation: []string{http.MethodPost},
+		},
+		"/api/oauth/clients/{id}" : {
+			Handler: controllers.DeleteOAuthClient,
+			Methods: []string{http.MethodDelete, http.MethodOptions},
+			NoImpersonation: []string{http.MethodDelete},
+		},
+		"/api/oauth/authorize" : {
+			Handler: controllers.OAuthAuthorize,
+			Methods: []string{http.MethodGet, http.MethodPost, http.MethodOptions},
+			NoImpersonation: []string{http.MethodPost},
+		},
+		"/api/oauth/token" : {
+			Handler: controllers.OAuthToken,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			Public:  true,
+		},
+		"/api/oauth/introspect" : {
+			Handler: controllers.OAuthIntrospect,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			Public:  true,
+		},
+		"/api/oauth/revoke" : {
+			Handler: controllers.OAuthRevoke,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			Public:  true,
 		},
 		"/api/auth/refresh" : {
 			Handler: controllers.RefreshToken,
 			Methods: []string{http.MethodPost, http.MethodOptions},
 			Public:  true,
 		},
+		"/api/auth/resend-confirmation" : {
+			Handler: controllers.ResendConfirmation,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			Public:  true,
+		},
+		"/api/auth/forgot-password" : {
+			Handler: controllers.ForgotPassword,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			Public:  true,
+		},
+		"/api/auth/reset-password" : {
+			Handler: controllers.ResetPassword,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			Public:  true,
+		},
+		"/api/auth/magic-link" : {
+			Handler: controllers.RequestMagicLink,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			Public:  true,
+		},
+		"/api/auth/magic-link/{token}" : {
+			Handler: controllers.MagicLinkLogin,
+			Methods: []string{http.MethodGet, http.MethodOptions},
+			Public:  true,
+		},
+		"/api/auth/oidc/{provider}/start" : {
+			Handler: controllers.OIDCStart,
+			Methods: []string{http.MethodGet, http.MethodOptions},
+			Public:  true,
+		},
+		"/api/auth/oidc/{provider}/link" : {
+			Handler: controllers.OIDCLink,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			NoImpersonation: []string{http.MethodPost},
+		},
+		"/api/auth/oidc/{provider}/callback" : {
+			Handler: controllers.OIDCCallback,
+			Methods: []string{http.MethodGet, http.MethodOptions},
+			Public:  true,
+		},
+		"/api/auth/unlock/{token}" : {
+			Handler: controllers.UnlockAccount,
+			Methods: []string{http.MethodGet, http.MethodOptions},
+			Public:  true,
+		},
+		"/api/auth/logout" : {
+			Handler: controllers.Logout,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			NoImpersonation: []string{http.MethodPost},
+		},
+		"/api/auth/logout-all" : {
+			Handler: controllers.LogoutAll,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			NoImpersonation: []string{http.MethodPost},
+		},
+		"/api/me/sessions" : {
+			Handler: controllers.GetSessions,
+			Methods: []string{http.MethodGet, http.MethodOptions},
+		},
+		"/api/me/sessions/{id}" : {
+			Handler: controllers.RevokeSession,
+			Methods: []string{http.MethodDelete, http.MethodOptions},
+			NoImpersonation: []string{http.MethodDelete},
+		},
 		"/api/card-transactions/new" : {
 			Handler: controllers.CreateCardTransaction,
 			Methods: []string{http.MethodPost, http.MethodOptions},
+			Scopes: map[string][]string{
+				http.MethodPost: {auth.ScopeTransactionsWrite},
+			},
+			Idempotency: []string{http.MethodPost},
 		},
 		"/api/me/card-transactions" : {
 			Handler: controllers.GetCardTransactions,
 			Methods: []string{http.MethodGet, http.MethodOptions},
+			Scopes: map[string][]string{
+				http.MethodGet: {auth.ScopeTransactionsRead},
+			},
+		},
+		"/api/me/card-transactions/{id:[0-9]+}" : {
+			Handler: controllers.CardTransaction,
+			Methods: []string{http.MethodGet, http.MethodPatch, http.MethodDelete, http.MethodOptions},
+			Scopes: map[string][]string{
+				http.MethodGet:    {auth.ScopeTransactionsRead},
+				http.MethodPatch:  {auth.ScopeTransactionsWrite},
+				http.MethodDelete: {auth.ScopeTransactionsWrite},
+			},
+		},
+		"/api/me/card-transactions/export" : {
+			Handler: controllers.ExportCardTransactions,
+			Methods: []string{http.MethodGet, http.MethodOptions},
+			Scopes: map[string][]string{
+				http.MethodGet: {auth.ScopeTransactionsRead},
+			},
+		},
+		"/api/me/card-transactions/import" : {
+			Handler: controllers.ImportCardTransactions,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			Scopes: map[string][]string{
+				http.MethodPost: {auth.ScopeTransactionsWrite},
+			},
+			Idempotency: []string{http.MethodPost},
 		},
 		"/api/users/confirm/{nonce}" : {
 			Handler: controllers.ConfirmUserSignUp,
 			Methods: []string{http.MethodGet, http.MethodOptions},
 			Public: true,
 		},
+		"/api/me" : {
+			Handler: controllers.DeleteCurrentUser,
+			Methods: []string{http.MethodDelete, http.MethodOptions},
+			NoImpersonation: []string{http.MethodDelete},
+		},
+		"/api/me/email" : {
+			Handler: controllers.ChangeEmail,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			NoImpersonation: []string{http.MethodPost},
+		},
+		"/api/users/confirm-email/{token}" : {
+			Handler: controllers.ConfirmEmailChange,
+			Methods: []string{http.MethodGet, http.MethodOptions},
+			Public: true,
+		},
+		"/api/admin/users" : {
+			Handler: controllers.AdminGetUsers,
+			Methods: []string{http.MethodGet, http.MethodOptions},
+			Roles:   []string{auth.RoleAdmin},
+		},
+		"/api/admin/users/{id}" : {
+			Handler: controllers.AdminGetUser,
+			Methods: []string{http.MethodGet, http.MethodOptions},
+			Roles:   []string{auth.RoleAdmin},
+		},
+		"/api/admin/users/{id}/confirm" : {
+			Handler: controllers.AdminConfirmUser,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			Roles:   []string{auth.RoleAdmin},
+		},
+		"/api/admin/users/{id}/disable" : {
+			Handler: controllers.AdminDisableUser,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			Roles:   []string{auth.RoleAdmin},
+		},
+		"/api/admin/users/{id}/enable" : {
+			Handler: controllers.AdminEnableUser,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			Roles:   []string{auth.RoleAdmin},
+		},
+		"/api/admin/users/{id}/role" : {
+			Handler: controllers.AdminSetUserRole,
+			Methods: []string{http.MethodPut, http.MethodOptions},
+			Roles:   []string{auth.RoleAdmin},
+		},
+		"/api/admin/users/{id}/password-reset" : {
+			Handler: controllers.AdminResetPassword,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			Roles:   []string{auth.RoleAdmin},
+		},
+		"/api/admin/users/{id}/resend-confirmation" : {
+			Handler: controllers.AdminResendConfirmation,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			Roles:   []string{auth.RoleAdmin},
+		},
+		"/api/admin/users/{id}/impersonate" : {
+			Handler: controllers.AdminImpersonateUser,
+			Methods: []string{http.MethodPost, http.MethodOptions},
+			Roles:   []string{auth.RoleAdmin},
+		},
+		"/api/admin/users/{id}/impersonations" : {
+			Handler: controllers.AdminGetImpersonationAudits,
+			Methods: []string{http.MethodGet, http.MethodOptions},
+			Roles:   []string{auth.RoleAdmin},
+		},
 	}
 }
\ No newline at end of file
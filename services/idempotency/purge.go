@@ -0,0 +1,41 @@
+package idempotency
+
+import (
+	"time"
+
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+const maxPurgeInterval = time.Hour
+
+// PurgeExpiredKeysForever periodically deletes the idempotency keys whose
+// window has passed.  Expired keys are ignored by the middleware anyway;
+// purging keeps the table from growing.
+func PurgeExpiredKeysForever(state *state.ServerState) {
+	logger := state.Logger
+
+	interval := state.IdempotencyWindow / 10
+	if interval > maxPurgeInterval || interval <= 0 {
+		interval = maxPurgeInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-state.Context.Done():
+			logger.Printf("PurgeExpiredKeysForever done.")
+			return
+		case <-ticker.C:
+			deleted, err := state.DataLayer.DeleteIdempotencyKeysExpiredBefore(time.Now())
+			if err != nil {
+				logger.Printf("failed to purge expired idempotency keys %s", err.Error())
+				continue
+			}
+			if deleted > 0 {
+				logger.Printf("Purged %d expired idempotency keys", deleted)
+			}
+		}
+	}
+}
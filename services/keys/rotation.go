@@ -0,0 +1,37 @@
+package keys
+
+import (
+	"time"
+
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+const maxCheckInterval = time.Hour
+
+// RotateKeysForever periodically reloads the signing keys, picking up keys
+// rotated by other instances, and rotates the signing key once it is due.
+func RotateKeysForever(state *state.ServerState) {
+	logger := state.Logger
+	keyStore := state.Keys
+
+	interval := keyStore.RotationPeriod() / 10
+	if interval > maxCheckInterval || interval <= 0 {
+		interval = maxCheckInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-state.Context.Done():
+			logger.Printf("RotateKeysForever done.")
+			return
+		case <-ticker.C:
+			err := keyStore.Refresh()
+			if err != nil {
+				logger.Printf("failed to refresh signing keys %s", err.Error())
+			}
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package services
 
 import (
+	"github.com/donohutcheon/gowebserver/services/idempotency"
+	"github.com/donohutcheon/gowebserver/services/keys"
 	"github.com/donohutcheon/gowebserver/services/users"
 	"github.com/donohutcheon/gowebserver/state"
 )
@@ -8,4 +10,24 @@ import (
 func StartServices(state *state.ServerState) {
 	state.ShutdownWG.Add(1)
 	go users.ConfirmUsersForever(state)
+
+	state.ShutdownWG.Add(1)
+	go users.ResetPasswordsForever(state)
+
+	state.ShutdownWG.Add(1)
+	go users.UnlockAccountsForever(state)
+
+	state.ShutdownWG.Add(1)
+	go users.ChangeEmailsForever(state)
+
+	state.ShutdownWG.Add(1)
+	go users.SendMagicLinksForever(state)
+
+	// Key rotation stops with the server context rather than the shutdown
+	// wait group, which is waited on before the context is cancelled.
+	go keys.RotateKeysForever(state)
+
+	// Like key rotation, purging stops with the server context.
+	go users.PurgeDeletedUsersForever(state)
+	go idempotency.PurgeExpiredKeysForever(state)
 }
\ No newline at end of file
@@ -0,0 +1,84 @@
+package users
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+// DefaultDeletionGracePeriod is how long a deleted account can be recovered
+// by logging in before it is purged.
+const DefaultDeletionGracePeriod = 30 * 24 * time.Hour
+
+const maxPurgeInterval = time.Hour
+
+// DeletionGracePeriodFromEnv reads the grace period from
+// ACCOUNT_DELETION_GRACE_PERIOD, falling back to the default.
+func DeletionGracePeriodFromEnv() (time.Duration, error) {
+	s := os.Getenv("ACCOUNT_DELETION_GRACE_PERIOD")
+	if len(s) == 0 {
+		return DefaultDeletionGracePeriod, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ACCOUNT_DELETION_GRACE_PERIOD: %w", err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid ACCOUNT_DELETION_GRACE_PERIOD: %s must be positive", s)
+	}
+
+	return d, nil
+}
+
+// PurgeDeletedUsersForever periodically purges the accounts whose deletion
+// grace period has passed.
+func PurgeDeletedUsersForever(state *state.ServerState) {
+	logger := state.Logger
+
+	interval := state.DeletionGracePeriod / 10
+	if interval > maxPurgeInterval || interval <= 0 {
+		interval = maxPurgeInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-state.Context.Done():
+			logger.Printf("PurgeDeletedUsersForever done.")
+			return
+		case <-ticker.C:
+			err := PurgeDeletedUsers(state)
+			if err != nil {
+				logger.Printf("failed to purge deleted users %s", err.Error())
+			}
+		}
+	}
+}
+
+// PurgeDeletedUsers permanently deletes the users, and all of their data,
+// that were deleted longer than the grace period ago.
+func PurgeDeletedUsers(state *state.ServerState) error {
+	logger := state.Logger
+	dl := state.DataLayer
+
+	users, err := dl.GetUsersDeletedBefore(time.Now().Add(-state.DeletionGracePeriod))
+	if err != nil {
+		return err
+	}
+
+	for _, u := range users {
+		err = dl.PurgeUserByID(u.ID)
+		if err != nil {
+			logger.Printf("failed to purge user %d %s", u.ID, err.Error())
+			continue
+		}
+		logger.Printf("Purged deleted user %d", u.ID)
+	}
+
+	return nil
+}
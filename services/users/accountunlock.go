@@ -0,0 +1,49 @@
+package users
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+const AccountUnlockLifeSpan = 24 * time.Hour
+
+func UnlockAccountsForever(state *state.ServerState) {
+	defer state.ShutdownWG.Done()
+	logger := state.Logger
+	dl := state.DataLayer
+
+	email := state.Providers.Email
+
+	for u := range state.Channels.UnlockAccounts {
+		logger.Printf("Received account lockout from channel for user %d", u.ID)
+		token, err := auth.NewSecret()
+		if err != nil {
+			logger.Printf("failed to generate unlock token for user %d %s", u.ID, err.Error())
+			continue
+		}
+
+		unlockID, err := dl.CreateAccountUnlock(auth.HashToken(token), u.ID, time.Now().Add(AccountUnlockLifeSpan))
+		if err != nil {
+			logger.Printf("failed to create account unlock for user %d %s", u.ID, err.Error())
+			continue
+		}
+
+		toList := []string{u.Email.String}
+		from := "noreply@someapp.com"
+		message := fmt.Sprintf("Hello %s,\n Your account has been temporarily locked after too many failed login attempts.  "+
+			"If this was you, unlock it now by following this link %s/api/auth/unlock/%s\n Otherwise consider resetting your password.",
+			u.Email.String, state.URL, token)
+
+		err = email.SendMail(toList, from, "Your account has been locked", message)
+		if err != nil {
+			logger.Printf("failed to send account unlock email for user %d %s", u.ID, err.Error())
+			continue
+		}
+
+		logger.Printf("Sent account unlock email for user %d unlockID %d", u.ID, unlockID)
+	}
+	logger.Printf("UnlockAccountsForever done.")
+}
@@ -1,16 +1,15 @@
 package users
 
 import (
+	"crypto/rand"
 	"fmt"
 	"github.com/donohutcheon/gowebserver/datalayer"
 	"github.com/donohutcheon/gowebserver/state"
-	"math/rand"
+	"math/big"
 	"time"
 )
 
-func init() {
-	rand.Seed(time.Now().Unix())
-}
+const SignUpConfirmationLifeSpan = 24 * time.Hour
 
 func ConfirmUsersForever(state *state.ServerState) {
 	defer state.ShutdownWG.Done()
@@ -20,18 +19,39 @@ func ConfirmUsersForever(state *state.ServerState) {
 	email := state.Providers.Email
 
 	for u := range state.Channels.ConfirmUsers {
-		logger.Printf("Received user to confirm from channel %s %s %s", u.Email.String, u.Password.String, u.State.String)
-		nonce := generateNonce(32)
+		logger.Printf("Received user to confirm from channel %d", u.ID)
+		nonce, err := generateNonce(32)
+		if err != nil {
+			logger.Printf("failed to generate sign-up confirmation nonce for user %s %s", u.Email.String, err.Error())
+			continue
+		}
+
+		err = dl.SetUserStateByID(u.ID, datalayer.UserStateProcessing)
+		if err != nil {
+			logger.Printf("failed to update user's state to %s %+v %s", u.Email.String, datalayer.UserStateProcessing, err.Error())
+			continue
+		}
+
+		// Only the latest link sent can be used.
+		err = dl.ExpireSignUpConfirmationsByUserID(u.ID)
+		if err != nil {
+			logger.Printf("failed to invalidate sign-up confirmations for user %s %s", u.Email.String, err.Error())
+			resetUserState(state, u)
+			continue
+		}
 
-		err := dl.SetUserStateByID(u.ID, datalayer.UserStateProcessing)
+		nonceID, err := dl.CreateSignUpConfirmation(nonce, u.ID, time.Now().Add(SignUpConfirmationLifeSpan))
 		if err != nil {
-			logger.Printf("failed to update user's state to %s %+v", u.Email.String, datalayer.UserStatePending)
+			logger.Printf("failed to create sign-up confirmation for user %s %s", u.Email.String, err.Error())
+			resetUserState(state, u)
 			continue
 		}
 
-		nonceID, err := dl.CreateSignUpConfirmation(nonce, u.ID)
+		// The user is pending before the mail goes out, as the link may be
+		// followed straight away.
+		err = dl.SetUserStateByID(u.ID, datalayer.UserStatePending)
 		if err != nil {
-			logger.Printf("failed to create sign-up confirmation for user %s %+v", u.Email.String, nonce)
+			logger.Printf("failed to update user's state to %s %+v %s", u.Email.String, datalayer.UserStatePending, err.Error())
 			continue
 		}
 
@@ -39,27 +59,38 @@ func ConfirmUsersForever(state *state.ServerState) {
 		toList := []string{to}
 		from := "noreply@someapp.com"
 		message := fmt.Sprintf("Hello %s,\n Welcome to this app - whatever it is.  Please confirm your registration by clicking on this link " +
-		"%s/api/users/confirm/%s", u.Email.String, state.URL, nonce)
+		"%s/api/users/confirm/%s\n The link expires in %v.", u.Email.String, state.URL, nonce, SignUpConfirmationLifeSpan)
 
-		email.SendMail(toList, from, "Welcome to this app!", message)
-
-		err = dl.SetUserStateByID(u.ID, datalayer.UserStatePending)
+		err = email.SendMail(toList, from, "Welcome to this app!", message)
 		if err != nil {
-			logger.Printf("failed to update user's state to %s %+v", u.Email.String, datalayer.UserStatePending)
+			logger.Printf("failed to send confirmation email for user %s %s", u.Email.String, err.Error())
 			continue
 		}
 
-		logger.Printf("Sent confirmation email for user %s with nonce %s nonceID %d", u.Email.String, nonce, nonceID)
+		logger.Printf("Sent confirmation email for user %s nonceID %d", u.Email.String, nonceID)
 	}
 	logger.Printf("ConfirmUsersForever done.")
 }
 
-func generateNonce(n int) string {
-	const chars = "abcdefghijklmnopqrstuvwxyz01234567890"
+// resetUserState returns a user to UNCONFIRMED when their confirmation could
+// not be prepared, so that it can be resent.
+func resetUserState(state *state.ServerState, u datalayer.User) {
+	err := state.DataLayer.SetUserStateByID(u.ID, datalayer.UserStateUnconfirmed)
+	if err != nil {
+		state.Logger.Printf("failed to update user's state to %s %+v %s", u.Email.String, datalayer.UserStateUnconfirmed, err.Error())
+	}
+}
+
+func generateNonce(n int) (string, error) {
+	const chars = "abcdefghijklmnopqrstuvwxyz0123456789"
 
 	b := make([]byte, n)
 	for i := range b {
-		b[i] = chars[rand.Intn(len(chars))]
+		r, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = chars[r.Int64()]
 	}
-	return string(b)
+	return string(b), nil
 }
@@ -0,0 +1,73 @@
+package users
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+const EmailChangeLifeSpan = 24 * time.Hour
+
+// ChangeEmailsForever sends the confirmation link for a requested email change
+// to the new address and lets the current address know about the request.
+func ChangeEmailsForever(state *state.ServerState) {
+	defer state.ShutdownWG.Done()
+	logger := state.Logger
+	dl := state.DataLayer
+
+	email := state.Providers.Email
+
+	for c := range state.Channels.ChangeEmails {
+		logger.Printf("Received email change request from channel for user %d", c.UserID)
+		u, err := dl.GetUserByID(c.UserID)
+		if err != nil {
+			logger.Printf("failed to query user %d for email change %s", c.UserID, err.Error())
+			continue
+		}
+
+		token, err := auth.NewSecret()
+		if err != nil {
+			logger.Printf("failed to generate email change token for user %d %s", u.ID, err.Error())
+			continue
+		}
+
+		// Only the latest request can be confirmed.
+		err = dl.ConsumeEmailChangesByUserID(u.ID)
+		if err != nil {
+			logger.Printf("failed to invalidate email changes for user %d %s", u.ID, err.Error())
+			continue
+		}
+
+		changeID, err := dl.CreateEmailChange(auth.HashToken(token), u.ID, c.NewEmail, time.Now().Add(EmailChangeLifeSpan))
+		if err != nil {
+			logger.Printf("failed to create email change for user %d %s", u.ID, err.Error())
+			continue
+		}
+
+		from := "noreply@someapp.com"
+		message := fmt.Sprintf("Hello %s,\n Please confirm your new email address by following this link "+
+			"%s/api/users/confirm-email/%s\n The link expires in %v.",
+			c.NewEmail, state.URL, token, EmailChangeLifeSpan)
+
+		err = email.SendMail([]string{c.NewEmail}, from, "Confirm your new email address", message)
+		if err != nil {
+			logger.Printf("failed to send email change confirmation for user %d %s", u.ID, err.Error())
+			continue
+		}
+
+		message = fmt.Sprintf("Hello %s,\n A change of your account's email address to %s was requested.  "+
+			"The address will only change once the new address has been confirmed.  If you did not request "+
+			"this change, reset your password.", u.Email.String, c.NewEmail)
+
+		err = email.SendMail([]string{u.Email.String}, from, "Your email address is being changed", message)
+		if err != nil {
+			logger.Printf("failed to send email change notification for user %d %s", u.ID, err.Error())
+			continue
+		}
+
+		logger.Printf("Sent email change confirmation for user %d changeID %d", u.ID, changeID)
+	}
+	logger.Printf("ChangeEmailsForever done.")
+}
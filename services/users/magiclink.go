@@ -0,0 +1,58 @@
+package users
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+const MagicLinkLifeSpan = 15 * time.Minute
+
+func SendMagicLinksForever(state *state.ServerState) {
+	defer state.ShutdownWG.Done()
+	logger := state.Logger
+	dl := state.DataLayer
+
+	email := state.Providers.Email
+
+	for u := range state.Channels.MagicLinks {
+		logger.Printf("Received magic link request from channel for user %d", u.ID)
+		token, err := auth.NewSecret()
+		if err != nil {
+			logger.Printf("failed to generate magic link token for user %d %s", u.ID, err.Error())
+			continue
+		}
+
+		// Only the latest link sent can be used.
+		err = dl.ExpireMagicLinksByUserID(u.ID)
+		if err != nil {
+			logger.Printf("failed to invalidate magic links for user %d %s", u.ID, err.Error())
+			continue
+		}
+
+		linkID, err := dl.CreateMagicLink(auth.HashToken(token), u.ID, time.Now().Add(MagicLinkLifeSpan))
+		if err != nil {
+			logger.Printf("failed to create magic link for user %d %s", u.ID, err.Error())
+			continue
+		}
+
+		// The link opens a page in the web app which asks the user to confirm,
+		// so that mail scanners following links do not use it up.
+		toList := []string{u.Email.String}
+		from := "noreply@someapp.com"
+		message := fmt.Sprintf("Hello %s,\n A login link was requested for your account.  Log in by following this link "+
+			"%s/magic-link?token=%s\n The link can be used once and expires in %v.  If you did not request it you can ignore this email.",
+			u.Email.String, state.URL, token, MagicLinkLifeSpan)
+
+		err = email.SendMail(toList, from, "Your login link", message)
+		if err != nil {
+			logger.Printf("failed to send magic link email for user %d %s", u.ID, err.Error())
+			continue
+		}
+
+		logger.Printf("Sent magic link email for user %d linkID %d", u.ID, linkID)
+	}
+	logger.Printf("SendMagicLinksForever done.")
+}
@@ -0,0 +1,56 @@
+package users
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/donohutcheon/gowebserver/router/auth"
+	"github.com/donohutcheon/gowebserver/state"
+)
+
+const PasswordResetLifeSpan = time.Hour
+
+func ResetPasswordsForever(state *state.ServerState) {
+	defer state.ShutdownWG.Done()
+	logger := state.Logger
+	dl := state.DataLayer
+
+	email := state.Providers.Email
+
+	for u := range state.Channels.ResetPasswords {
+		logger.Printf("Received password reset request from channel for user %d", u.ID)
+		token, err := auth.NewSecret()
+		if err != nil {
+			logger.Printf("failed to generate password reset token for user %d %s", u.ID, err.Error())
+			continue
+		}
+
+		// Only the latest link sent can be used.
+		err = dl.ExpirePasswordResetsByUserID(u.ID)
+		if err != nil {
+			logger.Printf("failed to invalidate password resets for user %d %s", u.ID, err.Error())
+			continue
+		}
+
+		resetID, err := dl.CreatePasswordReset(auth.HashToken(token), u.ID, time.Now().Add(PasswordResetLifeSpan))
+		if err != nil {
+			logger.Printf("failed to create password reset for user %d %s", u.ID, err.Error())
+			continue
+		}
+
+		toList := []string{u.Email.String}
+		from := "noreply@someapp.com"
+		message := fmt.Sprintf("Hello %s,\n A password reset was requested for your account.  Choose a new password by following this link "+
+			"%s/reset-password?token=%s\n The link expires in %v.  If you did not request a reset you can ignore this email.",
+			u.Email.String, state.URL, token, PasswordResetLifeSpan)
+
+		err = email.SendMail(toList, from, "Reset your password", message)
+		if err != nil {
+			logger.Printf("failed to send password reset email for user %d %s", u.ID, err.Error())
+			continue
+		}
+
+		logger.Printf("Sent password reset email for user %d resetID %d", u.ID, resetID)
+	}
+	logger.Printf("ResetPasswordsForever done.")
+}
@@ -7,9 +7,16 @@ import (
 	"github.com/donohutcheon/gowebserver/provider/mail"
 	"github.com/donohutcheon/gowebserver/provider/mail/mailtrap"
 	"github.com/donohutcheon/gowebserver/provider/mail/mockmail"
+	"github.com/donohutcheon/gowebserver/provider/oidc"
 	"github.com/donohutcheon/gowebserver/router"
+	"github.com/donohutcheon/gowebserver/router/auth/keys"
+	"github.com/donohutcheon/gowebserver/router/auth/passwords"
+	"github.com/donohutcheon/gowebserver/router/auth/replay"
+	"github.com/donohutcheon/gowebserver/router/idempotency"
+	"github.com/donohutcheon/gowebserver/router/auth/throttle"
 	"github.com/donohutcheon/gowebserver/server"
 	"github.com/donohutcheon/gowebserver/services"
+	"github.com/donohutcheon/gowebserver/services/users"
 	"github.com/donohutcheon/gowebserver/state"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/require"
@@ -42,23 +49,81 @@ var (
 )
 
 func newState(env environment, logger *log.Logger, mainThreadWG *sync.WaitGroup) (*state.ServerState, error) {
-	ctx, cancel := context.WithCancel(context.Background())
 	dataLayer, err := datalayer.New()
 	if err != nil {
 		return nil, err
 	}
 
+	keyConfig, err := keys.ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	keyStore, err := keys.New(dataLayer, keyConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	throttleConfig, err := throttle.ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	oidcConfigs, err := oidc.ConfigFromEnv(os.Getenv("URL"))
+	if err != nil {
+		return nil, err
+	}
+
+	passwordConfig, err := passwords.ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	passwordPolicy, err := passwords.New(passwordConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	deletionGracePeriod, err := users.DeletionGracePeriodFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	clockSkew, err := replay.ClockSkewFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	idempotencyWindow, err := idempotency.WindowFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
 	s := &state.ServerState{
 		URL: os.Getenv("URL"),
 		Channels: state.Channels{
 			ConfirmUsers: make(chan datalayer.User, 1),
+			ResetPasswords: make(chan datalayer.User, 1),
+			UnlockAccounts: make(chan datalayer.User, 1),
+			ChangeEmails: make(chan datalayer.EmailChange, 1),
+			MagicLinks: make(chan datalayer.User, 1),
 		},
 		Context: ctx,
 		Logger:    logger,
 		DataLayer: dataLayer,
+		Keys: keyStore,
+		Throttle: throttle.New(dataLayer, throttleConfig),
+		PasswordPolicy: passwordPolicy,
+		Signatures: replay.New(clockSkew),
+		DeletionGracePeriod: deletionGracePeriod,
+		IdempotencyWindow: idempotencyWindow,
 		ShutdownWG: new(sync.WaitGroup),
 		Router: mux.NewRouter(),
 		Cancel: cancel,
+		Providers: state.Providers{
+			OIDC: oidc.NewProviders(oidcConfigs),
+		},
 	}
 
 	if env == prod {
@@ -96,9 +161,25 @@ func NewForStaging(logger *log.Logger, mainThreadWG *sync.WaitGroup) (*state.Ser
 
 func NewForTesting(t *testing.T, callbacks *state.MockCallbacks) *state.ServerState {
 	logger := log.New(os.Stdout, "microservice", log.LstdFlags|log.Lshortfile)
-	ctx := context.Background()
+	// Cancelling the context stops the background services of the test.
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
 	mockDataLayer := mockdatalayer.New(t)
 
+	keyStore, err := keys.New(mockDataLayer, keys.Config{
+		Algorithm:          keys.AlgorithmRS256,
+		RotationPeriod:     keys.DefaultRotationPeriod,
+		VerificationPeriod: keys.DefaultVerificationPeriod,
+		EncryptionKey:      []byte("gowebserver-test-encryption-key!"),
+	})
+	require.NoError(t, err)
+
+	passwordPolicy, err := passwords.New(passwords.Config{
+		MinLength:    6,
+		BreachedList: "../" + passwords.DefaultBreachedList,
+	})
+	require.NoError(t, err)
+
 	mail := &mockmail.MockClient{
 		T:            t,
 		Context:      ctx,
@@ -110,19 +191,37 @@ func NewForTesting(t *testing.T, callbacks *state.MockCallbacks) *state.ServerSt
 	state := &state.ServerState{
 		Channels: state.Channels{
 			ConfirmUsers: make(chan datalayer.User, 1),
+			ResetPasswords: make(chan datalayer.User, 1),
+			UnlockAccounts: make(chan datalayer.User, 1),
+			ChangeEmails: make(chan datalayer.EmailChange, 1),
+			MagicLinks: make(chan datalayer.User, 1),
 		},
 		Context:    ctx,
 		Logger:     logger,
 		ShutdownWG: new(sync.WaitGroup),
 		DataLayer:  mockDataLayer,
+		Keys:       keyStore,
+		Throttle:   throttle.New(mockDataLayer, throttle.Config{
+			FreeAttempts:     throttle.DefaultFreeAttempts,
+			IPFreeAttempts:   throttle.DefaultIPFreeAttempts,
+			BaseDelay:        throttle.DefaultBaseDelay,
+			AccountThreshold: 5,
+			IPThreshold:      20,
+			LockoutDuration:  time.Minute,
+		}),
+		PasswordPolicy: passwordPolicy,
+		Signatures: replay.New(replay.DefaultClockSkew),
+		DeletionGracePeriod: users.DefaultDeletionGracePeriod,
+		IdempotencyWindow: idempotency.DefaultWindow,
 		Router:     r,
 		Providers: state.Providers{
 			Email: mockmail.New(mail),
+			OIDC:  make(map[string]*oidc.Provider),
 		},
 	}
 
 	h := router.NewHandlers(state)
-	err := h.SetupRoutes(r)
+	err = h.SetupRoutes(r)
 	require.NoError(t, err)
 
 	srv := server.New(r, "", "0")
@@ -195,6 +294,10 @@ func handleSignals(state *state.ServerState, mainThreadWG *sync.WaitGroup) {
 	log.Printf("system call: %+v", signalChan)
 	// Close all channels here and then wait for the wait group to unlock.
 	close(state.Channels.ConfirmUsers)
+	close(state.Channels.ResetPasswords)
+	close(state.Channels.UnlockAccounts)
+	close(state.Channels.ChangeEmails)
+	close(state.Channels.MagicLinks)
 	state.ShutdownWG.Wait() //Wait for consumers to finish processing messages and exit
 	state.Cancel()
 }
\ No newline at end of file
@@ -5,17 +5,29 @@ import (
 	"github.com/donohutcheon/gowebserver/datalayer"
 	"github.com/donohutcheon/gowebserver/provider/mail"
 	"github.com/donohutcheon/gowebserver/provider/mail/mockmail"
+	"github.com/donohutcheon/gowebserver/provider/oidc"
+	"github.com/donohutcheon/gowebserver/router/auth/keys"
+	"github.com/donohutcheon/gowebserver/router/auth/passwords"
+	"github.com/donohutcheon/gowebserver/router/auth/replay"
+	"github.com/donohutcheon/gowebserver/router/auth/throttle"
 	"github.com/gorilla/mux"
 	"log"
 	"sync"
+	"time"
 )
 
 type Channels struct {
-	ConfirmUsers chan  datalayer.User
+	ConfirmUsers   chan  datalayer.User
+	ResetPasswords chan  datalayer.User
+	UnlockAccounts chan  datalayer.User
+	ChangeEmails   chan  datalayer.EmailChange
+	MagicLinks     chan  datalayer.User
 }
 
 type Providers struct {
 	Email      mail.Client
+	// OIDC holds the external identity providers keyed by name.
+	OIDC       map[string]*oidc.Provider
 }
 
 type ServerState struct {
@@ -27,6 +39,15 @@ type ServerState struct {
 	ShutdownWG *sync.WaitGroup
 	Router     *mux.Router
 	Providers  Providers
+	Keys       *keys.KeyStore
+	Throttle   *throttle.Throttle
+	PasswordPolicy *passwords.Policy
+	// Signatures refuses replayed signed requests.
+	Signatures *replay.Guard
+	// DeletionGracePeriod is how long deleted accounts can be recovered.
+	DeletionGracePeriod time.Duration
+	// IdempotencyWindow is how long idempotency keys are remembered.
+	IdempotencyWindow time.Duration
 	Cancel     context.CancelFunc
 }
 